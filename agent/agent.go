@@ -10,6 +10,7 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/ryanreadbooks/tokkibot/agent/checkpoint"
 	agcontext "github.com/ryanreadbooks/tokkibot/agent/context"
 	"github.com/ryanreadbooks/tokkibot/agent/tools"
 	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
@@ -20,7 +21,10 @@ import (
 	"github.com/ryanreadbooks/tokkibot/llm"
 	"github.com/ryanreadbooks/tokkibot/llm/schema"
 	"github.com/ryanreadbooks/tokkibot/llm/schema/param"
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
 	"github.com/ryanreadbooks/tokkibot/workspace"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 //go:embed template/summary.md
@@ -29,6 +33,7 @@ var summaryPrompt string
 type (
 	UserMessage           = agcontext.UserInput
 	UserMessageAttachment = agcontext.UserInputAttachment
+	UserMessageSender     = agcontext.Sender
 	AttachmentType        = agcontext.AttachmentType
 )
 
@@ -63,6 +68,15 @@ type Agent struct {
 
 	// send message tool delegate
 	sendMessageToolDelegate *messageToolDelegate
+
+	// "always allow" answers of tool confirmations, shared with subagents
+	approvals *sessionApprovals
+
+	// originals of the files changed by the agent, nil if disabled
+	checkpoints *checkpoint.Store
+
+	// shells kept per chat by the shell tool
+	shellSessions *tools.ShellSessions
 }
 
 func NewAgent(
@@ -133,11 +147,16 @@ func NewAgent(
 		cachedReqs:     make(map[string]*schema.Request),
 		llm:            llm,
 		mcpManager:     mcpManager,
+		approvals:      newSessionApprovals(),
+		checkpoints:    newCheckpointStore(&cfg, agentWorkspace),
 	}
 
 	agent.subAgentToolDelegate = &subAgentToolDelegate{a: agent}
 	agent.sendMessageToolDelegate = &messageToolDelegate{a: agent}
 	agent.mcpLoaded.Store(mcpLoaded)
+	if cfg.parent != nil {
+		agent.approvals = cfg.parent.approvals
+	}
 	if !cfg.isSpawned {
 		agent.subAgentResults = make(map[string]chan string)
 	}
@@ -160,22 +179,88 @@ func (a *Agent) registerMainTools(agentWorkspace string) {
 }
 
 func (a *Agent) registerBasicTools(agentWorkspace string) {
-	workspaceReadDir := workspace.GetAllowedReadPaths(agentWorkspace)
-	workspaceWriteDir := workspace.GetAllowedWritePaths(agentWorkspace)
-	readableDirs := workspaceReadDir
-	writeableDirs := workspaceWriteDir
-	if a.cfg.EnableCwdAccess {
-		readableDirs = append(readableDirs, config.GetProjectDir())
-		writeableDirs = append(writeableDirs, config.GetProjectDir())
-	}
+	readableDirs, writeableDirs := a.accessibleDirs(agentWorkspace)
 
 	a.RegisterTool(tools.ReadFile(readableDirs))
+	a.RegisterTool(tools.ReadDocument(readableDirs))
 	a.RegisterTool(tools.WriteFile(writeableDirs))
 	a.RegisterTool(tools.ListDir(readableDirs))
 	a.RegisterTool(tools.EditFile(writeableDirs))
+	a.RegisterTool(tools.MultiEdit(writeableDirs))
+	a.RegisterTool(tools.ApplyPatch(writeableDirs))
+	if a.cfg.EnableCwdAccess {
+		a.RegisterTool(tools.Glob(readableDirs))
+		a.RegisterTool(tools.Grep(readableDirs))
+	}
 
 	a.RegisterTool(tools.LoadRef())
 
+	a.registerSandboxTools(readableDirs, writeableDirs)
+	a.registerWebTools()
+	a.RegisterTool(tools.TodoWrite())
+}
+
+// registerWebTools registers web_fetch, and web_search if a search provider
+// is configured. Both get pages through the same fetcher.
+func (a *Agent) registerWebTools() {
+	wfCfg := a.cfg.WebFetch
+	var fetchOpts []tools.WebFetchOption
+	if wfCfg.IsCacheEnabled() {
+		fetchOpts = append(fetchOpts, tools.WithWebFetchCache(config.GetWebCacheDir(), wfCfg.GetCacheTTL()))
+	}
+	if wfCfg.IsRobotsRespected() {
+		fetchOpts = append(fetchOpts, tools.WithWebFetchRobots())
+	}
+	fetcher := tools.NewWebFetcher(fetchOpts...)
+	a.RegisterTool(tools.WebFetch(fetcher))
+
+	wsCfg := a.cfg.WebSearch
+	if !wsCfg.IsEnabled() {
+		return
+	}
+
+	var provider tools.SearchProvider
+	switch wsCfg.Provider {
+	case config.WebSearchProviderSearXNG:
+		provider = tools.NewSearXNGProvider(wsCfg.SearXNG.GetBaseURL())
+	case config.WebSearchProviderBrave:
+		provider = tools.NewBraveProvider(wsCfg.Brave.GetApiKey(), wsCfg.Brave.GetBaseURL())
+	case config.WebSearchProviderBing:
+		provider = tools.NewBingProvider(wsCfg.Bing.GetApiKey(), wsCfg.Bing.GetBaseURL())
+	case config.WebSearchProviderJSON:
+		j := wsCfg.JSON
+		provider = tools.NewJSONSearchProvider(tools.JSONSearchSpec{
+			URL:     j.URL,
+			Headers: j.GetHeaders(),
+			Results: j.Results,
+			Title:   j.Fields.GetTitle(),
+			Link:    j.Fields.GetURL(),
+			Snippet: j.Fields.GetSnippet(),
+		})
+	default:
+		slog.Warn("[agent] unknown web search provider", slog.String("provider", wsCfg.Provider))
+		return
+	}
+
+	a.RegisterTool(tools.WebSearch(provider,
+		tools.WithWebSearchCount(wsCfg.GetCount()),
+		tools.WithWebSearchFetchTop(wsCfg.GetFetchTop()),
+		tools.WithWebSearchFetcher(fetcher),
+	))
+}
+
+func (a *Agent) accessibleDirs(agentWorkspace string) (readableDirs, writeableDirs []string) {
+	readableDirs = workspace.GetAllowedReadPaths(agentWorkspace)
+	writeableDirs = workspace.GetAllowedWritePaths(agentWorkspace)
+	if a.cfg.EnableCwdAccess {
+		readableDirs = append(readableDirs, config.GetProjectDir())
+		writeableDirs = append(writeableDirs, config.GetProjectDir())
+	}
+	return
+}
+
+// registerSandboxTools registers tools which run commands in the sandbox.
+func (a *Agent) registerSandboxTools(readableDirs, writeableDirs []string) {
 	sbCfg := a.cfg.Sandbox
 
 	var sb sandbox.Sandbox
@@ -189,7 +274,7 @@ func (a *Agent) registerBasicTools(agentWorkspace string) {
 		if a.cfg.EnableCwdAccess {
 			sandboxOpts = append(sandboxOpts, sandbox.WithWorkingDir(config.GetProjectDir()))
 		}
-		sb = sandbox.NewSandbox(sandboxOpts...)
+		sb = a.newSandbox(sandboxOpts...)
 	} else {
 		workingDir := ""
 		if a.cfg.EnableCwdAccess {
@@ -197,11 +282,20 @@ func (a *Agent) registerBasicTools(agentWorkspace string) {
 		}
 		sb = sandbox.NewPassthroughSandbox(workingDir)
 	}
-	a.RegisterTool(tools.Shell(sb))
+	shellCfg := a.cfg.Shell
+	shellJobs := tools.NewShellJobs(shellCfg.GetMaxJobs())
+	a.shellSessions = tools.NewShellSessions(sb)
+	a.RegisterTool(tools.Shell(sb,
+		tools.WithShellTimeout(shellCfg.GetTimeout(), shellCfg.GetMaxTimeout()),
+		tools.WithShellJobs(shellJobs),
+		tools.WithShellSessions(a.shellSessions),
+	))
+	a.RegisterTool(tools.ShellOutput(shellJobs))
+	a.RegisterTool(tools.ShellKill(shellJobs))
 
 	skillSbFactory := func(skillDir string) sandbox.Sandbox {
 		if sbCfg.IsEnabled() {
-			return sandbox.NewSandbox(
+			return a.newSandbox(
 				sandbox.WithReadWritePaths(skillDir),
 				sandbox.WithWorkingDir(skillDir),
 				sandbox.WithReadOnlyPaths(sbCfg.GetReadOnlyPaths()...),
@@ -211,8 +305,48 @@ func (a *Agent) registerBasicTools(agentWorkspace string) {
 		return sandbox.NewPassthroughSandbox(skillDir)
 	}
 	a.RegisterTool(tools.UseSkill(a.skillLoader, skillSbFactory))
-	a.RegisterTool(tools.WebFetch())
-	a.RegisterTool(tools.TodoWrite())
+}
+
+// newSandbox returns a sandbox of the configured backend with the network
+// and limits of the config.
+func (a *Agent) newSandbox(opts ...sandbox.Option) sandbox.Sandbox {
+	sbCfg := a.cfg.Sandbox
+	opts = append(opts, sandboxPolicyOptions(sbCfg)...)
+	if sbCfg.GetBackend() != config.SandboxBackendDocker {
+		return sandbox.NewSandbox(opts...)
+	}
+
+	// subagents share the containers of the agent which spawned them
+	root := a
+	for root.cfg.parent != nil {
+		root = root.cfg.parent
+	}
+	docker := sbCfg.GetDocker()
+	return sandbox.NewDockerSandbox(sandbox.DockerConfig{
+		Host:        docker.GetHost(),
+		Image:       docker.GetImage(),
+		Name:        root.Name(),
+		PerScope:    docker.IsPerChat(),
+		IdleTimeout: docker.GetIdleTimeout(),
+	}, opts...)
+}
+
+// sandboxPolicyOptions returns the network and limits options of the
+// sandbox config.
+func sandboxPolicyOptions(c *config.SandboxConfig) []sandbox.Option {
+	network := c.GetNetwork()
+	limits := c.GetLimits()
+	return []sandbox.Option{
+		sandbox.WithNetwork(sandbox.NetworkMode(network.GetMode()), network.GetAllow()...),
+		sandbox.WithLimits(sandbox.Limits{
+			CPUTime:  limits.GetCPUTime(),
+			Memory:   limits.GetMemory(),
+			Pids:     limits.GetPids(),
+			FileSize: limits.GetFileSize(),
+			Output:   limits.GetOutput(),
+			Cgroup:   limits.GetCgroup(),
+		}),
+	}
 }
 
 func (a *Agent) UnRegisterTool(name string) {
@@ -251,8 +385,16 @@ type (
 	}
 	askOptionImpl struct {
 		messageChannel *AskTemporaryMessageChannel
+		injected       func() []*UserMessage
+		stats          *RunStats
 	}
 	AskOption func(*askOptionImpl)
+
+	// RunStats reports the outcome of a run started by Ask.
+	RunStats struct {
+		Err   error                  // why the run failed, nil if it completed
+		Usage schema.CompletionUsage // tokens used by all llm calls of the run
+	}
 )
 
 func WithMessageChannel(msgCh *AskTemporaryMessageChannel) AskOption {
@@ -261,6 +403,36 @@ func WithMessageChannel(msgCh *AskTemporaryMessageChannel) AskOption {
 	}
 }
 
+// WithInjectedMessages sets the source of user messages which arrive while
+// the agent is running. They are appended to the context between iterations.
+func WithInjectedMessages(fn func() []*UserMessage) AskOption {
+	return func(o *askOptionImpl) {
+		o.injected = fn
+	}
+}
+
+// WithRunStats makes Ask fill stats once the run finishes.
+func WithRunStats(stats *RunStats) AskOption {
+	return func(o *askOptionImpl) {
+		o.stats = stats
+	}
+}
+
+func (o *askOptionImpl) addUsage(usage schema.CompletionUsage) {
+	if o.stats == nil {
+		return
+	}
+	o.stats.Usage.PromptTokens += usage.PromptTokens
+	o.stats.Usage.CompletionTokens += usage.CompletionTokens
+	o.stats.Usage.TotalTokens += usage.TotalTokens
+}
+
+func (o *askOptionImpl) fail(err error) {
+	if o.stats != nil {
+		o.stats.Err = err
+	}
+}
+
 // Handling incoming message in a blocking way
 func (a *Agent) Ask(ctx context.Context, msg *UserMessage, opts ...AskOption) string {
 	opt := &askOptionImpl{}
@@ -268,6 +440,10 @@ func (a *Agent) Ask(ctx context.Context, msg *UserMessage, opts ...AskOption) st
 		o(opt)
 	}
 
+	ctx, span := a.startAskSpan(ctx, msg)
+	defer span.End()
+	ctx = withSender(ctx, msg.Sender)
+
 	return a.handleIncomingMessage(ctx, msg, opt)
 }
 
@@ -278,16 +454,31 @@ func (a *Agent) AskStream(ctx context.Context, msg *UserMessage, emitter StreamE
 		o(opt)
 	}
 
+	ctx, span := a.startAskSpan(ctx, msg)
+	defer span.End()
+	ctx = withSender(ctx, msg.Sender)
+
 	a.handleIncomingMessageStream(ctx, msg, emitter, opt)
 }
 
+// startAskSpan starts the root span of an agent run. Spawned subagents run
+// with the ctx of the spawning tool call, so their spans nest under it.
+func (a *Agent) startAskSpan(ctx context.Context, msg *UserMessage) (context.Context, trace.Span) {
+	return trace.StartSpan(ctx, "agent.ask",
+		trace.AttrAgent.String(a.cfg.Name),
+		trace.AttrChannel.String(msg.Channel),
+		trace.AttrChatID.String(msg.ChatId),
+		attribute.Bool("agent.spawned", a.cfg.isSpawned),
+	)
+}
+
 func (a *Agent) buildLLMMessageRequest(ctx context.Context, msg *UserMessage) (*schema.Request, error) {
 	// Check context size and compact if needed
 	if err := a.checkAndCompactContext(ctx, msg); err != nil {
 		return nil, fmt.Errorf("failed to compact context: %w", err)
 	}
 
-	msgList, err := a.contextManager.GetMessageContext(msg.Channel, msg.ChatId)
+	msgList, err := a.contextManager.GetMessageContext(msg.Channel, msg.ChatId, msg.Sender)
 	if err != nil {
 		return nil, err
 	}
@@ -302,7 +493,7 @@ func (a *Agent) buildLLMMessageRequest(ctx context.Context, msg *UserMessage) (*
 			r.Thinking = schema.DisableThinking()
 		}
 	}
-	r.Tools = a.buildLLMTools()
+	r.Tools = a.buildLLMTools(ctx)
 
 	a.cachedReqsMu.Lock()
 	defer a.cachedReqsMu.Unlock()
@@ -328,6 +519,7 @@ func (a *Agent) checkAndCompactContext(ctx context.Context, msg *UserMessage) er
 	}
 
 	if compressed > 0 {
+		metrics.ContextCompactions.WithLabelValues(a.cfg.Name, "compress_tool_calls", "auto").Inc()
 		currentTokens = a.GetCurrentContextTokens(msg.Channel, msg.ChatId)
 	}
 
@@ -338,6 +530,7 @@ func (a *Agent) checkAndCompactContext(ctx context.Context, msg *UserMessage) er
 		if err != nil {
 			return fmt.Errorf("failed to summarize history: %w", err)
 		}
+		metrics.ContextCompactions.WithLabelValues(a.cfg.Name, "summarize", "auto").Inc()
 	}
 
 	return nil
@@ -356,7 +549,7 @@ func (a *Agent) summarizeMessagesWithLLM(ctx context.Context, messages []param.M
 	req.Temperature = providerCfg.Temperature
 	req.MaxTokens = 2000
 
-	resp, err := a.llm.ChatCompletion(ctx, req)
+	resp, err := a.chatCompletion(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -364,9 +557,13 @@ func (a *Agent) summarizeMessagesWithLLM(ctx context.Context, messages []param.M
 	return resp.FirstChoice().Message.Content, nil
 }
 
-func (a *Agent) buildLLMTools() []param.Tool {
+// buildLLMTools returns schemas of the tools usable in ctx.
+func (a *Agent) buildLLMTools(ctx context.Context) []param.Tool {
 	params := make([]param.Tool, 0, len(a.tools))
 	for _, tool := range a.tools {
+		if !componentool.IsToolAllowed(ctx, tool.Info().Name) {
+			continue
+		}
 		params = append(params, param.NewToolWithSchema(
 			tool.Info().Name,
 			tool.Info().Description,
@@ -377,6 +574,9 @@ func (a *Agent) buildLLMTools() []param.Tool {
 	if a.mcpLoaded.Load() {
 		// add mcp tools
 		for _, mcpTool := range a.mcpManager.ListTools() {
+			if !componentool.IsToolAllowed(ctx, mcpTool.Info().Name) {
+				continue
+			}
 			params = append(params, param.NewToolWithSchema(
 				mcpTool.Info().Name,
 				mcpTool.Info().Description,
@@ -400,12 +600,16 @@ func (a *Agent) CompactContext(ctx context.Context, channel, chatId string) (int
 	if err != nil {
 		return 0, fmt.Errorf("failed to compress tool calls: %w", err)
 	}
+	if compressed > 0 {
+		metrics.ContextCompactions.WithLabelValues(a.cfg.Name, "compress_tool_calls", "manual").Inc()
+	}
 
 	// Step 2: Summarize history
 	err = a.contextManager.SummarizeHistory(ctx, channel, chatId, a.summarizeMessagesWithLLM)
 	if err != nil {
 		return compressed, fmt.Errorf("failed to summarize history: %w", err)
 	}
+	metrics.ContextCompactions.WithLabelValues(a.cfg.Name, "summarize", "manual").Inc()
 
 	return compressed, nil
 }
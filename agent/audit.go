@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+	schema "github.com/ryanreadbooks/tokkibot/llm/schema"
+	"github.com/ryanreadbooks/tokkibot/pkg/audit"
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
+)
+
+type senderContextKey struct{}
+
+// withSender records the sender of the message being handled. Subagents run
+// with the ctx of the spawning tool call and keep the sender.
+func withSender(ctx context.Context, sender *UserMessageSender) context.Context {
+	if sender == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, senderContextKey{}, sender)
+}
+
+func senderFromContext(ctx context.Context) *UserMessageSender {
+	sender, _ := ctx.Value(senderContextKey{}).(*UserMessageSender)
+	return sender
+}
+
+// newAuditEntry starts the audit entry of a tool call.
+func (a *Agent) newAuditEntry(ctx context.Context, toolMeta tool.InvokeMeta, tc *schema.CompletionToolCall) *audit.Entry {
+	rec := &audit.Entry{
+		Time:      time.Now(),
+		Agent:     a.cfg.Name,
+		Channel:   toolMeta.Channel,
+		ChatId:    toolMeta.ChatId,
+		Tool:      tc.Function.Name,
+		Arguments: secret.Redact(tc.Function.Arguments),
+		Status:    audit.StatusOK,
+		Policy:    "allow",
+	}
+	if sender := senderFromContext(ctx); sender != nil {
+		rec.SenderId = sender.Id
+		rec.SenderName = sender.Name
+	}
+	switch tc.Function.Name {
+	case tools.ToolNameShell, tools.ToolNameUseSkill:
+		rec.Sandbox = "none"
+		if a.cfg.Sandbox.IsEnabled() {
+			rec.Sandbox = a.cfg.Sandbox.GetBackend()
+		}
+	}
+	return rec
+}
+
+// finishAuditEntry completes the entry with the result and records it. Tool
+// errors often echo the command or its output, so they are redacted like the
+// arguments.
+func finishAuditEntry(rec *audit.Entry, result string, elapsed time.Duration) {
+	rec.Error = secret.Redact(rec.Error)
+	rec.ResultHash = audit.HashResult(result)
+	rec.ResultLen = len(result)
+	rec.DurationMs = elapsed.Milliseconds()
+	audit.Record(rec)
+}
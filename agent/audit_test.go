@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/pkg/audit"
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
+)
+
+func TestFinishAuditEntryRedactsError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := audit.Init(path); err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	secret.Register("tok-audit-error-value")
+	finishAuditEntry(&audit.Entry{
+		Tool:   "shell",
+		Status: audit.StatusError,
+		Error:  "curl -H 'Authorization: tok-audit-error-value' failed: exit status 7",
+	}, "", time.Second)
+	audit.Close()
+
+	var got string
+	if err := audit.Read(path, func(e *audit.Entry, _ []byte) bool {
+		got = e.Error
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "tok-audit-error-value") || !strings.Contains(got, secret.Redacted) {
+		t.Fatalf("error not redacted: %q", got)
+	}
+}
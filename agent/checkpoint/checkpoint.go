@@ -0,0 +1,418 @@
+// Package checkpoint keeps the originals of files changed by the agent so
+// that the changes of a turn can be reviewed and undone.
+//
+// Layout: <dir>/<session>/<turn id>/turn.json with the snapshots of the
+// changed files next to it, <n>.before holding the content before the turn
+// and <n>.after the content after it.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
+)
+
+const (
+	manifestName = "turn.json"
+	turnIdLayout = "20060102T150405.000000Z"
+
+	maxPromptLen  = 200
+	pruneInterval = time.Hour
+)
+
+var ErrNotFound = errors.New("checkpoint not found")
+
+// File is a file changed during a turn.
+type File struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"` // false if the file was created in the turn
+	Deleted bool   `json:"deleted"` // true if the file was removed in the turn
+	Blob    int    `json:"blob"`    // number of the snapshots of the file
+}
+
+// Turn holds the files changed while the agent handled one message.
+type Turn struct {
+	Id       string     `json:"id"`
+	Prompt   string     `json:"prompt"`
+	Created  time.Time  `json:"created"`
+	Updated  time.Time  `json:"updated"`
+	Restored *time.Time `json:"restored,omitempty"`
+	Files    []*File    `json:"files"`
+
+	dir string
+}
+
+// NewTurnId returns the id of a turn starting now.
+func NewTurnId() string {
+	return time.Now().UTC().Format(turnIdLayout)
+}
+
+// SessionKey returns the key of the checkpoints of a chat.
+func SessionKey(channel, chatId string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_", "..", "_").Replace(channel + "_" + chatId)
+}
+
+// Store keeps checkpoints in a directory and removes them after the ttl.
+type Store struct {
+	dir string
+	ttl time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewStore(dir string, ttl time.Duration) *Store {
+	s := &Store{dir: dir, ttl: ttl}
+	s.prune()
+	return s
+}
+
+func (s *Store) turnDir(session, turnId string) string {
+	return filepath.Join(s.dir, session, turnId)
+}
+
+// Snapshot stores the content of a file before it is changed in a turn, so
+// that the original is kept even if the change is never recorded. Files
+// already in the turn are left alone.
+func (s *Store) Snapshot(session, turnId, prompt string, change *tools.FileChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	turn, err := s.openTurn(session, turnId, prompt)
+	if err != nil {
+		return err
+	}
+	if turn.File(change.Path) != nil {
+		return nil
+	}
+	file, err := turn.addFile(change)
+	if err != nil {
+		return err
+	}
+	// the file is unchanged until the change is recorded
+	if err := os.WriteFile(turn.blobPath(file, "after"), []byte(change.OldContent), 0600); err != nil {
+		return fmt.Errorf("failed to save checkpoint of %s: %w", change.Path, err)
+	}
+
+	turn.Updated = time.Now()
+	return turn.save()
+}
+
+// Record stores a file change of a turn. The content before the first change
+// of a file in the turn is kept, the content after is updated on every
+// change.
+func (s *Store) Record(session, turnId, prompt string, change *tools.FileChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	turn, err := s.openTurn(session, turnId, prompt)
+	if err != nil {
+		return err
+	}
+
+	file := turn.File(change.Path)
+	if file == nil {
+		if file, err = turn.addFile(change); err != nil {
+			return err
+		}
+	}
+	file.Deleted = change.Deleted
+	if !change.Deleted {
+		if err := os.WriteFile(turn.blobPath(file, "after"), []byte(change.NewContent), 0600); err != nil {
+			return fmt.Errorf("failed to save checkpoint of %s: %w", change.Path, err)
+		}
+	}
+
+	turn.Updated = time.Now()
+	if err := turn.save(); err != nil {
+		return err
+	}
+
+	if time.Since(s.lastPrune) > pruneInterval {
+		go s.prune()
+	}
+	return nil
+}
+
+// openTurn loads the turn or starts it if it has no files yet.
+func (s *Store) openTurn(session, turnId, prompt string) (*Turn, error) {
+	dir := s.turnDir(session, turnId)
+	turn, err := loadTurn(dir)
+	if errors.Is(err, ErrNotFound) {
+		created, _ := time.Parse(turnIdLayout, turnId)
+		turn = &Turn{Id: turnId, Prompt: truncate(prompt, maxPromptLen), Created: created, dir: dir}
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint %s: %w", turnId, err)
+	}
+	return turn, nil
+}
+
+// addFile adds the file of the change to the turn and saves its content
+// before the change.
+func (t *Turn) addFile(change *tools.FileChange) (*File, error) {
+	file := &File{Path: change.Path, Existed: !change.Created, Blob: len(t.Files) + 1}
+	if file.Existed {
+		if err := os.WriteFile(t.blobPath(file, "before"), []byte(change.OldContent), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save checkpoint of %s: %w", change.Path, err)
+		}
+	}
+	t.Files = append(t.Files, file)
+	return file, nil
+}
+
+// List returns the turns of a session which changed files, newest first.
+func (s *Store) List(session string) ([]*Turn, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, session))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+
+	turns := make([]*Turn, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		turn, err := loadTurn(s.turnDir(session, entry.Name()))
+		if err != nil {
+			continue
+		}
+		turns = append(turns, turn)
+	}
+	slices.Reverse(turns)
+	return turns, nil
+}
+
+// Get returns a turn by its number in List starting from 1, or by a unique
+// prefix of its id.
+func (s *Store) Get(session, ref string) (*Turn, error) {
+	turns, err := s.List(session)
+	if err != nil {
+		return nil, err
+	}
+	// ids start with the year, shorter numbers are positions
+	if n, err := strconv.Atoi(ref); err == nil && len(ref) < 4 {
+		if n < 1 || n > len(turns) {
+			return nil, ErrNotFound
+		}
+		return turns[n-1], nil
+	}
+
+	var found *Turn
+	for _, turn := range turns {
+		if strings.HasPrefix(turn.Id, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("checkpoint %s is ambiguous", ref)
+			}
+			found = turn
+		}
+	}
+	if found == nil || ref == "" {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// File returns the changed file whose path is or ends with path.
+func (t *Turn) File(path string) *File {
+	for _, f := range t.Files {
+		if f.Path == path {
+			return f
+		}
+	}
+	for _, f := range t.Files {
+		if strings.HasSuffix(f.Path, string(filepath.Separator)+path) {
+			return f
+		}
+	}
+	return nil
+}
+
+// Contents returns the content of a file before and after the turn.
+func (t *Turn) Contents(f *File) (before, after string, err error) {
+	if f.Existed {
+		data, err := os.ReadFile(t.blobPath(f, "before"))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read checkpoint of %s: %w", f.Path, err)
+		}
+		before = string(data)
+	}
+	if !f.Deleted {
+		data, err := os.ReadFile(t.blobPath(f, "after"))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read checkpoint of %s: %w", f.Path, err)
+		}
+		after = string(data)
+	}
+	return before, after, nil
+}
+
+// Diff returns the unified diff of the changes of the turn to the file.
+func (t *Turn) Diff(f *File) (string, error) {
+	before, after, err := t.Contents(f)
+	if err != nil {
+		return "", err
+	}
+	return tools.UnifiedDiff(f.Path, before, after), nil
+}
+
+// Modified reports whether the file was changed again after the turn.
+func (t *Turn) Modified(f *File) bool {
+	_, after, err := t.Contents(f)
+	if err != nil {
+		return true
+	}
+	current, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return !f.Deleted
+	}
+	return err != nil || f.Deleted || string(current) != after
+}
+
+// Restore puts the files back into their state before the turn, all files
+// of the turn if files is empty. Files created in the turn are removed. The
+// restore is recorded as a turn of its own so that it can be undone as well.
+func (s *Store) Restore(session string, turn *Turn, files []*File) error {
+	if len(files) == 0 {
+		files = turn.Files
+	}
+	restoreId := NewTurnId()
+	for _, f := range files {
+		change, err := turn.restoreFile(f)
+		if err != nil {
+			return err
+		}
+		if err := s.Record(session, restoreId, "restore "+turn.Id, change); err != nil {
+			slog.Warn("[checkpoint] failed to record restore", slog.String("path", f.Path), slog.Any("error", err))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	turn.Restored = &now
+	return turn.save()
+}
+
+// restoreFile restores one file and returns the change made.
+func (t *Turn) restoreFile(f *File) (*tools.FileChange, error) {
+	change := &tools.FileChange{Path: f.Path}
+	if current, err := os.ReadFile(f.Path); err == nil {
+		change.OldContent = string(current)
+	} else {
+		change.Created = true
+	}
+
+	if !f.Existed {
+		if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove %s: %w", f.Path, err)
+		}
+		change.Deleted = true
+		return change, nil
+	}
+
+	before, _, err := t.Contents(f)
+	if err != nil {
+		return nil, err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(f.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to restore %s: %w", f.Path, err)
+	}
+	if err := os.WriteFile(f.Path, []byte(before), mode); err != nil {
+		return nil, fmt.Errorf("failed to restore %s: %w", f.Path, err)
+	}
+	change.NewContent = before
+	return change, nil
+}
+
+func (t *Turn) blobPath(f *File, kind string) string {
+	return filepath.Join(t.dir, fmt.Sprintf("%d.%s", f.Blob, kind))
+}
+
+func (t *Turn) save() error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(t.dir, manifestName), data, 0600); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func loadTurn(dir string) (*Turn, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var turn Turn
+	if err := json.Unmarshal(data, &turn); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+	turn.dir = dir
+	return &turn, nil
+}
+
+// prune removes the turns which started longer than the ttl ago.
+func (s *Store) prune() {
+	s.mu.Lock()
+	s.lastPrune = time.Now()
+	s.mu.Unlock()
+
+	sessions, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(-s.ttl)
+	for _, session := range sessions {
+		if !session.IsDir() {
+			continue
+		}
+		sessionDir := filepath.Join(s.dir, session.Name())
+		turns, _ := os.ReadDir(sessionDir)
+		removed := 0
+		for _, turn := range turns {
+			created, err := time.Parse(turnIdLayout, turn.Name())
+			if err != nil || created.After(deadline) {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(sessionDir, turn.Name())); err != nil {
+				slog.Warn("[checkpoint] failed to remove expired checkpoint", slog.String("turn", turn.Name()), slog.Any("error", err))
+				continue
+			}
+			removed++
+		}
+		if removed == len(turns) {
+			os.Remove(sessionDir)
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
@@ -0,0 +1,155 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+func TestRecordAndRestore(t *testing.T) {
+	store := NewStore(t.TempDir(), time.Hour)
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.go")
+	added := filepath.Join(dir, "added.go")
+	if err := os.WriteFile(main, []byte("v2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(added, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// two edits of main.go and a new file in one turn
+	session := SessionKey("cli", "chat/1")
+	turnId := NewTurnId()
+	changes := []*tools.FileChange{
+		{Path: main, OldContent: "v0\n", NewContent: "v1\n"},
+		{Path: main, OldContent: "v1\n", NewContent: "v2\n"},
+		{Path: added, NewContent: "new\n", Created: true},
+	}
+	for _, change := range changes {
+		if err := store.Record(session, turnId, "change  the\nfiles", change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	turn, err := store.Get(session, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turn.Prompt != "change the files" || len(turn.Files) != 2 {
+		t.Fatalf("turn = %+v", turn)
+	}
+	if byId, err := store.Get(session, turn.Id[:12]); err != nil || byId.Id != turn.Id {
+		t.Errorf("get by id prefix: %v", err)
+	}
+	if _, err := store.Get(session, "2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	f := turn.File("main.go")
+	if f == nil {
+		t.Fatal("main.go not found by its base name")
+	}
+	diff, err := turn.Diff(f)
+	if err != nil || !strings.Contains(diff, "-v0\n+v2\n") {
+		t.Errorf("diff = %q, %v", diff, err)
+	}
+	if turn.Modified(f) {
+		t.Error("main.go was not modified after the turn")
+	}
+
+	if err := store.Restore(session, turn, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "v0\n" {
+		t.Errorf("main.go = %q", data)
+	}
+	if _, err := os.Stat(added); !os.IsNotExist(err) {
+		t.Error("the created file should be removed")
+	}
+
+	// the restore is the newest turn and undoing it brings the changes back
+	turns, err := store.List(session)
+	if err != nil || len(turns) != 2 {
+		t.Fatalf("turns = %v, %v", turns, err)
+	}
+	if turns[1].Restored == nil || turns[0].Prompt != "restore "+turn.Id {
+		t.Errorf("turns = %+v %+v", turns[0], turns[1])
+	}
+	if err := store.Restore(session, turns[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "v2\n" {
+		t.Errorf("main.go = %q", data)
+	}
+	if data, _ := os.ReadFile(added); string(data) != "new\n" {
+		t.Errorf("added.go = %q", data)
+	}
+}
+
+func TestSnapshotBeforeWrite(t *testing.T) {
+	store := NewStore(t.TempDir(), time.Hour)
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(main, []byte("v0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	session := SessionKey("cli", "chat")
+	ctx := tools.WithFileSnapshotter(t.Context(), func(change *tools.FileChange) {
+		if data, _ := os.ReadFile(change.Path); string(data) != change.OldContent {
+			t.Errorf("snapshot taken after the write: %q", data)
+		}
+		if err := store.Snapshot(session, NewTurnId(), "edit", change); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// the change is never recorded, as if the process stopped after the write
+	args := `{"file_name": "` + main + `", "old_string": "v0", "new_string": "v1"}`
+	if _, err := tools.EditFile([]string{dir}).Invoke(ctx, tool.InvokeMeta{}, args); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "v1\n" {
+		t.Fatalf("main.go = %q", data)
+	}
+
+	turn, err := store.Get(session, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := turn.File(main); f == nil || !turn.Modified(f) {
+		t.Fatalf("snapshot of main.go missing: %+v", turn.Files)
+	}
+	if err := store.Restore(session, turn, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(main); string(data) != "v0\n" {
+		t.Errorf("main.go = %q", data)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir, time.Hour)
+	file := filepath.Join(t.TempDir(), "f.txt")
+
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(turnIdLayout)
+	for _, turnId := range []string{old, NewTurnId()} {
+		if err := store.Record("s", turnId, "", &tools.FileChange{Path: file, Created: true, NewContent: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store.prune()
+	turns, err := store.List("s")
+	if err != nil || len(turns) != 1 || turns[0].Id == old {
+		t.Fatalf("turns = %v, %v", turns, err)
+	}
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/ryanreadbooks/tokkibot/agent/checkpoint"
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
+	"github.com/ryanreadbooks/tokkibot/config"
+)
+
+// newCheckpointStore returns the checkpoint store of the agent, nil if
+// checkpoints are disabled. Subagents record into the turn of the agent which
+// spawned them through the context of the tool call.
+func newCheckpointStore(cfg *Config, agentWorkspace string) *checkpoint.Store {
+	if cfg.isSpawned || !cfg.Checkpoint.IsEnabled() {
+		return nil
+	}
+	return checkpoint.NewStore(filepath.Join(agentWorkspace, config.CheckpointDirName), cfg.Checkpoint.GetTTL())
+}
+
+// Checkpoints returns the checkpoint store of the agent, nil if disabled.
+func (a *Agent) Checkpoints() *checkpoint.Store {
+	return a.checkpoints
+}
+
+// withCheckpoints records the files changed while handling the message as one
+// turn of the chat.
+func (a *Agent) withCheckpoints(ctx context.Context, userMsg *UserMessage) context.Context {
+	if a.checkpoints == nil {
+		return ctx
+	}
+	session := checkpoint.SessionKey(userMsg.Channel, userMsg.ChatId)
+	turnId := checkpoint.NewTurnId()
+	// the original is saved before the file is written, the change after
+	ctx = tools.WithFileSnapshotter(ctx, func(change *tools.FileChange) {
+		if err := a.checkpoints.Snapshot(session, turnId, userMsg.Content, change); err != nil {
+			slog.WarnContext(ctx, "[agent] failed to snapshot checkpoint",
+				slog.String("path", change.Path), slog.Any("error", err))
+		}
+	})
+	return tools.WithFileChangeReporter(ctx, func(change *tools.FileChange) {
+		if err := a.checkpoints.Record(session, turnId, userMsg.Content, change); err != nil {
+			slog.WarnContext(ctx, "[agent] failed to record checkpoint",
+				slog.String("path", change.Path), slog.Any("error", err))
+		}
+	})
+}
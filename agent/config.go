@@ -28,9 +28,14 @@ type Config struct {
 	VolatileContext bool   // if true, context/session data stays in memory only
 	EnableCwdAccess bool
 
-	Sandbox *config.SandboxConfig
+	Sandbox    *config.SandboxConfig
+	Checkpoint *config.CheckpointConfig
+	Shell      *config.ShellConfig
+	WebFetch   *config.WebFetchConfig
+	WebSearch  *config.WebSearchConfig
 
 	isSpawned              bool
+	parent                 *Agent // the agent which spawned this one
 	doNotAutoRegisterTools bool
 	subagentPrompt         string
 }
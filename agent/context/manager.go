@@ -23,7 +23,7 @@ type ContextManager interface {
 	AppendToolResult(inMsg *UserInput, toolCall *schema.CompletionToolCall, result string) error
 	AppendAssistantMessage(inMsg *UserInput, msg *schema.CompletionMessage) error
 
-	GetMessageContext(channel, chatId string) ([]param.Message, error)
+	GetMessageContext(channel, chatId string, sender *Sender) ([]param.Message, error)
 	GetSystemPrompt() string
 	GetMessageHistory(channel, chatId string) ([]session.LogItem, error)
 
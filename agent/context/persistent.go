@@ -56,8 +56,8 @@ func NewPersistentContextManager(
 
 // renderPrompts renders template variables in prompt string.
 // Available variables: see [promptBuiltinInfo].
-func (c *PersistentContextManager) renderPrompts(s string) string {
-	return renderPromptTemplate(c.agentWorkspace, c.skillLoader, s)
+func (c *PersistentContextManager) renderPrompts(s string, sender *Sender) string {
+	return renderPromptTemplate(c.agentWorkspace, c.skillLoader, s, sender)
 }
 
 // bootstrapSystemPrompts loads system prompts template from workspace files and memory.
@@ -71,8 +71,8 @@ func (c *PersistentContextManager) bootstrapSystemPrompts() error {
 	return nil
 }
 
-func (c *PersistentContextManager) getRenderedSystemPrompts() string {
-	return c.renderPrompts(c.systemPromptsTemplate)
+func (c *PersistentContextManager) getRenderedSystemPrompts(sender *Sender) string {
+	return c.renderPrompts(c.systemPromptsTemplate, sender)
 }
 
 // --- Session init & history ---
@@ -177,18 +177,18 @@ func (c *PersistentContextManager) AppendAssistantMessage(
 
 // --- Context query ---
 
-func (c *PersistentContextManager) GetMessageContext(channel, chatId string) ([]param.Message, error) {
+func (c *PersistentContextManager) GetMessageContext(channel, chatId string, sender *Sender) ([]param.Message, error) {
 	log, err := c.contextLogManager.GetOrCreate(channel, chatId)
 	if err != nil {
 		return nil, err
 	}
 
 	logs := log.GetLogs()
-	return buildMessageContextWithSystemPrompt(c.getRenderedSystemPrompts(), logs), nil
+	return buildMessageContextWithSystemPrompt(c.getRenderedSystemPrompts(sender), logs), nil
 }
 
 func (c *PersistentContextManager) GetSystemPrompt() string {
-	return c.getRenderedSystemPrompts()
+	return c.getRenderedSystemPrompts(nil)
 }
 
 func (c *PersistentContextManager) GetMessageHistory(channel, chatId string) ([]session.LogItem, error) {
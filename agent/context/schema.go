@@ -6,6 +6,15 @@ type UserInput struct {
 	Content     string // user input content
 	Created     int64  // created at unix timestamp
 	Attachments []*UserInputAttachment
+	Sender      *Sender // who sent the input, nil if unknown
+}
+
+// Sender is the identity of the user behind an input. It is available to
+// prompt templates as {{.Sender}}.
+type Sender struct {
+	Id   string
+	Name string
+	Role string
 }
 
 type AttachmentType string
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/ryanreadbooks/tokkibot/llm/schema/param"
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
 )
 
 var regMediaRef = regexp.MustCompile(`\[image\]\((@medias/[^)]+)\)`)
@@ -41,7 +42,7 @@ func (b *baseLog) writeLine(item *LogItem) error {
 		return err
 	}
 
-	data = append(data, '\n')
+	data = append(secret.RedactBytes(data), '\n')
 	_, err = b.f.Write(data)
 	return err
 }
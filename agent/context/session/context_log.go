@@ -9,6 +9,7 @@ import (
 
 	"github.com/ryanreadbooks/tokkibot/agent/ref"
 	"github.com/ryanreadbooks/tokkibot/llm/schema/param"
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
 )
 
 // ContextLog manages in-memory context for LLM, with support for reset, compress and flush.
@@ -68,7 +69,7 @@ func (s *ContextLog) Flush(root string) error {
 
 	for _, item := range snapshot {
 		if content := item.Json(); len(content) > 0 {
-			if _, err := s.f.WriteString(content + "\n"); err != nil {
+			if _, err := s.f.WriteString(secret.Redact(content) + "\n"); err != nil {
 				return err
 			}
 		}
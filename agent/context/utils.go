@@ -1,6 +1,7 @@
 package context
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
@@ -27,6 +28,7 @@ type promptBuiltinInfo struct {
 	Runtime         string
 	AvailableSkills string
 	DateWithTz      string
+	Sender          Sender // zero if unknown
 }
 
 var systemPromptList = []string{
@@ -36,7 +38,22 @@ var systemPromptList = []string{
 	"TOOLS.md",
 }
 
-func renderPromptTemplate(agentWorkspace string, skillLoader *skill.Loader, s string) string {
+// MissingPromptFiles returns the required system prompt files which do not
+// exist in the agent workspace.
+func MissingPromptFiles(agentWorkspace string) []string {
+	var missing []string
+	for _, name := range systemPromptList {
+		if name == "USER.md" { // optional
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(agentWorkspace, name)); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func renderPromptTemplate(agentWorkspace string, skillLoader *skill.Loader, s string, sender *Sender) string {
 	tmpl, err := template.New("prompts").Parse(s)
 	if err != nil {
 		panic(err)
@@ -51,6 +68,7 @@ func renderPromptTemplate(agentWorkspace string, skillLoader *skill.Loader, s st
 		Runtime:         runtime.GOOS,
 		AvailableSkills: skill.SkillsAsPrompt(skillLoader.Skills()),
 		DateWithTz:      now.Format("2006-01-02 MST -0700"),
+		Sender:          *cmp.Or(sender, &Sender{}),
 	})
 	if err != nil {
 		panic(err)
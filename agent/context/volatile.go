@@ -55,8 +55,8 @@ func NewVolatileContextManager(
 	return mgr, nil
 }
 
-func (c *VolatileContextManager) renderPrompts(s string) string {
-	return renderPromptTemplate(c.agentWorkspace, c.skillLoader, s)
+func (c *VolatileContextManager) renderPrompts(s string, sender *Sender) string {
+	return renderPromptTemplate(c.agentWorkspace, c.skillLoader, s, sender)
 }
 
 func (c *VolatileContextManager) bootstrapSystemPrompts() error {
@@ -68,8 +68,8 @@ func (c *VolatileContextManager) bootstrapSystemPrompts() error {
 	return nil
 }
 
-func (c *VolatileContextManager) getRenderedSystemPrompts() string {
-	return c.renderPrompts(c.systemPromptsTemplate)
+func (c *VolatileContextManager) getRenderedSystemPrompts(sender *Sender) string {
+	return c.renderPrompts(c.systemPromptsTemplate, sender)
 }
 
 func (c *VolatileContextManager) InitFromSessionLogs(channel, chatId string) {
@@ -142,13 +142,13 @@ func (c *VolatileContextManager) AppendAssistantMessage(
 	return c.appendMessage(inMsg.Channel, inMsg.ChatId, logItem, true)
 }
 
-func (c *VolatileContextManager) GetMessageContext(channel, chatId string) ([]param.Message, error) {
+func (c *VolatileContextManager) GetMessageContext(channel, chatId string, sender *Sender) ([]param.Message, error) {
 	logs := c.getContextLogs(channel, chatId)
-	return buildMessageContextWithSystemPrompt(c.getRenderedSystemPrompts(), logs), nil
+	return buildMessageContextWithSystemPrompt(c.getRenderedSystemPrompts(sender), logs), nil
 }
 
 func (c *VolatileContextManager) GetSystemPrompt() string {
-	return c.getRenderedSystemPrompts()
+	return c.getRenderedSystemPrompts(nil)
 }
 
 func (c *VolatileContextManager) GetMessageHistory(channel, chatId string) ([]session.LogItem, error) {
@@ -9,12 +9,23 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
 	"github.com/ryanreadbooks/tokkibot/component/tool"
 	schema "github.com/ryanreadbooks/tokkibot/llm/schema"
+	"github.com/ryanreadbooks/tokkibot/pkg/audit"
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
+	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 const (
 	xToolMetaMessageChannelKey = "x-tool-meta-message-channel"
+
+	// tool arguments recorded in spans are truncated to this length
+	maxSpanArgumentsLen = 1024
 )
 
 func getXToolMetaMessageChannel(meta tool.InvokeMeta) *AskTemporaryMessageChannel {
@@ -51,14 +62,17 @@ func (a *Agent) handleIncomingMessage(
 				slog.String("stack", string(debug.Stack())))
 
 			result = "I encountered an error while processing your request. Please try again later."
+			opt.fail(fmt.Errorf("panic: %v", err))
 		}
 	}()
 	slog.InfoContext(ctx, "[agent] handling incoming message", slog.Int("content_len", len(userMsg.Content)))
 
 	if err := a.initMessageContext(ctx, userMsg); err != nil {
 		slog.ErrorContext(ctx, "[agent] failed to init message context", slog.Any("error", err))
+		opt.fail(err)
 		return err.Error()
 	}
+	ctx = a.withCheckpoints(ctx, userMsg)
 
 	toolMeta := tool.InvokeMeta{
 		AgentName: a.cfg.Name,
@@ -69,11 +83,21 @@ func (a *Agent) handleIncomingMessage(
 		},
 	}
 
-	var lastResponse *schema.Response
+	var (
+		lastResponse *schema.Response
+		parentCtx    = ctx
+		iterSpan     trace.Span
+	)
+	defer func() { endIterationSpan(iterSpan) }()
+
 	for curIter := 1; curIter <= a.cfg.MaxIteration; curIter++ {
+		endIterationSpan(iterSpan)
+		ctx, iterSpan = a.startIterationSpan(parentCtx, curIter)
+
 		select {
 		case <-ctx.Done():
 			slog.WarnContext(ctx, "[agent] message handling cancelled", slog.Int("iteration", curIter))
+			opt.fail(ctx.Err())
 			return formatCancelledError(ctx)
 		default:
 		}
@@ -81,11 +105,12 @@ func (a *Agent) handleIncomingMessage(
 		llmReq, err := a.buildLLMMessageRequest(ctx, userMsg)
 		if err != nil {
 			slog.ErrorContext(ctx, "[agent] failed to build llm request", slog.Int("iteration", curIter), slog.Any("error", err))
+			opt.fail(fmt.Errorf("failed to build llm message request: %w", err))
 			return fmt.Sprintf("(failed to build llm message request: %s)", err.Error())
 		}
 
 		startTime := time.Now()
-		llmResp, err := a.llm.ChatCompletion(ctx, llmReq)
+		llmResp, err := a.chatCompletion(ctx, llmReq)
 		if err != nil {
 			slog.ErrorContext(ctx, "[agent] LLM call failed",
 				slog.Int("iteration", curIter),
@@ -95,13 +120,16 @@ func (a *Agent) handleIncomingMessage(
 				slog.Int("messages_count", len(llmReq.Messages)),
 				slog.Int("tools_count", len(llmReq.Tools)),
 			)
+			opt.fail(fmt.Errorf("failed to call llm: %w", err))
 			return fmt.Sprintf("(failed to call llm: %s)", err.Error())
 		}
+		opt.addUsage(llmResp.Usage)
 
 		lastResponse = llmResp
 		choice := llmResp.FirstChoice()
 		if err := a.contextManager.AppendAssistantMessage(userMsg, &choice.Message); err != nil {
 			slog.ErrorContext(ctx, "[agent] failed to append assistant message", slog.Any("error", err))
+			opt.fail(err)
 			return err.Error()
 		}
 
@@ -121,6 +149,7 @@ func (a *Agent) handleIncomingMessage(
 			for _, tc := range choice.Message.ToolCalls {
 				if err := a.handleToolCall(ctx, toolMeta, userMsg, &tc); err != nil {
 					slog.ErrorContext(ctx, "[agent] tool call failed", slog.String("tool", tc.Function.Name), slog.Any("error", err))
+					opt.fail(err)
 					return err.Error()
 				}
 			}
@@ -135,9 +164,12 @@ func (a *Agent) handleIncomingMessage(
 				Content: subResults,
 			})
 		}
+
+		a.appendInjectedMessages(ctx, opt)
 	}
 
 	slog.WarnContext(ctx, "[agent] max iterations reached", slog.Int("max_iteration", a.cfg.MaxIteration))
+	opt.fail(fmt.Errorf("max iterations (%d) reached", a.cfg.MaxIteration))
 	if lastResponse != nil {
 		return fmt.Sprintf("(max iterations reached, last response: %s)",
 			lastResponse.FirstChoice().Message.Content)
@@ -160,7 +192,7 @@ func (a *Agent) handleStreamingToolCall(
 	dstTcsMu := sync.Mutex{}
 	return func(ctx context.Context, tc schema.StreamChoiceDeltaToolCall) {
 		// invoke tool
-		result := a.getToolAndInvoke(ctx, toolMeta, &schema.CompletionToolCall{
+		result := a.invokeTool(ctx, toolMeta, &schema.CompletionToolCall{
 			Id:       tc.Id,
 			Type:     tc.Type,
 			Function: tc.Function,
@@ -203,6 +235,7 @@ func (a *Agent) handleIncomingMessageStream(
 		emitter.EmitContent(&EmittedContent{Round: -1, Content: err.Error()})
 		return
 	}
+	ctx = a.withCheckpoints(ctx, userMsg)
 
 	toolMeta := tool.InvokeMeta{
 		AgentName: a.cfg.Name,
@@ -213,8 +246,25 @@ func (a *Agent) handleIncomingMessageStream(
 		},
 	}
 
+	var (
+		parentCtx = ctx
+		iterSpan  trace.Span
+	)
+	defer func() { endIterationSpan(iterSpan) }()
+
 mainLoop:
 	for curIter := 1; curIter <= a.cfg.MaxIteration; curIter++ {
+		endIterationSpan(iterSpan)
+		ctx, iterSpan = a.startIterationSpan(parentCtx, curIter)
+		ctx = tools.WithFileChangeReporter(ctx, func(change *tools.FileChange) {
+			if change.Diff != "" {
+				emitter.EmitFileChange(curIter, change.Path, change.Diff)
+			}
+		})
+		ctx = tools.WithShellOutputReporter(ctx, func(output string, done bool) {
+			emitter.EmitToolOutput(curIter, tools.ToolNameShell, output, done)
+		})
+
 		select {
 		case <-ctx.Done():
 			slog.WarnContext(ctx, "[agent] message handling cancelled", slog.Int("iteration", curIter))
@@ -242,7 +292,7 @@ mainLoop:
 			break
 		}
 		// call llm the stream way
-		llmRespCh := a.llm.ChatCompletionStream(ctx, llmReq)
+		llmRespCh := a.chatCompletionStream(ctx, llmReq)
 		streamPacked := schema.StreamResponseHandler(
 			ctx,
 			llmRespCh,
@@ -350,6 +400,22 @@ mainLoop:
 				Content: subResults,
 			})
 		}
+
+		a.appendInjectedMessages(ctx, opt)
+	}
+}
+
+// appendInjectedMessages appends user messages which arrived during the run.
+func (a *Agent) appendInjectedMessages(ctx context.Context, opt *askOptionImpl) {
+	if opt.injected == nil {
+		return
+	}
+	for _, msg := range opt.injected() {
+		if _, err := a.contextManager.AppendContextUserMessage(msg); err != nil {
+			slog.ErrorContext(ctx, "[agent] failed to append injected message", slog.Any("error", err))
+			continue
+		}
+		slog.InfoContext(ctx, "[agent] injected user message", slog.Int("content_len", len(msg.Content)))
 	}
 }
 
@@ -359,23 +425,58 @@ func (a *Agent) handleToolCall(
 	inMsg *UserMessage,
 	tc *schema.CompletionToolCall,
 ) error {
-	toolResult := a.getToolAndInvoke(ctx, toolMeta, tc)
+	toolResult := a.invokeTool(ctx, toolMeta, tc)
 	// feedback tool calling result to llm
 	return a.contextManager.AppendToolResult(inMsg, tc, toolResult)
 }
 
+// invokeTool invokes the tool call and records it in the audit log.
+func (a *Agent) invokeTool(
+	ctx context.Context,
+	toolMeta tool.InvokeMeta,
+	tc *schema.CompletionToolCall,
+) string {
+	rec := a.newAuditEntry(ctx, toolMeta, tc)
+	startTime := time.Now()
+	// tools may read secrets from files or the environment, keep them away
+	// from the llm and the session log
+	toolResult := secret.Redact(a.getToolAndInvoke(ctx, toolMeta, tc, rec))
+	finishAuditEntry(rec, toolResult, time.Since(startTime))
+	return toolResult
+}
+
 func (a *Agent) getToolAndInvoke(
 	ctx context.Context,
 	toolMeta tool.InvokeMeta,
 	tc *schema.CompletionToolCall,
+	rec *audit.Entry,
 ) string {
 	select {
 	case <-ctx.Done():
 		slog.DebugContext(ctx, "[agent] tool invoke cancelled", slog.String("tool", tc.Function.Name))
+		rec.Status = audit.StatusCancelled
 		return formatCancelledError(ctx)
 	default:
 	}
 
+	if !tool.IsToolAllowed(ctx, tc.Function.Name) {
+		slog.WarnContext(ctx, "[agent] tool not allowed", slog.String("tool", tc.Function.Name))
+		rec.Status = audit.StatusDenied
+		rec.Error = "not allowed for the current user"
+		return fmt.Sprintf("Error: tool %s is not allowed for the current user", tc.Function.Name)
+	}
+
+	if err := a.checkToolPolicy(ctx, toolMeta, tc.Function.Name, tc.Function.Arguments, rec); err != nil {
+		rec.Error = err.Error()
+		return "Error: " + err.Error()
+	}
+
+	ctx, span := trace.StartSpan(ctx, "tool.invoke",
+		attribute.String("tool.name", tc.Function.Name),
+		attribute.String("tool.arguments", xstring.Truncate(tc.Function.Arguments, maxSpanArgumentsLen)),
+	)
+	defer span.End()
+
 	slog.DebugContext(ctx, "[agent] invoking tool",
 		slog.String("tool", tc.Function.Name),
 		slog.Int("args_len", len(tc.Function.Arguments)),
@@ -390,6 +491,11 @@ func (a *Agent) getToolAndInvoke(
 
 	if ok {
 		result, err := builtinTool.Invoke(ctx, toolMeta, tc.Function.Arguments)
+		observeToolCall(tc.Function.Name, metrics.ToolKindBuiltin, startTime, err)
+		span.SetAttributes(attribute.String("tool.kind", metrics.ToolKindBuiltin))
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
 		duration := time.Since(startTime).Milliseconds()
 		if err != nil {
 			slog.WarnContext(ctx, "[agent] builtin tool error",
@@ -398,6 +504,8 @@ func (a *Agent) getToolAndInvoke(
 				slog.Any("error", err),
 				slog.String("arguments", tc.Function.Arguments),
 			)
+			rec.Status = audit.StatusError
+			rec.Error = err.Error()
 			return err.Error()
 		}
 		slog.InfoContext(ctx, "[agent] builtin tool completed",
@@ -413,6 +521,11 @@ func (a *Agent) getToolAndInvoke(
 	if a.mcpLoaded.Load() {
 		if mcpTool, found := a.mcpManager.GetTool(tc.Function.Name); found {
 			result, err := mcpTool.Invoke(ctx, toolMeta, tc.Function.Arguments)
+			observeToolCall(tc.Function.Name, metrics.ToolKindMcp, startTime, err)
+			span.SetAttributes(attribute.String("tool.kind", metrics.ToolKindMcp))
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
 			duration := time.Since(startTime).Milliseconds()
 			if err != nil {
 				slog.WarnContext(ctx, "[agent] mcp tool error",
@@ -421,6 +534,8 @@ func (a *Agent) getToolAndInvoke(
 					slog.Any("error", err),
 					slog.String("arguments", tc.Function.Arguments),
 				)
+				rec.Status = audit.StatusError
+				rec.Error = err.Error()
 				return err.Error()
 			}
 			slog.InfoContext(ctx, "[agent] mcp tool completed",
@@ -434,5 +549,25 @@ func (a *Agent) getToolAndInvoke(
 	}
 
 	slog.WarnContext(ctx, "[agent] tool not found", slog.String("tool", tc.Function.Name))
+	span.SetStatus(codes.Error, "tool not found")
+	rec.Status = audit.StatusNotFound
 	return fmt.Sprintf("(tool %s not found)", tc.Function.Name)
 }
+
+func observeToolCall(name, kind string, startTime time.Time, err error) {
+	metrics.ToolInvocations.WithLabelValues(name, kind, metrics.StatusOf(err)).Inc()
+	metrics.ToolDuration.WithLabelValues(name, kind).Observe(time.Since(startTime).Seconds())
+}
+
+func (a *Agent) startIterationSpan(ctx context.Context, iter int) (context.Context, trace.Span) {
+	return trace.StartSpan(ctx, "agent.iteration",
+		trace.AttrAgent.String(a.cfg.Name),
+		attribute.Int("agent.iteration", iter),
+	)
+}
+
+func endIterationSpan(span trace.Span) {
+	if span != nil {
+		span.End()
+	}
+}
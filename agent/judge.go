@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ryanreadbooks/tokkibot/llm/schema"
+	"github.com/ryanreadbooks/tokkibot/llm/schema/param"
+)
+
+const judgePrompt = `You decide whether a statement holds for a given text.
+Answer with YES or NO on the first line, then give a one sentence reason on the second line.`
+
+// Judge asks the llm a yes or no question about the content, outside of any
+// session. It returns the answer and the reason given by the llm.
+func (a *Agent) Judge(ctx context.Context, question, content string) (bool, string, error) {
+	messages := []param.Message{
+		param.NewSystemMessage(judgePrompt),
+		param.NewUserMessage(fmt.Sprintf("Question: %s\n\nText:\n%s", question, content)),
+	}
+	req := schema.NewRequest(a.cfg.Model, messages)
+	req.Temperature = 0
+	req.MaxTokens = 200
+
+	resp, err := a.chatCompletion(ctx, req)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to judge: %w", err)
+	}
+
+	answer := strings.TrimSpace(resp.FirstChoice().Message.Content)
+	verdict, reason, _ := strings.Cut(answer, "\n")
+	verdict = strings.ToUpper(strings.Trim(strings.TrimSpace(verdict), "*.:"))
+	switch {
+	case strings.HasPrefix(verdict, "YES"):
+		return true, strings.TrimSpace(reason), nil
+	case strings.HasPrefix(verdict, "NO"):
+		return false, strings.TrimSpace(reason), nil
+	}
+	return false, "", fmt.Errorf("unexpected judgement: %s", answer)
+}
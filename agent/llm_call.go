@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/llm/schema"
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
+	"github.com/ryanreadbooks/tokkibot/pkg/safe"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// chatCompletion calls the llm and records metrics and span of the call.
+func (a *Agent) chatCompletion(ctx context.Context, req *schema.Request) (*schema.Response, error) {
+	ctx, span := a.startLLMSpan(ctx, req, false)
+	startTime := time.Now()
+	resp, err := a.llm.ChatCompletion(ctx, req)
+
+	var (
+		usage        schema.CompletionUsage
+		finishReason schema.FinishReason
+	)
+	if resp != nil {
+		usage = resp.Usage
+		finishReason = resp.FirstChoice().FinishReason
+	}
+	a.observeLLMCall(req.Model, false, time.Since(startTime), err, usage)
+	endLLMSpan(span, err, usage, finishReason)
+
+	return resp, err
+}
+
+// chatCompletionStream calls the llm the stream way. Metrics and span are
+// recorded once the returned channel is drained.
+func (a *Agent) chatCompletionStream(ctx context.Context, req *schema.Request) <-chan *schema.StreamResponseChunk {
+	ctx, span := a.startLLMSpan(ctx, req, true)
+	startTime := time.Now()
+	srcCh := a.llm.ChatCompletionStream(ctx, req)
+	dstCh := make(chan *schema.StreamResponseChunk)
+
+	safe.Go(func() {
+		defer close(dstCh)
+
+		var (
+			err          error
+			usage        schema.CompletionUsage
+			finishReason schema.FinishReason
+		)
+		defer func() {
+			a.observeLLMCall(req.Model, true, time.Since(startTime), err, usage)
+			endLLMSpan(span, err, usage, finishReason)
+		}()
+
+		for chunk := range srcCh {
+			if chunk.Err != nil {
+				err = chunk.Err
+			}
+			if chunk.Usage.TotalTokens > 0 {
+				usage = chunk.Usage
+			}
+			if reason := chunk.FirstChoice().FinishReason; reason != "" {
+				finishReason = reason
+			}
+			select {
+			case dstCh <- chunk:
+			case <-ctx.Done():
+				err = ctx.Err()
+				// drain the source so the producer can exit
+				for range srcCh {
+				}
+				return
+			}
+		}
+	})
+
+	return dstCh
+}
+
+func (a *Agent) observeLLMCall(model string, stream bool, elapsed time.Duration, err error, usage schema.CompletionUsage) {
+	provider := a.cfg.Provider
+	metrics.LLMRequestDuration.
+		WithLabelValues(provider, model, strconv.FormatBool(stream), metrics.StatusOf(err)).
+		Observe(elapsed.Seconds())
+	if usage.PromptTokens > 0 {
+		metrics.LLMTokens.WithLabelValues(provider, model, "prompt").Add(float64(usage.PromptTokens))
+	}
+	if usage.CompletionTokens > 0 {
+		metrics.LLMTokens.WithLabelValues(provider, model, "completion").Add(float64(usage.CompletionTokens))
+	}
+}
+
+func (a *Agent) startLLMSpan(ctx context.Context, req *schema.Request, stream bool) (context.Context, trace.Span) {
+	return trace.StartSpan(ctx, "llm.chat_completion",
+		trace.AttrAgent.String(a.cfg.Name),
+		attribute.String("llm.provider", a.cfg.Provider),
+		attribute.String("llm.model", req.Model),
+		attribute.Bool("llm.stream", stream),
+		attribute.Int("llm.messages", len(req.Messages)),
+		attribute.Int("llm.tools", len(req.Tools)),
+	)
+}
+
+func endLLMSpan(span trace.Span, err error, usage schema.CompletionUsage, finishReason schema.FinishReason) {
+	span.SetAttributes(
+		attribute.Int64("llm.usage.prompt_tokens", usage.PromptTokens),
+		attribute.Int64("llm.usage.completion_tokens", usage.CompletionTokens),
+		attribute.String("llm.finish_reason", string(finishReason)),
+	)
+	trace.EndSpan(span, err)
+}
@@ -61,8 +61,8 @@ func Prepare(ctx context.Context, agentName string, opts ...PrepareOption) (ag *
 	}
 
 	llm, err := factory.NewLLM(
-		factory.WithAPIKey(provider.ApiKey),
-		factory.WithBaseURL(provider.BaseURL),
+		factory.WithAPIKey(provider.GetApiKey()),
+		factory.WithBaseURL(provider.GetBaseURL()),
 		factory.WithStyle(factory.Style(provider.Style)),
 	)
 	if err != nil {
@@ -77,6 +77,10 @@ func Prepare(ctx context.Context, agentName string, opts ...PrepareOption) (ag *
 		Model:        model,
 		MaxIteration: entry.MaxIteration,
 		Sandbox:      entry.Sandbox,
+		Checkpoint:   entry.Checkpoint,
+		Shell:        entry.Shell,
+		WebFetch:     globalCfg.WebFetch,
+		WebSearch:    globalCfg.WebSearch,
 	}
 	for _, opt := range opts {
 		opt(&agCfg)
@@ -15,5 +15,10 @@ type EmittedContent struct {
 type StreamEmitter interface {
 	EmitContent(content *EmittedContent)
 	EmitTool(round int, name, args string)
+	// EmitFileChange emits the unified diff of a file changed by a tool call
+	EmitFileChange(round int, path, diff string)
+	// EmitToolOutput emits output of a running tool call, done is set with
+	// the last part
+	EmitToolOutput(round int, name, output string, done bool)
 	EmitDone()
 }
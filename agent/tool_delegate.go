@@ -54,8 +54,13 @@ func (d *subAgentToolDelegate) spawnSubAgent(meta component.InvokeMeta, input *t
 		WorkspaceDir:    d.a.cfg.WorkspaceDir,
 		SessionDir:      config.GetSubAgentSessionsDir(d.a.Name(), subAgentName),
 		VolatileContext: true,
+		Sandbox:         d.a.cfg.Sandbox,
+		Shell:           d.a.cfg.Shell,
+		WebFetch:        d.a.cfg.WebFetch,
+		WebSearch:       d.a.cfg.WebSearch,
 
 		isSpawned:              true,
+		parent:                 d.a,
 		doNotAutoRegisterTools: true,
 		subagentPrompt:         subagentPrompt,
 	}
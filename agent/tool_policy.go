@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
+	"github.com/ryanreadbooks/tokkibot/agent/tools/guard"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/audit"
+	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
+)
+
+const maxConfirmArgumentsLen = 500
+
+// sessionApprovals remembers "always allow" answers of each session.
+type sessionApprovals struct {
+	mu      sync.Mutex
+	allowed map[string]map[string]string // session -> approval key -> approver
+}
+
+func newSessionApprovals() *sessionApprovals {
+	return &sessionApprovals{allowed: make(map[string]map[string]string)}
+}
+
+// get returns who allowed the key for the session.
+func (s *sessionApprovals) get(session, key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	approver, ok := s.allowed[session][key]
+	return approver, ok
+}
+
+func (s *sessionApprovals) allow(session, key, approver string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.allowed[session] == nil {
+		s.allowed[session] = make(map[string]string)
+	}
+	s.allowed[session][key] = approver
+}
+
+func (s *sessionApprovals) clear(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.allowed, session)
+}
+
+// describeToolCall extracts what tool policy rules match on from a call.
+func (a *Agent) describeToolCall(name, arguments string) *config.ToolCall {
+	call := &config.ToolCall{Name: name}
+	if a.mcpLoaded.Load() {
+		if mcpTool, ok := a.mcpManager.GetTool(name); ok {
+			call.McpServer = mcpTool.ServerName()
+			call.McpTool = mcpTool.ToolName()
+		}
+	}
+
+	var args map[string]any
+	if json.Unmarshal([]byte(arguments), &args) != nil {
+		return call
+	}
+	if name == tools.ToolNameShell {
+		call.Command, _ = args["command"].(string)
+	}
+	for _, key := range []string{"path", "file_name", "directory"} {
+		if p, ok := args[key].(string); ok && p != "" {
+			call.Paths = append(call.Paths, p)
+		}
+	}
+	if patch, ok := args["patch"].(string); ok && name == tools.ToolNameApplyPatch {
+		call.Paths = append(call.Paths, tools.PatchPaths(patch)...)
+	}
+	return call
+}
+
+// evaluateToolPolicy returns the action of the call. Configured rules come
+// first, then the builtin confirmation of shell commands.
+func evaluateToolPolicy(policy *config.ToolPolicyConfig, call *config.ToolCall) config.ToolAction {
+	for i := range policy.Rules {
+		if policy.Rules[i].Match(call) {
+			return policy.Rules[i].Action
+		}
+	}
+	if call.Name == tools.ToolNameShell && guard.NeedsConfirmation(call.Command) {
+		return config.ToolActionAsk
+	}
+	return policy.GetDefault()
+}
+
+// shellChainTokens chain or nest commands, a command holding one of them is
+// never approved for the session.
+var shellChainTokens = []string{";", "&&", "||", "|", "$(", "`", "\n"}
+
+// approvalKey identifies what an "always allow" answer covers: the whole
+// normalized shell command, the file of a file tool, otherwise the whole
+// tool. Shell commands that chain commands or need the builtin confirmation
+// are not reusable and ok is false.
+func approvalKey(call *config.ToolCall) (key string, ok bool) {
+	switch {
+	case strings.TrimSpace(call.Command) != "":
+		if guard.NeedsConfirmation(call.Command) {
+			return "", false
+		}
+		for _, token := range shellChainTokens {
+			if strings.Contains(call.Command, token) {
+				return "", false
+			}
+		}
+		return call.Name + ":" + strings.Join(strings.Fields(call.Command), " "), true
+	case len(call.Paths) > 0:
+		return call.Name + ":" + call.Paths[0], true
+	}
+	return call.Name, true
+}
+
+// checkToolPolicy applies the tool policy of the agent to the call and
+// records the decision in rec. A non-nil error rejects the call.
+func (a *Agent) checkToolPolicy(
+	ctx context.Context,
+	toolMeta tool.InvokeMeta,
+	name, arguments string,
+	rec *audit.Entry,
+) error {
+	policy := config.GetToolPolicy(a.policyAgentName())
+	call := a.describeToolCall(name, arguments)
+
+	action := evaluateToolPolicy(policy, call)
+	rec.Policy = string(action)
+	switch action {
+	case config.ToolActionAllow:
+		return nil
+	case config.ToolActionDeny:
+		slog.WarnContext(ctx, "[agent] tool call denied by policy", slog.String("tool", name))
+		rec.Status = audit.StatusDenied
+		return fmt.Errorf("tool call %s is denied by the tool policy", name)
+	}
+
+	session := toolMeta.Channel + ":" + toolMeta.ChatId
+	key, reusable := approvalKey(call)
+	if approver, ok := a.approvals.get(session, key); reusable && ok {
+		rec.ApprovedBy = approver
+		rec.ApprovalReason = "always allowed for the session"
+		return nil
+	}
+
+	confirmer, ok := tool.GetConfirmer(ctx)
+	if !ok {
+		if policy.GetNonInteractive() == config.ToolActionAllow {
+			rec.ApprovalReason = "allowed by the nonInteractive policy"
+			return nil
+		}
+		slog.WarnContext(ctx, "[agent] tool call needs confirmation in a non-interactive run", slog.String("tool", name))
+		rec.Status = audit.StatusDenied
+		return fmt.Errorf("tool call %s requires confirmation, which is not possible in this run", name)
+	}
+
+	rec.ConfirmRequested = true
+
+	command := call.Command
+	if command == "" {
+		command = name + " " + xstring.Truncate(arguments, maxConfirmArgumentsLen)
+	}
+	resp, err := confirmer.RequestConfirm(ctx, &tool.ConfirmRequest{
+		Channel:     toolMeta.Channel,
+		ChatId:      toolMeta.ChatId,
+		ToolName:    name,
+		Level:       tool.ConfirmNormal,
+		Title:       "Confirm Tool Call",
+		Description: "The tool policy requires confirmation to run this tool.",
+		Command:     command,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "[agent] confirmation request failed", slog.String("tool", name), slog.Any("error", err))
+		rec.Status = audit.StatusRejected
+		return fmt.Errorf("confirmation of tool call %s failed: %w", name, err)
+	}
+	rec.ApprovedBy = resp.ApprovedBy
+	rec.ApprovalReason = resp.Reason
+	if !resp.Confirmed {
+		reason := "user rejected"
+		if resp.Reason != "" {
+			reason = resp.Reason
+		}
+		slog.InfoContext(ctx, "[agent] tool call rejected", slog.String("tool", name), slog.String("reason", reason))
+		rec.Status = audit.StatusRejected
+		return fmt.Errorf("tool call %s rejected: %s", name, reason)
+	}
+	if resp.Always && reusable {
+		a.approvals.allow(session, key, resp.ApprovedBy)
+	}
+	slog.InfoContext(ctx, "[agent] tool call confirmed", slog.String("tool", name), slog.Bool("always", resp.Always))
+	return nil
+}
+
+// policyAgentName returns the configured agent whose tool policy applies.
+// Subagents follow the policy of the agent which spawned them.
+func (a *Agent) policyAgentName() string {
+	if a.cfg.parent != nil {
+		return a.cfg.parent.policyAgentName()
+	}
+	return a.cfg.Name
+}
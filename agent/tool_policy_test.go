@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
+	"github.com/ryanreadbooks/tokkibot/config"
+)
+
+func TestApprovalKey(t *testing.T) {
+	shell := func(command string) *config.ToolCall {
+		return &config.ToolCall{Name: tools.ToolNameShell, Command: command}
+	}
+
+	status, ok := approvalKey(shell("git  status"))
+	if !ok || status != "shell:git status" {
+		t.Fatalf("unexpected key %q, %v", status, ok)
+	}
+	if again, _ := approvalKey(shell(" git status ")); again != status {
+		t.Errorf("normalized commands should share the key, got %q", again)
+	}
+	if push, _ := approvalKey(shell("git push --force")); push == status {
+		t.Error("a different subcommand should not share the key")
+	}
+
+	for _, command := range []string{
+		"ls; rm -rf ~",
+		"ls && curl example.com",
+		"false || reboot",
+		"cat notes | sh",
+		"echo $(whoami)",
+		"echo `whoami`",
+		"ls\ncurl example.com",
+		"rm build.log",
+	} {
+		if key, ok := approvalKey(shell(command)); ok {
+			t.Errorf("%q should not be approved for the session, got key %q", command, key)
+		}
+	}
+
+	if key, ok := approvalKey(&config.ToolCall{Name: tools.ToolNameWriteFile, Paths: []string{"a.txt"}}); !ok || key != "write_file:a.txt" {
+		t.Errorf("unexpected file key %q, %v", key, ok)
+	}
+}
+
+func TestSessionApprovalsNotReused(t *testing.T) {
+	approvals := newSessionApprovals()
+	key, _ := approvalKey(&config.ToolCall{Name: tools.ToolNameShell, Command: "git status"})
+	approvals.allow("lark:oc_1", key, "ou_1")
+
+	for _, command := range []string{"git status", "git push --force", "git status; git push --force"} {
+		key, ok := approvalKey(&config.ToolCall{Name: tools.ToolNameShell, Command: command})
+		_, allowed := approvals.get("lark:oc_1", key)
+		if got, want := ok && allowed, command == "git status"; got != want {
+			t.Errorf("%q allowed = %v, want %v", command, got, want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ryanreadbooks/tokkibot/agent/tools/description"
 	"github.com/ryanreadbooks/tokkibot/channel/model"
@@ -12,11 +14,20 @@ import (
 )
 
 type CronInput struct {
-	Action   string `json:"action"              jsonschema:"description=Action to perform,enum=schedule,enum=list,enum=delete"`
+	Action   string `json:"action"              jsonschema:"description=Action to perform,enum=schedule,enum=list,enum=delete,enum=preview"`
 	Name     string `json:"name,omitempty"      jsonschema:"description=Task name (required for schedule/delete)"`
-	CronExpr string `json:"cron_expr,omitempty" jsonschema:"description=Cron expression for schedule action (5 fields: minute hour day month weekday). Examples: '0 9 * * *' (daily 9am)\\, '*/5 * * * *' (every 5 min)\\, '0 0 * * 1' (every Monday)"`
+	CronExpr string `json:"cron_expr,omitempty" jsonschema:"description=Schedule for schedule/preview actions. One of: a delay to run once ('in 2h'\\, 'in 30 minutes'); a time to run once ('at 2026-11-01T09:00'\\, 'at 2026-11-01 09:00 Asia/Shanghai'); an interval ('every 90m'\\, 'every 2 hours'); or a 5-field cron expression (minute hour day month weekday) such as '0 9 * * *' (daily 9am) or '0 0 * * 1' (every Monday)"`
 	Prompt   string `json:"prompt,omitempty"    jsonschema:"description=The prompt/instruction to execute when triggered (required for schedule)"`
-	OneShot  bool   `json:"one_shot,omitempty"  jsonschema:"description=If true\\, task runs once then auto-disables (only for schedule action)"`
+	OneShot  bool   `json:"one_shot,omitempty"  jsonschema:"description=If true\\, task runs once then auto-disables (only for schedule action). Not needed for 'in' and 'at' schedules"`
+	Timezone string `json:"timezone,omitempty"  jsonschema:"description=IANA timezone of the schedule such as Asia/Shanghai (defaults to the server timezone)"`
+
+	MaxRetries      int  `json:"max_retries,omitempty"       jsonschema:"description=Number of retries with backoff after a failed run (only for schedule action)"`
+	NotifyOnFailure bool `json:"notify_on_failure,omitempty" jsonschema:"description=If true\\, notify the current chat when a run fails after all retries (only for schedule action)"`
+
+	OnSuccess        []string `json:"on_success,omitempty"         jsonschema:"description=Names of tasks to trigger after a successful run. Their prompts can use the result as {{.Upstream.Result}}"`
+	DeliverIfChanged bool     `json:"deliver_if_changed,omitempty" jsonschema:"description=If true\\, deliver the result only when it differs from the previous successful run"`
+	DeliverIfMatch   string   `json:"deliver_if_match,omitempty"   jsonschema:"description=Deliver the result only when it matches this regular expression"`
+	DeliverIf        string   `json:"deliver_if,omitempty"         jsonschema:"description=Deliver the result only when the answer to this yes or no question about the result is yes\\, e.g. 'Does the report mention a new incident?'"`
 }
 
 func Cron() tool.Invoker {
@@ -36,8 +47,10 @@ func Cron() tool.Invoker {
 			return cronList(mgr)
 		case "delete":
 			return cronDelete(mgr, input)
+		case "preview":
+			return cronPreview(input)
 		default:
-			return "", fmt.Errorf("invalid action '%s', must be one of: schedule, list, delete", input.Action)
+			return "", fmt.Errorf("invalid action '%s', must be one of: schedule, list, delete, preview", input.Action)
 		}
 	})
 }
@@ -73,6 +86,25 @@ func cronSchedule(mgr *cron.Manager, meta tool.InvokeMeta, input *CronInput) (st
 	if input.OneShot {
 		opts = append(opts, cron.WithOneShot())
 	}
+	if input.Timezone != "" {
+		opts = append(opts, cron.WithTimezone(input.Timezone))
+	}
+	if len(input.OnSuccess) > 0 {
+		opts = append(opts, cron.WithChain(input.OnSuccess, nil))
+	}
+	if input.DeliverIfChanged || input.DeliverIfMatch != "" || input.DeliverIf != "" {
+		opts = append(opts, cron.WithDeliverIf(&cron.Condition{
+			Regex:   input.DeliverIfMatch,
+			Changed: input.DeliverIfChanged,
+			Judge:   input.DeliverIf,
+		}))
+	}
+	if input.MaxRetries > 0 {
+		opts = append(opts, cron.WithRetry(&cron.RetryPolicy{MaxRetries: input.MaxRetries}))
+	}
+	if input.NotifyOnFailure {
+		opts = append(opts, cron.WithFailureNotify(channelType, meta.ChatId))
+	}
 
 	task := cron.NewTask(input.Name, input.CronExpr, input.Prompt, opts...)
 
@@ -88,11 +120,26 @@ func cronSchedule(mgr *cron.Manager, meta tool.InvokeMeta, input *CronInput) (st
 
 	result := fmt.Sprintf("Cron task '%s' %s successfully.\n", input.Name, action)
 	result += fmt.Sprintf("  Agent: %s\n", agentName)
-	result += fmt.Sprintf("  Expression: %s\n", input.CronExpr)
+	result += fmt.Sprintf("  Schedule: %s\n", task.CronExpr)
+	if next, ok := mgr.GetNextRun(task.Name); ok {
+		result += fmt.Sprintf("  Next run: %s\n", next.Format(time.RFC3339))
+	}
 	result += fmt.Sprintf("  Deliver to: %s (channel: %s)\n", meta.ChatId, meta.Channel)
-	if input.OneShot {
+	if task.IsOneShot() {
 		result += "  One-shot: yes (will auto-disable after first run)\n"
 	}
+	if input.MaxRetries > 0 {
+		result += fmt.Sprintf("  Retries: %d\n", input.MaxRetries)
+	}
+	if input.NotifyOnFailure {
+		result += "  Notify on failure: yes\n"
+	}
+	if len(input.OnSuccess) > 0 {
+		result += fmt.Sprintf("  On success: %s\n", strings.Join(input.OnSuccess, ", "))
+	}
+	if task.DeliverIf != nil {
+		result += "  Delivery is conditional\n"
+	}
 
 	return result, nil
 }
@@ -104,8 +151,8 @@ func cronList(mgr *cron.Manager) (string, error) {
 	}
 
 	result := "Cron Tasks:\n"
-	result += "| Name | Agent | Expression | Enabled | OneShot | Deliver | Last Run |\n"
-	result += "|------|-------|------------|---------|---------|---------|----------|\n"
+	result += "| Name | Agent | Expression | Enabled | OneShot | Deliver | Last Run | Last Status |\n"
+	result += "|------|-------|------------|---------|---------|---------|----------|-------------|\n"
 
 	for _, task := range tasks {
 		lastRun := "-"
@@ -118,8 +165,13 @@ func cronList(mgr *cron.Manager) (string, error) {
 			deliver = fmt.Sprintf("%s:%s", task.DeliverChannel, task.DeliverTo)
 		}
 
-		result += fmt.Sprintf("| %s | %s | %s | %v | %v | %s | %s |\n",
-			task.Name, task.AgentName, task.CronExpr, task.Enabled, task.OneShot, deliver, lastRun)
+		lastStatus := "-"
+		if task.LastStatus != "" {
+			lastStatus = string(task.LastStatus)
+		}
+
+		result += fmt.Sprintf("| %s | %s | %s | %v | %v | %s | %s | %s |\n",
+			task.Name, task.AgentName, task.CronExpr, task.Enabled, task.IsOneShot(), deliver, lastRun, lastStatus)
 	}
 
 	return result, nil
@@ -136,3 +188,36 @@ func cronDelete(mgr *cron.Manager, input *CronInput) (string, error) {
 
 	return fmt.Sprintf("Cron task '%s' deleted successfully.", input.Name), nil
 }
+
+const cronPreviewCount = 5
+
+func cronPreview(input *CronInput) (string, error) {
+	if input.CronExpr == "" {
+		return "", fmt.Errorf("cron expression is required for preview action")
+	}
+	spec, err := cron.NormalizeSpec(input.CronExpr, time.Now())
+	if err != nil {
+		return "", err
+	}
+	task := cron.NewTask("preview", spec, "", cron.WithTimezone(input.Timezone))
+	schedule, err := task.Schedule()
+	if err != nil {
+		return "", err
+	}
+
+	count := cronPreviewCount
+	if task.IsOneShot() || input.OneShot {
+		count = 1
+	}
+	times := schedule.NextN(time.Now(), count)
+	if len(times) == 0 {
+		return fmt.Sprintf("Schedule '%s' has no upcoming runs.", spec), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Next runs of '%s' (now is %s):\n", spec, time.Now().In(schedule.Location()).Format(time.RFC3339))
+	for _, t := range times {
+		fmt.Fprintf(&b, "- %s\n", t.In(schedule.Location()).Format("2006-01-02 15:04:05 MST Mon"))
+	}
+	return b.String(), nil
+}
@@ -8,6 +8,12 @@ var TodoWriteDescription string
 //go:embed shell.md
 var ShellDescription string
 
+//go:embed shell_output.md
+var ShellOutputDescription string
+
+//go:embed shell_kill.md
+var ShellKillDescription string
+
 //go:embed glob.md
 var GlobDescription string
 
@@ -21,4 +27,16 @@ var CronDescription string
 var SubagentDescription string
 
 //go:embed send_message.md
-var SendMessageDescription string
\ No newline at end of file
+var SendMessageDescription string
+
+//go:embed grep.md
+var GrepDescription string
+
+//go:embed multi_edit.md
+var MultiEditDescription string
+
+//go:embed apply_patch.md
+var ApplyPatchDescription string
+
+//go:embed web_search.md
+var WebSearchDescription string
@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+	// the middle part of larger changes is shown as removed and added as a
+	// whole instead of computing the longest common subsequence
+	diffMaxCells = 4_000_000
+	// diffs returned to the llm are cut after so many lines
+	maxToolDiffLines = 200
+)
+
+// FileChange is a change of one file made by a file tool.
+type FileChange struct {
+	Path       string
+	OldContent string
+	NewContent string
+	Created    bool // the file did not exist before
+	Deleted    bool // the file was removed
+	// Diff is the unified diff of the change
+	Diff string
+}
+
+// FileChangeReporter receives the changes made by the file tools, e.g. to
+// show them to the user.
+type FileChangeReporter func(change *FileChange)
+
+type fileChangeReporterKey struct{}
+
+// WithFileChangeReporter injects a FileChangeReporter into the context of
+// tool calls. Reporters already in the context still receive the changes.
+func WithFileChangeReporter(ctx context.Context, r FileChangeReporter) context.Context {
+	if prev, ok := ctx.Value(fileChangeReporterKey{}).(FileChangeReporter); ok && prev != nil {
+		next := r
+		r = func(change *FileChange) {
+			next(change)
+			prev(change)
+		}
+	}
+	return context.WithValue(ctx, fileChangeReporterKey{}, r)
+}
+
+func reportFileChange(ctx context.Context, change *FileChange) {
+	if r, ok := ctx.Value(fileChangeReporterKey{}).(FileChangeReporter); ok && r != nil {
+		r(change)
+	}
+}
+
+// FileSnapshotter receives a file before a file tool changes it, with the
+// content before the change, e.g. to be able to undo the change.
+type FileSnapshotter func(change *FileChange)
+
+type fileSnapshotterKey struct{}
+
+// WithFileSnapshotter injects a FileSnapshotter into the context of tool
+// calls.
+func WithFileSnapshotter(ctx context.Context, s FileSnapshotter) context.Context {
+	return context.WithValue(ctx, fileSnapshotterKey{}, s)
+}
+
+func snapshotFile(ctx context.Context, change *FileChange) {
+	if s, ok := ctx.Value(fileSnapshotterKey{}).(FileSnapshotter); ok && s != nil {
+		s(change)
+	}
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the edit script turning a into b.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// diffMiddle diffs the changed part by the longest common subsequence.
+func diffMiddle(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > diffMaxCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the lcs of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// UnifiedDiff returns the unified diff between the old and new content of
+// the file at path, empty if nothing changed.
+func UnifiedDiff(path, oldContent, newContent string) string {
+	if oldContent == newContent {
+		return ""
+	}
+	ops := diffLines(splitLines(oldContent), splitLines(newContent))
+
+	var b strings.Builder
+	oldName, newName := "a/"+strings.TrimPrefix(path, "/"), "b/"+strings.TrimPrefix(path, "/")
+	if oldContent == "" {
+		oldName = "/dev/null"
+	}
+	if newContent == "" {
+		newName = "/dev/null"
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		from := max(start-diffContextLines, 0)
+		// extend the hunk while changes are close enough to share context
+		end := start
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContextLines {
+				break
+			}
+			end = next
+		}
+		to := min(end+diffContextLines, len(ops))
+
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldStart++
+			}
+			if op.kind != '-' {
+				newStart++
+			}
+		}
+		oldLines, newLines := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldLines++
+			}
+			if op.kind != '-' {
+				newLines++
+			}
+		}
+		if oldLines == 0 {
+			oldStart--
+		}
+		if newLines == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLines, newStart, newLines)
+		for _, op := range ops[from:to] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.text)
+			b.WriteByte('\n')
+		}
+		start = to
+	}
+	return b.String()
+}
+
+// truncateDiff cuts a diff returned to the llm after maxToolDiffLines lines.
+func truncateDiff(diff string) string {
+	lines := strings.SplitAfter(diff, "\n")
+	if len(lines) <= maxToolDiffLines {
+		return diff
+	}
+	return strings.Join(lines[:maxToolDiffLines], "") +
+		fmt.Sprintf("... (%d more diff lines)\n", len(lines)-maxToolDiffLines)
+}
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools/guard"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+	"github.com/ryanreadbooks/tokkibot/pkg/document"
+)
+
+const (
+	maxReadDocumentChars = 50000
+	maxDocumentSize      = 50 * 1024 * 1024 // 50MB
+
+	// converted documents kept for reading on
+	maxCachedDocuments = 8
+)
+
+type ReadDocumentInput struct {
+	Path   string `json:"path"             jsonschema:"description=The path to the PDF, Word (docx), Excel (xlsx), PowerPoint (pptx) or CSV file"`
+	Offset int    `json:"offset,omitempty" jsonschema:"description=Character offset to read from, pass next_offset of the previous call to read on"`
+	Limit  int    `json:"limit,omitempty"  jsonschema:"description=Maximum characters to return, default and at most 50000"`
+}
+
+type ReadDocumentOutput struct {
+	Path       string `json:"path"`
+	Format     string `json:"format"`
+	Content    string `json:"content"`
+	Offset     int    `json:"offset,omitempty"`
+	TotalChars int    `json:"total_chars"`
+	NextOffset int    `json:"next_offset,omitempty"` // set when more content follows
+}
+
+// ReadDocument tool converts documents to markdown: pages of PDF files,
+// headings, lists and tables of Word documents, sheets of Excel workbooks as
+// tables and slides of presentations.
+func ReadDocument(allowDirs []string) tool.Invoker {
+	return tool.NewInvoker(tool.Info{
+		Name: ToolNameReadDocument,
+		Description: "Read a PDF, Word (docx), Excel (xlsx), PowerPoint (pptx) or CSV file as markdown. " +
+			"Sheets and tables are returned as markdown tables. Long documents are returned in parts, " +
+			"pass next_offset as offset to read on. Use read_file for plain text files.",
+	}, func(ctx context.Context, meta tool.InvokeMeta, input *ReadDocumentInput) (*ReadDocumentOutput, error) {
+		cleanPath, err := guard.ResolvePath(input.Path, allowDirs)
+		if err != nil {
+			slog.WarnContext(ctx, "[tool/document] path resolution failed", slog.String("path", input.Path), slog.Any("error", err))
+			return nil, err
+		}
+
+		format, markdown, err := convertDocument(cleanPath)
+		if err != nil {
+			slog.WarnContext(ctx, "[tool/document] failed to read document", slog.String("path", cleanPath), slog.Any("error", err))
+			return nil, err
+		}
+
+		content, next, err := pageText(markdown, input.Offset, input.Limit, maxReadDocumentChars)
+		if err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "[tool/document] document read", slog.String("path", cleanPath), slog.String("format", string(format)), slog.Int("chars", len(content)))
+		return &ReadDocumentOutput{
+			Path:       cleanPath,
+			Format:     string(format),
+			Content:    content,
+			Offset:     input.Offset,
+			TotalChars: utf8.RuneCountInString(markdown),
+			NextOffset: next,
+		}, nil
+	})
+}
+
+// pageText returns limit characters of content from offset, at most
+// maxLimit, and the offset of the rest or 0 if nothing follows.
+func pageText(content string, offset, limit, maxLimit int) (string, int, error) {
+	if offset < 0 {
+		return "", 0, fmt.Errorf("offset %d is negative", offset)
+	}
+	start := runeIndex(content, offset)
+	if offset > 0 && start == len(content) {
+		return "", 0, fmt.Errorf("offset %d is beyond the end of the content (%d characters)", offset, utf8.RuneCountInString(content))
+	}
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	end := start + runeIndex(content[start:], limit)
+	if end < len(content) {
+		return content[start:end], offset + limit, nil
+	}
+	return content[start:], 0, nil
+}
+
+// runeIndex returns the byte index of the n-th rune of s, or len(s).
+func runeIndex(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+type cachedDocument struct {
+	key      string
+	format   document.Format
+	markdown string
+}
+
+var (
+	documentCacheMu sync.Mutex
+	documentCache   []cachedDocument // most recent last
+)
+
+// convertDocument converts the document at path to markdown. The last
+// converted documents are kept so that reading on does not convert them
+// again.
+func convertDocument(path string) (document.Format, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return "", "", fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxDocumentSize {
+		return "", "", fmt.Errorf("document too large: %d bytes (max %d bytes)", info.Size(), maxDocumentSize)
+	}
+
+	key := fmt.Sprintf("%s:%d:%s", path, info.Size(), info.ModTime().Format(time.RFC3339Nano))
+	documentCacheMu.Lock()
+	for _, d := range documentCache {
+		if d.key == key {
+			documentCacheMu.Unlock()
+			return d.format, d.markdown, nil
+		}
+	}
+	documentCacheMu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	format := document.Detect(path, data)
+	if format == "" {
+		return "", "", errors.New("not a PDF, docx, xlsx, pptx or csv document, use read_file for text files")
+	}
+	markdown, err := document.ToMarkdown(format, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to convert %s: %w", path, err)
+	}
+
+	documentCacheMu.Lock()
+	documentCache = append(documentCache, cachedDocument{key: key, format: format, markdown: markdown})
+	if len(documentCache) > maxCachedDocuments {
+		documentCache = documentCache[1:]
+	}
+	documentCacheMu.Unlock()
+	return format, markdown, nil
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+func TestReadDocument(t *testing.T) {
+	dir := t.TempDir()
+	var csv strings.Builder
+	csv.WriteString("month,amount\n")
+	for i := 1; i <= 200; i++ {
+		fmt.Fprintf(&csv, "%d,%d\n", i, i*100)
+	}
+	path := filepath.Join(dir, "ledger.csv")
+	if err := os.WriteFile(path, []byte(csv.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("plain"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read := ReadDocument([]string{dir})
+	invoke := func(input ReadDocumentInput) (ReadDocumentOutput, tool.InvokeResult) {
+		t.Helper()
+		args, _ := json.Marshal(&input)
+		output, err := read.Invoke(t.Context(), tool.InvokeMeta{}, string(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res tool.InvokeResult
+		if err := json.Unmarshal([]byte(output), &res); err != nil {
+			t.Fatal(err)
+		}
+		var out ReadDocumentOutput
+		if res.Success {
+			if err := json.Unmarshal([]byte(res.Data), &out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return out, res
+	}
+
+	first, res := invoke(ReadDocumentInput{Path: path, Limit: 1000})
+	if !res.Success {
+		t.Fatalf("read_document failed: %+v", res)
+	}
+	if first.Format != "csv" || !strings.HasPrefix(first.Content, "| month | amount |\n| --- | --- |\n| 1 | 100 |") ||
+		first.NextOffset != 1000 || first.TotalChars <= 1000 {
+		t.Fatalf("unexpected first part: %+v", first)
+	}
+
+	var b strings.Builder
+	b.WriteString(first.Content)
+	for offset := first.NextOffset; offset > 0; {
+		part, res := invoke(ReadDocumentInput{Path: path, Offset: offset, Limit: 1000})
+		if !res.Success {
+			t.Fatalf("read_document failed at %d: %+v", offset, res)
+		}
+		b.WriteString(part.Content)
+		offset = part.NextOffset
+	}
+	if got := b.String(); len(got) != first.TotalChars || !strings.HasSuffix(got, "| 200 | 20000 |") {
+		t.Errorf("parts do not add up to the document: %d of %d characters", len(got), first.TotalChars)
+	}
+
+	if _, res := invoke(ReadDocumentInput{Path: filepath.Join(dir, "notes.txt")}); res.Success || !strings.Contains(res.Err, "read_file") {
+		t.Errorf("expected a text file to be refused, got %+v", res)
+	}
+	if _, res := invoke(ReadDocumentInput{Path: "/etc/passwd"}); res.Success {
+		t.Error("expected a path outside the allowed dirs to be refused")
+	}
+}
+
+func TestPageText(t *testing.T) {
+	content := "ab😀cd"
+	cases := []struct {
+		offset, limit int
+		want          string
+		next          int
+	}{
+		{0, 0, content, 0},
+		{0, 3, "ab😀", 3},
+		{3, 3, "cd", 0},
+		{2, 1, "😀", 3},
+	}
+	for _, c := range cases {
+		got, next, err := pageText(content, c.offset, c.limit, 10)
+		if err != nil || got != c.want || next != c.next {
+			t.Errorf("pageText(%d, %d) = %q, %d, %v, want %q, %d", c.offset, c.limit, got, next, err, c.want, c.next)
+		}
+	}
+	if _, _, err := pageText(content, 5, 1, 10); err == nil {
+		t.Error("expected an error for an offset past the end")
+	}
+}
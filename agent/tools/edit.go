@@ -0,0 +1,333 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools/description"
+	"github.com/ryanreadbooks/tokkibot/agent/tools/guard"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+// EditOperation replaces old_string with new_string in a file.
+type EditOperation struct {
+	OldString  string `json:"old_string"            jsonschema:"description=The exact text to replace. Must match the file content including whitespace and indentation"`
+	NewString  string `json:"new_string"            jsonschema:"description=The text to replace it with. Must differ from old_string"`
+	ReplaceAll bool   `json:"replace_all,omitempty" jsonschema:"description=Replace all occurrences. Otherwise old_string must occur exactly once"`
+}
+
+// applyEdit applies one replacement. It fails instead of silently doing
+// nothing when old_string is missing or, without replace_all, ambiguous.
+func applyEdit(content string, edit *EditOperation) (string, error) {
+	if edit.OldString == "" {
+		return "", errors.New("old_string must not be empty")
+	}
+	if edit.OldString == edit.NewString {
+		return "", errors.New("old_string and new_string are the same, nothing to change")
+	}
+
+	count := strings.Count(content, edit.OldString)
+	switch {
+	case count == 0:
+		return "", errors.New("old_string not found in file, read the file again and copy the text exactly")
+	case count > 1 && !edit.ReplaceAll:
+		return "", fmt.Errorf("old_string occurs %d times in file, add surrounding lines to make it unique or set replace_all", count)
+	}
+
+	if edit.ReplaceAll {
+		return strings.ReplaceAll(content, edit.OldString, edit.NewString), nil
+	}
+	return strings.Replace(content, edit.OldString, edit.NewString, 1), nil
+}
+
+// applyEdits applies the edits in order, each on the result of the previous
+// one. Nothing is applied if one of them fails.
+func applyEdits(content string, edits []EditOperation) (string, error) {
+	if len(edits) == 0 {
+		return "", errors.New("no edits given")
+	}
+	for i := range edits {
+		var err error
+		content, err = applyEdit(content, &edits[i])
+		if err != nil {
+			if len(edits) == 1 {
+				return "", err
+			}
+			return "", fmt.Errorf("edit %d: %w, no edits were applied", i+1, err)
+		}
+	}
+	return content, nil
+}
+
+// resolveWritablePath resolves path for writing.
+func resolveWritablePath(path string, allowDirs []string) (string, error) {
+	cleanPath, err := guard.ResolvePath(path, allowDirs)
+	if err != nil {
+		return "", err
+	}
+	if guard.IsPathWriteProtected(cleanPath) {
+		return "", fmt.Errorf("path %s is write protected", cleanPath)
+	}
+	return cleanPath, nil
+}
+
+// writeFileAtomic replaces the file through a temporary file so that a
+// failed write does not leave a partially written file behind. The mode of
+// an existing file is kept.
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := stageFile(path, content)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace file %s: %w", path, err)
+	}
+	return nil
+}
+
+// stageFile writes content to a temporary file next to path, with the mode
+// of path if it exists, and returns its name to be renamed over path.
+func stageFile(path string, content []byte) (string, error) {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create parent directories for %s: %w", path, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for %s: %w", path, err)
+	}
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to chmod file %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return f.Name(), nil
+}
+
+// formatFileChange reports the change and returns the result for the llm.
+func formatFileChange(ctx context.Context, verb string, change *FileChange) string {
+	change.Diff = UnifiedDiff(change.Path, change.OldContent, change.NewContent)
+	if change.Diff == "" && !change.Created && !change.Deleted {
+		return fmt.Sprintf("File %s %s, content unchanged", change.Path, verb)
+	}
+	reportFileChange(ctx, change)
+	return fmt.Sprintf("File %s %s successfully:\n%s", change.Path, verb, truncateDiff(change.Diff))
+}
+
+// editFileContent applies edits to the file at path and returns the result
+// for the llm.
+func editFileContent(ctx context.Context, path string, allowDirs []string, edits []EditOperation) (string, error) {
+	cleanPath, err := resolveWritablePath(path, allowDirs)
+	if err != nil {
+		slog.WarnContext(ctx, "[tool/file] path resolution failed", slog.String("path", path), slog.Any("error", err))
+		return "", err
+	}
+
+	content, err := os.ReadFile(cleanPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", cleanPath, err)
+	}
+
+	newContent, err := applyEdits(string(content), edits)
+	if err != nil {
+		slog.WarnContext(ctx, "[tool/file] edit rejected", slog.String("path", cleanPath), slog.Any("error", err))
+		return "", err
+	}
+
+	if newContent != string(content) {
+		snapshotFile(ctx, &FileChange{Path: cleanPath, OldContent: string(content)})
+	}
+	if err := writeFileAtomic(cleanPath, []byte(newContent)); err != nil {
+		slog.ErrorContext(ctx, "[tool/file] failed to write edited content", slog.String("path", cleanPath), slog.Any("error", err))
+		return "", err
+	}
+
+	slog.InfoContext(ctx, "[tool/file] file edited successfully", slog.String("path", cleanPath), slog.Int("edits", len(edits)))
+	return formatFileChange(ctx, "edited", &FileChange{
+		Path:       cleanPath,
+		OldContent: string(content),
+		NewContent: newContent,
+	}), nil
+}
+
+type MultiEditInput struct {
+	Path  string          `json:"path"  jsonschema:"description=The path to the file to edit"`
+	Edits []EditOperation `json:"edits" jsonschema:"description=The replacements to apply in order. Each one applies to the result of the previous one"`
+}
+
+// MultiEdit tool to apply several replacements to a file at once. Either all
+// of them are applied or none.
+func MultiEdit(allowDirs []string) tool.Invoker {
+	return tool.NewInvoker(tool.Info{
+		Name:        ToolNameMultiEdit,
+		Description: description.MultiEditDescription,
+	}, func(ctx context.Context, meta tool.InvokeMeta, input *MultiEditInput) (string, error) {
+		slog.DebugContext(ctx, "[tool/file] multi editing file", slog.String("path", input.Path), slog.Int("edits", len(input.Edits)))
+		return editFileContent(ctx, input.Path, allowDirs, input.Edits)
+	})
+}
+
+type ApplyPatchInput struct {
+	Patch string `json:"patch" jsonschema:"description=The patch in unified diff format with ---/+++ file headers and @@ hunks. May change several files. Use /dev/null to create or delete a file"`
+}
+
+// ApplyPatch tool to apply a unified diff. Either all files are changed or
+// none.
+func ApplyPatch(allowDirs []string) tool.Invoker {
+	return tool.NewInvoker(tool.Info{
+		Name:        ToolNameApplyPatch,
+		Description: description.ApplyPatchDescription,
+	}, func(ctx context.Context, meta tool.InvokeMeta, input *ApplyPatchInput) (string, error) {
+		slog.DebugContext(ctx, "[tool/patch] applying patch", slog.Int("patch_len", len(input.Patch)))
+
+		patches, err := parsePatch(input.Patch)
+		if err != nil {
+			return "", err
+		}
+
+		// compute all results before touching any file
+		type change struct {
+			path       string
+			oldContent string
+			newContent string
+			mode       os.FileMode
+			create     bool
+			delete     bool
+			staged     string // temporary file holding newContent
+		}
+		var changes []*change
+		byPath := make(map[string]*change)
+		for _, p := range patches {
+			path, err := resolveWritablePath(p.path(), allowDirs)
+			if err != nil {
+				return "", err
+			}
+			c, ok := byPath[path]
+			if !ok {
+				c = &change{path: path, create: p.isCreate()}
+				if !p.isCreate() {
+					data, err := os.ReadFile(path)
+					if err != nil {
+						return "", fmt.Errorf("failed to read file %s: %w", path, err)
+					}
+					c.oldContent = string(data)
+					if info, err := os.Stat(path); err == nil {
+						c.mode = info.Mode().Perm()
+					}
+				} else if _, err := os.Stat(path); err == nil {
+					return "", fmt.Errorf("file %s already exists", path)
+				}
+				c.newContent = c.oldContent
+				byPath[path] = c
+				changes = append(changes, c)
+			}
+			// several parts of a patch may change the same file
+			if c.newContent, err = p.apply(c.newContent); err != nil {
+				return "", fmt.Errorf("%s: %w, no files were changed", p.path(), err)
+			}
+			c.delete = p.isDelete()
+		}
+
+		// write every file next to its target first and move them into place
+		// only once all are written, a failure restores the files moved so far
+		defer func() {
+			for _, c := range changes {
+				if c.staged != "" {
+					os.Remove(c.staged)
+				}
+			}
+		}()
+		for _, c := range changes {
+			if c.delete {
+				continue
+			}
+			if c.staged, err = stageFile(c.path, []byte(c.newContent)); err != nil {
+				return "", fmt.Errorf("%w, no files were changed", err)
+			}
+		}
+
+		for _, c := range changes {
+			if c.create || c.delete || c.newContent != c.oldContent {
+				snapshotFile(ctx, &FileChange{Path: c.path, OldContent: c.oldContent, Created: c.create})
+			}
+		}
+		for i, c := range changes {
+			if c.delete {
+				err = os.Remove(c.path)
+			} else if err = os.Rename(c.staged, c.path); err == nil {
+				c.staged = ""
+			}
+			if err == nil {
+				continue
+			}
+			var failed []string
+			for _, done := range changes[:i] {
+				if rerr := restorePatchedFile(done.path, done.oldContent, done.mode, done.create); rerr != nil {
+					slog.ErrorContext(ctx, "[tool/patch] failed to restore file", slog.String("path", done.path), slog.Any("error", rerr))
+					failed = append(failed, done.path)
+				}
+			}
+			if len(failed) > 0 {
+				return "", fmt.Errorf("failed to change file %s: %w, could not restore %s", c.path, err, strings.Join(failed, ", "))
+			}
+			return "", fmt.Errorf("failed to change file %s: %w, no files were changed", c.path, err)
+		}
+
+		var results []string
+		for _, c := range changes {
+			if c.delete {
+				results = append(results, formatFileChange(ctx, "deleted", &FileChange{
+					Path:       c.path,
+					OldContent: c.oldContent,
+					Deleted:    true,
+				}))
+				continue
+			}
+			verb := "patched"
+			if c.create {
+				verb = "created"
+			}
+			results = append(results, formatFileChange(ctx, verb, &FileChange{
+				Path:       c.path,
+				OldContent: c.oldContent,
+				NewContent: c.newContent,
+				Created:    c.create,
+			}))
+		}
+
+		slog.InfoContext(ctx, "[tool/patch] patch applied", slog.Int("files", len(changes)))
+		return strings.Join(results, "\n"), nil
+	})
+}
+
+// restorePatchedFile puts back the content of a file changed by a patch
+// which could not be applied as a whole.
+func restorePatchedFile(path, oldContent string, mode os.FileMode, created bool) error {
+	if created {
+		return os.Remove(path)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return os.WriteFile(path, []byte(oldContent), mode)
+	}
+	return writeFileAtomic(path, []byte(oldContent))
+}
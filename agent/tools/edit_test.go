@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+func patchArgs(patch string) string {
+	b, _ := json.Marshal(&ApplyPatchInput{Patch: patch})
+	return string(b)
+}
+
+func TestApplyEdits(t *testing.T) {
+	content := "a := 1\nb := 1\nc := 2\n"
+
+	got, err := applyEdits(content, []EditOperation{
+		{OldString: "a := 1", NewString: "a := 10"},
+		{OldString: ":= 1\n", NewString: ":= 11\n", ReplaceAll: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "a := 10\nb := 11\nc := 2\n" {
+		t.Errorf("got %q", got)
+	}
+
+	failures := [][]EditOperation{
+		{{OldString: "d := 3", NewString: "d := 4"}},
+		{{OldString: ":= 1", NewString: ":= 2"}},
+		{{OldString: "c := 2", NewString: "c := 2"}},
+		{{OldString: "", NewString: "x"}},
+		{{OldString: "a := 1", NewString: "a := 2"}, {OldString: "a := 1", NewString: "a := 3"}},
+	}
+	for _, edits := range failures {
+		if _, err := applyEdits(content, edits); err == nil {
+			t.Errorf("%+v: expected an error", edits)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var old, new []string
+	for i := 1; i <= 20; i++ {
+		line := strings.Repeat("x", i)
+		old = append(old, line)
+		if i == 2 {
+			continue
+		}
+		new = append(new, line)
+		if i == 15 {
+			new = append(new, "added")
+		}
+	}
+
+	diff := UnifiedDiff("f.txt", strings.Join(old, "\n")+"\n", strings.Join(new, "\n")+"\n")
+	want := `--- a/f.txt
++++ b/f.txt
+@@ -1,5 +1,4 @@
+ x
+-xx
+ xxx
+ xxxx
+ xxxxx
+@@ -13,6 +12,7 @@
+ xxxxxxxxxxxxx
+ xxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxx
++added
+ xxxxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxxxxx
+`
+	if diff != want {
+		t.Errorf("got\n%s\nwant\n%s", diff, want)
+	}
+	if UnifiedDiff("f.txt", "same\n", "same\n") != "" {
+		t.Error("expected no diff for unchanged content")
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.go")
+	old := filepath.Join(dir, "old.txt")
+	if err := os.WriteFile(main, []byte("package main\n\n// added later\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(old, []byte("bye\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the hunk is two lines off and has wrong counts
+	patch := `diff --git a/main.go b/main.go
+--- a/` + main + `
++++ b/` + main + `
+@@ -3,2 +3,2 @@ package main
+ func main() {
+-	println("hi")
++	println("hello")
+ }
+
+--- /dev/null
++++ b/` + filepath.Join(dir, "new.txt") + `
+@@ -0,0 +1,1 @@
++new file
+--- a/` + old + `
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	apply := ApplyPatch([]string{dir})
+	out, err := apply.Invoke(t.Context(), tool.InvokeMeta{}, patchArgs(patch))
+	if err != nil || !strings.Contains(out, `"success":true`) {
+		t.Fatalf("apply failed: %s %v", out, err)
+	}
+
+	data, _ := os.ReadFile(main)
+	if !strings.Contains(string(data), `println("hello")`) {
+		t.Errorf("main.go = %s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "new.txt")); string(data) != "new file\n" {
+		t.Errorf("new.txt = %q", data)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("old.txt should be deleted")
+	}
+
+	// the second hunk does not match, nothing must change
+	patch = `--- a/` + main + `
++++ b/` + main + `
+@@ -1,1 +1,1 @@
+-package main
++package app
+--- a/` + main + `
++++ b/` + main + `
+@@ -5,1 +5,1 @@
+-	println("missing")
++	println("x")
+`
+	out, _ = apply.Invoke(t.Context(), tool.InvokeMeta{}, patchArgs(patch))
+	if !strings.Contains(out, `"success":false`) {
+		t.Errorf("expected a failure: %s", out)
+	}
+	if data, _ := os.ReadFile(main); !strings.HasPrefix(string(data), "package main") {
+		t.Errorf("file changed by a failed patch: %s", data)
+	}
+
+	if paths := PatchPaths(patch); len(paths) != 2 || paths[0] != main {
+		t.Errorf("paths = %v", paths)
+	}
+}
+
+func TestApplyPatchSecondFileFails(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	gone := filepath.Join(dir, "gone.txt")
+	blocker := filepath.Join(dir, "blocker")
+	for path, content := range map[string]string{first: "one\n", gone: "bye\n", blocker: "a file, not a directory\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the third file cannot be written as its parent is a file
+	patch := `--- a/` + first + `
++++ b/` + first + `
+@@ -1 +1 @@
+-one
++two
+--- a/` + gone + `
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+--- /dev/null
++++ b/` + filepath.Join(blocker, "new.txt") + `
+@@ -0,0 +1 @@
++new
+`
+	out, _ := ApplyPatch([]string{dir}).Invoke(t.Context(), tool.InvokeMeta{}, patchArgs(patch))
+	if !strings.Contains(out, `"success":false`) || !strings.Contains(out, "no files were changed") {
+		t.Fatalf("expected a failure: %s", out)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "one\n" {
+		t.Errorf("first.txt changed by a failed patch: %q", data)
+	}
+	if _, err := os.Stat(gone); err != nil {
+		t.Errorf("gone.txt deleted by a failed patch: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
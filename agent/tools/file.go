@@ -4,11 +4,10 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
-	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/ryanreadbooks/tokkibot/agent/ref"
 	"github.com/ryanreadbooks/tokkibot/agent/tools/guard"
@@ -109,20 +108,31 @@ func WriteFile(allowDirs []string) tool.Invoker {
 			return "", fmt.Errorf("path %s is write protected", cleanPath)
 		}
 
-		err = os.MkdirAll(filepath.Dir(cleanPath), 0755)
-		if err != nil {
-			slog.ErrorContext(ctx, "[tool/file] failed to create parent directories", slog.String("path", input.Path), slog.Any("error", err))
-			return "", fmt.Errorf("failed to create parent directories for %s: %w", input.Path, err)
+		var oldContent []byte
+		existed := false
+		if info, err := os.Stat(cleanPath); err == nil && !info.IsDir() {
+			if oldContent, err = os.ReadFile(cleanPath); err != nil {
+				return "", fmt.Errorf("failed to read file %s: %w", cleanPath, err)
+			}
+			existed = true
 		}
 
-		err = os.WriteFile(cleanPath, []byte(input.Content), 0644)
+		if !existed || string(oldContent) != input.Content {
+			snapshotFile(ctx, &FileChange{Path: cleanPath, OldContent: string(oldContent), Created: !existed})
+		}
+		err = writeFileAtomic(cleanPath, []byte(input.Content))
 		if err != nil {
 			slog.ErrorContext(ctx, "[tool/file] failed to write file", slog.String("path", cleanPath), slog.Any("error", err))
-			return "", fmt.Errorf("failed to write file %s: %w", cleanPath, err)
+			return "", err
 		}
 
 		slog.InfoContext(ctx, "[tool/file] file written successfully", slog.String("path", cleanPath), slog.Int("bytes", len(input.Content)))
-		return fmt.Sprintf("File %s written successfully", cleanPath), nil
+		return formatFileChange(ctx, "written", &FileChange{
+			Path:       cleanPath,
+			OldContent: string(oldContent),
+			NewContent: input.Content,
+			Created:    !existed,
+		}), nil
 	})
 }
 
@@ -172,80 +182,55 @@ type EditFileInput struct {
 
 func EditFile(allowDirs []string) tool.Invoker {
 	return tool.NewInvoker(tool.Info{
-		Name:        ToolNameEditFile,
-		Description: "Edit the contents of a file at the given path by replacing the old string with the new string.",
+		Name: ToolNameEditFile,
+		Description: "Edit the contents of a file at the given path by replacing the old string with the new string. " +
+			"old_string must match the file exactly and occur once unless replace_all is set, otherwise the edit fails. " +
+			"Returns a unified diff of the change. Use multi_edit for several changes to one file.",
 	}, func(ctx context.Context, meta tool.InvokeMeta, input *EditFileInput) (result string, err error) {
 		slog.DebugContext(ctx, "[tool/file] editing file", slog.String("path", input.FileName), slog.Bool("replace_all", input.ReplaceAll))
 
-		cleanPath, err := guard.ResolvePath(input.FileName, allowDirs)
-		if err != nil {
-			slog.WarnContext(ctx, "[tool/file] path resolution failed", slog.String("path", input.FileName), slog.Any("error", err))
-			return "", err
-		}
-
-		if guard.IsPathWriteProtected(cleanPath) {
-			slog.WarnContext(ctx, "[tool/file] write protected path", slog.String("path", cleanPath))
-			return "", fmt.Errorf("path %s is write protected", cleanPath)
-		}
-
-		f, err := os.OpenFile(cleanPath, os.O_RDWR, 0664)
-		if err != nil {
-			slog.ErrorContext(ctx, "[tool/file] failed to open file for editing", slog.String("path", cleanPath), slog.Any("error", err))
-			return "", fmt.Errorf("failed to open file %s: %w", cleanPath, err)
-		}
-		defer f.Close()
-
-		content, err := io.ReadAll(f)
-		if err != nil {
-			return "", fmt.Errorf("failed to read file %s: %w", cleanPath, err)
-		}
-
-		contentStr := string(content)
-		if input.ReplaceAll {
-			contentStr = strings.ReplaceAll(contentStr, input.OldString, input.NewString)
-		} else {
-			contentStr = strings.Replace(contentStr, input.OldString, input.NewString, 1)
-		}
-
-		if _, err = f.Seek(0, 0); err != nil {
-			return "", fmt.Errorf("failed to seek file %s: %w", cleanPath, err)
-		}
-		if err = f.Truncate(0); err != nil {
-			return "", fmt.Errorf("failed to truncate file %s: %w", cleanPath, err)
-		}
-
-		_, err = f.WriteString(contentStr)
-		if err != nil {
-			slog.ErrorContext(ctx, "[tool/file] failed to write edited content", slog.String("path", cleanPath), slog.Any("error", err))
-			return "", fmt.Errorf("failed to write file %s: %w", cleanPath, err)
-		}
-
-		slog.InfoContext(ctx, "[tool/file] file edited successfully", slog.String("path", cleanPath))
-		return fmt.Sprintf("File %s edited successfully", cleanPath), nil
+		return editFileContent(ctx, input.FileName, allowDirs, []EditOperation{{
+			OldString:  input.OldString,
+			NewString:  input.NewString,
+			ReplaceAll: input.ReplaceAll,
+		}})
 	})
 }
 
 type LoadRefInput struct {
-	Name string `json:"name" jsonschema:"description=The reference name to load"`
+	Name   string `json:"name"             jsonschema:"description=The reference name to load"`
+	Offset int    `json:"offset,omitempty" jsonschema:"description=Character offset to read from, for references too long to load at once"`
+	Limit  int    `json:"limit,omitempty"  jsonschema:"description=Maximum characters to return, default and at most 50000"`
 }
 
+const maxLoadRefChars = 50000
+
 // Load ref, similar to read file, but for better understanding this is tool is seperated.
 func LoadRef() tool.Invoker {
 	return tool.NewInvoker(tool.Info{
-		Name:        ToolNameLoadRef,
-		Description: "Load content from a previously stored reference (e.g., tool call results).",
+		Name: ToolNameLoadRef,
+		Description: "Load content from a previously stored reference (e.g., tool call results or converted documents). " +
+			"Long references are returned in parts, use offset to read on.",
 	}, func(ctx context.Context, meta tool.InvokeMeta, input *LoadRefInput) (string, error) {
 		// refName example: @refs/xxx/xxx
 		fullpath, err := ref.Fullpath(input.Name)
 		if err != nil {
-			return "", fmt.Errorf("invalid refname %s: %w", input, err)
+			return "", fmt.Errorf("invalid refname %s: %w", input.Name, err)
 		}
 
 		content, err := os.ReadFile(fullpath)
 		if err != nil {
-			return "", fmt.Errorf("failed to read %s: %w", input, err)
+			return "", fmt.Errorf("failed to read %s: %w", input.Name, err)
 		}
 
-		return string(content), err
+		part, next, err := pageText(string(content), input.Offset, input.Limit, maxLoadRefChars)
+		if err != nil {
+			return "", err
+		}
+		if next > 0 {
+			part += fmt.Sprintf("\n\n[characters %d to %d of %d, call load_ref with offset %d to read on]",
+				input.Offset, next, utf8.RuneCount(content), next)
+		}
+		return part, nil
 	})
 }
@@ -9,7 +9,6 @@ import (
 
 	"github.com/ryanreadbooks/tokkibot/agent/tools/description"
 	"github.com/ryanreadbooks/tokkibot/component/tool"
-	"github.com/ryanreadbooks/tokkibot/config"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
@@ -19,16 +18,10 @@ type GlobInput struct {
 	Directory string `json:"directory" jsonschema:"description=The directory to search in. If not specified, the current directory will be used. IMPORTANT: Omit this field to use the default directory. DO NOT enter \"undefined\" or \"null\" - simply omit it for the default behavior. Must be a valid directory path if provided."`
 }
 
-func doGlobInvoke(ctx context.Context, meta tool.InvokeMeta, input *GlobInput) (string, error) {
-	dir := config.GetProjectDir()
-	if input.Directory != "" {
-		var dir2 string
-		dir2, err := filepath.Abs(input.Directory)
-		if err != nil {
-			return "", fmt.Errorf("failed to get absolute path of directory: %w", err)
-		}
-
-		dir = dir2
+func doGlobInvoke(ctx context.Context, allowDirs []string, input *GlobInput) (string, error) {
+	dir, err := resolveSearchPath(input.Directory, allowDirs)
+	if err != nil {
+		return "", err
 	}
 
 	fs := os.DirFS(dir)
@@ -44,11 +37,16 @@ func doGlobInvoke(ctx context.Context, meta tool.InvokeMeta, input *GlobInput) (
 	return strings.Join(matches, "\n"), nil
 }
 
-func Glob() tool.Invoker {
+// Tool to find files by glob patterns.
+//
+// Only directories inside the allowed directories can be searched.
+func Glob(allowDirs []string) tool.Invoker {
 	info := tool.Info{
 		Name:        ToolNameGlob,
 		Description: description.GlobDescription,
 	}
 
-	return tool.NewInvoker(info, doGlobInvoke)
+	return tool.NewInvoker(info, func(ctx context.Context, meta tool.InvokeMeta, input *GlobInput) (string, error) {
+		return doGlobInvoke(ctx, allowDirs, input)
+	})
 }
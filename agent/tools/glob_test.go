@@ -1,16 +1,16 @@
 package tools
 
 import (
+	"path/filepath"
 	"testing"
-
-	"github.com/ryanreadbooks/tokkibot/component/tool"
 )
 
 func TestGlob(t *testing.T) {
+	dir, _ := filepath.Abs("../")
 	output, err := doGlobInvoke(t.Context(),
-		tool.InvokeMeta{},
+		[]string{dir},
 		&GlobInput{
-			Directory: "../",
+			Directory: dir,
 			Pattern:   "**/*.go",
 		})
 	t.Log(output)
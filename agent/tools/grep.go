@@ -0,0 +1,386 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools/description"
+	"github.com/ryanreadbooks/tokkibot/agent/tools/guard"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+	"github.com/ryanreadbooks/tokkibot/config"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	grepOutputContent = "content"
+	grepOutputFiles   = "files_with_matches"
+	grepOutputCount   = "count"
+
+	grepDefaultLimit = 100
+	grepMaxLimit     = 1000
+	grepMaxContext   = 10
+	grepMaxFileSize  = 10 << 20
+	grepMaxLineLen   = 500
+)
+
+// grepTypes maps the file types accepted by the type filter to glob patterns.
+var grepTypes = map[string][]string{
+	"c":      {"*.c", "*.h"},
+	"cpp":    {"*.cpp", "*.cc", "*.cxx", "*.hpp", "*.hh", "*.hxx", "*.h"},
+	"css":    {"*.css", "*.scss", "*.sass", "*.less"},
+	"go":     {"*.go"},
+	"html":   {"*.html", "*.htm"},
+	"java":   {"*.java"},
+	"js":     {"*.js", "*.mjs", "*.cjs", "*.jsx"},
+	"json":   {"*.json", "*.jsonl"},
+	"kotlin": {"*.kt", "*.kts"},
+	"md":     {"*.md", "*.markdown"},
+	"php":    {"*.php"},
+	"proto":  {"*.proto"},
+	"py":     {"*.py", "*.pyi"},
+	"rb":     {"*.rb"},
+	"rust":   {"*.rs"},
+	"sh":     {"*.sh", "*.bash", "*.zsh"},
+	"sql":    {"*.sql"},
+	"swift":  {"*.swift"},
+	"toml":   {"*.toml"},
+	"ts":     {"*.ts", "*.tsx", "*.mts", "*.cts"},
+	"yaml":   {"*.yaml", "*.yml"},
+}
+
+type GrepInput struct {
+	Pattern    string `json:"pattern"                jsonschema:"description=The regular expression (RE2 syntax) to search for in file contents"`
+	Path       string `json:"path,omitempty"         jsonschema:"description=File or directory to search in. Defaults to the current project directory"`
+	Glob       string `json:"glob,omitempty"         jsonschema:"description=Only search files matching the glob, e.g. '*.go' or 'src/**/*.{ts,tsx}'. Patterns without '/' match the file name"`
+	Type       string `json:"type,omitempty"         jsonschema:"description=Only search files of the type, e.g. go, py, js, ts, rust, java, md"`
+	Literal    bool   `json:"literal,omitempty"      jsonschema:"description=Treat the pattern as a literal string instead of a regular expression"`
+	IgnoreCase bool   `json:"ignore_case,omitempty"  jsonschema:"description=Case insensitive search"`
+	Context    int    `json:"context,omitempty"      jsonschema:"description=Number of lines to show before and after each match. Only for content output"`
+	OutputMode string `json:"output_mode,omitempty"  jsonschema:"enum=content,enum=files_with_matches,enum=count,description=content shows matching lines (default)\\, files_with_matches shows only file paths\\, count shows the number of matches per file"`
+	Limit      int    `json:"limit,omitempty"        jsonschema:"description=Maximum number of matching lines (content) or files (files_with_matches and count) to return. Default is 100"`
+	NoIgnore   bool   `json:"no_ignore,omitempty"    jsonschema:"description=Also search files ignored by .gitignore"`
+	Hidden     bool   `json:"hidden,omitempty"       jsonschema:"description=Also search hidden files and directories"`
+}
+
+// Tool to search file contents, like ripgrep.
+//
+// Only files inside the allowed directories can be searched.
+func Grep(allowDirs []string) tool.Invoker {
+	return tool.NewInvoker(tool.Info{
+		Name:        ToolNameGrep,
+		Description: description.GrepDescription,
+	}, func(ctx context.Context, meta tool.InvokeMeta, input *GrepInput) (string, error) {
+		return doGrep(ctx, allowDirs, input)
+	})
+}
+
+// resolveSearchPath resolves path like the file tools and makes sure the
+// result is inside allowDirs, also for relative paths escaping with "..".
+// An empty path is the project directory.
+func resolveSearchPath(path string, allowDirs []string) (string, error) {
+	if path == "" {
+		path = config.GetProjectDir()
+	}
+	resolved, err := guard.ResolvePath(path, allowDirs)
+	if err != nil {
+		return "", err
+	}
+	return guard.ResolvePath(resolved, allowDirs)
+}
+
+type grepper struct {
+	re        *regexp.Regexp
+	root      string
+	glob      string
+	types     []string
+	mode      string
+	context   int
+	limit     int
+	noIgnore  bool
+	hidden    bool
+	ignore    *ignoreMatcher
+	out       strings.Builder
+	entries   int
+	matches   int
+	files     int
+	truncated bool
+}
+
+func doGrep(ctx context.Context, allowDirs []string, input *GrepInput) (string, error) {
+	slog.DebugContext(ctx, "[tool/grep] searching", slog.String("pattern", input.Pattern), slog.String("path", input.Path))
+
+	if input.Pattern == "" {
+		return "", fmt.Errorf("pattern is required")
+	}
+	root, err := resolveSearchPath(input.Path, allowDirs)
+	if err != nil {
+		slog.WarnContext(ctx, "[tool/grep] path resolution failed", slog.String("path", input.Path), slog.Any("error", err))
+		return "", err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", root, err)
+	}
+
+	g, err := newGrepper(input, root)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		g.ignore = newIgnoreMatcher(root)
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// unreadable entries are skipped like ripgrep does
+				return nil
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if g.truncated {
+				return filepath.SkipAll
+			}
+			if path == root {
+				return nil
+			}
+			if d.IsDir() {
+				if g.skipDir(path, d.Name()) {
+					return filepath.SkipDir
+				}
+				if !g.noIgnore {
+					g.ignore.loadDir(path)
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !g.wanted(path, d.Name()) {
+				return nil
+			}
+			return g.searchFile(path)
+		})
+	} else {
+		// an explicitly given file is searched regardless of the filters
+		root = filepath.Dir(root)
+		g.root = root
+		err = g.searchFile(filepath.Join(root, info.Name()))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to search files: %w", err)
+	}
+
+	return g.result(), nil
+}
+
+func newGrepper(input *GrepInput, root string) (*grepper, error) {
+	expr := input.Pattern
+	if input.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if input.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	mode := input.OutputMode
+	switch mode {
+	case "":
+		mode = grepOutputContent
+	case grepOutputContent, grepOutputFiles, grepOutputCount:
+	default:
+		return nil, fmt.Errorf("unknown output mode %s", mode)
+	}
+
+	g := &grepper{
+		re:       re,
+		root:     root,
+		mode:     mode,
+		context:  min(max(input.Context, 0), grepMaxContext),
+		limit:    grepDefaultLimit,
+		noIgnore: input.NoIgnore,
+		hidden:   input.Hidden,
+	}
+	if input.Limit > 0 {
+		g.limit = min(input.Limit, grepMaxLimit)
+	}
+	if input.Glob != "" {
+		if !doublestar.ValidatePattern(filepath.ToSlash(input.Glob)) {
+			return nil, fmt.Errorf("invalid glob %s", input.Glob)
+		}
+		g.glob = filepath.ToSlash(input.Glob)
+	}
+	if input.Type != "" {
+		patterns, ok := grepTypes[strings.ToLower(input.Type)]
+		if !ok {
+			return nil, fmt.Errorf("unknown file type %s", input.Type)
+		}
+		g.types = patterns
+	}
+	return g, nil
+}
+
+func (g *grepper) skipDir(path, name string) bool {
+	if name == ".git" {
+		return true
+	}
+	if !g.hidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	return !g.noIgnore && g.ignore.ignored(path, true)
+}
+
+// wanted reports whether the file passes the hidden, ignore, glob and type
+// filters.
+func (g *grepper) wanted(path, name string) bool {
+	if !g.hidden && strings.HasPrefix(name, ".") {
+		return false
+	}
+	if !g.noIgnore && g.ignore.ignored(path, false) {
+		return false
+	}
+	if g.types != nil && !matchAny(g.types, name) {
+		return false
+	}
+	if g.glob == "" {
+		return true
+	}
+	target := name
+	if strings.Contains(g.glob, "/") {
+		target = g.rel(path)
+	}
+	ok, _ := doublestar.Match(g.glob, target)
+	return ok
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *grepper) rel(path string) string {
+	rel, err := filepath.Rel(g.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// searchFile searches one file. Binary and very large files are skipped.
+func (g *grepper) searchFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > grepMaxFileSize {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), grepMaxFileSize)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	var matched []int
+	for i, line := range lines {
+		if g.re.MatchString(line) {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	rel := g.rel(path)
+	g.files++
+	g.matches += len(matched)
+	switch g.mode {
+	case grepOutputFiles:
+		g.add(rel)
+	case grepOutputCount:
+		g.add(fmt.Sprintf("%s:%d", rel, len(matched)))
+	default:
+		g.writeContent(rel, lines, matched)
+	}
+	return nil
+}
+
+// add appends one entry of the files or count output.
+func (g *grepper) add(line string) {
+	if g.entries >= g.limit {
+		g.truncated = true
+		return
+	}
+	g.entries++
+	g.out.WriteString(line)
+	g.out.WriteByte('\n')
+}
+
+// writeContent writes the matching lines of a file as path:line:text and the
+// context lines as path-line-text, with -- between separate groups.
+func (g *grepper) writeContent(rel string, lines []string, matched []int) {
+	last := -1 // last written line
+	for n, m := range matched {
+		if g.entries >= g.limit {
+			g.truncated = true
+			return
+		}
+		from := max(m-g.context, last+1)
+		if g.context > 0 && g.out.Len() > 0 && (last < 0 || from > last+1) {
+			g.out.WriteString("--\n")
+		}
+		to := min(m+g.context, len(lines)-1)
+		if n+1 < len(matched) && matched[n+1] <= to {
+			// the next match is written with its own context
+			to = matched[n+1] - 1
+		}
+		for i := from; i <= to; i++ {
+			sep := "-"
+			if i == m {
+				sep = ":"
+			}
+			fmt.Fprintf(&g.out, "%s%s%d%s%s\n", rel, sep, i+1, sep, truncateLine(lines[i]))
+		}
+		last = to
+		g.entries++
+	}
+}
+
+func truncateLine(line string) string {
+	if len(line) <= grepMaxLineLen {
+		return line
+	}
+	return line[:grepMaxLineLen] + "...(truncated)"
+}
+
+func (g *grepper) result() string {
+	if g.files == 0 {
+		return "No matches found"
+	}
+	out := strings.TrimRight(g.out.String(), "\n")
+	if g.truncated {
+		out += fmt.Sprintf("\n\n(results truncated at %d entries, narrow the search with path, glob or type, or raise the limit)", g.limit)
+	} else if g.mode == grepOutputContent {
+		out += fmt.Sprintf("\n\nFound %d matches in %d files", g.matches, g.files)
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeGrepFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGrep(t *testing.T) {
+	dir := writeGrepFiles(t, map[string]string{
+		".gitignore":       "build/\n*.log\n!keep.log\n",
+		"main.go":          "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+		"pkg/util.go":      "package pkg\n\n// Hello says hello\nfunc Hello() {}\n",
+		"pkg/.gitignore":   "generated.go\n",
+		"pkg/generated.go": "package pkg // hello\n",
+		"web/app.ts":       "const hello = 'hello(world)';\n",
+		"build/out.go":     "package build // hello\n",
+		"debug.log":        "hello\n",
+		"keep.log":         "hello\n",
+		".hidden/a.go":     "package hidden // hello\n",
+		"bin.dat":          "hello\x00world\n",
+	})
+	allow := []string{dir}
+
+	tests := []struct {
+		name  string
+		input GrepInput
+		want  []string
+	}{
+		{"files", GrepInput{Pattern: "hello", IgnoreCase: true, OutputMode: grepOutputFiles},
+			[]string{"keep.log", "main.go", "pkg/util.go", "web/app.ts"}},
+		{"type", GrepInput{Pattern: "hello", Type: "go", OutputMode: grepOutputCount},
+			[]string{"main.go:1", "pkg/util.go:1"}},
+		{"glob", GrepInput{Pattern: "hello", Glob: "web/**/*.ts", OutputMode: grepOutputFiles},
+			[]string{"web/app.ts"}},
+		{"literal", GrepInput{Pattern: "hello(world)", Literal: true, OutputMode: grepOutputFiles},
+			[]string{"web/app.ts"}},
+		{"no ignore", GrepInput{Pattern: "hello", Path: filepath.Join(dir, "pkg"), NoIgnore: true, OutputMode: grepOutputFiles},
+			[]string{"generated.go", "util.go"}},
+		{"hidden", GrepInput{Pattern: "hidden", Hidden: true, OutputMode: grepOutputFiles},
+			[]string{".hidden/a.go"}},
+	}
+	for _, tt := range tests {
+		input := tt.input
+		if input.Path == "" {
+			input.Path = dir
+		}
+		out, err := doGrep(t.Context(), allow, &input)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := strings.Split(out, "\n"); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGrepContent(t *testing.T) {
+	dir := writeGrepFiles(t, map[string]string{
+		"a.txt": "one\ntwo match\nthree\nfour\nfive\nsix\nseven match\neight match\nnine\n",
+	})
+
+	out, err := doGrep(t.Context(), []string{dir}, &GrepInput{Pattern: "match", Path: dir, Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"a.txt-1-one",
+		"a.txt:2:two match",
+		"a.txt-3-three",
+		"--",
+		"a.txt-6-six",
+		"a.txt:7:seven match",
+		"a.txt:8:eight match",
+		"a.txt-9-nine",
+		"",
+		"Found 3 matches in 1 files",
+	}, "\n")
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	out, err = doGrep(t.Context(), []string{dir}, &GrepInput{Pattern: "match", Path: filepath.Join(dir, "a.txt"), Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "a.txt:2:two match\na.txt:7:seven match\n\n(results truncated") {
+		t.Errorf("unexpected limited output:\n%s", out)
+	}
+}
+
+func TestGrepOutsideAllowedDirs(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+	if _, err := doGrep(t.Context(), []string{dir}, &GrepInput{Pattern: "x", Path: other}); err == nil {
+		t.Error("expected an error for a path outside the allowed directories")
+	}
+	if _, err := doGrep(t.Context(), []string{dir}, &GrepInput{Pattern: "x", Path: "../../../../etc"}); err == nil {
+		t.Error("expected an error for a relative path escaping the allowed directories")
+	}
+}
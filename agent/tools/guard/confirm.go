@@ -0,0 +1,12 @@
+package guard
+
+// NeedsConfirmation reports whether a shell command should be confirmed by
+// the user before it runs.
+func NeedsConfirmation(command string) bool {
+	for _, p := range ConfirmRequiredPatterns {
+		if p.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
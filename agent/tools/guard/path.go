@@ -57,5 +57,16 @@ func IsPathWriteProtected(path string) bool {
 			return true
 		}
 	}
-	return false
+	return isCheckpointPath(abs)
+}
+
+// isCheckpointPath reports whether path is inside the checkpoints of an
+// agent workspace, e.g. ~/.tokkibot/workspace/checkpoints.
+func isCheckpointPath(path string) bool {
+	rel, err := filepath.Rel(config.GetHomeDir(), path)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	return len(parts) >= 2 && strings.HasPrefix(parts[0], "workspace") && parts[1] == config.CheckpointDirName
 }
@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreRule is one pattern of a .gitignore file.
+type ignoreRule struct {
+	base     string // directory of the .gitignore relative to the matcher root, "" for the root
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the path relative to base instead of the name
+}
+
+// ignoreMatcher applies .gitignore files the way git does: later rules win,
+// and rules of a .gitignore only apply below its directory.
+type ignoreMatcher struct {
+	root  string // root of the repository, or of the search outside repositories
+	rules []ignoreRule
+}
+
+// newIgnoreMatcher returns a matcher for a search in dir. Inside a git
+// repository the .gitignore files between the repository root and dir are
+// loaded as well.
+func newIgnoreMatcher(dir string) *ignoreMatcher {
+	root := findRepoRoot(dir)
+	if root == "" {
+		root = dir
+	}
+	m := &ignoreMatcher{root: root}
+	m.load(filepath.Join(root, ".git", "info", "exclude"), "")
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return m
+	}
+	cur := root
+	m.loadDir(cur)
+	if rel != "." {
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			cur = filepath.Join(cur, part)
+			m.loadDir(cur)
+		}
+	}
+	return m
+}
+
+// findRepoRoot returns the closest ancestor of dir containing .git.
+func findRepoRoot(dir string) string {
+	for cur := dir; ; {
+		if _, err := os.Stat(filepath.Join(cur, ".git")); err == nil {
+			return cur
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return ""
+		}
+		cur = parent
+	}
+}
+
+// loadDir loads the .gitignore of dir.
+func (m *ignoreMatcher) loadDir(dir string) {
+	base, err := filepath.Rel(m.root, dir)
+	if err != nil {
+		return
+	}
+	if base == "." {
+		base = ""
+	}
+	m.load(filepath.Join(dir, ".gitignore"), filepath.ToSlash(base))
+}
+
+func (m *ignoreMatcher) load(path, base string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		m.rules = append(m.rules, rule)
+	}
+}
+
+// ignored reports whether the file or directory at path is ignored.
+func (m *ignoreMatcher) ignored(path string, isDir bool) bool {
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if rule.base != "" {
+			var ok bool
+			if sub, ok = strings.CutPrefix(rel, rule.base+"/"); !ok {
+				continue
+			}
+		}
+		target := sub
+		if !rule.anchored {
+			target = sub[strings.LastIndexByte(sub, '/')+1:]
+		}
+		if ok, _ := doublestar.Match(rule.pattern, target); ok {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const devNull = "/dev/null"
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// filePatch is the part of a unified diff changing one file.
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []*patchHunk
+}
+
+type patchHunk struct {
+	// oldStart is the first line of the hunk in the old file, 0 if the hunk
+	// header has no line numbers
+	oldStart int
+	ops      []diffOp
+}
+
+func (p *filePatch) isCreate() bool { return p.oldPath == devNull }
+
+func (p *filePatch) isDelete() bool { return p.newPath == devNull }
+
+func (p *filePatch) path() string {
+	if p.isDelete() {
+		return p.oldPath
+	}
+	return p.newPath
+}
+
+// parsePatchPath strips the a/ or b/ prefix and a trailing timestamp.
+func parsePatchPath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	s = strings.TrimSpace(s)
+	if s == devNull {
+		return s
+	}
+	for _, prefix := range []string{"a/", "b/"} {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			return rest
+		}
+	}
+	return s
+}
+
+// parsePatch parses a unified diff. Hunk line counts are not trusted since
+// they are often wrong in generated patches, a hunk ends at the next hunk or
+// file header instead.
+func parsePatch(patch string) ([]*filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+
+	var (
+		patches []*filePatch
+		cur     *filePatch
+		hunk    *patchHunk
+		// number of trailing bare empty lines in the hunk, dropped when the
+		// hunk ends as they are usually separators
+		bare int
+	)
+	endHunk := func() {
+		if hunk != nil {
+			hunk.ops = hunk.ops[:len(hunk.ops)-bare]
+			cur.hunks = append(cur.hunks, hunk)
+		}
+		hunk, bare = nil, 0
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			endHunk()
+			cur = &filePatch{
+				oldPath: parsePatchPath(line[4:]),
+				newPath: parsePatchPath(lines[i+1][4:]),
+			}
+			patches = append(patches, cur)
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("hunk at line %d has no ---/+++ file header", i+1)
+			}
+			endHunk()
+			hunk = &patchHunk{}
+			if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+				hunk.oldStart, _ = strconv.Atoi(m[1])
+			}
+		case hunk != nil && line == "":
+			hunk.ops = append(hunk.ops, diffOp{' ', ""})
+			bare++
+		case hunk != nil && (line[0] == ' ' || line[0] == '-' || line[0] == '+'):
+			hunk.ops = append(hunk.ops, diffOp{line[0], line[1:]})
+			bare = 0
+		case hunk != nil && line[0] == '\\':
+			// "\ No newline at end of file"
+		default:
+			// git headers like "diff --git" or "index" and other text
+			endHunk()
+		}
+	}
+	endHunk()
+
+	if len(patches) == 0 {
+		return nil, errors.New("no file changes found in patch, expected ---/+++ file headers")
+	}
+	for _, p := range patches {
+		if p.path() == devNull || p.path() == "" {
+			return nil, errors.New("patch has a file without a path")
+		}
+		if len(p.hunks) == 0 && !p.isDelete() {
+			return nil, fmt.Errorf("patch for %s has no hunks", p.path())
+		}
+	}
+	return patches, nil
+}
+
+// PatchPaths returns the paths of the files changed by a unified diff.
+func PatchPaths(patch string) []string {
+	patches, _ := parsePatch(patch)
+	paths := make([]string, 0, len(patches))
+	for _, p := range patches {
+		paths = append(paths, p.path())
+	}
+	return paths
+}
+
+// apply applies the hunks to content. A hunk is searched for close to its
+// stated line first, so patches against slightly different versions of a
+// file still apply.
+func (p *filePatch) apply(content string) (string, error) {
+	if p.isDelete() {
+		return "", nil
+	}
+	lines := splitLines(content)
+
+	offset := 0 // lines added minus lines removed by previous hunks
+	minPos := 0 // hunks apply in order and must not overlap
+	for n, h := range p.hunks {
+		var old, repl []string
+		for _, op := range h.ops {
+			if op.kind != '+' {
+				old = append(old, op.text)
+			}
+			if op.kind != '-' {
+				repl = append(repl, op.text)
+			}
+		}
+
+		want := minPos
+		if h.oldStart > 0 {
+			want = max(h.oldStart-1+offset, minPos)
+			if len(old) == 0 {
+				// pure insertion after line oldStart
+				want = max(h.oldStart+offset, minPos)
+			}
+		}
+		pos := findLines(lines, old, want, minPos)
+		if pos < 0 {
+			return "", fmt.Errorf("hunk %d does not match the file content, read the file again and regenerate the patch", n+1)
+		}
+
+		lines = append(lines[:pos], append(repl, lines[pos+len(old):]...)...)
+		offset += len(repl) - len(old)
+		minPos = pos + len(repl)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// findLines returns the position of needle in lines closest to want and not
+// before minPos, -1 if not found. Lines which differ only in trailing white
+// space match as well.
+func findLines(lines, needle []string, want, minPos int) int {
+	if len(needle) == 0 {
+		return min(want, len(lines))
+	}
+	for _, trim := range []bool{false, true} {
+		for d := 0; ; d++ {
+			before, after := want-d, want+d
+			if before < minPos && after > len(lines)-len(needle) {
+				break
+			}
+			if after <= len(lines)-len(needle) && matchLines(lines[after:], needle, trim) {
+				return after
+			}
+			if d > 0 && before >= minPos && before <= len(lines)-len(needle) && matchLines(lines[before:], needle, trim) {
+				return before
+			}
+		}
+	}
+	return -1
+}
+
+func matchLines(lines, needle []string, trim bool) bool {
+	for i := range needle {
+		a, b := lines[i], needle[i]
+		if trim {
+			a, b = strings.TrimRight(a, " \t"), strings.TrimRight(b, " \t")
+		}
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
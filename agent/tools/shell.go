@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ryanreadbooks/tokkibot/agent/tools/description"
@@ -20,20 +22,20 @@ import (
 const (
 	maxAllowedShellOutputLen = 15000
 	shellExecTimeout         = 60 * time.Second
+	// partial output of a running command is reported at most so often
+	shellStreamInterval = 500 * time.Millisecond
 )
 
 type shellResultTag string
 
 const (
-	shellBlockedTag       shellResultTag = "<shell_blocked>"
-	shellRunErrTag        shellResultTag = "<shell_run_error>"
-	shellSandboxErrTag    shellResultTag = "<shell_sandbox_error>"
-	shellConfirmNeededTag shellResultTag = "<shell_confirm_needed>"
+	shellBlockedTag    shellResultTag = "<shell_blocked>"
+	shellRunErrTag     shellResultTag = "<shell_run_error>"
+	shellSandboxErrTag shellResultTag = "<shell_sandbox_error>"
 )
 
 var (
 	errDangerousCommand = errors.New("dangerous command blocked")
-	errConfirmNeeded    = errors.New("command requires user confirmation")
 )
 
 // ConfirmationRequiredError indicates a command needs user confirmation
@@ -47,18 +49,179 @@ func wrapShellError(err error, errTag shellResultTag) error {
 
 // shell command input
 type ShellInput struct {
-	Command    string `json:"command"               jsonschema:"description=The command to execute along with its arguments"`
-	WorkingDir string `json:"working_dir,omitempty" jsonschema:"description=The working directory to execute the command in"`
+	Command         string `json:"command"                     jsonschema:"description=The command to execute along with its arguments"`
+	WorkingDir      string `json:"working_dir,omitempty"       jsonschema:"description=The working directory to execute the command in"`
+	Timeout         int    `json:"timeout,omitempty"           jsonschema:"description=Timeout in seconds. Defaults to the configured timeout and is capped by the configured maximum"`
+	RunInBackground bool   `json:"run_in_background,omitempty" jsonschema:"description=Start the command in the background and return a job id at once. Use shell_output to read its output and shell_kill to stop it"`
+	Reset           bool   `json:"reset,omitempty"             jsonschema:"description=Start a new shell session before running the command, dropping the working directory and environment set by earlier commands. The command may be empty to only reset"`
 }
 
-// checkCommandNeedsConfirmation checks if command requires user confirmation
-func checkCommandNeedsConfirmation(command string) bool {
-	for _, p := range guard.ConfirmRequiredPatterns {
-		if p.MatchString(command) {
-			return true
+type shellOptions struct {
+	timeout    time.Duration
+	maxTimeout time.Duration
+	jobs       *ShellJobs
+	sessions   *ShellSessions
+}
+
+type ShellOption func(*shellOptions)
+
+// WithShellTimeout sets the timeout of commands which do not set one and the
+// longest timeout a command may set.
+func WithShellTimeout(timeout, maxTimeout time.Duration) ShellOption {
+	return func(o *shellOptions) {
+		o.timeout = timeout
+		o.maxTimeout = max(maxTimeout, timeout)
+	}
+}
+
+// WithShellJobs enables running commands in the background.
+func WithShellJobs(jobs *ShellJobs) ShellOption {
+	return func(o *shellOptions) {
+		o.jobs = jobs
+	}
+}
+
+// WithShellSessions runs commands in a shell kept per chat instead of a new
+// shell for every command.
+func WithShellSessions(sessions *ShellSessions) ShellOption {
+	return func(o *shellOptions) {
+		o.sessions = sessions
+	}
+}
+
+// run runs the command in the shell session of the chat if enabled. It
+// fails like sandbox.Sandbox.Run.
+func (o *shellOptions) run(ctx context.Context, sb sandbox.Sandbox, meta tool.InvokeMeta, command string, out io.Writer) error {
+	if o.sessions == nil {
+		return sb.Run(ctx, command, out)
+	}
+	res, err := o.sessions.get(shellJobSession(meta)).run(ctx, command, out)
+	switch {
+	case errors.Is(err, errShellSessionExited):
+		return &sandbox.CommandError{ExitCode: res.exitCode, Err: err}
+	case err != nil:
+		return err
+	case res.exitCode != 0:
+		return &sandbox.CommandError{ExitCode: res.exitCode, Err: fmt.Errorf("exit status %d", res.exitCode)}
+	}
+	return nil
+}
+
+// sessionDir returns the working directory of the shell session of the chat.
+func (o *shellOptions) sessionDir(meta tool.InvokeMeta) string {
+	if o.sessions == nil {
+		return ""
+	}
+	return o.sessions.cwd(shellJobSession(meta))
+}
+
+// commandTimeout returns the timeout of a command asking for seconds.
+func (o *shellOptions) commandTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return o.timeout
+	}
+	return min(time.Duration(seconds)*time.Second, o.maxTimeout)
+}
+
+// ShellOutputReporter receives the output of a running shell command as it
+// is produced, e.g. to show it to the user. done is set with the last part.
+type ShellOutputReporter func(output string, done bool)
+
+type shellOutputReporterKey struct{}
+
+// WithShellOutputReporter injects a ShellOutputReporter into the context of
+// tool calls. Reporters already in the context still receive the output.
+func WithShellOutputReporter(ctx context.Context, r ShellOutputReporter) context.Context {
+	if prev, ok := ctx.Value(shellOutputReporterKey{}).(ShellOutputReporter); ok && prev != nil {
+		next := r
+		r = func(output string, done bool) {
+			next(output, done)
+			prev(output, done)
 		}
 	}
-	return false
+	return context.WithValue(ctx, shellOutputReporterKey{}, r)
+}
+
+// outputStreamer passes the output written to it to a ShellOutputReporter
+// every shellStreamInterval.
+type outputStreamer struct {
+	report ShellOutputReporter
+
+	mu      sync.Mutex
+	pending []byte
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newOutputStreamer returns nil if there is no reporter in the context.
+func newOutputStreamer(ctx context.Context) *outputStreamer {
+	r, ok := ctx.Value(shellOutputReporterKey{}).(ShellOutputReporter)
+	if !ok || r == nil {
+		return nil
+	}
+	s := &outputStreamer{report: r, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(shellStreamInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.flush(false)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *outputStreamer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, p...)
+	// a slow reader only gets the latest output
+	if over := len(s.pending) - maxAllowedShellOutputLen; over > 0 {
+		s.pending = s.pending[over:]
+	}
+	return len(p), nil
+}
+
+func (s *outputStreamer) flush(done bool) {
+	s.mu.Lock()
+	output := string(s.pending)
+	s.pending = s.pending[:0]
+	s.mu.Unlock()
+	if output != "" || done {
+		s.report(output, done)
+	}
+}
+
+// Close reports the rest of the output.
+func (s *outputStreamer) Close() {
+	close(s.stop)
+	<-s.done
+	s.flush(true)
+}
+
+// lockedBuffer collects the output written by stdout and stderr of a
+// command at the same time.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
 }
 
 // checkCommandBlocked checks if command is completely blocked
@@ -127,8 +290,17 @@ func filterHTMLContent(content string) string {
 	return strings.TrimSpace(result)
 }
 
-func doShellInvoke(sb sandbox.Sandbox) func(ctx context.Context, meta tool.InvokeMeta, input *ShellInput) (string, error) {
+func doShellInvoke(sb sandbox.Sandbox, opts *shellOptions) func(ctx context.Context, meta tool.InvokeMeta, input *ShellInput) (string, error) {
 	return func(ctx context.Context, meta tool.InvokeMeta, input *ShellInput) (string, error) {
+		// sandboxes may keep a container per chat
+		ctx = sandbox.WithScope(ctx, shellJobSession(meta))
+		if input.Reset && opts.sessions != nil {
+			opts.sessions.reset(shellJobSession(meta))
+			if strings.TrimSpace(input.Command) == "" {
+				return "Shell session reset", nil
+			}
+		}
+
 		if strings.TrimSpace(input.Command) == "" {
 			return "", wrapShellError(errors.New("empty command"), shellRunErrTag)
 		}
@@ -140,15 +312,49 @@ func doShellInvoke(sb sandbox.Sandbox) func(ctx context.Context, meta tool.Invok
 		command := input.Command
 		if input.WorkingDir != "" {
 			cleanWd, _ := guard.ResolvePath(input.WorkingDir, []string{})
-			command = fmt.Sprintf("cd '%s' && %s", cleanWd, command)
+			command = fmt.Sprintf("cd %s && %s", shellQuote(cleanWd), command)
+		}
+
+		if input.RunInBackground {
+			// background jobs start where the shell session is
+			if dir := opts.sessionDir(meta); dir != "" && input.WorkingDir == "" {
+				command = fmt.Sprintf("cd %s && %s", shellQuote(dir), command)
+			}
+			if opts.jobs == nil {
+				return "", wrapShellError(errors.New("running commands in the background is not supported"), shellRunErrTag)
+			}
+			// background jobs run up to the maximum unless they set a timeout
+			timeout := opts.maxTimeout
+			if input.Timeout > 0 {
+				timeout = opts.commandTimeout(input.Timeout)
+			}
+			job, err := opts.jobs.start(ctx, sb, shellJobSession(meta), input.Command, command, timeout)
+			if err != nil {
+				return "", wrapShellError(err, shellRunErrTag)
+			}
+			slog.InfoContext(ctx, "[tool/shell] command started in background",
+				slog.String("job_id", job.id),
+				slog.String("command", input.Command))
+			return fmt.Sprintf("Command started in the background as job %s. Use shell_output to read its output and shell_kill to stop it.", job.id), nil
 		}
 
-		ctx, cancel := context.WithTimeout(ctx, shellExecTimeout)
+		timeout := opts.commandTimeout(input.Timeout)
+		runCtx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 
+		var (
+			output lockedBuffer
+			out    io.Writer = &output
+		)
+		if streamer := newOutputStreamer(ctx); streamer != nil {
+			defer streamer.Close()
+			out = io.MultiWriter(&output, streamer)
+		}
+
 		startTime := time.Now()
-		outputStr, err := sb.Execute(ctx, command)
+		err := opts.run(runCtx, sb, meta, command, out)
 		duration := time.Since(startTime).Milliseconds()
+		outputStr := output.String()
 
 		if err != nil {
 			slog.WarnContext(ctx, "[tool/shell] command failed",
@@ -158,7 +364,20 @@ func doShellInvoke(sb sandbox.Sandbox) func(ctx context.Context, meta tool.Invok
 			if sandbox.IsSandboxError(err) {
 				return "", wrapShellError(err, shellSandboxErrTag)
 			}
+			if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+				note := ""
+				if opts.sessions != nil {
+					note = " The shell session was restarted, the working directory and environment were reset."
+				}
+				err = fmt.Errorf("command timed out after %s, set a longer timeout or run it in the background.%s Output: %s",
+					timeout, note, truncateShellOutput(outputStr))
+				return "", wrapShellError(err, shellRunErrTag)
+			}
 			if ce, ok := err.(*sandbox.CommandError); ok {
+				ce.Output = outputStr
+				if errors.Is(err, errShellSessionExited) {
+					ce.Output += "\n(the shell session exited, the next command starts a new one)"
+				}
 				return ce.Output, wrapShellError(err, shellRunErrTag)
 			}
 			return "", wrapShellError(err, shellRunErrTag)
@@ -168,13 +387,16 @@ func doShellInvoke(sb sandbox.Sandbox) func(ctx context.Context, meta tool.Invok
 			outputStr = filterHTMLContent(outputStr)
 		}
 
-		if len(outputStr) > maxAllowedShellOutputLen {
-			more := len(outputStr) - maxAllowedShellOutputLen
-			outputStr = outputStr[:maxAllowedShellOutputLen] + fmt.Sprintf("\n... (truncated, %d more chars)", more)
-		}
+		return truncateShellOutput(outputStr), nil
+	}
+}
 
-		return outputStr, nil
+func truncateShellOutput(output string) string {
+	if len(output) > maxAllowedShellOutputLen {
+		more := len(output) - maxAllowedShellOutputLen
+		output = output[:maxAllowedShellOutputLen] + fmt.Sprintf("\n... (truncated, %d more chars)", more)
 	}
+	return output
 }
 
 func beforeDoShellInvoke(ctx context.Context, meta tool.InvokeMeta, input *ShellInput) error {
@@ -185,50 +407,21 @@ func beforeDoShellInvoke(ctx context.Context, meta tool.InvokeMeta, input *Shell
 		return wrapShellError(errDangerousCommand, shellBlockedTag)
 	}
 
-	// Check if command needs user confirmation
-	if checkCommandNeedsConfirmation(input.Command) {
-		slog.InfoContext(ctx, "[tool/shell] command requires confirmation", slog.String("command", input.Command))
-		confirmer, ok := tool.GetConfirmer(ctx)
-		if !ok {
-			slog.WarnContext(ctx, "[tool/shell] no confirmer available, rejecting command")
-			return wrapShellError(errConfirmNeeded, shellConfirmNeededTag)
-		}
-
-		resp, err := confirmer.RequestConfirm(ctx, &tool.ConfirmRequest{
-			Channel:     meta.Channel,
-			ChatId:      meta.ChatId,
-			ToolName:    ToolNameShell,
-			Level:       tool.ConfirmNormal,
-			Title:       "Confirm Command Execution",
-			Description: "This command may modify system state. Please confirm to proceed.",
-			Command:     input.Command,
-		})
-		if err != nil {
-			slog.ErrorContext(ctx, "[tool/shell] confirmation request failed", slog.Any("error", err))
-			return wrapShellError(fmt.Errorf("confirmation failed: %w", err), shellConfirmNeededTag)
-		}
-
-		if !resp.Confirmed {
-			reason := "user rejected"
-			if resp.Reason != "" {
-				reason = resp.Reason
-			}
-			slog.InfoContext(ctx, "[tool/shell] command rejected by user", slog.String("reason", reason))
-			return wrapShellError(fmt.Errorf("command rejected: %s", reason), shellConfirmNeededTag)
-		}
-		slog.InfoContext(ctx, "[tool/shell] command confirmed by user")
-	}
-
 	return nil
 }
 
 // Tool to execute a command under the optional given working directory.
 // All commands are executed inside the given sandbox for isolation.
-func Shell(sb sandbox.Sandbox) tool.Invoker {
+func Shell(sb sandbox.Sandbox, opts ...ShellOption) tool.Invoker {
 	info := tool.Info{
 		Name:        ToolNameShell,
 		Description: fmt.Sprintf(description.ShellDescription, pkgos.GetSystemDistro()),
 	}
 
-	return tool.NewInvoker(info, doShellInvoke(sb), tool.WithBeforeInvoke(beforeDoShellInvoke))
+	o := &shellOptions{timeout: shellExecTimeout, maxTimeout: shellExecTimeout}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return tool.NewInvoker(info, doShellInvoke(sb, o), tool.WithBeforeInvoke(beforeDoShellInvoke))
 }
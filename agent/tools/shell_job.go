@@ -0,0 +1,321 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools/description"
+	"github.com/ryanreadbooks/tokkibot/component/sandbox"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+const (
+	// output of a background job is kept up to so many bytes, older output
+	// is dropped
+	maxShellJobOutputLen = 1 << 20
+	// finished jobs are forgotten when there are more jobs
+	maxShellJobs = 20
+	// longest wait of shell_output for a job to finish
+	maxShellJobWait = 10 * time.Minute
+	// how long shell_kill waits for a killed job to exit
+	shellJobKillWait = 5 * time.Second
+)
+
+// jobOutput keeps the latest output of a job.
+type jobOutput struct {
+	mu    sync.Mutex
+	buf   []byte
+	total int // bytes written so far
+}
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, p...)
+	o.total += len(p)
+	if over := len(o.buf) - maxShellJobOutputLen; over > 0 {
+		o.buf = append(o.buf[:0], o.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// since returns the output written after offset, the offset to read from
+// next time and how many bytes after offset were already dropped.
+func (o *jobOutput) since(offset int) (output string, next, dropped int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	first := o.total - len(o.buf)
+	if offset < first {
+		dropped = first - offset
+		offset = first
+	}
+	return string(o.buf[offset-first:]), o.total, dropped
+}
+
+type shellJob struct {
+	id      string
+	session string
+	command string
+	started time.Time
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	output jobOutput
+	read   int // output before this offset was returned by shell_output
+
+	done   chan struct{}
+	err    error // why the command failed, set before done is closed
+	ended  time.Time
+	killed bool
+}
+
+func (j *shellJob) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// status describes the state of the job.
+func (j *shellJob) status() string {
+	if j.running() {
+		return fmt.Sprintf("running for %s", time.Since(j.started).Round(time.Second))
+	}
+	return j.exitStatus()
+}
+
+// exitStatus describes how the job ended.
+func (j *shellJob) exitStatus() string {
+	took := j.ended.Sub(j.started).Round(time.Second)
+	var ce *sandbox.CommandError
+	switch {
+	case j.killed:
+		return fmt.Sprintf("killed after %s", took)
+	case j.err == nil:
+		return fmt.Sprintf("exited with code 0 after %s", took)
+	case took >= j.timeout:
+		return fmt.Sprintf("timed out after %s", took)
+	case errors.As(j.err, &ce):
+		return fmt.Sprintf("exited with code %d after %s", ce.ExitCode, took)
+	default:
+		return fmt.Sprintf("failed after %s: %v", took, j.err)
+	}
+}
+
+// readNew returns the output not returned before.
+func (j *shellJob) readNew() string {
+	output, next, dropped := j.output.since(j.read)
+	j.read = next
+	if len(output) > maxAllowedShellOutputLen {
+		dropped += len(output) - maxAllowedShellOutputLen
+		output = output[len(output)-maxAllowedShellOutputLen:]
+	}
+	if dropped > 0 {
+		output = fmt.Sprintf("... (%d earlier chars omitted)\n", dropped) + output
+	}
+	return output
+}
+
+// ShellJobs keeps the commands run in the background by the shell tool.
+// Jobs are only visible to the chat which started them.
+type ShellJobs struct {
+	maxRunning int
+
+	mu   sync.Mutex
+	seq  int
+	jobs []*shellJob
+}
+
+// NewShellJobs returns jobs which run at most maxRunning commands at once.
+func NewShellJobs(maxRunning int) *ShellJobs {
+	return &ShellJobs{maxRunning: maxRunning}
+}
+
+func shellJobSession(meta tool.InvokeMeta) string {
+	return meta.Channel + ":" + meta.ChatId
+}
+
+// start runs the command in the background until it exits, is killed or
+// the timeout passes.
+func (s *ShellJobs) start(
+	ctx context.Context,
+	sb sandbox.Sandbox,
+	session, display, command string,
+	timeout time.Duration,
+) (*shellJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := 0
+	for _, j := range s.jobs {
+		if j.running() {
+			running++
+		}
+	}
+	if running >= s.maxRunning {
+		return nil, fmt.Errorf("%d background jobs are running already, wait for them or stop one with shell_kill", running)
+	}
+
+	// the job outlives the tool call
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	s.seq++
+	job := &shellJob{
+		id:      fmt.Sprintf("job_%d", s.seq),
+		session: session,
+		command: display,
+		started: time.Now(),
+		timeout: timeout,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	s.jobs = append(s.jobs, job)
+	s.forgetFinished()
+
+	go func() {
+		defer cancel()
+		err := sb.Run(jobCtx, command, &job.output)
+		s.mu.Lock()
+		job.err = err
+		job.ended = time.Now()
+		status := job.exitStatus()
+		s.mu.Unlock()
+		close(job.done)
+		slog.InfoContext(jobCtx, "[tool/shell] background job finished",
+			slog.String("job_id", job.id),
+			slog.String("status", status))
+	}()
+
+	return job, nil
+}
+
+// forgetFinished drops the oldest finished jobs when there are too many.
+func (s *ShellJobs) forgetFinished() {
+	for i := 0; len(s.jobs) > maxShellJobs && i < len(s.jobs); {
+		if s.jobs[i].running() {
+			i++
+			continue
+		}
+		s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+	}
+}
+
+func (s *ShellJobs) get(session, id string) (*shellJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.id == id && j.session == session {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("job %s not found", id)
+}
+
+func (s *ShellJobs) list(session string) []*shellJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []*shellJob
+	for _, j := range s.jobs {
+		if j.session == session {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+// report formats the state and the new output of the job.
+func (s *ShellJobs) report(job *shellJob) string {
+	s.mu.Lock()
+	status := job.status()
+	output := job.readNew()
+	s.mu.Unlock()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Job %s %s: %s\n", job.id, status, job.command)
+	if output == "" {
+		sb.WriteString("(no new output)")
+	} else {
+		sb.WriteString(output)
+	}
+	return sb.String()
+}
+
+type ShellOutputInput struct {
+	JobId string `json:"job_id,omitempty" jsonschema:"description=The id of the background job. Lists all jobs if empty"`
+	Wait  int    `json:"wait,omitempty"   jsonschema:"description=Seconds to wait for the job to finish before returning. Returns at once if 0"`
+}
+
+// ShellOutput tool to read the output of background jobs.
+func ShellOutput(jobs *ShellJobs) tool.Invoker {
+	return tool.NewInvoker(tool.Info{
+		Name:        ToolNameShellOutput,
+		Description: description.ShellOutputDescription,
+	}, func(ctx context.Context, meta tool.InvokeMeta, input *ShellOutputInput) (string, error) {
+		session := shellJobSession(meta)
+		if input.JobId == "" {
+			list := jobs.list(session)
+			if len(list) == 0 {
+				return "No background jobs", nil
+			}
+			var sb strings.Builder
+			jobs.mu.Lock()
+			for _, j := range list {
+				fmt.Fprintf(&sb, "%s %s: %s\n", j.id, j.status(), j.command)
+			}
+			jobs.mu.Unlock()
+			return sb.String(), nil
+		}
+
+		job, err := jobs.get(session, input.JobId)
+		if err != nil {
+			return "", err
+		}
+		if input.Wait > 0 {
+			timer := time.NewTimer(min(time.Duration(input.Wait)*time.Second, maxShellJobWait))
+			defer timer.Stop()
+			select {
+			case <-job.done:
+			case <-timer.C:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		return jobs.report(job), nil
+	})
+}
+
+type ShellKillInput struct {
+	JobId string `json:"job_id" jsonschema:"description=The id of the background job to stop"`
+}
+
+// ShellKill tool to stop a background job.
+func ShellKill(jobs *ShellJobs) tool.Invoker {
+	return tool.NewInvoker(tool.Info{
+		Name:        ToolNameShellKill,
+		Description: description.ShellKillDescription,
+	}, func(ctx context.Context, meta tool.InvokeMeta, input *ShellKillInput) (string, error) {
+		job, err := jobs.get(shellJobSession(meta), input.JobId)
+		if err != nil {
+			return "", err
+		}
+		if job.running() {
+			jobs.mu.Lock()
+			job.killed = true
+			jobs.mu.Unlock()
+			job.cancel()
+			select {
+			case <-job.done:
+			case <-time.After(shellJobKillWait):
+				return "", fmt.Errorf("job %s did not exit after being killed", job.id)
+			}
+			slog.InfoContext(ctx, "[tool/shell] background job killed", slog.String("job_id", job.id))
+		}
+		return jobs.report(job), nil
+	})
+}
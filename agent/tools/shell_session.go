@@ -0,0 +1,318 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/component/sandbox"
+)
+
+// sessions not used for so long are closed
+const shellSessionIdle = 30 * time.Minute
+
+var errShellSessionExited = errors.New("shell session exited")
+
+// ShellSessions keeps a shell per chat so that the working directory and
+// the environment carry over between calls of the shell tool.
+type ShellSessions struct {
+	sb sandbox.Sandbox
+
+	mu       sync.Mutex
+	sessions map[string]*shellSession
+}
+
+func NewShellSessions(sb sandbox.Sandbox) *ShellSessions {
+	return &ShellSessions{sb: sb, sessions: make(map[string]*shellSession)}
+}
+
+// Reset closes the shell of the chat, the next command starts a new one.
+func (s *ShellSessions) Reset(channel, chatId string) {
+	s.reset(channel + ":" + chatId)
+}
+
+// Close closes the shells of all chats.
+func (s *ShellSessions) Close() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[string]*shellSession)
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		sess.close()
+	}
+}
+
+func (s *ShellSessions) reset(key string) {
+	s.mu.Lock()
+	sess := s.sessions[key]
+	delete(s.sessions, key)
+	s.mu.Unlock()
+	if sess != nil {
+		sess.close()
+	}
+}
+
+// get returns the session of the chat and closes sessions which were not
+// used for a while.
+func (s *ShellSessions) get(key string) *shellSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, sess := range s.sessions {
+		if k != key && sess.idleSince(shellSessionIdle) {
+			delete(s.sessions, k)
+			go sess.close()
+		}
+	}
+	sess, ok := s.sessions[key]
+	if !ok {
+		sess = &shellSession{sb: s.sb}
+		s.sessions[key] = sess
+	}
+	return sess
+}
+
+// cwd returns the working directory of the shell of the chat, empty if it
+// has none.
+func (s *ShellSessions) cwd(key string) string {
+	s.mu.Lock()
+	sess := s.sessions[key]
+	s.mu.Unlock()
+	if sess == nil {
+		return ""
+	}
+	sess.stateMu.Lock()
+	defer sess.stateMu.Unlock()
+	return sess.dir
+}
+
+// shellSessionResult is the result of a command run in a shell session.
+type shellSessionResult struct {
+	exitCode int
+	dir      string
+}
+
+// shellSession is a shell reading commands from its stdin. After each
+// command it prints a marker line with the exit code and the working
+// directory, the output before the marker is the output of the command.
+type shellSession struct {
+	sb sandbox.Sandbox
+
+	mu sync.Mutex // one command at a time
+
+	proc    *sandbox.Process
+	stdin   *os.File
+	marker  string
+	results chan shellSessionResult
+	exited  chan struct{}
+	exitErr error
+
+	stateMu  sync.Mutex
+	out      io.Writer // output of the running command
+	pending  []byte    // output which may be the start of the marker
+	dir      string
+	busy     bool
+	lastUsed time.Time
+}
+
+func (s *shellSession) idleSince(d time.Duration) bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return !s.busy && time.Since(s.lastUsed) > d
+}
+
+func (s *shellSession) alive() bool {
+	if s.proc == nil {
+		return false
+	}
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// start starts the shell. It runs until it is closed, not bound to the
+// command which started it.
+func (s *shellSession) start(ctx context.Context) error {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	s.marker = "__tokkibot_done_" + hex.EncodeToString(nonce)
+	s.results = make(chan shellSessionResult, 1)
+	s.exited = make(chan struct{})
+	s.pending = nil
+
+	// stdin is a file so that waiting for the shell does not wait for
+	// stdin to be closed
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create shell stdin: %w", err)
+	}
+	proc, err := s.sb.Start(context.WithoutCancel(ctx), "exec sh", stdinR, s)
+	stdinR.Close()
+	if err != nil {
+		stdinW.Close()
+		return err
+	}
+	s.proc = proc
+	s.stdin = stdinW
+
+	exited := s.exited
+	go func() {
+		err := proc.Wait()
+		s.stateMu.Lock()
+		// the output after the last marker
+		if s.out != nil && len(s.pending) > 0 {
+			s.out.Write(s.pending)
+		}
+		s.pending = nil
+		s.stateMu.Unlock()
+		s.exitErr = err
+		stdinW.Close()
+		close(exited)
+	}()
+
+	slog.DebugContext(ctx, "[tool/shell] shell session started")
+	return nil
+}
+
+// close kills the shell.
+func (s *shellSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kill()
+}
+
+func (s *shellSession) kill() {
+	if !s.alive() {
+		return
+	}
+	s.proc.Kill()
+	<-s.exited
+}
+
+// Write receives the output of the shell and passes it on to the running
+// command until the marker.
+func (s *shellSession) Write(p []byte) (int, error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	s.pending = append(s.pending, p...)
+	for {
+		prefix := "\n" + s.marker + " "
+		idx := bytes.Index(s.pending, []byte(prefix))
+		if idx < 0 {
+			// keep what may be the start of the marker
+			keep := min(len(s.pending), len(prefix)-1)
+			tail := s.pending[len(s.pending)-keep:]
+			if i := bytes.LastIndexByte(tail, '\n'); i >= 0 && strings.HasPrefix(prefix, string(tail[i:])) {
+				keep -= i
+			} else {
+				keep = 0
+			}
+			s.emit(s.pending[:len(s.pending)-keep])
+			s.pending = append(s.pending[:0], s.pending[len(s.pending)-keep:]...)
+			return len(p), nil
+		}
+
+		end := bytes.IndexByte(s.pending[idx+len(prefix):], '\n')
+		if end < 0 {
+			// the marker line is incomplete
+			s.emit(s.pending[:idx])
+			s.pending = append(s.pending[:0], s.pending[idx:]...)
+			return len(p), nil
+		}
+		s.emit(s.pending[:idx])
+		line := string(s.pending[idx+len(prefix) : idx+len(prefix)+end])
+		s.pending = append(s.pending[:0], s.pending[idx+len(prefix)+end+1:]...)
+
+		code, dir, _ := strings.Cut(line, " ")
+		exitCode, _ := strconv.Atoi(code)
+		select {
+		case s.results <- shellSessionResult{exitCode: exitCode, dir: dir}:
+		default:
+		}
+	}
+}
+
+func (s *shellSession) emit(p []byte) {
+	if s.out != nil && len(p) > 0 {
+		s.out.Write(p)
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// run runs the command in the shell, starting it if needed. The shell is
+// killed if the command does not finish before ctx is done.
+func (s *shellSession) run(ctx context.Context, command string, out io.Writer) (shellSessionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.alive() {
+		if err := s.start(ctx); err != nil {
+			return shellSessionResult{}, err
+		}
+	}
+
+	s.stateMu.Lock()
+	s.out = out
+	s.busy = true
+	s.stateMu.Unlock()
+	defer func() {
+		s.stateMu.Lock()
+		s.out = nil
+		s.busy = false
+		s.lastUsed = time.Now()
+		s.stateMu.Unlock()
+	}()
+
+	// a syntax error would make sh exit, so the command is checked first.
+	// It reads from /dev/null as the shell reads the next commands from stdin
+	s.proc.ResetLimits()
+	quoted := shellQuote(command)
+	script := fmt.Sprintf("if __tokkibot_err=$(sh -n -c %[1]s 2>&1); then eval %[1]s </dev/null; "+
+		"else printf '%%s\\n' \"$__tokkibot_err\"; (exit 2); fi\n"+
+		"__tokkibot_ec=$?; printf '\\n%[2]s %%d %%s\\n' \"$__tokkibot_ec\" \"$PWD\"\n", quoted, s.marker)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		s.kill()
+		return shellSessionResult{}, fmt.Errorf("failed to send command to shell: %w", err)
+	}
+
+	select {
+	case res := <-s.results:
+		s.stateMu.Lock()
+		s.dir = res.dir
+		s.stateMu.Unlock()
+		// the command may be killed for a limit of the sandbox
+		if err := s.proc.CheckExit(res.exitCode); err != nil {
+			return res, err
+		}
+		return res, nil
+	case <-s.exited:
+		// the command ran exit or crashed the shell
+		if sandbox.IsSandboxError(s.exitErr) {
+			return shellSessionResult{}, s.exitErr
+		}
+		var ce *sandbox.CommandError
+		if errors.As(s.exitErr, &ce) {
+			return shellSessionResult{exitCode: ce.ExitCode}, errShellSessionExited
+		}
+		return shellSessionResult{}, errShellSessionExited
+	case <-ctx.Done():
+		s.kill()
+		return shellSessionResult{}, ctx.Err()
+	}
+}
@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/component/sandbox"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+func jsonArgs(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestShellTimeout(t *testing.T) {
+	shell := Shell(sandbox.NewPassthroughSandbox(t.TempDir()), WithShellTimeout(time.Second, 2*time.Second))
+
+	// the timeout set by the call is capped at the maximum
+	start := time.Now()
+	out, _ := shell.Invoke(t.Context(), tool.InvokeMeta{}, jsonArgs(&ShellInput{Command: "echo started; sleep 10", Timeout: 60}))
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("command ran for %s", took)
+	}
+	if !strings.Contains(out, "timed out after 2s") || !strings.Contains(out, "started") {
+		t.Errorf("out = %s", out)
+	}
+}
+
+func TestShellStreamsOutput(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		parts  []string
+		closed bool
+	)
+	ctx := WithShellOutputReporter(t.Context(), func(output string, done bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		parts = append(parts, output)
+		closed = done
+	})
+
+	shell := Shell(sandbox.NewPassthroughSandbox(t.TempDir()))
+	out, err := shell.Invoke(ctx, tool.InvokeMeta{}, jsonArgs(&ShellInput{Command: "echo one; sleep 1; echo two"}))
+	if err != nil || !strings.Contains(out, "one\\ntwo") {
+		t.Fatalf("out = %s, err = %v", out, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(parts) < 2 || !closed || strings.Join(parts, "") != "one\ntwo\n" {
+		t.Errorf("parts = %q, done = %v", parts, closed)
+	}
+}
+
+func TestShellBackgroundJobs(t *testing.T) {
+	jobs := NewShellJobs(1)
+	sb := sandbox.NewPassthroughSandbox(t.TempDir())
+	shell := Shell(sb, WithShellTimeout(time.Second, time.Minute), WithShellJobs(jobs))
+	output := ShellOutput(jobs)
+	kill := ShellKill(jobs)
+	meta := tool.InvokeMeta{Channel: "cli", ChatId: "1"}
+
+	out, _ := shell.Invoke(t.Context(), meta, jsonArgs(&ShellInput{Command: "echo first; sleep 2; echo second", RunInBackground: true}))
+	if !strings.Contains(out, "job_1") {
+		t.Fatalf("out = %s", out)
+	}
+
+	// only one job may run at once
+	out, _ = shell.Invoke(t.Context(), meta, jsonArgs(&ShellInput{Command: "sleep 1", RunInBackground: true}))
+	if !strings.Contains(out, `"success":false`) {
+		t.Errorf("expected the second job to be rejected: %s", out)
+	}
+
+	// the job outlives the default timeout of one second
+	out, _ = output.Invoke(t.Context(), meta, jsonArgs(&ShellOutputInput{JobId: "job_1", Wait: 10}))
+	if !strings.Contains(out, "exited with code 0") || !strings.Contains(out, "first\\nsecond") {
+		t.Errorf("out = %s", out)
+	}
+	out, _ = output.Invoke(t.Context(), meta, jsonArgs(&ShellOutputInput{JobId: "job_1"}))
+	if !strings.Contains(out, "no new output") {
+		t.Errorf("output was returned twice: %s", out)
+	}
+
+	// jobs of other chats are not visible
+	out, _ = output.Invoke(t.Context(), tool.InvokeMeta{Channel: "cli", ChatId: "2"}, jsonArgs(&ShellOutputInput{JobId: "job_1"}))
+	if !strings.Contains(out, "not found") {
+		t.Errorf("out = %s", out)
+	}
+
+	shell.Invoke(t.Context(), meta, jsonArgs(&ShellInput{Command: "echo serving; sleep 30", RunInBackground: true}))
+	out, _ = kill.Invoke(t.Context(), meta, jsonArgs(&ShellKillInput{JobId: "job_2"}))
+	if !strings.Contains(out, "job_2 killed") {
+		t.Errorf("out = %s", out)
+	}
+	out, _ = output.Invoke(t.Context(), meta, jsonArgs(&ShellOutputInput{}))
+	if !strings.Contains(out, "job_1 exited") || !strings.Contains(out, "job_2 killed") {
+		t.Errorf("out = %s", out)
+	}
+}
+
+func TestShellSession(t *testing.T) {
+	dir := t.TempDir()
+	sessions := NewShellSessions(sandbox.NewPassthroughSandbox(dir))
+	shell := Shell(sandbox.NewPassthroughSandbox(dir), WithShellTimeout(time.Second, time.Second), WithShellSessions(sessions))
+	meta := tool.InvokeMeta{Channel: "cli", ChatId: "1"}
+	run := func(input *ShellInput) string {
+		out, _ := shell.Invoke(t.Context(), meta, jsonArgs(input))
+		return out
+	}
+
+	if out := run(&ShellInput{Command: "mkdir sub && cd sub && export GREETING='hi there'"}); !strings.Contains(out, `"success":true`) {
+		t.Fatalf("out = %s", out)
+	}
+	if out := run(&ShellInput{Command: `pwd; echo "$GREETING"`}); !strings.Contains(out, "/sub\\nhi there") {
+		t.Errorf("cwd and env were not kept: %s", out)
+	}
+
+	// exit codes, output without a trailing newline and syntax errors
+	if out := run(&ShellInput{Command: "printf partial; exit_code() { return 3; }; exit_code"}); !strings.Contains(out, "code 3: partial") {
+		t.Errorf("out = %s", out)
+	}
+	if out := run(&ShellInput{Command: "if then"}); !strings.Contains(out, `"success":false`) {
+		t.Errorf("out = %s", out)
+	}
+	if out := run(&ShellInput{Command: "echo $GREETING"}); !strings.Contains(out, "hi there") {
+		t.Errorf("the session did not survive a syntax error: %s", out)
+	}
+
+	// the shell exits and a new one starts with the next command
+	if out := run(&ShellInput{Command: "exit 4"}); !strings.Contains(out, "code 4") || !strings.Contains(out, "session exited") {
+		t.Errorf("out = %s", out)
+	}
+	if out := run(&ShellInput{Command: `echo "[$GREETING]"`}); !strings.Contains(out, "[]") {
+		t.Errorf("out = %s", out)
+	}
+
+	// a command which times out restarts the session
+	run(&ShellInput{Command: "export GREETING=again"})
+	if out := run(&ShellInput{Command: "sleep 10"}); !strings.Contains(out, "session was restarted") {
+		t.Errorf("out = %s", out)
+	}
+	if out := run(&ShellInput{Command: `echo "[$GREETING]"`}); !strings.Contains(out, "[]") {
+		t.Errorf("out = %s", out)
+	}
+
+	run(&ShellInput{Command: "export GREETING=again"})
+	if out := run(&ShellInput{Reset: true}); !strings.Contains(out, "reset") {
+		t.Errorf("out = %s", out)
+	}
+	if out := run(&ShellInput{Command: `echo "[$GREETING]"`}); !strings.Contains(out, "[]") {
+		t.Errorf("out = %s", out)
+	}
+
+	// other chats have their own shell
+	out, _ := shell.Invoke(t.Context(), tool.InvokeMeta{Channel: "cli", ChatId: "2"}, jsonArgs(&ShellInput{Command: "pwd"}))
+	if strings.Contains(out, "/sub") {
+		t.Errorf("out = %s", out)
+	}
+	sessions.Reset("cli", "1")
+	sessions.Reset("cli", "2")
+}
+
+func TestShellSessionMarkerSplit(t *testing.T) {
+	var out lockedBuffer
+	s := &shellSession{marker: "__done_1", results: make(chan shellSessionResult, 1), out: &out}
+
+	// the marker arrives one byte at a time after output with a newline
+	for _, b := range []byte("line\n\n__done_1 7 /tmp/a b\n") {
+		s.Write([]byte{b})
+	}
+	if got := out.String(); got != "line\n" {
+		t.Errorf("output = %q", got)
+	}
+	if res := <-s.results; res.exitCode != 7 || res.dir != "/tmp/a b" {
+		t.Errorf("result = %+v", res)
+	}
+
+	// output which only looks like the start of the marker is passed on,
+	// the last newline may still start it
+	s.Write([]byte("\n__do"))
+	s.Write([]byte("ne_2\n"))
+	if got := out.String(); got != "line\n\n__done_2" {
+		t.Errorf("output = %q", got)
+	}
+}
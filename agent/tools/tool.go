@@ -2,17 +2,24 @@ package tools
 
 // tool name constants definitions for other packages to use
 const (
-	ToolNameGlob        = "glob"
-	ToolNameReadFile    = "read_file"
-	ToolNameWriteFile   = "write_file"
-	ToolNameListDir     = "list_dir"
-	ToolNameEditFile    = "edit_file"
-	ToolNameLoadRef     = "load_ref"
-	ToolNameShell       = "shell"
-	ToolNameWebFetch    = "web_fetch"
-	ToolNameCron        = "cron"
-	ToolNameTodoWrite   = "todo_write"
-	ToolNameUseSkill    = "use_skill"
-	ToolNameSubagent    = "subagent"
-	ToolNameSendMessage = "send_message"
+	ToolNameGlob         = "glob"
+	ToolNameGrep         = "grep"
+	ToolNameReadFile     = "read_file"
+	ToolNameReadDocument = "read_document"
+	ToolNameWriteFile    = "write_file"
+	ToolNameListDir      = "list_dir"
+	ToolNameEditFile     = "edit_file"
+	ToolNameMultiEdit    = "multi_edit"
+	ToolNameApplyPatch   = "apply_patch"
+	ToolNameLoadRef      = "load_ref"
+	ToolNameShell        = "shell"
+	ToolNameShellOutput  = "shell_output"
+	ToolNameShellKill    = "shell_kill"
+	ToolNameWebFetch     = "web_fetch"
+	ToolNameWebSearch    = "web_search"
+	ToolNameCron         = "cron"
+	ToolNameTodoWrite    = "todo_write"
+	ToolNameUseSkill     = "use_skill"
+	ToolNameSubagent     = "subagent"
+	ToolNameSendMessage  = "send_message"
 )
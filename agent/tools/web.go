@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 	"sync"
@@ -15,7 +16,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/ryanreadbooks/tokkibot/component/tool"
-	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
+	"github.com/ryanreadbooks/tokkibot/pkg/document"
 
 	"github.com/JohannesKaufmann/html-to-markdown/v2"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
@@ -57,7 +58,10 @@ func getHttpClient() *http.Client {
 }
 
 type WebFetchInput struct {
-	URL string `json:"url" jsonschema:"description=The URL to fetch, use this over shell curl"`
+	URL      string `json:"url"                 jsonschema:"description=The URL to fetch, use this over shell curl"`
+	Offset   int    `json:"offset,omitempty"    jsonschema:"description=Character offset to read from, pass next_offset of the previous call to read on"`
+	Limit    int    `json:"limit,omitempty"     jsonschema:"description=Maximum characters to return, default and at most 50000"`
+	FullPage bool   `json:"full_page,omitempty" jsonschema:"description=Return the whole HTML page including navigation instead of the main content"`
 }
 
 type WebFetchOutput struct {
@@ -66,29 +70,32 @@ type WebFetchOutput struct {
 	IsBinary    bool   `json:"is_binary"`
 	ContentType string `json:"content_type"`
 	StatusCode  int    `json:"status_code"`
+	Offset      int    `json:"offset,omitempty"`
+	TotalChars  int    `json:"total_chars,omitempty"`
+	NextOffset  int    `json:"next_offset,omitempty"` // set when more content follows
+	Cached      bool   `json:"cached,omitempty"`
 }
 
-func newWebFetchTextOutput(content string, contentType string, statusCode int) *WebFetchOutput {
-	if l := utf8.RuneCountInString(content); l > maxWebFetchOutputChars {
-		return &WebFetchOutput{
-			Content:     xstring.Truncate(content, maxWebFetchOutputChars) + "...",
-			Truncated:   true,
-			IsBinary:    false,
-			ContentType: contentType,
-			StatusCode:  statusCode,
-		}
+// newWebFetchTextOutput returns limit characters of content from offset.
+func newWebFetchTextOutput(content string, offset, limit int, page *webPage) (*WebFetchOutput, error) {
+	part, next, err := pageText(content, offset, limit, maxWebFetchOutputChars)
+	if err != nil {
+		return nil, err
 	}
-
 	return &WebFetchOutput{
-		Content:     content,
-		Truncated:   false,
-		IsBinary:    false,
-		ContentType: contentType,
-		StatusCode:  statusCode,
-	}
+		Content:     part,
+		Truncated:   next > 0,
+		ContentType: page.contentType,
+		StatusCode:  page.statusCode,
+		Offset:      offset,
+		TotalChars:  utf8.RuneCountInString(content),
+		NextOffset:  next,
+		Cached:      page.cached,
+	}, nil
 }
 
-func newWebFetchBinaryOutput(data []byte, contentType string, statusCode int) *WebFetchOutput {
+func newWebFetchBinaryOutput(page *webPage) *WebFetchOutput {
+	data := page.body
 	truncated := len(data) > maxWebFetchOutputChars
 	if truncated {
 		data = data[:maxWebFetchOutputChars]
@@ -98,74 +105,171 @@ func newWebFetchBinaryOutput(data []byte, contentType string, statusCode int) *W
 		Content:     base64.URLEncoding.EncodeToString(data),
 		Truncated:   truncated,
 		IsBinary:    true,
-		ContentType: contentType,
-		StatusCode:  statusCode,
+		ContentType: page.contentType,
+		StatusCode:  page.statusCode,
+		Cached:      page.cached,
 	}
 }
 
-func WebFetch() tool.Invoker {
+// WebFetcher gets web pages as markdown, optionally through an on-disk
+// cache and respecting robots.txt.
+type WebFetcher struct {
+	cache  *webCache
+	robots *robotsChecker
+}
+
+type WebFetchOption func(*WebFetcher)
+
+// WithWebFetchCache keeps fetched pages in dir for ttl. Cached pages are
+// revalidated with their ETag or Last-Modified.
+func WithWebFetchCache(dir string, ttl time.Duration) WebFetchOption {
+	return func(f *WebFetcher) {
+		f.cache = newWebCache(dir, ttl)
+	}
+}
+
+// WithWebFetchRobots refuses pages disallowed by the robots.txt of their
+// site.
+func WithWebFetchRobots() WebFetchOption {
+	return func(f *WebFetcher) {
+		f.robots = newRobotsChecker()
+	}
+}
+
+func NewWebFetcher(opts ...WebFetchOption) *WebFetcher {
+	f := &WebFetcher{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func WebFetch(fetcher *WebFetcher) tool.Invoker {
+	if fetcher == nil {
+		fetcher = NewWebFetcher()
+	}
 	return tool.NewInvoker(tool.Info{
 		Name:        ToolNameWebFetch,
-		Description: "Fetch URL and extract HTML content to markdown or text",
+		Description: "Fetch URL and extract the main content of HTML pages as markdown, and the text of PDF and office documents. Long content is returned in parts, pass next_offset as offset to read on",
 	}, func(ctx context.Context, meta tool.InvokeMeta, input *WebFetchInput) (*WebFetchOutput, error) {
-		// Validate URL scheme
-		if !strings.HasPrefix(input.URL, "http://") && !strings.HasPrefix(input.URL, "https://") {
-			return nil, errors.New("invalid URL scheme, only http:// and https:// are supported")
-		}
+		return fetcher.Fetch(ctx, input)
+	})
+}
+
+// Fetch gets the page of input and converts it to text.
+func (f *WebFetcher) Fetch(ctx context.Context, input *WebFetchInput) (*WebFetchOutput, error) {
+	page, err := f.get(ctx, input.URL)
+	if err != nil {
+		return nil, err
+	}
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, input.URL, nil)
+	contentType := page.contentType
+	switch {
+	case strings.Contains(contentType, "text/html"):
+		body := page.body
+		if !input.FullPage {
+			if body, err = extractMainContent(body); err != nil {
+				return nil, fmt.Errorf("failed to extract main content: %w", err)
+			}
+		}
+		markdown, err := convertHTMLToMarkdown(ctx, body, page.url.Hostname())
 		if err != nil {
 			return nil, err
 		}
-		req.Header.Set("User-Agent", userAgent)
-
-		domain := req.URL.Hostname()
+		return newWebFetchTextOutput(markdown, input.Offset, input.Limit, page)
+	case isTextContent(contentType):
+		return newWebFetchTextOutput(string(page.body), input.Offset, input.Limit, page)
+	}
 
-		resp, err := getHttpClient().Do(req)
+	// pdf and office documents
+	if format := document.Detect(page.url.Path, page.body); format != "" {
+		markdown, err := document.ToMarkdown(format, page.body)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to convert %s document: %w", format, err)
 		}
-		defer resp.Body.Close()
+		return newWebFetchTextOutput(markdown, input.Offset, input.Limit, page)
+	}
 
-		// Check HTTP status code
-		if resp.StatusCode >= 400 {
-			return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
-		}
+	return newWebFetchBinaryOutput(page), nil
+}
 
-		// Check content length to avoid memory issues
-		if resp.ContentLength > maxContentLength {
-			return nil, fmt.Errorf("content too large: %d bytes (max %d bytes)", resp.ContentLength, maxContentLength)
-		}
+// webPage is a fetched page.
+type webPage struct {
+	url         *url.URL
+	body        []byte
+	contentType string
+	statusCode  int
+	cached      bool
+}
 
-		// Read response body with size limit
-		limitedReader := io.LimitReader(resp.Body, maxContentLength)
-		body, err := io.ReadAll(limitedReader)
-		if err != nil {
+// get fetches rawURL, from the cache if it is still fresh or has not
+// changed.
+func (f *WebFetcher) get(ctx context.Context, rawURL string) (*webPage, error) {
+	// Validate URL scheme
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return nil, errors.New("invalid URL scheme, only http:// and https:// are supported")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	if f.robots != nil {
+		if err := f.robots.check(ctx, req.URL); err != nil {
 			return nil, err
 		}
+	}
 
-		contentType := resp.Header.Get("Content-Type")
-		if contentType == "" {
-			contentType = http.DetectContentType(body)
+	entry, cachedBody := f.cache.load(rawURL)
+	if entry != nil {
+		if entry.isFresh() {
+			return entry.page(cachedBody), nil
 		}
+		entry.setValidators(req)
+	}
 
-		// Handle HTML content
-		if strings.Contains(contentType, "text/html") {
-			markdown, err := convertHTMLToMarkdown(ctx, body, domain)
-			if err != nil {
-				return nil, err
-			}
-			return newWebFetchTextOutput(markdown, contentType, resp.StatusCode), nil
-		}
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		// Handle text content types
-		if isTextContent(contentType) {
-			return newWebFetchTextOutput(string(body), contentType, resp.StatusCode), nil
-		}
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		f.cache.touch(ctx, entry)
+		return entry.page(cachedBody), nil
+	}
 
-		// Handle binary content
-		return newWebFetchBinaryOutput(body, contentType, resp.StatusCode), nil
-	})
+	// Check HTTP status code
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	// Check content length to avoid memory issues
+	if resp.ContentLength > maxContentLength {
+		return nil, fmt.Errorf("content too large: %d bytes (max %d bytes)", resp.ContentLength, maxContentLength)
+	}
+
+	// Read response body with size limit
+	limitedReader := io.LimitReader(resp.Body, maxContentLength)
+	body, err := io.ReadAll(limitedReader)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	f.cache.store(ctx, rawURL, resp, contentType, body)
+	return &webPage{
+		url:         resp.Request.URL,
+		body:        body,
+		contentType: contentType,
+		statusCode:  resp.StatusCode,
+	}, nil
 }
 
 // isTextContent checks if the content type is text-based
@@ -175,6 +279,8 @@ func isTextContent(contentType string) bool {
 		"text/xml",
 		"text/css",
 		"text/javascript",
+		"text/markdown",
+		"text/csv",
 		"application/json",
 		"application/xml",
 		"application/javascript",
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cached pages younger than this are used without asking the server
+const webCacheFreshFor = 5 * time.Minute
+
+// webCache keeps fetched pages on disk, a page as <sha256 of url>.json
+// holding its headers and <sha256 of url>.body holding its body. Pages
+// older than the ttl are fetched again and pruned. A nil cache caches
+// nothing.
+type webCache struct {
+	dir       string
+	ttl       time.Duration
+	pruneOnce sync.Once
+}
+
+type webCacheEntry struct {
+	URL          string    `json:"url"`
+	FinalURL     string    `json:"final_url,omitempty"`
+	ContentType  string    `json:"content_type"`
+	StatusCode   int       `json:"status_code"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+func newWebCache(dir string, ttl time.Duration) *webCache {
+	if dir == "" || ttl <= 0 {
+		return nil
+	}
+	return &webCache{dir: dir, ttl: ttl}
+}
+
+func (c *webCache) path(rawURL, ext string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// load returns the entry of rawURL and its body, or nil if there is none
+// within the ttl.
+func (c *webCache) load(rawURL string) (*webCacheEntry, []byte) {
+	if c == nil {
+		return nil, nil
+	}
+	c.pruneOnce.Do(c.prune)
+
+	data, err := os.ReadFile(c.path(rawURL, ".json"))
+	if err != nil {
+		return nil, nil
+	}
+	var entry webCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != rawURL {
+		return nil, nil
+	}
+	if time.Since(entry.FetchedAt) > c.ttl {
+		return nil, nil
+	}
+	body, err := os.ReadFile(c.path(rawURL, ".body"))
+	if err != nil {
+		return nil, nil
+	}
+	return &entry, body
+}
+
+// store keeps a successful response unless the server forbids it.
+func (c *webCache) store(ctx context.Context, rawURL string, resp *http.Response, contentType string, body []byte) {
+	if c == nil || resp.StatusCode != http.StatusOK ||
+		strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-store") {
+		return
+	}
+
+	entry := &webCacheEntry{
+		URL:          rawURL,
+		ContentType:  contentType,
+		StatusCode:   resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	if resp.Request != nil && resp.Request.URL.String() != rawURL {
+		entry.FinalURL = resp.Request.URL.String()
+	}
+	if err := writeFileAtomic(c.path(rawURL, ".body"), body); err != nil {
+		slog.WarnContext(ctx, "[tool/web] failed to cache page", slog.String("url", rawURL), slog.Any("error", err))
+		return
+	}
+	c.writeEntry(ctx, entry)
+}
+
+// touch marks the entry as fetched now, after the server reported it
+// unchanged.
+func (c *webCache) touch(ctx context.Context, entry *webCacheEntry) {
+	entry.FetchedAt = time.Now()
+	c.writeEntry(ctx, entry)
+}
+
+func (c *webCache) writeEntry(ctx context.Context, entry *webCacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := writeFileAtomic(c.path(entry.URL, ".json"), data); err != nil {
+		slog.WarnContext(ctx, "[tool/web] failed to cache page", slog.String("url", entry.URL), slog.Any("error", err))
+	}
+}
+
+// prune removes the files of pages older than the ttl.
+func (c *webCache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || time.Since(info.ModTime()) <= c.ttl {
+			continue
+		}
+		os.Remove(filepath.Join(c.dir, e.Name()))
+	}
+}
+
+func (e *webCacheEntry) isFresh() bool {
+	return time.Since(e.FetchedAt) < webCacheFreshFor
+}
+
+// setValidators makes req conditional on the cached page having changed.
+func (e *webCacheEntry) setValidators(req *http.Request) {
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+func (e *webCacheEntry) page(body []byte) *webPage {
+	rawURL := e.URL
+	if e.FinalURL != "" {
+		rawURL = e.FinalURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		u = &url.URL{}
+	}
+	return &webPage{
+		url:         u,
+		body:        body,
+		contentType: e.ContentType,
+		statusCode:  e.StatusCode,
+		cached:      true,
+	}
+}
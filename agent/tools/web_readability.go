@@ -0,0 +1,376 @@
+package tools
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// minimum characters of the main content, shorter pages are kept whole
+	minMainContentChars = 200
+	// paragraphs shorter than this do not score their ancestors
+	minScoredParagraphChars = 25
+)
+
+var (
+	unlikelyContentRegexp = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumb|combx|comment|community|cookie|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|navbar|newsletter|popup|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|supplemental|yom-remote`)
+	maybeContentRegexp    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveContentRegexp = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story|markdown|prose|docs?\b`)
+	negativeContentRegexp = regexp.MustCompile(`(?i)-ad-|hidden|^hid$|\bhid\b|banner|combx|comment|com-|contact|footer|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|widget`)
+)
+
+// boilerplate elements which are never part of the main content
+var boilerplateAtoms = []atom.Atom{
+	atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Canvas,
+	atom.Iframe, atom.Nav, atom.Footer, atom.Aside, atom.Button,
+	atom.Input, atom.Select, atom.Textarea, atom.Dialog,
+}
+
+// boilerplate landmarks
+var boilerplateRoles = []string{"navigation", "banner", "contentinfo", "complementary", "search", "dialog", "menu", "menubar"}
+
+// containers which are dropped when their class or id looks like boilerplate
+var removableAtoms = []atom.Atom{
+	atom.Div, atom.Section, atom.Header, atom.Ul, atom.Ol, atom.Dl, atom.Table, atom.Span, atom.P,
+}
+
+// extractMainContent returns the html of the main content of a page the way
+// reader modes do: navigation, headers, footers, sidebars and the like are
+// dropped, and the element holding most of the text is kept. Pages without
+// a clear main content, such as index pages, are returned whole with the
+// boilerplate dropped.
+func extractMainContent(body []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	title := documentTitle(doc)
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	removeBoilerplate(root)
+
+	content := mainContent(root)
+	if content == nil || textLength(content) < minMainContentChars {
+		content = root
+	}
+
+	var buf bytes.Buffer
+	if title != "" && findElement(content, atom.H1) == nil {
+		buf.WriteString("<h1>" + html.EscapeString(title) + "</h1>\n")
+	}
+	if content == root {
+		for c := root.FirstChild; c != nil; c = c.NextSibling {
+			if err := html.Render(&buf, c); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := html.Render(&buf, content); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func documentTitle(doc *html.Node) string {
+	if t := findElement(doc, atom.Title); t != nil {
+		title := strings.TrimSpace(innerText(t))
+		// drop the site name of "Page - Site"
+		for _, sep := range []string{" | ", " - ", " — ", " · "} {
+			if i := strings.LastIndex(title, sep); i > 0 && len(strings.Fields(title[:i])) >= 2 {
+				title = title[:i]
+				break
+			}
+		}
+		return title
+	}
+	return ""
+}
+
+// mainContent returns the element holding the main content, or nil. An
+// article or main element holding a good part of the text wins, otherwise
+// the element whose paragraphs score best.
+func mainContent(root *html.Node) *html.Node {
+	total := textLength(root)
+	if total == 0 {
+		return nil
+	}
+
+	var landmark *html.Node
+	walkElements(root, func(n *html.Node) bool {
+		if n.DataAtom == atom.Main || n.DataAtom == atom.Article || attr(n, "role") == "main" {
+			if landmark == nil || textLength(n) > textLength(landmark) {
+				landmark = n
+			}
+			return false
+		}
+		return true
+	})
+	if landmark != nil && textLength(landmark)*4 >= total {
+		return landmark
+	}
+
+	return bestScoredElement(root)
+}
+
+// bestScoredElement scores elements by the paragraphs they hold, in the way
+// of Readability: each paragraph adds points for its length and commas to
+// its parent and less to further ancestors.
+func bestScoredElement(root *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = baseScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	walkElements(root, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+		case atom.Div:
+			if hasBlockChild(n) {
+				return true
+			}
+		default:
+			return true
+		}
+
+		text := innerText(n)
+		length := len([]rune(strings.TrimSpace(text)))
+		if length < minScoredParagraphChars {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(length)/100, 3)
+		parent := n.Parent
+		for level := 1; parent != nil && parent != root.Parent && level <= 3; level++ {
+			switch level {
+			case 1:
+				addScore(parent, score)
+			case 2:
+				addScore(parent, score/2)
+			default:
+				addScore(parent, score/float64(level*3))
+			}
+			parent = parent.Parent
+		}
+		return false
+	})
+
+	var (
+		best      *html.Node
+		bestScore float64
+	)
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(n))
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	// a parent which holds more of the text is usually the article
+	for best.Parent != nil && best.Parent != root.Parent {
+		parentScore, ok := scores[best.Parent]
+		if !ok || parentScore*(1-linkDensity(best.Parent)) < bestScore*0.75 {
+			break
+		}
+		best = best.Parent
+	}
+	return best
+}
+
+func baseScore(n *html.Node) float64 {
+	var score float64
+	switch n.DataAtom {
+	case atom.Div, atom.Article, atom.Main, atom.Section:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+	for _, s := range []string{attr(n, "class"), attr(n, "id")} {
+		if s == "" {
+			continue
+		}
+		if negativeContentRegexp.MatchString(s) {
+			score -= 25
+		}
+		if positiveContentRegexp.MatchString(s) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// removeBoilerplate drops elements which are not part of the content of any
+// page, and containers whose class or id names boilerplate.
+func removeBoilerplate(root *html.Node) {
+	var remove []*html.Node
+	walkElements(root, func(n *html.Node) bool {
+		if n.DataAtom == atom.Pre || n.DataAtom == atom.Code {
+			return false
+		}
+		if isBoilerplate(n) {
+			remove = append(remove, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	if slices.Contains(boilerplateAtoms, n.DataAtom) {
+		return true
+	}
+	if slices.Contains(boilerplateRoles, attr(n, "role")) || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	if _, hidden := attrOk(n, "hidden"); hidden {
+		return true
+	}
+	if !slices.Contains(removableAtoms, n.DataAtom) {
+		return false
+	}
+	// a header within the content holds its title
+	if n.DataAtom == atom.Header && findAncestor(n, atom.Article, atom.Main) != nil {
+		return false
+	}
+	if n.DataAtom == atom.Header {
+		return true
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	if !unlikelyContentRegexp.MatchString(names) || maybeContentRegexp.MatchString(names) {
+		return false
+	}
+	// e.g. <div class="section-header"><h2>Install</h2></div>
+	return !holdsHeading(n) || textLength(n) >= minMainContentChars
+}
+
+func holdsHeading(n *html.Node) bool {
+	for _, a := range []atom.Atom{atom.H1, atom.H2, atom.H3, atom.H4} {
+		if findElement(n, a) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBlockChild(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.DataAtom {
+		case atom.A, atom.Blockquote, atom.Dl, atom.Div, atom.Img, atom.Ol, atom.P, atom.Pre, atom.Table, atom.Ul, atom.Section, atom.Article:
+			return true
+		}
+	}
+	return false
+}
+
+// linkDensity returns the share of the text of n which is link text.
+func linkDensity(n *html.Node) float64 {
+	total := textLength(n)
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	walkElements(n, func(c *html.Node) bool {
+		if c.DataAtom == atom.A {
+			links += textLength(c)
+			return false
+		}
+		return true
+	})
+	return float64(links) / float64(total)
+}
+
+func textLength(n *html.Node) int {
+	return len([]rune(strings.Join(strings.Fields(innerText(n)), " ")))
+}
+
+func innerText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// walkElements calls fn for the elements under n in document order, not
+// descending into elements for which fn returns false.
+func walkElements(n *html.Node, fn func(*html.Node) bool) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if fn(c) {
+			walkElements(c, fn)
+		}
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walkElements(n, func(c *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if c.DataAtom == a {
+			found = c
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func findAncestor(n *html.Node, atoms ...atom.Atom) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if slices.Contains(atoms, p.DataAtom) {
+			return p
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrOk(n, key)
+	return v
+}
+
+func attrOk(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the product token matched against the user-agent lines of robots.txt
+	robotsAgent = "tokkibot"
+
+	robotsTTL            = time.Hour
+	maxRobotsContentSize = 512 * 1024
+)
+
+// robotsChecker checks urls against the robots.txt of their site, which is
+// fetched once an hour. Sites whose robots.txt cannot be fetched allow
+// everything.
+type robotsChecker struct {
+	mu    sync.Mutex
+	sites map[string]*robotsSite // by scheme://host
+}
+
+type robotsSite struct {
+	rules     []robotsRule
+	fetchedAt time.Time
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+func newRobotsChecker() *robotsChecker {
+	return &robotsChecker{sites: make(map[string]*robotsSite)}
+}
+
+// check returns an error if u is disallowed.
+func (c *robotsChecker) check(ctx context.Context, u *url.URL) error {
+	origin := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	site, ok := c.sites[origin]
+	c.mu.Unlock()
+	if !ok || time.Since(site.fetchedAt) > robotsTTL {
+		site = &robotsSite{rules: fetchRobots(ctx, origin), fetchedAt: time.Now()}
+		c.mu.Lock()
+		c.sites[origin] = site
+		c.mu.Unlock()
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if !robotsAllowed(site.rules, path) {
+		return fmt.Errorf("fetching %s is disallowed by the robots.txt of %s", u.String(), u.Host)
+	}
+	return nil
+}
+
+// fetchRobots returns the rules of the robots.txt of origin for us.
+func fetchRobots(ctx context.Context, origin string) []robotsRule {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsContentSize))
+	if err != nil {
+		return nil
+	}
+	return parseRobots(data, robotsAgent)
+}
+
+// parseRobots returns the rules of the group of agent, or of the * group
+// if no group names agent.
+func parseRobots(data []byte, agent string) []robotsRule {
+	var (
+		specific, wildcard []robotsRule
+		hasSpecific        bool
+		// the agents of the current group, and whether its rules began
+		forAgent, forAll bool
+		inRules          bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				forAgent, forAll, inRules = false, false, false
+			}
+			name := strings.ToLower(value)
+			if name == "*" {
+				forAll = true
+			} else if name != "" && strings.Contains(agent, name) {
+				forAgent, hasSpecific = true, true
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// an empty disallow allows everything
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value}
+			if forAgent {
+				specific = append(specific, rule)
+			}
+			if forAll {
+				wildcard = append(wildcard, rule)
+			}
+		}
+	}
+
+	if hasSpecific {
+		return specific
+	}
+	return wildcard
+}
+
+// robotsAllowed applies the longest rule matching path, allow rules win
+// ties.
+func robotsAllowed(rules []robotsRule, path string) bool {
+	allowed, longest := true, -1
+	for _, r := range rules {
+		if !robotsMatch(r.pattern, path) {
+			continue
+		}
+		if n := len(r.pattern); n > longest || (n == longest && r.allow) {
+			allowed, longest = r.allow, n
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches path against a pattern which may use * for any
+// characters and end with $ to anchor the end.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	return !anchored || rest == ""
+}
@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/ryanreadbooks/tokkibot/agent/tools/description"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+const (
+	defaultWebSearchCount = 5
+	maxWebSearchCount     = 20
+
+	maxWebSearchContentChars = 10000
+)
+
+// SearchResult is a result of a web search.
+type SearchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet,omitempty"`
+
+	// set when the result is fetched
+	Content    string `json:"content,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	FetchError string `json:"fetch_error,omitempty"`
+}
+
+// SearchProvider searches the web with a search engine.
+type SearchProvider interface {
+	// Name of the provider, e.g. brave
+	Name() string
+
+	// Search returns at most count results of query, best first.
+	Search(ctx context.Context, query string, count int) ([]SearchResult, error)
+}
+
+type WebSearchInput struct {
+	Query string `json:"query"           jsonschema:"description=The search query"`
+	Count int    `json:"count,omitempty" jsonschema:"description=Number of results to return, at most 20"`
+	Fetch *int   `json:"fetch,omitempty" jsonschema:"description=Fetch the pages of the top N results as markdown, 0 to only return snippets"`
+}
+
+type WebSearchOutput struct {
+	Query    string         `json:"query"`
+	Provider string         `json:"provider"`
+	Results  []SearchResult `json:"results"`
+}
+
+type webSearchOptions struct {
+	count    int
+	fetchTop int
+	fetcher  *WebFetcher
+}
+
+type WebSearchOption func(*webSearchOptions)
+
+// WithWebSearchCount sets the number of results of searches which do not
+// set one.
+func WithWebSearchCount(count int) WebSearchOption {
+	return func(o *webSearchOptions) {
+		if count > 0 {
+			o.count = min(count, maxWebSearchCount)
+		}
+	}
+}
+
+// WithWebSearchFetchTop sets the number of top results fetched by searches
+// which do not set one.
+func WithWebSearchFetchTop(n int) WebSearchOption {
+	return func(o *webSearchOptions) {
+		o.fetchTop = max(n, 0)
+	}
+}
+
+// WithWebSearchFetcher sets the fetcher of the pages of top results, so
+// that they share the cache and robots.txt rules of web_fetch.
+func WithWebSearchFetcher(f *WebFetcher) WebSearchOption {
+	return func(o *webSearchOptions) {
+		if f != nil {
+			o.fetcher = f
+		}
+	}
+}
+
+func WebSearch(provider SearchProvider, opts ...WebSearchOption) tool.Invoker {
+	o := &webSearchOptions{count: defaultWebSearchCount}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.fetcher == nil {
+		o.fetcher = NewWebFetcher()
+	}
+
+	return tool.NewInvoker(tool.Info{
+		Name:        ToolNameWebSearch,
+		Description: description.WebSearchDescription,
+	}, func(ctx context.Context, meta tool.InvokeMeta, input *WebSearchInput) (*WebSearchOutput, error) {
+		query := strings.TrimSpace(input.Query)
+		if query == "" {
+			return nil, errors.New("query is empty")
+		}
+		count := o.count
+		if input.Count > 0 {
+			count = min(input.Count, maxWebSearchCount)
+		}
+		fetchTop := o.fetchTop
+		if input.Fetch != nil {
+			fetchTop = max(*input.Fetch, 0)
+		}
+
+		results, err := provider.Search(ctx, query, count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search with %s: %w", provider.Name(), err)
+		}
+		results = dedupSearchResults(results)
+		if len(results) > count {
+			results = results[:count]
+		}
+		fetchSearchResults(ctx, o.fetcher, results[:min(fetchTop, len(results))])
+
+		return &WebSearchOutput{
+			Query:    query,
+			Provider: provider.Name(),
+			Results:  results,
+		}, nil
+	})
+}
+
+// dedupSearchResults drops results without a http url and results pointing
+// to the same page as an earlier one.
+func dedupSearchResults(results []SearchResult) []SearchResult {
+	seen := make(map[string]struct{}, len(results))
+	deduped := make([]SearchResult, 0, len(results))
+	for _, r := range results {
+		key, ok := searchResultKey(r.URL)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		deduped = append(deduped, r)
+	}
+	return deduped
+}
+
+// searchResultKey normalizes a result url so that http and https, www.,
+// fragments and trailing slashes do not tell pages apart.
+func searchResultKey(rawURL string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	return host + strings.TrimRight(u.EscapedPath(), "/") + "?" + u.RawQuery, true
+}
+
+// fetchSearchResults fetches the pages of results at once and stores them
+// as markdown in the results. A panic while fetching a page, e.g. in a
+// document parser, becomes the fetch error of its result.
+func fetchSearchResults(ctx context.Context, fetcher *WebFetcher, results []SearchResult) {
+	var wg sync.WaitGroup
+	for i := range results {
+		r := &results[i]
+		wg.Go(func() {
+			defer func() {
+				if err := recover(); err != nil {
+					slog.ErrorContext(ctx, "[tool/web_search] fetch panic",
+						slog.String("url", r.URL),
+						slog.Any("error", err),
+						slog.String("stack", string(debug.Stack())))
+					r.Content = ""
+					r.FetchError = fmt.Sprintf("failed to fetch page: %v", err)
+				}
+			}()
+
+			out, err := fetcher.Fetch(ctx, &WebFetchInput{URL: r.URL, Limit: maxWebSearchContentChars})
+			switch {
+			case err != nil:
+				r.FetchError = err.Error()
+			case out.IsBinary:
+				r.FetchError = "binary content of type " + out.ContentType + ", use web_fetch to get it"
+			default:
+				r.Content = out.Content
+				r.Truncated = out.Truncated
+			}
+		})
+	}
+	wg.Wait()
+}
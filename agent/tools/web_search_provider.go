@@ -0,0 +1,266 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultBraveSearchURL = "https://api.search.brave.com/res/v1/web/search"
+	defaultBingSearchURL  = "https://api.bing.microsoft.com/v7.0/search"
+
+	maxSearchResponseSize = 5 * 1024 * 1024 // 5MB
+)
+
+var stripHTMLTagsRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// searchJSON sends a GET request to rawURL and decodes the json response
+// into v.
+func searchJSON(ctx context.Context, rawURL string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Accept", "application/json")
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSearchResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode search response: %w", err)
+	}
+	return nil
+}
+
+// cleanSnippet strips the highlighting markup some apis put in snippets.
+func cleanSnippet(s string) string {
+	return strings.TrimSpace(html.UnescapeString(stripHTMLTagsRegexp.ReplaceAllString(s, "")))
+}
+
+// SearXNGProvider searches with a SearXNG instance, which must have the json
+// format enabled.
+type SearXNGProvider struct {
+	baseURL string
+}
+
+func NewSearXNGProvider(baseURL string) *SearXNGProvider {
+	return &SearXNGProvider{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (p *SearXNGProvider) Name() string { return "searxng" }
+
+func (p *SearXNGProvider) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	params := url.Values{"q": {query}, "format": {"json"}}
+
+	var resp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := searchJSON(ctx, p.baseURL+"/search?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: cleanSnippet(r.Content)})
+	}
+	return results[:min(count, len(results))], nil
+}
+
+// BraveProvider searches with the Brave Search API.
+type BraveProvider struct {
+	apiKey   string
+	endpoint string
+}
+
+// NewBraveProvider returns a provider using the public api unless endpoint
+// is set.
+func NewBraveProvider(apiKey, endpoint string) *BraveProvider {
+	if endpoint == "" {
+		endpoint = defaultBraveSearchURL
+	}
+	return &BraveProvider{apiKey: apiKey, endpoint: endpoint}
+}
+
+func (p *BraveProvider) Name() string { return "brave" }
+
+func (p *BraveProvider) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	params := url.Values{"q": {query}, "count": {strconv.Itoa(count)}}
+	header := http.Header{}
+	header.Set("X-Subscription-Token", p.apiKey)
+
+	var resp struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := searchJSON(ctx, p.endpoint+"?"+params.Encode(), header, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(resp.Web.Results))
+	for _, r := range resp.Web.Results {
+		results = append(results, SearchResult{Title: cleanSnippet(r.Title), URL: r.URL, Snippet: cleanSnippet(r.Description)})
+	}
+	return results, nil
+}
+
+// BingProvider searches with the Bing Web Search API.
+type BingProvider struct {
+	apiKey   string
+	endpoint string
+}
+
+// NewBingProvider returns a provider using the public api unless endpoint
+// is set.
+func NewBingProvider(apiKey, endpoint string) *BingProvider {
+	if endpoint == "" {
+		endpoint = defaultBingSearchURL
+	}
+	return &BingProvider{apiKey: apiKey, endpoint: endpoint}
+}
+
+func (p *BingProvider) Name() string { return "bing" }
+
+func (p *BingProvider) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	params := url.Values{
+		"q":              {query},
+		"count":          {strconv.Itoa(count)},
+		"textFormat":     {"Raw"},
+		"responseFilter": {"Webpages"},
+	}
+	header := http.Header{}
+	header.Set("Ocp-Apim-Subscription-Key", p.apiKey)
+
+	var resp struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := searchJSON(ctx, p.endpoint+"?"+params.Encode(), header, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(resp.WebPages.Value))
+	for _, r := range resp.WebPages.Value {
+		results = append(results, SearchResult{Title: r.Name, URL: r.URL, Snippet: cleanSnippet(r.Snippet)})
+	}
+	return results, nil
+}
+
+// JSONSearchSpec describes a search api answering in json.
+type JSONSearchSpec struct {
+	// Request url, {query} and {count} are replaced with the escaped query
+	// and the number of results.
+	URL     string
+	Headers map[string]string
+
+	// Dotted path to the array of results, e.g. data.items. Numbers index
+	// arrays.
+	Results string
+
+	// Dotted paths to fields within a result.
+	Title, Link, Snippet string
+}
+
+// JSONSearchProvider searches with any api answering in json.
+type JSONSearchProvider struct {
+	spec JSONSearchSpec
+}
+
+func NewJSONSearchProvider(spec JSONSearchSpec) *JSONSearchProvider {
+	return &JSONSearchProvider{spec: spec}
+}
+
+func (p *JSONSearchProvider) Name() string { return "json" }
+
+func (p *JSONSearchProvider) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	rawURL := strings.NewReplacer(
+		"{query}", url.QueryEscape(query),
+		"{count}", strconv.Itoa(count),
+	).Replace(p.spec.URL)
+	header := http.Header{}
+	for k, v := range p.spec.Headers {
+		header.Set(k, v)
+	}
+
+	var resp any
+	if err := searchJSON(ctx, rawURL, header, &resp); err != nil {
+		return nil, err
+	}
+	items, ok := jsonPath(resp, p.spec.Results).([]any)
+	if !ok {
+		return nil, fmt.Errorf("no result array at %q in search response", p.spec.Results)
+	}
+
+	results := make([]SearchResult, 0, len(items))
+	for _, item := range items {
+		link, _ := jsonPath(item, p.spec.Link).(string)
+		if link == "" {
+			continue
+		}
+		title, _ := jsonPath(item, p.spec.Title).(string)
+		snippet, _ := jsonPath(item, p.spec.Snippet).(string)
+		results = append(results, SearchResult{Title: cleanSnippet(title), URL: link, Snippet: cleanSnippet(snippet)})
+	}
+	if len(items) > 0 && len(results) == 0 {
+		return nil, errors.New("no result has a url at " + strconv.Quote(p.spec.Link))
+	}
+	return results[:min(count, len(results))], nil
+}
+
+// jsonPath returns the value at a dotted path of decoded json, or nil.
+func jsonPath(v any, path string) any {
+	if path == "" {
+		return v
+	}
+	for key := range strings.SplitSeq(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
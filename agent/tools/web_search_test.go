@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+)
+
+// newSearchServer serves body as json after checking the query and the
+// header of the request.
+func newSearchServer(t *testing.T, header, value, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query().Get("q"); q != "go generics" {
+			t.Errorf("unexpected query %q", q)
+		}
+		if header != "" && r.Header.Get(header) != value {
+			http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearchProviders(t *testing.T) {
+	searxng := newSearchServer(t, "", "", `{"results": [
+		{"title": "Generics", "url": "https://go.dev/doc/tutorial/generics", "content": "Tutorial &amp; more"},
+		{"title": "Spec", "url": "https://go.dev/ref/spec", "content": "The spec"},
+		{"title": "Blog", "url": "https://go.dev/blog/intro-generics", "content": "Intro"}
+	]}`)
+	brave := newSearchServer(t, "X-Subscription-Token", "brave-key", `{"web": {"results": [
+		{"title": "<strong>Generics</strong>", "url": "https://go.dev/doc/tutorial/generics", "description": "Learn <strong>generics</strong>"}
+	]}}`)
+	bing := newSearchServer(t, "Ocp-Apim-Subscription-Key", "bing-key", `{"webPages": {"value": [
+		{"name": "Generics", "url": "https://go.dev/doc/tutorial/generics", "snippet": "Learn generics"}
+	]}}`)
+	generic := newSearchServer(t, "Authorization", "Bearer token", `{"data": {"items": [
+		{"name": "Generics", "link": {"href": "https://go.dev/doc/tutorial/generics"}, "summary": "Learn generics"},
+		{"name": "No link"}
+	]}}`)
+
+	tests := []struct {
+		provider SearchProvider
+		want     SearchResult
+	}{
+		{NewSearXNGProvider(searxng.URL + "/"), SearchResult{Title: "Generics", URL: "https://go.dev/doc/tutorial/generics", Snippet: "Tutorial & more"}},
+		{NewBraveProvider("brave-key", brave.URL), SearchResult{Title: "Generics", URL: "https://go.dev/doc/tutorial/generics", Snippet: "Learn generics"}},
+		{NewBingProvider("bing-key", bing.URL), SearchResult{Title: "Generics", URL: "https://go.dev/doc/tutorial/generics", Snippet: "Learn generics"}},
+		{NewJSONSearchProvider(JSONSearchSpec{
+			URL:     generic.URL + "/search?q={query}&limit={count}",
+			Headers: map[string]string{"Authorization": "Bearer token"},
+			Results: "data.items",
+			Title:   "name",
+			Link:    "link.href",
+			Snippet: "summary",
+		}), SearchResult{Title: "Generics", URL: "https://go.dev/doc/tutorial/generics", Snippet: "Learn generics"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider.Name(), func(t *testing.T) {
+			results, err := tt.provider.Search(t.Context(), "go generics", 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) == 0 || len(results) > 2 {
+				t.Fatalf("expected 1 or 2 results, got %d", len(results))
+			}
+			if results[0] != tt.want {
+				t.Errorf("got %+v, want %+v", results[0], tt.want)
+			}
+		})
+	}
+
+	_, err := NewBraveProvider("wrong-key", brave.URL).Search(t.Context(), "go generics", 5)
+	if err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("expected HTTP 401, got %v", err)
+	}
+	_, err = NewJSONSearchProvider(JSONSearchSpec{URL: searxng.URL + "/search?q={query}", Results: "data.items"}).
+		Search(t.Context(), "go generics", 5)
+	if err == nil {
+		t.Error("expected an error for a missing result array")
+	}
+}
+
+func TestDedupSearchResults(t *testing.T) {
+	results := dedupSearchResults([]SearchResult{
+		{URL: "https://go.dev/doc/"},
+		{URL: "http://www.go.dev/doc#install"},
+		{URL: "https://GO.dev/doc"},
+		{URL: "https://go.dev/doc?page=2"},
+		{URL: "ftp://go.dev/doc"},
+		{URL: "not a url"},
+		{URL: "https://pkg.go.dev"},
+	})
+	var urls []string
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	want := "https://go.dev/doc/ https://go.dev/doc?page=2 https://pkg.go.dev"
+	if got := strings.Join(urls, " "); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// decodeWebSearchOutput decodes the output of an invocation of web_search.
+func decodeWebSearchOutput(t *testing.T, output string) WebSearchOutput {
+	t.Helper()
+	var res tool.InvokeResult
+	if err := json.Unmarshal([]byte(output), &res); err != nil || !res.Success {
+		t.Fatalf("web_search failed: %s", output)
+	}
+	var out WebSearchOutput
+	if err := json.Unmarshal([]byte(res.Data), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+type staticSearchProvider []SearchResult
+
+func (p staticSearchProvider) Name() string { return "static" }
+
+func (p staticSearchProvider) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	return p, nil
+}
+
+func TestWebSearch(t *testing.T) {
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><body><h1>Page A</h1><script>x()</script></body></html>")
+		case "/b":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer pages.Close()
+
+	provider := staticSearchProvider{
+		{Title: "A", URL: pages.URL + "/a"},
+		{Title: "A again", URL: pages.URL + "/a/"},
+		{Title: "B", URL: pages.URL + "/b"},
+		{Title: "C", URL: pages.URL + "/c"},
+		{Title: "D", URL: pages.URL + "/d"},
+	}
+	search := WebSearch(provider, WithWebSearchCount(3), WithWebSearchFetchTop(3))
+	meta := tool.InvokeMeta{Channel: "test", ChatId: "test"}
+
+	output, err := search.Invoke(t.Context(), meta, `{"query": "pages"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := decodeWebSearchOutput(t, output)
+	if out.Provider != "static" || len(out.Results) != 3 {
+		t.Fatalf("unexpected output %s", output)
+	}
+	if a := out.Results[0]; a.Content != "# Page A" || a.FetchError != "" {
+		t.Errorf("page A not fetched: %+v", a)
+	}
+	if b := out.Results[1]; b.Content != "" || !strings.Contains(b.FetchError, "binary") {
+		t.Errorf("binary page B should not be returned: %+v", b)
+	}
+	if c := out.Results[2]; !strings.Contains(c.FetchError, "404") {
+		t.Errorf("expected 404 for page C: %+v", c)
+	}
+
+	output, err = search.Invoke(t.Context(), meta, `{"query": "pages", "count": 1, "fetch": 0}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = decodeWebSearchOutput(t, output)
+	if len(out.Results) != 1 || out.Results[0].Content != "" {
+		t.Errorf("expected one unfetched result, got %s", output)
+	}
+
+	output, _ = search.Invoke(t.Context(), meta, `{"query": " "}`)
+	if !strings.Contains(output, "query is empty") {
+		t.Errorf("expected an error for an empty query, got %s", output)
+	}
+}
+
+func TestFetchSearchResultsRecovers(t *testing.T) {
+	// a nil fetcher panics on every fetch
+	results := []SearchResult{{URL: "https://example.com/a"}, {URL: "https://example.com/b"}}
+	fetchSearchResults(t.Context(), nil, results)
+	for _, r := range results {
+		if !strings.Contains(r.FetchError, "failed to fetch page") {
+			t.Errorf("panic not reported for %s: %+v", r.URL, r)
+		}
+	}
+}
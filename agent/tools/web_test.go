@@ -1,15 +1,251 @@
 package tools
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ryanreadbooks/tokkibot/component/tool"
 )
 
 func TestWebFetch(t *testing.T) {
-	output, err := WebFetch().Invoke(t.Context(),
+	output, err := WebFetch(nil).Invoke(t.Context(),
 		tool.InvokeMeta{Channel: "test", ChatId: "test"},
 		`{"url": "https://www.bing.com"}`)
 	t.Log(err)
 	t.Log(output)
 }
+
+const testArticlePage = `<html><head><title>Tuning the garbage collector - Example Blog</title></head>
+<body>
+<header><a href="/">Example Blog</a><a href="/about">About</a></header>
+<nav><ul><li><a href="/a">Archive</a></li><li><a href="/b">Tags</a></li></ul></nav>
+<div class="sidebar-widget"><p>Subscribe to the newsletter for weekly posts about nothing in particular.</p></div>
+<div class="post-content">
+<p>The garbage collector of the runtime can be tuned with two knobs, which trade memory for cpu time.</p>
+<p>Raising the target percentage makes collections rarer, at the cost of a larger heap, and the memory limit caps the heap.</p>
+<p>Most services, however, run well with the defaults, so measure before changing anything, and change one knob at a time.</p>
+</div>
+<footer>Copyright Example Blog</footer>
+</body></html>`
+
+func TestExtractMainContent(t *testing.T) {
+	out, err := extractMainContent([]byte(testArticlePage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	for _, want := range []string{"<h1>Tuning the garbage collector</h1>", "two knobs", "measure before changing"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("main content misses %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"Archive", "About", "newsletter", "Copyright"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("main content holds %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestWebFetcherPages(t *testing.T) {
+	content := strings.Repeat("0123456789", 10) + "äöü"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, testArticlePage)
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, testPDF("Hello from a PDF"))
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, content)
+		}
+	}))
+	defer srv.Close()
+
+	f := NewWebFetcher()
+	out, err := f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + "/page.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.Content, "# Tuning the garbage collector") || strings.Contains(out.Content, "Archive") {
+		t.Errorf("unexpected markdown:\n%s", out.Content)
+	}
+	out, err = f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + "/page.html", FullPage: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.Content, "Archive") {
+		t.Errorf("full page misses the navigation:\n%s", out.Content)
+	}
+
+	out, err = f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + "/doc.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.IsBinary || out.Content != "## Page 1\n\nHello from a PDF" {
+		t.Errorf("unexpected pdf text: %+v", out)
+	}
+
+	out, err = f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + "/text", Limit: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Content != content[:60] || !out.Truncated || out.NextOffset != 60 || out.TotalChars != 103 {
+		t.Errorf("unexpected first part: %+v", out)
+	}
+	out, err = f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + "/text", Offset: out.NextOffset, Limit: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Content != content[60:] || out.Truncated || out.NextOffset != 0 {
+		t.Errorf("unexpected last part: %+v", out)
+	}
+	if _, err := f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + "/text", Offset: 103}); err == nil {
+		t.Error("expected an error for an offset past the end")
+	}
+}
+
+func TestWebFetcherCache(t *testing.T) {
+	var requests, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		fmt.Fprint(w, "cached content")
+	}))
+	defer srv.Close()
+
+	f := NewWebFetcher(WithWebFetchCache(t.TempDir(), time.Hour))
+	fetch := func(path string) *WebFetchOutput {
+		t.Helper()
+		out, err := f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Content != "cached content" {
+			t.Fatalf("unexpected content %q", out.Content)
+		}
+		return out
+	}
+
+	if fetch("/page").Cached {
+		t.Error("first fetch should not be cached")
+	}
+	if !fetch("/page").Cached || requests.Load() != 1 {
+		t.Errorf("fresh page should be served from the cache, requests %d", requests.Load())
+	}
+
+	// age the entry so that it is revalidated
+	entry, _ := f.cache.load(srv.URL + "/page")
+	entry.FetchedAt = time.Now().Add(-30 * time.Minute)
+	f.cache.writeEntry(t.Context(), entry)
+	if !fetch("/page").Cached || requests.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("stale page should be revalidated, requests %d, not modified %d", requests.Load(), notModified.Load())
+	}
+
+	// entries older than the ttl are fetched again
+	entry.FetchedAt = time.Now().Add(-2 * time.Hour)
+	f.cache.writeEntry(t.Context(), entry)
+	if fetch("/page").Cached || requests.Load() != 3 {
+		t.Errorf("expired page should be fetched again, requests %d", requests.Load())
+	}
+
+	fetch("/private")
+	if fetch("/private").Cached {
+		t.Error("no-store page should not be cached")
+	}
+}
+
+func TestWebFetcherRobots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\nAllow: /private/open\n")
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	f := NewWebFetcher(WithWebFetchRobots())
+	if _, err := f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + "/private/secret"}); err == nil ||
+		!strings.Contains(err.Error(), "disallowed by the robots.txt") {
+		t.Errorf("expected a robots.txt error, got %v", err)
+	}
+	for _, path := range []string{"/public", "/private/open"} {
+		if _, err := f.Fetch(t.Context(), &WebFetchInput{URL: srv.URL + path}); err != nil {
+			t.Errorf("fetching %s: %v", path, err)
+		}
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := `# comment
+User-agent: Googlebot
+Disallow: /
+
+User-agent: TokkiBot
+User-agent: other
+Disallow: /tmp/
+Disallow: /*.pdf$
+Allow: /tmp/public
+
+User-agent: *
+Disallow: /everything
+`
+	rules := parseRobots([]byte(robots), robotsAgent)
+	cases := map[string]bool{
+		"/":                  true,
+		"/everything":        true,
+		"/tmp/x":             false,
+		"/tmp/public/x":      true,
+		"/files/a.pdf":       false,
+		"/files/a.pdf?x=1":   true,
+		"/files/a.pdf.html":  true,
+		"/files/pdf":         true,
+		"/tmp":               true,
+		"/tmp/public-index/": true,
+	}
+	for path, want := range cases {
+		if got := robotsAllowed(rules, path); got != want {
+			t.Errorf("robotsAllowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	rules = parseRobots([]byte(robots), "somebot")
+	if robotsAllowed(rules, "/everything/x") || !robotsAllowed(rules, "/tmp/x") {
+		t.Error("expected the rules of the * group")
+	}
+}
+
+// testPDF returns a one page pdf file showing text.
+func testPDF(text string) string {
+	content := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.String()
+}
@@ -1,9 +1,12 @@
 package agent
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 
 	"github.com/ryanreadbooks/tokkibot/agent/context/session"
+	"github.com/ryanreadbooks/tokkibot/agent/tools"
 	"github.com/ryanreadbooks/tokkibot/component/skill"
 	"github.com/ryanreadbooks/tokkibot/component/tool"
 	"github.com/ryanreadbooks/tokkibot/config"
@@ -52,14 +55,14 @@ func (a *Agent) GetCurrentContextTokens(channel, chatId string) int64 {
 	a.cachedReqsMu.RUnlock()
 
 	// If no cached request, build a minimal request without triggering compaction
-	msgList, err := a.contextManager.GetMessageContext(channel, chatId)
+	msgList, err := a.contextManager.GetMessageContext(channel, chatId, nil)
 	if err != nil {
 		return 0
 	}
 
 	// Create a temporary request for estimation only (without calling buildLLMMessageRequest)
 	fakeReq := schema.NewRequest(a.cfg.Model, msgList)
-	fakeReq.Tools = a.buildLLMTools()
+	fakeReq.Tools = a.buildLLMTools(a.cfg.RootCtx)
 
 	tokens, err := est.Estimate(a.cfg.RootCtx, fakeReq)
 	if err != nil {
@@ -113,8 +116,8 @@ func (a *Agent) SetProviderAndModel(provider, model string) error {
 
 	// Create new LLM client with the new provider config
 	newLLM, err := factory.NewLLM(
-		factory.WithAPIKey(providerCfg.ApiKey),
-		factory.WithBaseURL(providerCfg.BaseURL),
+		factory.WithAPIKey(providerCfg.GetApiKey()),
+		factory.WithBaseURL(providerCfg.GetBaseURL()),
 		factory.WithStyle(factory.Style(providerCfg.Style)),
 	)
 	if err != nil {
@@ -129,6 +132,51 @@ func (a *Agent) SetProviderAndModel(provider, model string) error {
 	return nil
 }
 
+func (a *Agent) SetMaxIteration(n int) {
+	a.cfg.MaxIteration = n
+}
+
+// SetSandbox applies a new sandbox config by recreating the tools which run
+// in the sandbox.
+func (a *Agent) SetSandbox(sb *config.SandboxConfig) {
+	a.cfg.Sandbox = sb
+	// shells of the old sandbox do not follow the new config
+	if a.shellSessions != nil {
+		a.shellSessions.Close()
+	}
+	a.UnRegisterTool(tools.ToolNameShell)
+	a.UnRegisterTool(tools.ToolNameUseSkill)
+	a.registerSandboxTools(a.accessibleDirs(a.cfg.WorkspaceDir))
+}
+
+// SetWeb applies new web fetch and web search configs by recreating
+// web_fetch and web_search.
+func (a *Agent) SetWeb(wf *config.WebFetchConfig, ws *config.WebSearchConfig) {
+	a.cfg.WebFetch = wf
+	a.cfg.WebSearch = ws
+	a.UnRegisterTool(tools.ToolNameWebFetch)
+	a.UnRegisterTool(tools.ToolNameWebSearch)
+	a.registerWebTools()
+}
+
+// ReloadMcp reconnects mcp servers with the current mcp config.
+func (a *Agent) ReloadMcp(ctx context.Context) error {
+	mcpConfig, err := config.GetMcpConfig()
+	if err != nil {
+		a.mcpLoaded.Store(false)
+		return a.mcpManager.Reload(ctx, config.McpConfig{})
+	}
+
+	if err := a.mcpManager.Reload(ctx, mcpConfig); err != nil {
+		return fmt.Errorf("failed to reload mcp tools: %w", err)
+	}
+	a.mcpLoaded.Store(true)
+	slog.InfoContext(ctx, "[agent] mcp tools reloaded",
+		slog.String("name", a.cfg.Name),
+		slog.Int("tools_count", len(a.mcpManager.ListTools())))
+	return nil
+}
+
 func (a *Agent) GetToolCount() int {
 	a.toolsMu.RLock()
 	defer a.toolsMu.RUnlock()
@@ -149,6 +197,10 @@ func (a *Agent) ClearContext(channel, chatId string) error {
 	a.cachedReqsMu.Lock()
 	delete(a.cachedReqs, cacheKey)
 	a.cachedReqsMu.Unlock()
+	a.approvals.clear(cacheKey)
+	if a.shellSessions != nil {
+		a.shellSessions.Reset(channel, chatId)
+	}
 
 	return a.contextManager.ClearSession(channel, chatId)
 }
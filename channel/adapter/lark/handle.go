@@ -10,6 +10,7 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/ryanreadbooks/tokkibot/channel/adapter/lark/emoji"
 	"github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/pkg/document"
 	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
 )
 
@@ -215,31 +216,31 @@ func (a *LarkAdapter) handleImageMessage(ctx context.Context, messageId, content
 	return image.ImageKey, data, mimeType.String(), nil
 }
 
-func (a *LarkAdapter) handleFileMessage(ctx context.Context, messageId, content string) (string, []byte, error) {
+func (a *LarkAdapter) handleFileMessage(ctx context.Context, messageId, content string) (string, []byte, string, error) {
 	// download file
 	var file FileMessageContent
 	err := json.Unmarshal(xstring.ToBytes(content), &file)
 	if err != nil {
-		return "", nil, err
+		return "", nil, "", err
 	}
 
 	if len(file.FileKey) == 0 {
-		return "", nil, fmt.Errorf("file key is empty")
+		return "", nil, "", fmt.Errorf("file key is empty")
 	}
 
 	data, err := a.downloadMessageResourceFile(ctx, messageId, file.FileKey)
 	if err != nil {
-		return "", nil, err
+		return "", nil, "", err
 	}
 
 	// detect file type, video may be provided here
 	mimeType := mimetype.Detect(data)
-	// only handle text files for now
-	if !strings.Contains(mimeType.String(), "text") {
-		return "", nil, fmt.Errorf("[%s] 只支持处理文本文件", emoji.EMBARRASSED)
+	// text files and documents which are converted to markdown
+	if !strings.Contains(mimeType.String(), "text") && document.Detect(file.FileName, data) == "" {
+		return "", nil, "", fmt.Errorf("[%s] 只支持处理文本文件和 PDF、Word、Excel、PPT、CSV 文档", emoji.EMBARRASSED)
 	}
 
-	return file.FileName, data, nil
+	return file.FileName, data, mimeType.String(), nil
 }
 
 func (a *LarkAdapter) handleAudioMessage(ctx context.Context, messageId, content string) (string, []byte, error) {
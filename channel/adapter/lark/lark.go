@@ -299,12 +299,14 @@ func (a *LarkAdapter) onMessageReceive(ctx context.Context, event *imv1.P2Messag
 		var (
 			fileData []byte
 			fileName string
+			mimeType string
 		)
-		fileName, fileData, err = a.handleFileMessage(ctx, messageId, messageContent)
+		fileName, fileData, mimeType, err = a.handleFileMessage(ctx, messageId, messageContent)
 		attachments = append(attachments, &model.IncomingMessageAttachment{
-			Key:  wrapResourceKey(fileName),
-			Type: model.AttachmentFile,
-			Data: fileData,
+			Key:      wrapResourceKey(fileName),
+			Type:     model.AttachmentFile,
+			Data:     fileData,
+			MimeType: mimeType,
 		})
 	case imv1.MsgTypeAudio:
 		var (
@@ -421,6 +423,7 @@ func (a *LarkAdapter) onMessageReceive(ctx context.Context, event *imv1.P2Messag
 		SourceCtx: sourceCtx,
 		Stream:    true,
 		OnContent: state.onContent,
+		OnTool:    state.onTool,
 		OnDone:    state.onDone,
 	}
 
@@ -432,6 +435,8 @@ func (a *LarkAdapter) onMessageReceive(ctx context.Context, event *imv1.P2Messag
 const (
 	streamFlushInterval  = 700 * time.Millisecond
 	streamFlushThreshold = 256 // flush when accumulated content exceeds this
+	maxCardDiffLines     = 40  // lines of a file change diff shown in the card
+	maxCardOutputLines   = 15  // lines of the output of a running command shown in the card
 
 	metaKeyMessageId  = "message_id"
 	metaKeySenderId   = "sender_id"
@@ -460,6 +465,10 @@ type larkStreamState struct {
 	streamSendEnabled       bool
 	shouldRecallCardMessage bool
 
+	// tail of the output of the running command
+	toolOutput        string
+	toolOutputChanged bool
+
 	dirty               bool
 	lastSeqLen          int
 	lastReasoningSeqLen int
@@ -516,8 +525,11 @@ func (s *larkStreamState) flush(ctx context.Context) {
 
 	content := s.contentBuilder.String()
 	reasoningContent := s.reasoningContentBuilder.String()
+	if s.toolOutput != "" {
+		content += "\n```\n" + s.toolOutput + "\n```\n"
+	}
 
-	contentChanged := len(content) != s.lastSeqLen
+	contentChanged := len(content) != s.lastSeqLen || s.toolOutputChanged
 	reasoningChanged := len(reasoningContent) != s.lastReasoningSeqLen
 	if !contentChanged && !reasoningChanged {
 		return
@@ -546,6 +558,7 @@ func (s *larkStreamState) flush(ctx context.Context) {
 		}
 		s.seq++
 		s.lastSeqLen = len(content)
+		s.toolOutputChanged = false
 	}
 
 	s.dirty = false
@@ -573,6 +586,49 @@ func (s *larkStreamState) onContent(content *model.StreamContent) {
 	}
 }
 
+// onTool shows the diffs of files changed by tool calls and the output of
+// running commands in the card.
+func (s *larkStreamState) onTool(tool *model.StreamTool) {
+	if tool.Output != "" || tool.OutputDone {
+		s.onToolOutput(tool)
+		return
+	}
+	if tool.Diff == "" {
+		return
+	}
+
+	lines := strings.Split(strings.TrimSuffix(tool.Diff, "\n"), "\n")
+	if len(lines) > maxCardDiffLines {
+		more := len(lines) - maxCardDiffLines
+		lines = append(lines[:maxCardDiffLines], fmt.Sprintf("... (%d more lines)", more))
+	}
+	s.onContent(&model.StreamContent{
+		Round:           tool.Round,
+		Content:         "\n```diff\n" + strings.Join(lines, "\n") + "\n```\n",
+		ThinkingEnabled: s.thinkingEnabled,
+	})
+}
+
+// onToolOutput shows the last lines of the output of a running command below
+// the content until the command finishes.
+func (s *larkStreamState) onToolOutput(tool *model.StreamTool) {
+	s.initOnce.Do(func() { s.init(s.thinkingEnabled) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tool.OutputDone {
+		s.toolOutput = ""
+	} else {
+		lines := strings.Split(strings.TrimRight(s.toolOutput+tool.Output, "\n"), "\n")
+		if len(lines) > maxCardOutputLines {
+			lines = lines[len(lines)-maxCardOutputLines:]
+		}
+		s.toolOutput = strings.Join(lines, "\n")
+	}
+	s.toolOutputChanged = true
+	s.dirty = true
+}
+
 func (s *larkStreamState) onDone() {
 	if s.stopCh != nil {
 		close(s.stopCh)
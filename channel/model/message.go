@@ -17,6 +17,13 @@ type StreamTool struct {
 	Round     int
 	Name      string
 	Arguments string
+	// Diff is set instead of the name and arguments when a tool call changed
+	// a file, it is the unified diff of the change
+	Diff string
+	// Output is set instead of the arguments while a tool call runs, it is
+	// the output produced since the last event. OutputDone marks the last one
+	Output     string
+	OutputDone bool
 }
 
 // ConfirmRequest represents a tool confirmation request
@@ -35,6 +42,9 @@ type ConfirmRequest struct {
 type ConfirmResponse struct {
 	Confirmed bool
 	Reason    string
+	Always    bool // allow the same call for the rest of the session
+
+	ResponderId string // sender who answered, empty if it is the requester
 }
 
 // ConfirmEvent wraps a confirmation request with response channel
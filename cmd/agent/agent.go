@@ -12,6 +12,7 @@ import (
 	"github.com/ryanreadbooks/tokkibot/cmd/agent/ui/tui"
 	cfg "github.com/ryanreadbooks/tokkibot/config"
 	"github.com/ryanreadbooks/tokkibot/gateway"
+	"github.com/ryanreadbooks/tokkibot/pkg/audit"
 
 	"github.com/spf13/cobra"
 )
@@ -29,6 +30,7 @@ var AgentCmd = &cobra.Command{
 	Short: "Interact with tokkibot agent in a CLI.",
 	Long:  "Interact with tokkibot agent in a CLI.",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		initAudit()
 		if oneTimeQuestion != "" {
 			return runAgentOnce(cmd.Context(), oneTimeQuestion)
 		}
@@ -76,6 +78,13 @@ func init() {
 	AgentCmd.AddCommand(AgentSystemPromptCmd)
 }
 
+// initAudit opens the audit log of tool executions, it is closed on exit.
+func initAudit() {
+	if err := audit.Init(cfg.GetAuditLogPath()); err != nil {
+		slog.Error("[cmd/agent] failed to open audit log, tool executions are not audited", slog.Any("error", err))
+	}
+}
+
 func runAgentOnce(ctx context.Context, message string) error {
 	slog.Info("[cmd/agent] running one-time agent", slog.String("agent", agentName), slog.Int("message_len", len(message)))
 
@@ -43,9 +43,12 @@ type StreamContent struct {
 }
 
 type StreamToolCall struct {
-	Round     int
-	Name      string
-	Arguments string
+	Round      int
+	Name       string
+	Arguments  string
+	Diff       string
+	Output     string
+	OutputDone bool
 }
 
 // SendMessage sends a message via adapter to gateway and returns streaming result
@@ -70,9 +73,12 @@ func (h *AgentHandler) SendMessage(ctx context.Context, content string) *StreamR
 	go func() {
 		for tc := range result.ToolCall {
 			toolCallCh <- &StreamToolCall{
-				Round:     tc.Round,
-				Name:      tc.Name,
-				Arguments: tc.Arguments,
+				Round:      tc.Round,
+				Name:       tc.Name,
+				Arguments:  tc.Arguments,
+				Diff:       tc.Diff,
+				Output:     tc.Output,
+				OutputDone: tc.OutputDone,
 			}
 		}
 		close(toolCallCh)
@@ -104,6 +104,32 @@ func (c *ChatComponent) UpdateLastToolCall(toolName, arguments string) {
 	}
 }
 
+// AppendToolCallOutput appends output of a running tool call to the last
+// tool call message with the name. The output is shown until the call
+// finishes.
+func (c *ChatComponent) AppendToolCallOutput(toolName, output string, done bool) {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].IsToolCall() && c.messages[i].ToolName == toolName {
+			c.messages[i].ToolOutput += output
+			c.messages[i].ToolRunning = !done
+			c.refresh()
+			return
+		}
+	}
+}
+
+// AddToolCallDiff attaches the diff of a changed file to the last completed
+// tool call message
+func (c *ChatComponent) AddToolCallDiff(diff string) {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].IsToolCall() && c.messages[i].ToolComplete {
+			c.messages[i].ToolDiffs = append(c.messages[i].ToolDiffs, diff)
+			c.refresh()
+			return
+		}
+	}
+}
+
 // SetSize updates the component size
 func (c *ChatComponent) SetSize(width, height int) {
 	c.width = width
@@ -155,7 +181,7 @@ func (c *ChatComponent) renderMessages() string {
 				sb.WriteString(c.renderAssistantMessage(msg.Content))
 			}
 		} else if msg.IsToolCall() {
-			sb.WriteString(c.renderToolCallMessage(msg.ToolName, msg.ToolArguments))
+			sb.WriteString(c.renderToolCallMessage(&msg))
 		}
 	}
 
@@ -217,17 +243,23 @@ func (c *ChatComponent) renderThinkingMessage(content string) string {
 }
 
 // renderToolCallMessage renders a tool call message (no box, similar to thinking)
-func (c *ChatComponent) renderToolCallMessage(name, args string) string {
-	header := c.theme.ToolCallMsg.HeaderStyle.Render("🔧 Tool: " + name)
+func (c *ChatComponent) renderToolCallMessage(msg *types.Message) string {
+	header := c.theme.ToolCallMsg.HeaderStyle.Render("🔧 Tool: " + msg.ToolName)
 
 	// Format arguments
 	var argsDisplay string
-	if args == "" {
+	if msg.ToolArguments == "" {
 		argsDisplay = "⟳ executing..."
 	} else {
-		argsDisplay = types.FormatToolCallArgs(name, args, 100)
+		argsDisplay = types.FormatToolCallArgs(msg.ToolName, msg.ToolArguments, 100)
 	}
 
 	body := c.theme.ToolCallMsg.BodyStyle.Render(argsDisplay)
+	if msg.ToolRunning && msg.ToolOutput != "" {
+		body += "\n" + types.FormatToolOutput(msg.ToolOutput, 10, 100)
+	}
+	for _, diff := range msg.ToolDiffs {
+		body += "\n" + types.FormatUnifiedDiff(diff, 30, 100)
+	}
 	return header + "\n" + body + "\n"
 }
@@ -62,7 +62,7 @@ func (c *ConfirmDialog) View() string {
 		command = c.request.ToolName
 	}
 
-	confirmText := fmt.Sprintf("⚠️  %s\n\n%s\n\n> %s\n\n[Enter] Accept  [Esc] Reject  [Ctrl+C] Cancel",
+	confirmText := fmt.Sprintf("⚠️  %s\n\n%s\n\n> %s\n\n[Enter] Accept  [A] Always for this session  [Esc] Reject  [Ctrl+C] Cancel",
 		title, description, command)
 
 	return c.theme.Confirm.BoxStyle.Width(boxWidth).Render(confirmText)
@@ -95,6 +95,14 @@ func (c *ConfirmDialog) Accept() {
 	c.Hide()
 }
 
+// AcceptAlways confirms the action and allows it for the rest of the session
+func (c *ConfirmDialog) AcceptAlways() {
+	if c.respCh != nil {
+		c.respCh <- &model.ConfirmResponse{Confirmed: true, Always: true}
+	}
+	c.Hide()
+}
+
 // Reject rejects the action
 func (c *ConfirmDialog) Reject() {
 	if c.respCh != nil {
@@ -17,6 +17,10 @@ type (
 		Round     int
 		Name      string
 		Arguments string
+		Diff      string
+		// output of a running tool call
+		Output     string
+		OutputDone bool
 	}
 
 	// ClearRoundMsg signals the end of a conversation round
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -107,6 +108,11 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (Model, tea.Cmd) {
 		case tea.KeyEsc:
 			m.confirm.Reject()
 			return m, nil
+		case tea.KeyRunes:
+			if strings.EqualFold(string(msg.Runes), "a") {
+				m.confirm.AcceptAlways()
+			}
+			return m, nil
 		}
 		// Ignore other keys during confirmation
 		return m, nil
@@ -174,9 +180,12 @@ func (m Model) handleKeyPress(msg tea.KeyMsg) (Model, tea.Cmd) {
 		go func() {
 			for tc := range stream.ToolCall {
 				program.Send(ToolCallMsg{
-					Round:     tc.Round,
-					Name:      tc.Name,
-					Arguments: tc.Arguments,
+					Round:      tc.Round,
+					Name:       tc.Name,
+					Arguments:  tc.Arguments,
+					Diff:       tc.Diff,
+					Output:     tc.Output,
+					OutputDone: tc.OutputDone,
 				})
 			}
 			// Signal completion
@@ -224,6 +233,17 @@ func (m Model) handleContent(msg ContentMsg) Model {
 
 // handleToolCall handles tool call events
 func (m Model) handleToolCall(msg ToolCallMsg) Model {
+	if msg.Diff != "" {
+		// a file was changed by the last tool call
+		m.chat.AddToolCallDiff(msg.Diff)
+		return m
+	}
+
+	if msg.Output != "" || msg.OutputDone {
+		m.chat.AppendToolCallOutput(msg.Name, msg.Output, msg.OutputDone)
+		return m
+	}
+
 	if msg.Name == "" {
 		// Tool call finished, mark last tool message as complete
 		// Find and update the last tool call message
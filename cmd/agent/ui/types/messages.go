@@ -32,6 +32,9 @@ type Message struct {
 	ToolName      string
 	ToolArguments string
 	ToolComplete  bool
+	ToolDiffs     []string // unified diffs of the files changed by the call
+	ToolOutput    string   // output of the call while it runs
+	ToolRunning   bool     // output of the call is still streaming
 }
 
 // IsUser returns true if message is from user
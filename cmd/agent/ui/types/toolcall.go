@@ -49,8 +49,14 @@ func FormatToolCallArgs(name string, argsJSON string, maxLen int) string {
 		return formatWriteFileArgs(args)
 	case tools.ToolNameEditFile:
 		return formatEditFileArgs(args)
+	case tools.ToolNameMultiEdit:
+		return formatMultiEditArgs(args)
+	case tools.ToolNameApplyPatch:
+		return formatApplyPatchArgs(args)
 	case tools.ToolNameListDir:
 		return formatListDirArgs(args)
+	case tools.ToolNameGrep:
+		return formatGrepArgs(args)
 	case tools.ToolNameShell:
 		return formatShellArgs(args)
 	case tools.ToolNameTodoWrite:
@@ -121,6 +127,27 @@ func formatEditFileArgs(args map[string]any) string {
 	return strings.TrimSuffix(sb.String(), "\n")
 }
 
+func formatMultiEditArgs(args map[string]any) string {
+	path, ok := args["path"].(string)
+	if !ok {
+		return formatGenericArgs(args, 100)
+	}
+	edits, _ := args["edits"].([]any)
+	return fmt.Sprintf("✏️  %s (%d edits)", shortenPath(path, 50), len(edits))
+}
+
+func formatApplyPatchArgs(args map[string]any) string {
+	patch, ok := args["patch"].(string)
+	if !ok {
+		return formatGenericArgs(args, 100)
+	}
+	paths := tools.PatchPaths(patch)
+	for i := range paths {
+		paths[i] = shortenPath(paths[i], 40)
+	}
+	return fmt.Sprintf("🩹 %s", strings.Join(paths, ", "))
+}
+
 func formatListDirArgs(args map[string]any) string {
 	if path, ok := args["path"].(string); ok {
 		return fmt.Sprintf("📁 %s", shortenPath(path, 60))
@@ -128,11 +155,34 @@ func formatListDirArgs(args map[string]any) string {
 	return formatGenericArgs(args, 100)
 }
 
+func formatGrepArgs(args map[string]any) string {
+	pattern, ok := args["pattern"].(string)
+	if !ok {
+		return formatGenericArgs(args, 100)
+	}
+
+	parts := []string{fmt.Sprintf("🔍 %s", truncateString(pattern, 40))}
+	if path, ok := args["path"].(string); ok && path != "" {
+		parts = append(parts, fmt.Sprintf("in %s", shortenPath(path, 40)))
+	}
+	for _, key := range []string{"glob", "type"} {
+		if v, ok := args[key].(string); ok && v != "" {
+			parts = append(parts, fmt.Sprintf("%s %s", key, v))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
 func formatShellArgs(args map[string]any) string {
-	if cmd, ok := args["command"].(string); ok {
-		return fmt.Sprintf("$ %s", cmd)
+	cmd, ok := args["command"].(string)
+	if !ok {
+		return formatGenericArgs(args, 100)
 	}
-	return formatGenericArgs(args, 100)
+	if bg, _ := args["run_in_background"].(bool); bg {
+		return fmt.Sprintf("$ %s &", cmd)
+	}
+	return fmt.Sprintf("$ %s", cmd)
 }
 
 func formatTodoWriteArgs(args map[string]any) string {
@@ -403,3 +453,44 @@ func splitContentLines(s string) []string {
 	}
 	return lines
 }
+
+// FormatUnifiedDiff colors a unified diff of a file change made by a tool,
+// showing at most maxLines lines.
+// FormatToolOutput shows the last lines of the output of a running tool
+// call.
+func FormatToolOutput(output string, maxLines int, maxLineLen int) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	var sb strings.Builder
+	if len(lines) > maxLines {
+		fmt.Fprintf(&sb, "  ... (%d earlier lines)\n", len(lines)-maxLines)
+		lines = lines[len(lines)-maxLines:]
+	}
+	for _, line := range lines {
+		fmt.Fprintf(&sb, "  %s\n", diffSepStyle.Render(truncateString(line, maxLineLen)))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func FormatUnifiedDiff(diff string, maxLines int, maxLineLen int) string {
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	shown := clampLines(len(lines), maxLines)
+
+	var sb strings.Builder
+	for _, line := range lines[:shown] {
+		line = truncateString(line, maxLineLen)
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "@@"):
+			line = diffSepStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			line = diffAddStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = diffDelStyle.Render(line)
+		}
+		fmt.Fprintf(&sb, "  %s\n", line)
+	}
+	if shown < len(lines) {
+		fmt.Fprintf(&sb, "  ... (%d more lines)\n", len(lines)-shown)
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
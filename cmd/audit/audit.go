@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/config"
+	pkgaudit "github.com/ryanreadbooks/tokkibot/pkg/audit"
+	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
+	"github.com/spf13/cobra"
+)
+
+const maxListArgumentsLen = 80
+
+var (
+	filterAgent   string
+	filterChannel string
+	filterChat    string
+	filterSender  string
+	filterTool    string
+	filterStatus  string
+	filterSince   string
+	filterUntil   string
+	limit         int
+	jsonl         bool
+	output        string
+)
+
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the audit log of tool executions",
+	Long: "List tool executions recorded in " + config.GetAuditLogPath() + ".\n" +
+		"Use --jsonl to export matching entries as JSON lines, and `tokkibot audit verify` to check the log for tampering.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := buildFilter()
+		if err != nil {
+			return err
+		}
+
+		var (
+			entries []*pkgaudit.Entry
+			raws    [][]byte
+		)
+		err = pkgaudit.Read(config.GetAuditLogPath(), func(e *pkgaudit.Entry, raw []byte) bool {
+			if filter.Match(e) {
+				entries = append(entries, e)
+				raws = append(raws, append([]byte(nil), raw...))
+			}
+			return true
+		})
+		if os.IsNotExist(err) {
+			fmt.Println("No audit entries found.")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		// keep the latest entries
+		if limit > 0 && len(entries) > limit {
+			entries = entries[len(entries)-limit:]
+			raws = raws[len(raws)-limit:]
+		}
+
+		if jsonl {
+			return exportJSONL(raws)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No audit entries found.")
+			return nil
+		}
+		printEntries(entries)
+		return nil
+	},
+}
+
+func buildFilter() (*pkgaudit.Filter, error) {
+	filter := &pkgaudit.Filter{
+		Agent:   filterAgent,
+		Channel: filterChannel,
+		ChatId:  filterChat,
+		Sender:  filterSender,
+		Tool:    filterTool,
+		Status:  filterStatus,
+	}
+	var err error
+	if filter.Since, err = parseTime(filterSince); err != nil {
+		return nil, fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseTime(filterUntil); err != nil {
+		return nil, fmt.Errorf("invalid --until: %w", err)
+	}
+	return filter, nil
+}
+
+// parseTime parses an RFC3339 time, a date, or a duration ago such as 24h.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
+
+func exportJSONL(raws [][]byte) error {
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, raw := range raws {
+		bw.Write(raw)
+		bw.WriteByte('\n')
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to export audit entries: %w", err)
+	}
+	if output != "" {
+		fmt.Printf("Exported %d entries to %s\n", len(raws), output)
+	}
+	return nil
+}
+
+func printEntries(entries []*pkgaudit.Entry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEQ\tTIME\tAGENT\tCHAT\tSENDER\tTOOL\tSTATUS\tAPPROVED BY\tARGUMENTS")
+	fmt.Fprintln(w, "---\t----\t-----\t----\t------\t----\t------\t-----------\t---------")
+	for _, e := range entries {
+		sender := e.SenderName
+		if sender == "" {
+			sender = e.SenderId
+		}
+		approvedBy := "-"
+		if e.ConfirmRequested || e.ApprovedBy != "" {
+			approvedBy = e.ApprovedBy
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Seq,
+			e.Time.Local().Format(time.DateTime),
+			e.Agent,
+			orDash(e.Channel+":"+e.ChatId, e.ChatId == ""),
+			orDash(sender, sender == ""),
+			e.Tool,
+			e.Status,
+			orDash(approvedBy, approvedBy == ""),
+			xstring.Truncate(compactJSON(e.Arguments), maxListArgumentsLen),
+		)
+	}
+	w.Flush()
+}
+
+func orDash(s string, empty bool) string {
+	if empty {
+		return "-"
+	}
+	return s
+}
+
+// compactJSON shows the arguments on one line.
+func compactJSON(s string) string {
+	var v any
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return s
+	}
+	return string(b)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:          "verify",
+	Short:        "Verify the hash chain of the audit log",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := pkgaudit.Verify(config.GetAuditLogPath())
+		if os.IsNotExist(err) {
+			fmt.Println("No audit log found.")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%d entries verified before the failure: %w", n, err)
+		}
+		fmt.Printf("Audit log is intact, %d entries verified\n", n)
+		return nil
+	},
+}
+
+func init() {
+	flags := AuditCmd.Flags()
+	flags.StringVar(&filterAgent, "agent", "", "Filter by agent")
+	flags.StringVar(&filterChannel, "channel", "", "Filter by channel")
+	flags.StringVar(&filterChat, "chat", "", "Filter by chat id")
+	flags.StringVar(&filterSender, "sender", "", "Filter by sender id or name")
+	flags.StringVar(&filterTool, "tool", "", "Filter by tool name, globs are supported")
+	flags.StringVar(&filterStatus, "status", "", "Filter by status: ok, error, denied, rejected, cancelled, not_found")
+	flags.StringVar(&filterSince, "since", "", "Entries since a time (RFC3339, YYYY-MM-DD or a duration such as 24h)")
+	flags.StringVar(&filterUntil, "until", "", "Entries until a time (RFC3339, YYYY-MM-DD or a duration such as 1h)")
+	flags.IntVarP(&limit, "limit", "n", 50, "Show only the latest n entries, 0 for all")
+	flags.BoolVar(&jsonl, "jsonl", false, "Print full entries as JSON lines")
+	flags.StringVarP(&output, "output", "o", "", "Write JSON lines to a file instead of stdout (with --jsonl)")
+
+	AuditCmd.AddCommand(verifyCmd)
+}
@@ -3,6 +3,7 @@ package cron
 import (
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -16,7 +17,7 @@ import (
 var CronCmd = &cobra.Command{
 	Use:   "cron",
 	Short: "Manage cron tasks",
-	Long:  "Add, delete, list, enable or disable cron tasks.",
+	Long:  "Add, delete, list, enable or disable cron tasks, and inspect their run history.",
 }
 
 var listCmd = &cobra.Command{
@@ -35,8 +36,8 @@ var listCmd = &cobra.Command{
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "NAME\tEXPR\tENABLED\tONCE\tDELIVER\tLAST RUN\tNEXT RUN")
-		fmt.Fprintln(w, "----\t----\t-------\t----\t-------\t--------\t--------")
+		fmt.Fprintln(w, "NAME\tEXPR\tENABLED\tONCE\tDELIVER\tLAST RUN\tSTATUS\tNEXT RUN")
+		fmt.Fprintln(w, "----\t----\t-------\t----\t-------\t--------\t------\t--------")
 
 		for _, task := range tasks {
 			lastRun := "-"
@@ -54,8 +55,13 @@ var listCmd = &cobra.Command{
 				deliver = fmt.Sprintf("%s:%s", task.DeliverChannel, task.DeliverTo)
 			}
 
-			fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%s\t%s\t%s\n",
-				task.Name, task.CronExpr, task.Enabled, task.OneShot, deliver, lastRun, nextRun)
+			lastStatus := "-"
+			if task.LastStatus != "" {
+				lastStatus = string(task.LastStatus)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%s\t%s\t%s\t%s\n",
+				task.Name, task.CronExpr, task.Enabled, task.IsOneShot(), deliver, lastRun, lastStatus, nextRun)
 		}
 		w.Flush()
 		return nil
@@ -70,6 +76,24 @@ var (
 	addDeliver bool
 	addChannel string
 	addTo      string
+
+	addRetries         int
+	addRetryBackoff    string
+	addRetryMaxBackoff string
+	addNotifyChannel   string
+	addNotifyTo        string
+
+	addTimezone  string
+	addJitter    string
+	addStart     string
+	addEnd       string
+	addBlackouts []string
+
+	addOnSuccess        []string
+	addOnFailure        []string
+	addDeliverIfMatch   string
+	addDeliverIfChanged bool
+	addDeliverIfJudge   string
 )
 
 var addCmd = &cobra.Command{
@@ -95,6 +119,36 @@ var addCmd = &cobra.Command{
 			}
 			opts = append(opts, cron.WithDelivery(channelType, addTo))
 		}
+		if addRetries > 0 {
+			opts = append(opts, cron.WithRetry(&cron.RetryPolicy{
+				MaxRetries: addRetries,
+				Backoff:    addRetryBackoff,
+				MaxBackoff: addRetryMaxBackoff,
+			}))
+		}
+		if addNotifyChannel != "" || addNotifyTo != "" {
+			channelType := model.Type(addNotifyChannel)
+			if addNotifyTo == "" || !model.IsCronDeliveryChannel(channelType) {
+				return fmt.Errorf("--notify-channel must be a supported channel and --notify-to is required")
+			}
+			opts = append(opts, cron.WithFailureNotify(channelType, addNotifyTo))
+		}
+
+		scheduleOpts, err := scheduleOptions()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, scheduleOpts...)
+		if len(addOnSuccess) > 0 || len(addOnFailure) > 0 {
+			opts = append(opts, cron.WithChain(addOnSuccess, addOnFailure))
+		}
+		if addDeliverIfMatch != "" || addDeliverIfChanged || addDeliverIfJudge != "" {
+			opts = append(opts, cron.WithDeliverIf(&cron.Condition{
+				Regex:   addDeliverIfMatch,
+				Changed: addDeliverIfChanged,
+				Judge:   addDeliverIfJudge,
+			}))
+		}
 
 		task := cron.NewTask(addName, addExpr, addPrompt, opts...)
 
@@ -113,14 +167,30 @@ var addCmd = &cobra.Command{
 			action = "updated"
 		}
 		fmt.Printf("Cron task '%s' %s successfully.\n", addName, action)
+		fmt.Printf("  Schedule: %s\n", task.CronExpr)
+		if next, ok := mgr.GetNextRun(addName); ok {
+			fmt.Printf("  Next run: %s\n", next.Format(time.RFC3339))
+		}
 		fmt.Printf("  Directory: %s/%s\n", mgr.CronsDir(), addName)
 		fmt.Printf("  Session ID: cron:%s\n", addName)
-		if addOnce {
+		if task.IsOneShot() {
 			fmt.Println("  One-shot: yes (will auto-disable after first run)")
 		}
 		if addDeliver {
 			fmt.Printf("  Deliver to: %s (%s)\n", addTo, addChannel)
 		}
+		if addRetries > 0 {
+			fmt.Printf("  Retries: %d\n", addRetries)
+		}
+		if addNotifyTo != "" {
+			fmt.Printf("  Notify on failure: %s (%s)\n", addNotifyTo, addNotifyChannel)
+		}
+		if len(addOnSuccess) > 0 {
+			fmt.Printf("  On success: %s\n", strings.Join(addOnSuccess, ", "))
+		}
+		if len(addOnFailure) > 0 {
+			fmt.Printf("  On failure: %s\n", strings.Join(addOnFailure, ", "))
+		}
 		return nil
 	},
 }
@@ -206,8 +276,13 @@ var runCmd = &cobra.Command{
 			return fmt.Errorf("task '%s' not found", taskName)
 		}
 
+		req, err := task.NewRunRequest(nil)
+		if err != nil {
+			return fmt.Errorf("failed to prepare the prompt: %w", err)
+		}
+
 		fmt.Printf("Running cron task '%s'...\n", taskName)
-		fmt.Printf("Prompt: %s\n\n", task.Prompt())
+		fmt.Printf("Prompt: %s\n\n", req.Prompt)
 
 		ag, err := agent.Prepare(ctx, config.CronsAgentName,
 			agent.WithWorkspace(config.GetAgentWorkspaceDir(config.MainAgentName)),
@@ -221,23 +296,81 @@ var runCmd = &cobra.Command{
 		userMessage := &agent.UserMessage{
 			Channel: "cron",
 			ChatId:  task.ChatId(),
-			Content: task.Prompt(),
+			Content: req.Prompt,
 			Created: time.Now().Unix(),
 		}
 
 		// execute
-		result := ag.Ask(ctx, userMessage)
+		run := task.NewRun(cron.TriggerManual, 1)
+		var stats agent.RunStats
+		result := ag.Ask(ctx, userMessage, agent.WithRunStats(&stats))
+		run.Finish(&cron.Outcome{
+			Agent:  config.CronsAgentName,
+			Result: result,
+			Err:    stats.Err,
+			Usage: cron.Usage{
+				PromptTokens:     stats.Usage.PromptTokens,
+				CompletionTokens: stats.Usage.CompletionTokens,
+				TotalTokens:      stats.Usage.TotalTokens,
+			},
+		})
+		if err := task.SaveRun(run); err != nil {
+			fmt.Printf("Warning: failed to record the run: %v\n", err)
+		}
 
 		fmt.Println("--- Result ---")
 		fmt.Println(result)
+		fmt.Printf("\nRun %s: %s\n", run.Id, run.Status)
 
 		return nil
 	},
 }
 
+// scheduleOptions builds the timezone, jitter, active range and blackout
+// options of the add command.
+func scheduleOptions() ([]cron.TaskOption, error) {
+	var opts []cron.TaskOption
+	if addTimezone != "" {
+		opts = append(opts, cron.WithTimezone(addTimezone))
+	}
+	if addJitter != "" {
+		opts = append(opts, cron.WithJitter(addJitter))
+	}
+	if addStart != "" || addEnd != "" {
+		var start, end *time.Time
+		if addStart != "" {
+			t, err := cron.ParseTime(addStart, addTimezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --start: %w", err)
+			}
+			start = &t
+		}
+		if addEnd != "" {
+			t, err := cron.ParseTime(addEnd, addTimezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --end: %w", err)
+			}
+			end = &t
+		}
+		opts = append(opts, cron.WithActiveRange(start, end))
+	}
+	if len(addBlackouts) > 0 {
+		windows := make([]cron.Window, 0, len(addBlackouts))
+		for _, b := range addBlackouts {
+			w, err := cron.ParseWindow(b)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --blackout: %w", err)
+			}
+			windows = append(windows, w)
+		}
+		opts = append(opts, cron.WithBlackouts(windows...))
+	}
+	return opts, nil
+}
+
 func init() {
 	addCmd.Flags().StringVar(&addName, "name", "", "Task name")
-	addCmd.Flags().StringVar(&addExpr, "expr", "", "Cron expression (e.g., '0 9 * * *' for daily at 9am)")
+	addCmd.Flags().StringVar(&addExpr, "expr", "", "Schedule: a cron expression ('0 9 * * *'), an interval ('every 90m'), a time ('at 2026-11-01T09:00') or a delay ('in 2h')")
 	addCmd.Flags().StringVar(&addPrompt, "prompt", "", "Prompt to send when triggered")
 	addCmd.Flags().BoolVar(&addOnce, "once", false, "Run only once then auto-disable")
 	addCmd.Flags().BoolVar(&addDeliver, "deliver", false, "Enable delivery after task completion")
@@ -249,5 +382,27 @@ func init() {
 	CronCmd.AddCommand(deleteCmd)
 	CronCmd.AddCommand(enableCmd)
 	CronCmd.AddCommand(disableCmd)
+	addCmd.Flags().StringVar(&addTimezone, "tz", "", "Timezone of the schedule, e.g. Asia/Shanghai (default local)")
+	addCmd.Flags().StringVar(&addJitter, "jitter", "", "Delay each scheduled run by a random duration up to this, e.g. 5m")
+	addCmd.Flags().StringVar(&addStart, "start", "", "Do not run before this time, e.g. 2026-11-01 or 2026-11-01T09:00")
+	addCmd.Flags().StringVar(&addEnd, "end", "", "Do not run after this time")
+	addCmd.Flags().StringArrayVar(&addBlackouts, "blackout", nil, "Skip runs in a daily window '[days ]HH:MM-HH:MM', e.g. '22:00-07:00' or 'sat,sun 00:00-24:00', repeatable")
+	addCmd.Flags().StringSliceVar(&addOnSuccess, "on-success", nil, "Tasks to trigger after a successful run, their prompts can use {{.Upstream.Result}}")
+	addCmd.Flags().StringSliceVar(&addOnFailure, "on-failure", nil, "Tasks to trigger after a run failed after all retries")
+	addCmd.Flags().StringVar(&addDeliverIfMatch, "deliver-if-match", "", "Deliver only results matching this regex")
+	addCmd.Flags().BoolVar(&addDeliverIfChanged, "deliver-if-changed", false, "Deliver only results which differ from the previous successful run")
+	addCmd.Flags().StringVar(&addDeliverIfJudge, "deliver-if", "", "Deliver only if the LLM answers yes to this question about the result")
+	addCmd.Flags().IntVar(&addRetries, "retries", 0, "Number of retries after a failed run")
+	addCmd.Flags().StringVar(&addRetryBackoff, "retry-backoff", "", "Delay before the first retry, doubled for each further retry (default 30s)")
+	addCmd.Flags().StringVar(&addRetryMaxBackoff, "retry-max-backoff", "", "Maximum delay between retries (default 10m)")
+	addCmd.Flags().StringVar(&addNotifyChannel, "notify-channel", "", "Channel type notified when a run fails after all retries (lark)")
+	addCmd.Flags().StringVar(&addNotifyTo, "notify-to", "", "Receiver of failure notifications (e.g., chat_id for lark)")
+
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Show only the latest n runs, 0 for all")
+	historyCmd.Flags().StringVar(&historyStatus, "status", "", "Filter by status: ok, failed, cancelled")
+
 	CronCmd.AddCommand(runCmd)
+	CronCmd.AddCommand(historyCmd)
+	CronCmd.AddCommand(previewCmd)
+	CronCmd.AddCommand(logsCmd)
 }
@@ -0,0 +1,227 @@
+package cron
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/cron"
+	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
+	"github.com/spf13/cobra"
+)
+
+const maxHistoryErrorLen = 60
+
+var (
+	historyLimit  int
+	historyStatus string
+)
+
+var historyCmd = &cobra.Command{
+	Use:          "history <task-name>",
+	Short:        "Show the run history of a cron task",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		task, err := loadTask(args[0])
+		if err != nil {
+			return err
+		}
+
+		runs, err := task.ListRuns()
+		if err != nil {
+			return fmt.Errorf("failed to list runs: %w", err)
+		}
+		if historyStatus != "" {
+			filtered := runs[:0]
+			for _, run := range runs {
+				if string(run.Status) == historyStatus {
+					filtered = append(filtered, run)
+				}
+			}
+			runs = filtered
+		}
+		if historyLimit > 0 && len(runs) > historyLimit {
+			runs = runs[len(runs)-historyLimit:]
+		}
+		if len(runs) == 0 {
+			fmt.Printf("No runs of cron task '%s' found.\n", task.Name)
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN\tSTARTED\tDURATION\tTRIGGER\tATTEMPT\tSTATUS\tTOKENS\tDELIVERED\tERROR")
+		fmt.Fprintln(w, "---\t-------\t--------\t-------\t-------\t------\t------\t---------\t-----")
+		for _, run := range runs {
+			delivered := "-"
+			switch {
+			case run.Delivered:
+				delivered = "yes"
+			case run.DeliveryError != "":
+				delivered = "failed"
+			case run.Suppressed != "":
+				delivered = "suppressed"
+			}
+			errMsg := "-"
+			if run.Error != "" {
+				errMsg = xstring.Truncate(run.Error, maxHistoryErrorLen)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%d\t%s\t%s\n",
+				run.Id,
+				run.StartedAt.Local().Format(time.DateTime),
+				(time.Duration(run.DurationMs) * time.Millisecond).String(),
+				run.Trigger,
+				run.Attempt,
+				run.Status,
+				run.Usage.TotalTokens,
+				delivered,
+				errMsg,
+			)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var logsCmd = &cobra.Command{
+	Use:          "logs <task-name> [run-id]",
+	Short:        "Show the output of a cron task run, the latest run by default",
+	Long:         "Show the details and the result text of a run. Unique prefixes of run ids are accepted.",
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		task, err := loadTask(args[0])
+		if err != nil {
+			return err
+		}
+
+		var run *cron.Run
+		if len(args) == 2 {
+			run, err = task.GetRun(args[1])
+		} else {
+			run, err = task.LatestRun()
+		}
+		if err != nil {
+			return err
+		}
+		if run == nil {
+			fmt.Printf("Cron task '%s' has not run yet.\n", task.Name)
+			return nil
+		}
+
+		printRun(run)
+		return nil
+	},
+}
+
+func printRun(run *cron.Run) {
+	fmt.Printf("Run:       %s\n", run.Id)
+	fmt.Printf("Task:      %s (agent: %s)\n", run.Task, run.Agent)
+	fmt.Printf("Session:   cron:%s\n", run.ChatId)
+	fmt.Printf("Trigger:   %s (attempt %d)\n", run.Trigger, run.Attempt)
+	if run.Upstream != "" {
+		fmt.Printf("Upstream:  %s\n", run.Upstream)
+	}
+	fmt.Printf("Started:   %s\n", run.StartedAt.Local().Format(time.RFC3339))
+	fmt.Printf("Ended:     %s (%s)\n", run.EndedAt.Local().Format(time.RFC3339),
+		time.Duration(run.DurationMs)*time.Millisecond)
+	fmt.Printf("Status:    %s\n", run.Status)
+	if run.Error != "" {
+		fmt.Printf("Error:     %s\n", run.Error)
+	}
+	if run.NextRetry != nil {
+		fmt.Printf("Retry at:  %s\n", run.NextRetry.Local().Format(time.RFC3339))
+	}
+	fmt.Printf("Tokens:    %d (prompt %d, completion %d)\n",
+		run.Usage.TotalTokens, run.Usage.PromptTokens, run.Usage.CompletionTokens)
+	switch {
+	case run.Delivered:
+		fmt.Println("Delivered: yes")
+	case run.DeliveryError != "":
+		fmt.Printf("Delivered: no (%s)\n", run.DeliveryError)
+	case run.Suppressed != "":
+		fmt.Printf("Delivered: no, %s\n", run.Suppressed)
+	}
+	fmt.Println("--- Result ---")
+	fmt.Println(strings.TrimRight(run.Result, "\n"))
+}
+
+func loadTask(name string) (*cron.Task, error) {
+	mgr := cron.NewManager()
+	if err := mgr.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load cron tasks: %w", err)
+	}
+	task, exists := mgr.GetTask(name)
+	if !exists {
+		return nil, fmt.Errorf("task '%s' not found", name)
+	}
+	return task, nil
+}
+
+var (
+	previewExpr     string
+	previewTimezone string
+	previewCount    int
+)
+
+var previewCmd = &cobra.Command{
+	Use:   "preview [task-name]",
+	Short: "Show the next run times of a cron task or a schedule",
+	Long: "Show the next run times of an existing task, or of the schedule given by --expr.\n" +
+		"Schedules are cron expressions ('0 9 * * *'), intervals ('every 90m'), times ('at 2026-11-01T09:00 Asia/Shanghai') or delays ('in 2h').",
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var task *cron.Task
+		switch {
+		case len(args) == 1:
+			t, err := loadTask(args[0])
+			if err != nil {
+				return err
+			}
+			task = t
+		case previewExpr != "":
+			spec, err := cron.NormalizeSpec(previewExpr, time.Now())
+			if err != nil {
+				return err
+			}
+			task = cron.NewTask("preview", spec, "", cron.WithTimezone(previewTimezone))
+		default:
+			return fmt.Errorf("a task name or --expr is required")
+		}
+
+		schedule, err := task.Schedule()
+		if err != nil {
+			return err
+		}
+		count := previewCount
+		if task.IsOneShot() {
+			count = 1
+		}
+		times := schedule.NextN(time.Now(), count)
+		if len(times) == 0 {
+			fmt.Println("No upcoming runs.")
+			return nil
+		}
+
+		fmt.Printf("Schedule: %s (timezone: %s)\n", task.CronExpr, schedule.Location())
+		if task.Jitter != "" {
+			fmt.Printf("Each run is delayed by up to %s of jitter.\n", task.Jitter)
+		}
+		for i, t := range times {
+			fmt.Printf("%3d  %s\n", i+1, t.In(schedule.Location()).Format("2006-01-02 15:04:05 MST Mon"))
+		}
+		if task.IsOneShot() {
+			fmt.Println("The task runs once, then it is disabled.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	previewCmd.Flags().StringVar(&previewExpr, "expr", "", "Schedule to preview instead of a task")
+	previewCmd.Flags().StringVar(&previewTimezone, "tz", "", "Timezone of --expr (default local)")
+	previewCmd.Flags().IntVarP(&previewCount, "count", "n", 5, "Number of run times to show")
+}
@@ -0,0 +1,331 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	agcontext "github.com/ryanreadbooks/tokkibot/agent/context"
+	"github.com/ryanreadbooks/tokkibot/component/sandbox"
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/llm/factory"
+	"github.com/ryanreadbooks/tokkibot/pkg/audio"
+	"github.com/ryanreadbooks/tokkibot/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+const (
+	probeTimeout = 10 * time.Second
+	bwrapTimeout = 5 * time.Second
+)
+
+var offline bool
+
+var DoctorCmd = &cobra.Command{
+	Use:          "doctor",
+	Short:        "Diagnose tokkibot setup.",
+	Long:         "Check config files, workspaces, external tools and providers, and report misconfigurations.",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDoctor(cmd.Context())
+	},
+}
+
+func init() {
+	DoctorCmd.Flags().BoolVar(&offline, "offline", false, "Skip provider health probes")
+}
+
+type report struct {
+	fails int
+	warns int
+}
+
+func (r *report) section(title string) {
+	fmt.Printf("\n%s\n", title)
+}
+
+func (r *report) ok(format string, args ...any) {
+	fmt.Printf("  ✓ %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *report) warn(format string, args ...any) {
+	r.warns++
+	fmt.Printf("  ! %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *report) fail(format string, args ...any) {
+	r.fails++
+	fmt.Printf("  ✗ %s\n", fmt.Sprintf(format, args...))
+}
+
+// problems prints problems of a validation error, or err itself.
+func (r *report) problems(err error) {
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		r.fail("%v", err)
+		return
+	}
+	for _, p := range verr.Problems {
+		r.fail("%s", p)
+	}
+}
+
+func runDoctor(ctx context.Context) error {
+	r := &report{}
+
+	cfg, cfgOk := checkConfig(r)
+	checkMcpConfig(r)
+	checkWorkspaces(r, cfg)
+	checkSandbox(r, cfg)
+	checkFFmpeg(r)
+	checkAudit(r)
+	if cfgOk && !offline {
+		checkProviders(ctx, r, cfg)
+	}
+
+	fmt.Printf("\n%d problem(s), %d warning(s)\n", r.fails, r.warns)
+	if r.fails > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", r.fails)
+	}
+	return nil
+}
+
+func checkConfig(r *report) (config.Config, bool) {
+	r.section("Config")
+
+	configPath, err := config.GetWorkspaceConfigPath()
+	if err != nil {
+		r.fail("%v", err)
+		return config.Config{}, false
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		r.fail("%s not found, run `tokkibot onboard` first", configPath)
+		return config.Config{}, false
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		r.fail("%v", err)
+		return config.Config{}, false
+	}
+
+	if err := config.CheckConfigFile(configPath); err != nil {
+		r.problems(err)
+	} else {
+		r.ok("%s is valid", configPath)
+	}
+	return cfg, true
+}
+
+func checkMcpConfig(r *report) {
+	r.section("MCP")
+
+	found := false
+	for _, get := range []func() (string, error){
+		config.GetWorkspaceMcpConfigPath,
+		config.GetProjectMcpConfigPath,
+	} {
+		path, err := get()
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		found = true
+		if err := config.CheckMcpConfigFile(path); err != nil {
+			r.problems(err)
+		} else {
+			r.ok("%s is valid", path)
+		}
+	}
+	if !found {
+		r.ok("no mcp config")
+	}
+}
+
+func agentNamesOf(cfg config.Config) []string {
+	names := make([]string, 0, len(cfg.Agents))
+	for _, entry := range cfg.Agents {
+		names = append(names, entry.Name)
+	}
+	if !slices.Contains(names, config.MainAgentName) {
+		names = append(names, config.MainAgentName)
+	}
+	return names
+}
+
+func checkWorkspaces(r *report, cfg config.Config) {
+	r.section("Workspaces")
+
+	for _, name := range agentNamesOf(cfg) {
+		dir := config.GetAgentWorkspaceDir(name)
+		if _, err := os.Stat(dir); err != nil {
+			r.fail("agent %s: workspace %s not found, run `tokkibot onboard --agent %s`", name, dir, name)
+			continue
+		}
+
+		f, err := os.CreateTemp(dir, ".doctor-*")
+		if err != nil {
+			r.fail("agent %s: workspace %s is not writable: %v", name, dir, err)
+			continue
+		}
+		f.Close()
+		os.Remove(f.Name())
+
+		if missing := agcontext.MissingPromptFiles(dir); len(missing) > 0 {
+			r.fail("agent %s: missing prompt files %s in %s, run `tokkibot onboard --agent %s`",
+				name, strings.Join(missing, ", "), dir, name)
+			continue
+		}
+		r.ok("agent %s: %s", name, dir)
+	}
+}
+
+func checkSandbox(r *report, cfg config.Config) {
+	r.section("Sandbox")
+
+	var sandboxed []string
+	for _, entry := range cfg.Agents {
+		if entry.Sandbox == nil || !entry.Sandbox.Enabled {
+			continue
+		}
+		if entry.Sandbox.GetBackend() == config.SandboxBackendDocker {
+			checkDockerSandbox(r, entry)
+			continue
+		}
+		// IsEnabled is false outside linux, check the raw flag instead
+		sandboxed = append(sandboxed, entry.Name)
+	}
+	report := r.warn
+	if len(sandboxed) > 0 {
+		report = r.fail
+	}
+
+	if runtime.GOOS != "linux" {
+		if len(sandboxed) > 0 {
+			r.fail("sandbox is enabled for %s but only supported on linux", strings.Join(sandboxed, ", "))
+		} else {
+			r.ok("sandbox is not used")
+		}
+		return
+	}
+
+	bwrapPath, err := exec.LookPath("bwrap")
+	if err != nil {
+		report("bwrap not found, install bubblewrap to use the sandbox")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bwrapTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, bwrapPath, "--ro-bind", "/", "/", "true").CombinedOutput()
+	if err != nil {
+		report("bwrap cannot create a sandbox: %s", strings.TrimSpace(string(out)+" "+err.Error()))
+		return
+	}
+	r.ok("bwrap works (%s)", bwrapPath)
+
+	for _, entry := range cfg.Agents {
+		if !entry.Sandbox.IsEnabled() || entry.Sandbox.GetBackend() != config.SandboxBackendBwrap {
+			continue
+		}
+		limits := entry.Sandbox.GetLimits()
+		if cg := limits.GetCgroup(); cg != "" {
+			if _, err := os.Stat(filepath.Join(cg, "cgroup.controllers")); err != nil {
+				r.fail("agent %s: sandbox cgroup %s is not a cgroup v2 directory", entry.Name, cg)
+			}
+		}
+		needPrlimit := limits.GetCPUTime() > 0 || limits.GetFileSize() > 0 ||
+			(limits.GetCgroup() == "" && (limits.GetMemory() > 0 || limits.GetPids() > 0))
+		if needPrlimit {
+			if _, err := exec.LookPath("prlimit"); err != nil {
+				r.fail("agent %s: prlimit not found, install util-linux to use the sandbox limits", entry.Name)
+			}
+		}
+	}
+}
+
+func checkDockerSandbox(r *report, entry config.AgentEntry) {
+	docker := entry.Sandbox.GetDocker()
+	ctx, cancel := context.WithTimeout(context.Background(), bwrapTimeout)
+	defer cancel()
+	if err := sandbox.PingDocker(ctx, docker.GetHost()); err != nil {
+		r.fail("agent %s: docker engine not reachable: %v", entry.Name, err)
+		return
+	}
+	r.ok("agent %s: docker engine reachable, commands run in %s", entry.Name, docker.GetImage())
+}
+
+func checkFFmpeg(r *report) {
+	r.section("Audio")
+
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		r.warn("%v", audio.ErrFFmpegNotFound)
+		return
+	}
+	r.ok("ffmpeg found (%s)", path)
+}
+
+func checkAudit(r *report) {
+	r.section("Audit log")
+	path := config.GetAuditLogPath()
+	n, err := audit.Verify(path)
+	switch {
+	case os.IsNotExist(err):
+		r.ok("no tool executions recorded yet")
+	case err != nil:
+		r.fail("%s: %v", path, err)
+	default:
+		r.ok("%s: %d entries, hash chain intact", path, n)
+	}
+}
+
+func checkProviders(ctx context.Context, r *report, cfg config.Config) {
+	r.section("Providers")
+
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	used := make(map[string]bool)
+	for _, entry := range cfg.Agents {
+		used[entry.Provider] = true
+	}
+
+	for _, name := range names {
+		provider := cfg.Providers[name]
+		if provider.GetApiKey() == "" && !used[name] {
+			r.ok("%s: skipped, no api key and not used by any agent", name)
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		startAt := time.Now()
+		err := factory.Probe(probeCtx,
+			factory.WithAPIKey(provider.GetApiKey()),
+			factory.WithBaseURL(provider.GetBaseURL()),
+			factory.WithStyle(factory.Style(provider.Style)),
+		)
+		cancel()
+
+		switch {
+		case err == nil:
+			r.ok("%s: %s answered in %s", name, provider.GetBaseURL(), time.Since(startAt).Round(time.Millisecond))
+		case used[name]:
+			r.fail("%s: %v", name, err)
+		default:
+			r.warn("%s: %v", name, err)
+		}
+	}
+}
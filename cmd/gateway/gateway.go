@@ -3,17 +3,32 @@ package gateway
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	chadapter "github.com/ryanreadbooks/tokkibot/channel/adapter"
 	"github.com/ryanreadbooks/tokkibot/channel/adapter/lark"
 	"github.com/ryanreadbooks/tokkibot/config"
 	gw "github.com/ryanreadbooks/tokkibot/gateway"
+	"github.com/ryanreadbooks/tokkibot/pkg/audit"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
 
 	"github.com/spf13/cobra"
 )
 
+const (
+	tracingShutdownTimeout = 5 * time.Second
+	reloadRequestTimeout   = 30 * time.Second
+)
+
+var watchConfig bool
+
 var GatewayCmd = &cobra.Command{
 	Use:   "gateway",
 	Short: "Start the tokkibot gateway.",
@@ -23,10 +38,47 @@ var GatewayCmd = &cobra.Command{
 	},
 }
 
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload the config of the running gateway.",
+	Long:  "Ask the running gateway to reload its config through the admin API. Sending SIGHUP to the gateway process does the same.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return requestReload(cmd.Context())
+	},
+}
+
+func init() {
+	GatewayCmd.Flags().BoolVar(&watchConfig, "watch-config", true, "Reload the config when config files change")
+	GatewayCmd.AddCommand(reloadCmd)
+}
+
 func initAndRunGateway(ctx context.Context) error {
 	slog.Info("[cmd/gateway] initializing gateway")
 	cfg := config.GetConfig()
 
+	if err := cfg.Validate(); err != nil {
+		slog.Warn("[cmd/gateway] config has problems, run `tokkibot doctor` for details", slog.Any("error", err))
+	}
+
+	if err := audit.Init(config.GetAuditLogPath()); err != nil {
+		slog.Error("[cmd/gateway] failed to open audit log, tool executions are not audited", slog.Any("error", err))
+	}
+
+	if cfg.Tracing.IsEnabled() {
+		shutdown, err := initTracing(ctx, cfg.Tracing)
+		if err != nil {
+			slog.Error("[cmd/gateway] failed to init tracing", slog.Any("error", err))
+			return err
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+			defer cancel()
+			if err := shutdown(shutdownCtx); err != nil {
+				slog.Warn("[cmd/gateway] failed to shutdown tracing", slog.Any("error", err))
+			}
+		}()
+	}
+
 	// check for heartbeat configs
 	heartbeatCfgs := make(map[string]config.AgentHeartbeatConfig)
 	for _, agentEntry := range cfg.Agents {
@@ -38,6 +90,10 @@ func initAndRunGateway(ctx context.Context) error {
 		gw.WithVerbose(true),
 		gw.WithRunCronTasks(true),
 		gw.WithHeartbeatCfgs(heartbeatCfgs),
+		gw.WithWebhookCfg(cfg.Webhook),
+		gw.WithAdminCfg(cfg.Admin),
+		gw.WithAdapterFactory(createAdapter),
+		gw.WithConfigWatch(watchConfig),
 	)
 	if err != nil {
 		slog.Error("[cmd/gateway] failed to create gateway", slog.Any("error", err))
@@ -82,15 +138,121 @@ func initAndRunGateway(ctx context.Context) error {
 		g.AddAdapterWithRouting(adapter, agentEntry.Name, match.Account, match.ChatIds)
 	}
 
+	reloadOnSignal(ctx, g)
+
 	return g.Run(ctx)
 }
 
+// reloadOnSignal reloads the gateway config on SIGHUP.
+func reloadOnSignal(ctx context.Context, g *gw.Gateway) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigCh:
+				slog.Info("[cmd/gateway] SIGHUP received, reloading config")
+				if _, err := g.ReloadConfig(ctx); err != nil {
+					slog.Error("[cmd/gateway] failed to reload config", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+type reloadResponse struct {
+	Status   string   `json:"status"`
+	Changes  []string `json:"changes"`
+	Problems []string `json:"problems"`
+	Error    string   `json:"error"`
+}
+
+func requestReload(ctx context.Context) error {
+	adminCfg := config.GetConfig().Admin
+	if !adminCfg.IsEnabled() || adminCfg.GetToken() == "" {
+		return errors.New("admin api is not enabled, send SIGHUP to the gateway process instead")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reloadRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"http://"+adminCfg.GetListen()+"/api/config/reload", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminCfg.GetToken())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach gateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result reloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unexpected response from gateway (%s): %w", resp.Status, err)
+	}
+
+	switch result.Status {
+	case "rejected":
+		fmt.Println("Config rejected:")
+		for _, p := range result.Problems {
+			fmt.Printf("  - %s\n", p)
+		}
+		return errors.New("invalid config")
+	case "":
+		return fmt.Errorf("reload failed: %s", result.Error)
+	}
+
+	if len(result.Changes) == 0 {
+		fmt.Println("Config reloaded, nothing changed.")
+	} else {
+		fmt.Println("Config reloaded:")
+		for _, c := range result.Changes {
+			fmt.Printf("  - %s\n", c)
+		}
+	}
+	if result.Error != "" {
+		return fmt.Errorf("some changes failed: %s", result.Error)
+	}
+	return nil
+}
+
+func initTracing(ctx context.Context, c *config.TracingConfig) (func(context.Context) error, error) {
+	shutdown, err := trace.InitOtel(ctx, trace.OtelOptions{
+		ServiceName: c.GetServiceName(),
+		Exporter:    trace.Exporter(c.GetExporter()),
+		Endpoint:    c.GetEndpoint(),
+		Insecure:    c.Insecure,
+		Headers:     c.Headers,
+		FilePath:    c.GetFile(),
+		SampleRatio: c.GetSampleRatio(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("[cmd/gateway] tracing enabled",
+		slog.String("exporter", c.GetExporter()),
+		slog.Float64("sample_ratio", c.GetSampleRatio()))
+	return shutdown, nil
+}
+
 // createAdapter creates a channel adapter from config
 func createAdapter(channelName, accountName string) (chadapter.Adapter, error) {
 	raw, ok := config.GetChannelAccountRaw(channelName, accountName)
 	if !ok {
 		return nil, fmt.Errorf("channel %s account %s not found in config", channelName, accountName)
 	}
+	raw, err := config.ResolveJSONValues(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve channel %s account %s: %w", channelName, accountName, err)
+	}
 
 	switch channelName {
 	case "lark":
@@ -7,6 +7,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
 	"github.com/spf13/cobra"
 )
 
@@ -183,7 +184,7 @@ var listCmd = &cobra.Command{
 				transport = "http"
 				target = server.Url
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\n", name, transport, target)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, transport, secret.Redact(target))
 		}
 
 		w.Flush()
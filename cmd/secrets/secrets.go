@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var SecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage encrypted secrets",
+	Long: "Store credentials in an encrypted local store and reference them in config.json and mcp.json as secret://<name>.\n" +
+		"The store is encrypted with " + config.SecretsPassphraseEnv + " if set, otherwise with a key file that is generated on first use.",
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set <name> [value]",
+	Short: "Set a secret, reading the value from stdin if omitted",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		var value string
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			var err error
+			if value, err = readValue(name); err != nil {
+				return err
+			}
+		}
+		if value == "" {
+			return fmt.Errorf("secret value is empty")
+		}
+
+		store, err := config.OpenSecretStore(true)
+		if err != nil {
+			return err
+		}
+		store.Set(name, value)
+		if err := store.Save(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Secret '%s' saved, reference it as %s\n", name, secret.Ref(name))
+		return nil
+	},
+}
+
+// readValue prompts for the value without echo on a terminal, or reads the
+// first line of stdin otherwise.
+func readValue(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Printf("Value of %s: ", name)
+		value, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret value: %w", err)
+		}
+		return string(value), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read secret value: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+var getCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Print a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := config.OpenSecretStore(false)
+		if err != nil {
+			return err
+		}
+		value, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List secret names",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(config.GetSecretsPath()); err != nil {
+			fmt.Println("No secrets found.")
+			return nil
+		}
+		store, err := config.OpenSecretStore(false)
+		if err != nil {
+			return err
+		}
+
+		names := store.Names()
+		if len(names) == 0 {
+			fmt.Println("No secrets found.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tREFERENCE")
+		fmt.Fprintln(w, "----\t---------")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, secret.Ref(name))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var removeCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a secret",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := config.OpenSecretStore(false)
+		if err != nil {
+			return err
+		}
+		if !store.Delete(args[0]) {
+			return fmt.Errorf("secret '%s' not found", args[0])
+		}
+		if err := store.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Secret '%s' removed\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	SecretsCmd.AddCommand(setCmd)
+	SecretsCmd.AddCommand(getCmd)
+	SecretsCmd.AddCommand(listCmd)
+	SecretsCmd.AddCommand(removeCmd)
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"github.com/ryanreadbooks/tokkibot/cmd/agent"
+	"github.com/ryanreadbooks/tokkibot/cmd/audit"
 	"github.com/ryanreadbooks/tokkibot/cmd/cron"
+	"github.com/ryanreadbooks/tokkibot/cmd/doctor"
 	"github.com/ryanreadbooks/tokkibot/cmd/gateway"
 	"github.com/ryanreadbooks/tokkibot/cmd/mcp"
 	"github.com/ryanreadbooks/tokkibot/cmd/onboard"
+	"github.com/ryanreadbooks/tokkibot/cmd/secrets"
+	"github.com/ryanreadbooks/tokkibot/component/sandbox"
 	"github.com/ryanreadbooks/tokkibot/config"
+	pkgaudit "github.com/ryanreadbooks/tokkibot/pkg/audit"
 	"github.com/ryanreadbooks/tokkibot/pkg/log"
 	"github.com/ryanreadbooks/tokkibot/pkg/process"
 	"github.com/spf13/cobra"
@@ -19,6 +24,17 @@ var skipConfigCmds = map[string]bool{
 	"list":    true,
 	"remove":  true,
 	"rm":      true,
+	"doctor":  true,
+	"secrets": true,
+	"set":     true,
+	"get":     true,
+	"audit":   true,
+	"verify":  true,
+	"history": true,
+	"logs":    true,
+	"preview": true,
+
+	sandbox.BridgeCommand: true,
 }
 
 var rootCmd = &cobra.Command{
@@ -37,7 +53,11 @@ func init() {
 	rootCmd.AddCommand(gateway.GatewayCmd)
 	rootCmd.AddCommand(cron.CronCmd)
 	rootCmd.AddCommand(mcp.McpCmd)
+	rootCmd.AddCommand(doctor.DoctorCmd)
+	rootCmd.AddCommand(secrets.SecretsCmd)
+	rootCmd.AddCommand(audit.AuditCmd)
 	rootCmd.AddCommand(VersionCmd)
+	rootCmd.AddCommand(SandboxBridgeCmd)
 }
 
 func main() {
@@ -48,5 +68,6 @@ func main() {
 	wait()
 
 	// Close logger on exit
+	pkgaudit.Close()
 	log.Close()
 }
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+
+	"github.com/ryanreadbooks/tokkibot/component/sandbox"
+	"github.com/spf13/cobra"
+)
+
+// SandboxBridgeCmd runs inside the sandbox to pass connections of commands
+// on to the network proxy of the host.
+var SandboxBridgeCmd = &cobra.Command{
+	Use:                sandbox.BridgeCommand + " <socket> <command> [args...]",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(sandbox.RunBridge(args))
+	},
+}
@@ -0,0 +1,87 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// BridgeCommand is the hidden subcommand of tokkibot which runs RunBridge.
+const BridgeCommand = "sandbox-bridge"
+
+const (
+	bridgeErrorPrefix = "sandbox-bridge:"
+	// address of the proxy inside the sandbox
+	bridgeProxyAddr = "127.0.0.1:3128"
+)
+
+// RunBridge runs as the first process of commands in a sandbox with
+// NetworkAllowlist. The network of the sandbox has no way out, so the
+// bridge listens on the proxy address in it and passes connections on to
+// the filtering proxy of the host through its unix socket. Then it runs the
+// command. args are the socket path and the command, it returns the exit
+// code of the command.
+func RunBridge(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "%s usage: %s <socket> <command> [args...]\n", bridgeErrorPrefix, BridgeCommand)
+		return 126
+	}
+	socketPath, command := args[0], args[1:]
+
+	ln, err := net.Listen("tcp", bridgeProxyAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed to listen on proxy address: %v\n", bridgeErrorPrefix, err)
+		return 126
+	}
+	go serveBridge(ln, socketPath)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// exit like a shell does when the command was killed
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	fmt.Fprintf(os.Stderr, "%s failed to run command: %v\n", bridgeErrorPrefix, err)
+	return 127
+}
+
+func serveBridge(ln net.Listener, socketPath string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			upstream, err := net.Dial("unix", socketPath)
+			if err != nil {
+				return
+			}
+			defer upstream.Close()
+			done := make(chan struct{}, 2)
+			go func() {
+				io.Copy(upstream, conn)
+				done <- struct{}{}
+			}()
+			go func() {
+				io.Copy(conn, upstream)
+				done <- struct{}{}
+			}()
+			<-done
+		}()
+	}
+}
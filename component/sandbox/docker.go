@@ -0,0 +1,695 @@
+package sandbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDockerHost        = "unix:///var/run/docker.sock"
+	defaultDockerIdleTimeout = 30 * time.Minute
+	dockerAPIVersion         = "v1.41"
+	// label of the containers created by tokkibot
+	dockerLabel = "tokkibot.sandbox"
+	// env var set for each command to find its processes when killing it
+	dockerExecEnv = "TOKKIBOT_EXEC"
+	// how long Wait waits for a killed command to exit
+	dockerKillWait = 5 * time.Second
+)
+
+// DockerConfig configures the container of NewDockerSandbox.
+type DockerConfig struct {
+	// docker or podman socket as unix:///path or tcp://host:port, DOCKER_HOST
+	// or /var/run/docker.sock by default
+	Host  string
+	Image string
+	// prefix of container names, e.g. the agent name
+	Name string
+	// one container per scope of WithScope instead of one for all commands
+	PerScope bool
+	// containers no command ran in for so long are removed
+	IdleTimeout time.Duration
+}
+
+type scopeCtxKey struct{}
+
+// WithScope tells the sandbox whom a command runs for, e.g. a chat.
+// Sandboxes keeping state between commands may keep it per scope.
+func WithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeCtxKey{}, scope)
+}
+
+func scopeFromContext(ctx context.Context) string {
+	scope, _ := ctx.Value(scopeCtxKey{}).(string)
+	return scope
+}
+
+// DockerSandbox runs commands in a long-lived container through the Docker
+// Engine API, which podman serves as well. The container is created on the
+// first command and removed after it was idle for a while.
+type DockerSandbox struct {
+	cfg DockerConfig
+	opt option
+
+	client    *dockerClient
+	clientErr error
+}
+
+var _ Sandbox = (*DockerSandbox)(nil)
+
+func NewDockerSandbox(cfg DockerConfig, opts ...Option) Sandbox {
+	opt := option{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultDockerIdleTimeout
+	}
+	client, err := newDockerClient(cfg.Host)
+	return &DockerSandbox{cfg: cfg, opt: opt, client: client, clientErr: err}
+}
+
+func (s *DockerSandbox) Execute(ctx context.Context, command string) (string, error) {
+	return executeByRun(ctx, s, command)
+}
+
+func (s *DockerSandbox) Run(ctx context.Context, command string, out io.Writer) error {
+	return runByStart(ctx, s, command, out)
+}
+
+func (s *DockerSandbox) Start(ctx context.Context, command string, stdin io.Reader, out io.Writer) (*Process, error) {
+	if s.clientErr != nil {
+		return nil, &SandboxError{Reason: "docker host not usable", Err: s.clientErr}
+	}
+	if s.opt.network == NetworkAllowlist {
+		return nil, &SandboxError{Reason: "network allowlist is not supported by the docker sandbox", Err: errors.ErrUnsupported}
+	}
+
+	for attempt := 0; ; attempt++ {
+		c, id, err := s.container(ctx)
+		if err != nil {
+			return nil, &SandboxError{Reason: fmt.Sprintf("container of image %s not available", s.cfg.Image), Err: err}
+		}
+		p, err := s.startExec(ctx, c, id, command, stdin, out)
+		if err == nil {
+			return p, nil
+		}
+		c.release()
+		// the container was removed or stopped behind our back, look it up again
+		if attempt == 0 && (isDockerStatus(err, http.StatusNotFound) || isDockerStatus(err, http.StatusConflict)) {
+			c.forget()
+			continue
+		}
+		return nil, err
+	}
+}
+
+func (s *DockerSandbox) startExec(
+	ctx context.Context,
+	c *dockerContainer,
+	containerId string,
+	command string,
+	stdin io.Reader,
+	out io.Writer,
+) (*Process, error) {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	marker := hex.EncodeToString(nonce)
+
+	var created struct{ Id string }
+	execReq := map[string]any{
+		"AttachStdin":  stdin != nil,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          false,
+		"Cmd":          []string{"sh", "-c", command},
+		"Env":          []string{dockerExecEnv + "=" + marker},
+	}
+	if s.opt.workingDir != "" {
+		execReq["WorkingDir"] = s.opt.workingDir
+	}
+	if err := s.client.do(ctx, http.MethodPost, "/containers/"+containerId+"/exec", nil, execReq, &created); err != nil {
+		return nil, &SandboxError{Reason: "failed to create exec in container", Err: err}
+	}
+
+	conn, err := s.client.upgrade(ctx, "/exec/"+created.Id+"/start", map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return nil, &SandboxError{Reason: "failed to start exec in container", Err: err}
+	}
+
+	limits := &dockerLimits{limits: s.opt.limits}
+	var killOnce sync.Once
+	kill := func() error {
+		var err error
+		killOnce.Do(func() {
+			err = s.killExec(containerId, marker)
+			conn.Close()
+		})
+		return err
+	}
+	out = limits.limitOutput(out, func() { go kill() })
+
+	if stdin != nil {
+		go io.Copy(conn, stdin)
+	}
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		demuxDockerStream(conn, out)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			kill()
+		case <-streamDone:
+		}
+	}()
+
+	wait := func() error {
+		<-streamDone
+		conn.Close()
+		defer c.release()
+		code, err := s.execExitCode(created.Id)
+		if err != nil {
+			return &CommandError{ExitCode: -1, Err: err}
+		}
+		if code != 0 {
+			return &CommandError{ExitCode: code, Err: fmt.Errorf("exit status %d", code)}
+		}
+		return nil
+	}
+	return &Process{wait: wait, kill: kill, limits: limits}, nil
+}
+
+// execExitCode returns the exit code of an exec whose output ended. A
+// killed exec may still run for a moment.
+func (s *DockerSandbox) execExitCode(id string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerKillWait)
+	defer cancel()
+	for {
+		var info struct {
+			Running  bool
+			ExitCode *int
+		}
+		if err := s.client.do(ctx, http.MethodGet, "/exec/"+id+"/json", nil, nil, &info); err != nil {
+			return -1, fmt.Errorf("failed to inspect exec: %w", err)
+		}
+		if !info.Running && info.ExitCode != nil {
+			return *info.ExitCode, nil
+		}
+		// the output ended before the exec was marked as exited
+		select {
+		case <-ctx.Done():
+			return -1, fmt.Errorf("exec did not exit")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// killExec kills the processes of the exec, which all have its marker in
+// their environment. The Engine API cannot kill an exec.
+func (s *DockerSandbox) killExec(containerId, marker string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerKillWait)
+	defer cancel()
+	script := fmt.Sprintf(`for p in /proc/[0-9]*; do
+  if tr '\0' '\n' < "$p/environ" 2>/dev/null | grep -qx '%s=%s'; then kill -9 "${p#/proc/}" 2>/dev/null; fi
+done`, dockerExecEnv, marker)
+	var created struct{ Id string }
+	if err := s.client.do(ctx, http.MethodPost, "/containers/"+containerId+"/exec", nil, map[string]any{
+		"Cmd": []string{"sh", "-c", script},
+	}, &created); err != nil {
+		return fmt.Errorf("failed to kill command in container: %w", err)
+	}
+	conn, err := s.client.upgrade(ctx, "/exec/"+created.Id+"/start", map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return fmt.Errorf("failed to kill command in container: %w", err)
+	}
+	defer conn.Close()
+	io.Copy(io.Discard, conn)
+	return nil
+}
+
+// demuxDockerStream copies the output of an exec without a tty, which is
+// framed by headers telling stdout from stderr, to out.
+func demuxDockerStream(r io.Reader, out io.Writer) error {
+	br := bufio.NewReader(r)
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(out, br, size); err != nil {
+			return err
+		}
+	}
+}
+
+// dockerLimits tells which limit a command in a container broke.
+type dockerLimits struct {
+	limits Limits
+	output *outputLimiter
+}
+
+var _ limitWatcher = (*dockerLimits)(nil)
+
+func (l *dockerLimits) limitOutput(out io.Writer, kill func()) io.Writer {
+	if l.limits.Output <= 0 {
+		return out
+	}
+	l.output = &outputLimiter{w: out, max: l.limits.Output, exceeded: kill}
+	return l.output
+}
+
+func (l *dockerLimits) violation(exitCode int) error {
+	reason := rlimitViolation(l.limits, l.output, exitCode)
+	if reason == "" && l.limits.Memory > 0 && exitCode == 128+9 {
+		reason = fmt.Sprintf("the command was killed, likely for the memory limit of %s", formatBytes(l.limits.Memory))
+	}
+	if reason == "" {
+		return nil
+	}
+	return &SandboxError{Reason: reason}
+}
+
+func (l *dockerLimits) reset() {
+	if l.output != nil {
+		l.output.reset()
+	}
+}
+
+func (l *dockerLimits) close() {}
+
+// dockerContainer is a container commands run in. It is shared by all
+// sandboxes with the same container name.
+type dockerContainer struct {
+	name   string
+	client *dockerClient
+	idle   time.Duration
+
+	mu sync.Mutex // held while the container is created
+	id string
+
+	// guarded by dockerContainers
+	running    int
+	lastActive time.Time
+	timer      *time.Timer
+}
+
+var dockerContainers = struct {
+	sync.Mutex
+	m map[string]*dockerContainer
+}{m: make(map[string]*dockerContainer)}
+
+// container returns the running container of the scope of ctx and its id,
+// creating it if needed. It must be released once the command exited.
+func (s *DockerSandbox) container(ctx context.Context) (*dockerContainer, string, error) {
+	name := s.containerName(ctx)
+
+	dockerContainers.Lock()
+	c, ok := dockerContainers.m[name]
+	if !ok {
+		c = &dockerContainer{name: name, client: s.client, idle: s.cfg.IdleTimeout}
+		dockerContainers.m[name] = c
+	}
+	c.running++
+	dockerContainers.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.id == "" {
+		id, err := s.ensureContainer(ctx, name)
+		if err != nil {
+			c.release()
+			return nil, "", err
+		}
+		c.id = id
+	}
+	return c, c.id, nil
+}
+
+// containerName names the container after everything it is created with,
+// so that a changed config gets a new container.
+func (s *DockerSandbox) containerName(ctx context.Context) string {
+	h := sha256.New()
+	fmt.Fprintln(h, s.cfg.Image, s.opt.network, s.opt.limits)
+	fmt.Fprintln(h, s.opt.readOnlyPaths, s.opt.readWritePaths)
+	if s.cfg.PerScope {
+		fmt.Fprintln(h, scopeFromContext(ctx))
+	}
+	prefix := "tokkibot"
+	if name := dockerNameRe.ReplaceAllString(s.cfg.Name, "-"); name != "" {
+		prefix += "-" + name
+	}
+	return prefix + "-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+var dockerNameRe = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// ensureContainer starts the container with the name, creating it and
+// pulling its image if needed.
+func (s *DockerSandbox) ensureContainer(ctx context.Context, name string) (string, error) {
+	for range 2 {
+		var info struct {
+			Id    string
+			State struct{ Running bool }
+		}
+		err := s.client.do(ctx, http.MethodGet, "/containers/"+name+"/json", nil, nil, &info)
+		if err == nil {
+			if !info.State.Running {
+				if err := s.client.do(ctx, http.MethodPost, "/containers/"+info.Id+"/start", nil, nil, nil); err != nil {
+					return "", fmt.Errorf("failed to start container: %w", err)
+				}
+			}
+			return info.Id, nil
+		}
+		if !isDockerStatus(err, http.StatusNotFound) {
+			return "", fmt.Errorf("failed to inspect container: %w", err)
+		}
+
+		id, err := s.createContainer(ctx, name)
+		if isDockerStatus(err, http.StatusConflict) {
+			// created by someone else meanwhile
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := s.client.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil); err != nil {
+			return "", fmt.Errorf("failed to start container: %w", err)
+		}
+		return id, nil
+	}
+	return "", fmt.Errorf("container %s keeps changing", name)
+}
+
+func (s *DockerSandbox) createContainer(ctx context.Context, name string) (string, error) {
+	var binds []string
+	for _, p := range s.opt.readOnlyPaths {
+		if pathExists(p) {
+			binds = append(binds, p+":"+p+":ro")
+		}
+	}
+	for _, p := range s.opt.readWritePaths {
+		if pathExists(p) {
+			binds = append(binds, p+":"+p)
+		}
+	}
+	hostConfig := map[string]any{
+		"Binds": binds,
+		"Init":  true,
+	}
+	if s.opt.network == NetworkNone {
+		hostConfig["NetworkMode"] = "none"
+	}
+	limits := s.opt.limits
+	if limits.Memory > 0 {
+		hostConfig["Memory"] = limits.Memory
+		hostConfig["MemorySwap"] = limits.Memory
+	}
+	if limits.Pids > 0 {
+		hostConfig["PidsLimit"] = limits.Pids
+	}
+	var ulimits []map[string]any
+	if limits.CPUTime > 0 {
+		secs := int64(max(limits.CPUTime.Round(time.Second), time.Second) / time.Second)
+		ulimits = append(ulimits, map[string]any{"Name": "cpu", "Soft": secs, "Hard": secs + 1})
+	}
+	if limits.FileSize > 0 {
+		ulimits = append(ulimits, map[string]any{"Name": "fsize", "Soft": limits.FileSize, "Hard": limits.FileSize})
+	}
+	if len(ulimits) > 0 {
+		hostConfig["Ulimits"] = ulimits
+	}
+	body := map[string]any{
+		"Image":      s.cfg.Image,
+		"Entrypoint": []string{"tail", "-f", "/dev/null"},
+		"Labels":     map[string]string{dockerLabel: s.cfg.Name},
+		"HostConfig": hostConfig,
+	}
+
+	query := url.Values{"name": {name}}
+	var created struct{ Id string }
+	err := s.client.do(ctx, http.MethodPost, "/containers/create", query, body, &created)
+	if isDockerStatus(err, http.StatusNotFound) {
+		if err := s.client.pull(ctx, s.cfg.Image); err != nil {
+			return "", err
+		}
+		err = s.client.do(ctx, http.MethodPost, "/containers/create", query, body, &created)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+	return created.Id, nil
+}
+
+// release marks a command in the container as exited. The container is
+// removed once no command ran in it for the idle timeout.
+func (c *dockerContainer) release() {
+	dockerContainers.Lock()
+	defer dockerContainers.Unlock()
+	c.running--
+	c.lastActive = time.Now()
+	if c.running == 0 && c.timer == nil {
+		c.timer = time.AfterFunc(c.idle, c.removeIfIdle)
+	}
+}
+
+// forget drops the container so that the next command looks it up again.
+func (c *dockerContainer) forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = ""
+}
+
+func (c *dockerContainer) removeIfIdle() {
+	dockerContainers.Lock()
+	c.timer = nil
+	if c.running > 0 || dockerContainers.m[c.name] != c {
+		dockerContainers.Unlock()
+		return
+	}
+	if idle := time.Since(c.lastActive); idle < c.idle {
+		c.timer = time.AfterFunc(c.idle-idle, c.removeIfIdle)
+		dockerContainers.Unlock()
+		return
+	}
+	delete(dockerContainers.m, c.name)
+	dockerContainers.Unlock()
+
+	c.mu.Lock()
+	id := c.id
+	c.mu.Unlock()
+	if id == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	c.client.do(ctx, http.MethodDelete, "/containers/"+id, url.Values{"force": {"true"}}, nil, nil)
+}
+
+// dockerClient calls the Docker Engine API.
+type dockerClient struct {
+	http *http.Client
+	base string
+}
+
+func newDockerClient(host string) (*dockerClient, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	base := "http://docker"
+	switch u.Scheme {
+	case "unix":
+		socketPath := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+	case "tcp", "http":
+		base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q", host)
+	}
+	return &dockerClient{http: &http.Client{Transport: transport}, base: base + "/" + dockerAPIVersion}, nil
+}
+
+// dockerError is an error response of the Engine API.
+type dockerError struct {
+	status  int
+	message string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.message, e.status)
+}
+
+func isDockerStatus(err error, status int) bool {
+	var de *dockerError
+	return errors.As(err, &de) && de.status == status
+}
+
+func (c *dockerClient) newRequest(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func checkDockerResponse(resp *http.Response) error {
+	if resp.StatusCode < 300 || resp.StatusCode == http.StatusSwitchingProtocols {
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var msg struct{ Message string }
+	if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+		msg.Message = strings.TrimSpace(string(data))
+	}
+	return &dockerError{status: resp.StatusCode, message: msg.Message}
+}
+
+// do sends a request and decodes the json response into out if not nil.
+func (c *dockerClient) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkDockerResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// upgrade sends a request which turns the connection into the stream of
+// an exec.
+func (c *dockerClient) upgrade(ctx context.Context, path string, body any) (io.ReadWriteCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, path, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	// the stream outlives the request
+	req = req.WithContext(context.WithoutCancel(ctx))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDockerResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if rwc, ok := resp.Body.(io.ReadWriteCloser); ok {
+		return rwc, nil
+	}
+	// daemons not switching protocols stream on the response body
+	return readOnlyStream{resp.Body}, nil
+}
+
+type readOnlyStream struct{ io.ReadCloser }
+
+func (readOnlyStream) Write(p []byte) (int, error) { return 0, errors.ErrUnsupported }
+
+// pull pulls the image, which is streamed as json progress messages.
+func (c *dockerClient) pull(ctx context.Context, image string) error {
+	ref, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		ref, tag = image[:i], image[i+1:]
+	}
+	if i := strings.Index(ref, "@"); i >= 0 {
+		// pinned by digest
+		ref, tag = image, ""
+	}
+	query := url.Values{"fromImage": {ref}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+	if err := checkDockerResponse(resp); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct{ Error string }
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to pull image %s: %w", image, err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("failed to pull image %s: %s", image, msg.Error)
+		}
+	}
+}
+
+// PingDocker checks that the Engine API answers on host.
+func PingDocker(ctx context.Context, host string) error {
+	client, err := newDockerClient(host)
+	if err != nil {
+		return err
+	}
+	return client.do(ctx, http.MethodGet, "/_ping", nil, nil, nil)
+}
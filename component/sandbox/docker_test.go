@@ -0,0 +1,404 @@
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker serves the part of the Docker Engine API the sandbox uses and
+// runs the commands of execs on the host.
+type fakeDocker struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	seq        int
+	images     map[string]bool
+	containers map[string]*fakeContainer // by name
+	execs      map[string]*fakeExec
+	created    []map[string]any
+	removed    []string
+}
+
+type fakeContainer struct {
+	id, name string
+	running  bool
+}
+
+type fakeExec struct {
+	Cmd         []string
+	Env         []string
+	WorkingDir  string
+	AttachStdin bool
+
+	running  bool
+	exitCode *int
+}
+
+func newFakeDocker(t *testing.T) (*fakeDocker, string) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake docker kills commands through /proc")
+	}
+	d := &fakeDocker{
+		t:          t,
+		images:     make(map[string]bool),
+		containers: make(map[string]*fakeContainer),
+		execs:      make(map[string]*fakeExec),
+	}
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(d)
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return d, "unix://" + socketPath
+}
+
+func (d *fakeDocker) byId(id string) *fakeContainer {
+	for _, c := range d.containers {
+		if c.id == id || c.name == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (d *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	notFound := func(what string) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "No such " + what})
+	}
+
+	d.mu.Lock()
+	switch {
+	case r.Method == http.MethodPost && path == "/images/create":
+		d.images[r.URL.Query().Get("fromImage")+":"+r.URL.Query().Get("tag")] = true
+		d.mu.Unlock()
+		fmt.Fprintln(w, `{"status":"Pulling"}`)
+		fmt.Fprintln(w, `{"status":"Done"}`)
+	case r.Method == http.MethodPost && path == "/containers/create":
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		image := body["Image"].(string)
+		if !strings.Contains(image, ":") {
+			image += ":latest"
+		}
+		if !d.images[image] {
+			d.mu.Unlock()
+			notFound("image")
+			return
+		}
+		d.seq++
+		c := &fakeContainer{id: fmt.Sprintf("c%d", d.seq), name: r.URL.Query().Get("name")}
+		d.containers[c.name] = c
+		d.created = append(d.created, body)
+		d.mu.Unlock()
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": c.id})
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "json":
+		c := d.byId(parts[1])
+		d.mu.Unlock()
+		if c == nil {
+			notFound("container")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"Id": c.id, "State": map[string]bool{"Running": c.running}})
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "start":
+		c := d.byId(parts[1])
+		if c != nil {
+			c.running = true
+		}
+		d.mu.Unlock()
+		if c == nil {
+			notFound("container")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "exec":
+		c := d.byId(parts[1])
+		if c == nil {
+			d.mu.Unlock()
+			notFound("container")
+			return
+		}
+		e := &fakeExec{}
+		json.NewDecoder(r.Body).Decode(e)
+		d.seq++
+		id := fmt.Sprintf("e%d", d.seq)
+		d.execs[id] = e
+		d.mu.Unlock()
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": id})
+	case len(parts) == 3 && parts[0] == "exec" && parts[2] == "start":
+		e := d.execs[parts[1]]
+		e.running = true
+		d.mu.Unlock()
+		d.runExec(w, r, e)
+	case len(parts) == 3 && parts[0] == "exec" && parts[2] == "json":
+		e := d.execs[parts[1]]
+		info := map[string]any{"Running": e.running, "ExitCode": e.exitCode}
+		d.mu.Unlock()
+		writeJSON(w, http.StatusOK, info)
+	case r.Method == http.MethodDelete && len(parts) == 2 && parts[0] == "containers":
+		if c := d.byId(parts[1]); c != nil {
+			delete(d.containers, c.name)
+			d.removed = append(d.removed, c.id)
+		}
+		d.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		d.mu.Unlock()
+		d.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		notFound("endpoint")
+	}
+}
+
+// runExec runs the command of the exec on the hijacked connection.
+func (d *fakeDocker) runExec(w http.ResponseWriter, r *http.Request, e *fakeExec) {
+	io.Copy(io.Discard, r.Body)
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		d.t.Error(err)
+		return
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+
+	cmd := exec.Command(e.Cmd[0], e.Cmd[1:]...)
+	cmd.Env = append(os.Environ(), e.Env...)
+	cmd.Dir = e.WorkingDir
+	if e.AttachStdin {
+		// the stream stays open after the command exits
+		stdin, _ := cmd.StdinPipe()
+		go io.Copy(stdin, buf.Reader)
+	}
+	var mu sync.Mutex
+	frame := func(stream byte) io.Writer {
+		return writerFunc(func(p []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			header := [8]byte{stream}
+			binary.BigEndian.PutUint32(header[4:], uint32(len(p)))
+			conn.Write(header[:])
+			return conn.Write(p)
+		})
+	}
+	cmd.Stdout = frame(1)
+	cmd.Stderr = frame(2)
+	cmd.Run()
+
+	code := cmd.ProcessState.ExitCode()
+	if code < 0 {
+		code = 137
+	}
+	d.mu.Lock()
+	e.running = false
+	e.exitCode = &code
+	d.mu.Unlock()
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestDockerSandbox(t *testing.T) {
+	d, host := newFakeDocker(t)
+	roDir, rwDir := t.TempDir(), t.TempDir()
+	sb := NewDockerSandbox(DockerConfig{Host: host, Image: "alpine", Name: "main agent"},
+		WithReadOnlyPaths(roDir, filepath.Join(roDir, "missing")),
+		WithReadWritePaths(rwDir),
+		WithWorkingDir(rwDir),
+		WithNetwork(NetworkNone),
+		WithLimits(Limits{Memory: 1 << 30, Pids: 64, FileSize: 1 << 20}),
+	)
+
+	var out lockedBuffer
+	if err := sb.Run(t.Context(), "echo out; echo err >&2; pwd", &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"out\n", "err\n", rwDir + "\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q misses %q", out.String(), want)
+		}
+	}
+
+	output, err := sb.Execute(t.Context(), "echo failed; exit 3")
+	var ce *CommandError
+	if !errors.As(err, &ce) || ce.ExitCode != 3 || ce.Output != "failed\n" {
+		t.Fatalf("output = %q, err = %v", output, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.images["alpine:latest"] {
+		t.Error("image was not pulled")
+	}
+	if len(d.created) != 1 {
+		t.Fatalf("created %d containers, want 1", len(d.created))
+	}
+	for name := range d.containers {
+		if !strings.HasPrefix(name, "tokkibot-main-agent-") {
+			t.Errorf("container name = %s", name)
+		}
+	}
+	hostConfig := d.created[0]["HostConfig"].(map[string]any)
+	binds := fmt.Sprint(hostConfig["Binds"])
+	if binds != fmt.Sprintf("[%s:%s:ro %s:%s]", roDir, roDir, rwDir, rwDir) {
+		t.Errorf("binds = %s", binds)
+	}
+	if hostConfig["NetworkMode"] != "none" || hostConfig["Memory"] != float64(1<<30) || hostConfig["PidsLimit"] != float64(64) {
+		t.Errorf("host config = %v", hostConfig)
+	}
+	if ulimits := fmt.Sprint(hostConfig["Ulimits"]); !strings.Contains(ulimits, "fsize") {
+		t.Errorf("ulimits = %s", ulimits)
+	}
+}
+
+func TestDockerSandbox_Scope(t *testing.T) {
+	d, host := newFakeDocker(t)
+	d.images["python:3.12"] = true
+	sb := NewDockerSandbox(DockerConfig{Host: host, Image: "python:3.12", Name: "scoped", PerScope: true})
+
+	for _, scope := range []string{"lark:a", "lark:b", "lark:a"} {
+		if _, err := sb.Execute(WithScope(t.Context(), scope), "true"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.mu.Lock()
+	created := len(d.created)
+	d.mu.Unlock()
+	if created != 2 {
+		t.Errorf("created %d containers, want one per scope", created)
+	}
+}
+
+func TestDockerSandbox_Kill(t *testing.T) {
+	d, host := newFakeDocker(t)
+	d.images["alpine:latest"] = true
+	sb := NewDockerSandbox(DockerConfig{Host: host, Image: "alpine", Name: "kill"})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := sb.Run(ctx, "sleep 30 & sleep 30", io.Discard)
+	if !IsCommandError(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if took := time.Since(start); took > dockerKillWait {
+		t.Errorf("run returned after %s", took)
+	}
+
+	// output beyond the limit kills the command
+	sb = NewDockerSandbox(DockerConfig{Host: host, Image: "alpine", Name: "kill"}, WithLimits(Limits{Output: 1000}))
+	var out lockedBuffer
+	err = sb.Run(t.Context(), "while :; do echo yes; done", &out)
+	if !IsSandboxError(err) || !strings.Contains(err.Error(), "output limit of 1000B exceeded") {
+		t.Errorf("err = %v", err)
+	}
+	if len(out.String()) != 1000 {
+		t.Errorf("output has %d bytes", len(out.String()))
+	}
+}
+
+func TestDockerSandbox_Start(t *testing.T) {
+	d, host := newFakeDocker(t)
+	d.images["alpine:latest"] = true
+	sb := NewDockerSandbox(DockerConfig{Host: host, Image: "alpine", Name: "start"})
+
+	stdinR, stdinW := io.Pipe()
+	var out lockedBuffer
+	p, err := sb.Start(t.Context(), "read line; echo got $line", stdinR, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(stdinW, "hello")
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	stdinW.Close()
+	if got := out.String(); got != "got hello\n" {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestDockerSandbox_Idle(t *testing.T) {
+	d, host := newFakeDocker(t)
+	d.images["alpine:latest"] = true
+	sb := NewDockerSandbox(DockerConfig{Host: host, Image: "alpine", Name: "idle", IdleTimeout: 100 * time.Millisecond})
+
+	if _, err := sb.Execute(t.Context(), "true"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		d.mu.Lock()
+		removed := len(d.removed)
+		d.mu.Unlock()
+		if removed == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("idle container was not removed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// removed behind our back, the next command creates it again
+	if _, err := sb.Execute(t.Context(), "true"); err != nil {
+		t.Fatal(err)
+	}
+	d.mu.Lock()
+	for name := range d.containers {
+		delete(d.containers, name)
+	}
+	d.mu.Unlock()
+	if _, err := sb.Execute(t.Context(), "true"); err != nil {
+		t.Fatal(err)
+	}
+	d.mu.Lock()
+	created := len(d.created)
+	d.mu.Unlock()
+	if created != 3 {
+		t.Errorf("created %d containers, want 3", created)
+	}
+}
+
+func TestDemuxDockerStream(t *testing.T) {
+	var in strings.Builder
+	for _, part := range []string{"hello ", "world\n"} {
+		header := [8]byte{1}
+		binary.BigEndian.PutUint32(header[4:], uint32(len(part)))
+		in.Write(header[:])
+		in.WriteString(part)
+	}
+	var out strings.Builder
+	if err := demuxDockerStream(bufio.NewReader(strings.NewReader(in.String())), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello world\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
@@ -0,0 +1,24 @@
+package sandbox
+
+import "fmt"
+
+// exit codes of shells on linux for commands killed by SIGXCPU and SIGXFSZ,
+// which are sent when the cpu time and file size limits are exceeded
+const (
+	exitCodeCPULimit  = 128 + 24
+	exitCodeFileLimit = 128 + 25
+)
+
+// rlimitViolation returns why a command exited with exitCode if it broke
+// the output, cpu time or file size limit, empty if it did not.
+func rlimitViolation(limits Limits, output *outputLimiter, exitCode int) string {
+	switch {
+	case output != nil && output.isExceeded():
+		return fmt.Sprintf("output limit of %s exceeded, the command was killed", formatBytes(limits.Output))
+	case limits.CPUTime > 0 && exitCode == exitCodeCPULimit:
+		return fmt.Sprintf("cpu time limit of %s exceeded", limits.CPUTime)
+	case limits.FileSize > 0 && exitCode == exitCodeFileLimit:
+		return fmt.Sprintf("file size limit of %s exceeded", formatBytes(limits.FileSize))
+	}
+	return ""
+}
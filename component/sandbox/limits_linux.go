@@ -0,0 +1,264 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the directory of the proxy socket inside the sandbox
+const sandboxProxyDir = "/run/tokkibot-proxy"
+
+// sandboxLimits applies the network policy and the limits of SandboxImpl to
+// a command and tells which of them it broke.
+type sandboxLimits struct {
+	limits Limits
+
+	output   *outputLimiter
+	cgroup   *cgroup
+	proxy    *filterProxy
+	proxyDir string
+}
+
+var _ limitWatcher = (*sandboxLimits)(nil)
+
+func newSandboxLimits(opt option) (*sandboxLimits, error) {
+	l := &sandboxLimits{limits: opt.limits}
+
+	if opt.limits.Cgroup != "" && (opt.limits.Memory > 0 || opt.limits.Pids > 0) {
+		cg, err := newCgroup(opt.limits.Cgroup, opt.limits.Memory, opt.limits.Pids)
+		if err != nil {
+			return nil, &SandboxError{Reason: fmt.Sprintf("cgroup %s not usable", opt.limits.Cgroup), Err: err}
+		}
+		l.cgroup = cg
+	}
+
+	if opt.network == NetworkAllowlist {
+		dir, err := os.MkdirTemp("", "tokkibot-proxy-")
+		if err != nil {
+			l.close()
+			return nil, &SandboxError{Reason: "network proxy not available", Err: err}
+		}
+		l.proxyDir = dir
+		proxy, err := startFilterProxy(filepath.Join(dir, "proxy.sock"), opt.allowedHosts)
+		if err != nil {
+			l.close()
+			return nil, &SandboxError{Reason: "network proxy not available", Err: err}
+		}
+		l.proxy = proxy
+	}
+
+	return l, nil
+}
+
+// wrap returns the bwrap arguments the limits need and the command run
+// with them.
+func (l *sandboxLimits) wrap(command []string) (bwrapArgs, wrapped []string, err error) {
+	var prlimit []string
+	if l.limits.CPUTime > 0 {
+		secs := int64(max(l.limits.CPUTime.Round(time.Second), time.Second) / time.Second)
+		// SIGXCPU at the soft limit tells why the process was killed
+		prlimit = append(prlimit, fmt.Sprintf("--cpu=%d:%d", secs, secs+1))
+	}
+	if l.limits.Memory > 0 && l.cgroup == nil {
+		prlimit = append(prlimit, fmt.Sprintf("--as=%d", l.limits.Memory))
+	}
+	if l.limits.Pids > 0 && l.cgroup == nil {
+		prlimit = append(prlimit, fmt.Sprintf("--nproc=%d", l.limits.Pids))
+	}
+	if l.limits.FileSize > 0 {
+		prlimit = append(prlimit, fmt.Sprintf("--fsize=%d", l.limits.FileSize))
+	}
+	if len(prlimit) > 0 {
+		prlimitPath, err := exec.LookPath("prlimit")
+		if err != nil {
+			return nil, nil, &SandboxError{Reason: "prlimit not found, install util-linux to limit commands", Err: err}
+		}
+		bwrapArgs = append(bwrapArgs, "--ro-bind", prlimitPath, prlimitPath)
+		command = append(append(append([]string{prlimitPath}, prlimit...), "--"), command...)
+	}
+
+	if l.proxy != nil {
+		exe, err := os.Executable()
+		if err == nil {
+			exe, err = filepath.EvalSymlinks(exe)
+		}
+		if err != nil {
+			return nil, nil, &SandboxError{Reason: "network bridge not available", Err: err}
+		}
+		proxyURL := "http://" + bridgeProxyAddr
+		bwrapArgs = append(bwrapArgs,
+			"--bind", l.proxyDir, sandboxProxyDir,
+			"--ro-bind", exe, exe,
+		)
+		for _, env := range []string{
+			"http_proxy", "https_proxy", "HTTP_PROXY", "HTTPS_PROXY",
+			"npm_config_proxy", "npm_config_https_proxy",
+		} {
+			bwrapArgs = append(bwrapArgs, "--setenv", env, proxyURL)
+		}
+		bwrapArgs = append(bwrapArgs,
+			"--setenv", "no_proxy", "localhost,127.0.0.1",
+			"--setenv", "NO_PROXY", "localhost,127.0.0.1",
+		)
+		command = append([]string{exe, BridgeCommand, sandboxProxyDir + "/proxy.sock"}, command...)
+	}
+
+	return bwrapArgs, command, nil
+}
+
+// limitOutput returns out limited to the output limit, kill is called
+// once the command wrote more.
+func (l *sandboxLimits) limitOutput(out io.Writer, kill func()) io.Writer {
+	if l.limits.Output <= 0 {
+		return out
+	}
+	l.output = &outputLimiter{w: out, max: l.limits.Output, exceeded: kill}
+	return l.output
+}
+
+func (l *sandboxLimits) prepare(cmd *exec.Cmd) {
+	if l.cgroup != nil {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(l.cgroup.fd.Fd())
+	}
+}
+
+func (l *sandboxLimits) violation(exitCode int) error {
+	reason := rlimitViolation(l.limits, l.output, exitCode)
+	switch {
+	case reason != "":
+	case l.cgroup != nil && l.cgroup.oomKilled():
+		reason = fmt.Sprintf("memory limit of %s exceeded, the command was killed", formatBytes(l.limits.Memory))
+	case l.cgroup != nil && l.cgroup.pidsExhausted():
+		reason = fmt.Sprintf("process limit of %d reached", l.limits.Pids)
+	case l.proxy != nil && len(l.proxy.deniedHosts()) > 0:
+		reason = fmt.Sprintf("network access to %s is not allowed, allowed hosts are %s",
+			strings.Join(l.proxy.deniedHosts(), ", "), strings.Join(l.proxy.allowed, ", "))
+	default:
+		return nil
+	}
+	return &SandboxError{Reason: reason}
+}
+
+func (l *sandboxLimits) reset() {
+	if l.output != nil {
+		l.output.reset()
+	}
+	if l.cgroup != nil {
+		l.cgroup.reset()
+	}
+	if l.proxy != nil {
+		l.proxy.reset()
+	}
+}
+
+func (l *sandboxLimits) close() {
+	if l.cgroup != nil {
+		l.cgroup.remove()
+	}
+	if l.proxy != nil {
+		l.proxy.close()
+	}
+	if l.proxyDir != "" {
+		os.RemoveAll(l.proxyDir)
+	}
+}
+
+// cgroup is a cgroup v2 created for a command.
+type cgroup struct {
+	dir string
+	fd  *os.File
+
+	// counts of the events before the current command
+	oomKills  int
+	pidsLimit int
+}
+
+func newCgroup(parent string, memory int64, pids int) (*cgroup, error) {
+	dir, err := os.MkdirTemp(parent, "tokkibot-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	cg := &cgroup{dir: dir}
+	if memory > 0 {
+		if err := cg.set("memory.max", strconv.FormatInt(memory, 10)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+		// swapping only slows the command down before it is killed
+		cg.set("memory.swap.max", "0")
+	}
+	if pids > 0 {
+		if err := cg.set("pids.max", strconv.Itoa(pids)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	if cg.fd, err = os.Open(dir); err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	return cg, nil
+}
+
+func (c *cgroup) set(file, value string) error {
+	if err := os.WriteFile(filepath.Join(c.dir, file), []byte(value), 0o644); err != nil {
+		return fmt.Errorf("failed to set %s: %w", file, err)
+	}
+	return nil
+}
+
+// count returns the value of key in an events file of the cgroup.
+func (c *cgroup) count(file, key string) int {
+	data, err := os.ReadFile(filepath.Join(c.dir, file))
+	if err != nil {
+		return 0
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), " "); ok && k == key {
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
+
+func (c *cgroup) oomKilled() bool {
+	return c.count("memory.events", "oom_kill") > c.oomKills
+}
+
+func (c *cgroup) pidsExhausted() bool {
+	return c.count("pids.events", "max") > c.pidsLimit
+}
+
+func (c *cgroup) reset() {
+	c.oomKills = c.count("memory.events", "oom_kill")
+	c.pidsLimit = c.count("pids.events", "max")
+}
+
+// remove kills what is left in the cgroup and removes it.
+func (c *cgroup) remove() {
+	if c.fd != nil {
+		c.fd.Close()
+	}
+	c.set("cgroup.kill", "1")
+	for range 50 {
+		err := os.Remove(c.dir)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
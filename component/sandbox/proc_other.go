@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sandbox
+
+import "os/exec"
+
+// setProcessGroup is a no-op, cancelling kills only the command itself.
+func setProcessGroup(cmd *exec.Cmd) {}
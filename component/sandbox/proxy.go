@@ -0,0 +1,198 @@
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const proxyDialTimeout = 30 * time.Second
+
+// hop-by-hop headers are not passed on by the proxy
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// filterProxy is an http proxy which only lets requests to allowed hosts
+// through. It is the only way out of a sandbox with NetworkAllowlist.
+type filterProxy struct {
+	allowed   []string
+	server    *http.Server
+	transport *http.Transport
+
+	mu     sync.Mutex
+	denied []string // hosts denied since the last reset
+}
+
+// startFilterProxy starts the proxy listening on the unix socket.
+func startFilterProxy(socketPath string, allowed []string) (*filterProxy, error) {
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on proxy socket: %w", err)
+	}
+	dialer := &net.Dialer{Timeout: proxyDialTimeout}
+	p := &filterProxy{
+		allowed: allowed,
+		transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: proxyDialTimeout,
+		},
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: proxyDialTimeout}
+	go p.server.Serve(ln)
+	return p, nil
+}
+
+func (p *filterProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.Host
+	if r.Method != http.MethodConnect {
+		if !r.URL.IsAbs() {
+			http.Error(w, "tokkibot sandbox: not a proxy request", http.StatusBadRequest)
+			return
+		}
+		target = r.URL.Host
+	}
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+	if !hostAllowed(host, p.allowed) {
+		p.deny(host)
+		http.Error(w, fmt.Sprintf("tokkibot sandbox: %s is not in the network allowlist", host), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, target)
+	} else {
+		p.forward(w, r)
+	}
+}
+
+// tunnel passes the connection on to target, for https.
+func (p *filterProxy) tunnel(w http.ResponseWriter, target string) {
+	upstream, err := net.DialTimeout("tcp", target, proxyDialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunnel not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+	pipe(conn, buf.Reader, upstream)
+}
+
+// pipe copies between both connections until one side is done.
+func pipe(conn net.Conn, connReader *bufio.Reader, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, connReader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+	conn.Close()
+	upstream.Close()
+	<-done
+}
+
+// forward sends a plain http request on.
+func (p *filterProxy) forward(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (p *filterProxy) deny(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !slices.Contains(p.denied, host) {
+		p.denied = append(p.denied, host)
+	}
+}
+
+// deniedHosts returns the hosts denied since the last reset.
+func (p *filterProxy) deniedHosts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.denied)
+}
+
+func (p *filterProxy) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.denied = nil
+}
+
+func (p *filterProxy) close() {
+	p.server.Close()
+	p.transport.CloseIdleConnections()
+}
+
+// hostAllowed reports whether host matches one of the patterns. A pattern
+// matches the host itself, *.example.com matches the subdomains of
+// example.com.
+func hostAllowed(host string, patterns []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	patterns := []string{"registry.npmjs.org", "*.pypi.org"}
+	for host, want := range map[string]bool{
+		"registry.npmjs.org":  true,
+		"Registry.NPMJS.org.": true,
+		"npmjs.org":           false,
+		"files.pypi.org":      true,
+		"pypi.org":            false,
+		"evilpypi.org":        false,
+		"example.com":         false,
+	} {
+		if got := hostAllowed(host, patterns); got != want {
+			t.Errorf("hostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestFilterProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from upstream")
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	socketPath := filepath.Join(t.TempDir(), "proxy.sock")
+	proxy, err := startFilterProxy(socketPath, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.close()
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy"}),
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socketPath)
+		},
+	}}
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello from upstream" {
+		t.Errorf("body = %q", body)
+	}
+
+	// https goes through a tunnel
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", upstreamURL.Host, upstreamURL.Host)
+	br := bufio.NewReader(conn)
+	status, _ := br.ReadString('\n')
+	if !strings.Contains(status, "200") {
+		t.Fatalf("CONNECT status = %q", status)
+	}
+	br.ReadString('\n')
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", upstreamURL.Host)
+	rest, _ := io.ReadAll(br)
+	conn.Close()
+	if !strings.Contains(string(rest), "hello from upstream") {
+		t.Errorf("tunnel response = %q", rest)
+	}
+
+	if denied := proxy.deniedHosts(); len(denied) != 0 {
+		t.Fatalf("denied = %v", denied)
+	}
+	resp, err = client.Get("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+	if denied := proxy.deniedHosts(); len(denied) != 1 || denied[0] != "example.com" {
+		t.Errorf("denied = %v", denied)
+	}
+	proxy.reset()
+	if denied := proxy.deniedHosts(); len(denied) != 0 {
+		t.Errorf("denied after reset = %v", denied)
+	}
+}
@@ -1,10 +1,17 @@
 package sandbox
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"os/exec"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type option struct {
@@ -16,6 +23,38 @@ type option struct {
 
 	// initial working directory inside sandbox
 	workingDir string
+
+	// network access of commands and the hosts of NetworkAllowlist
+	network      NetworkMode
+	allowedHosts []string
+
+	limits Limits
+}
+
+type NetworkMode string
+
+const (
+	NetworkFull      NetworkMode = "full"
+	NetworkNone      NetworkMode = "none"
+	NetworkAllowlist NetworkMode = "allowlist"
+)
+
+// Limits of the resources a command may use, zero values are unlimited.
+type Limits struct {
+	// cpu time of each process
+	CPUTime time.Duration
+	// memory of all processes of a command, only the address space of each
+	// process is limited without Cgroup
+	Memory int64
+	// processes of a command at once, processes of the user without Cgroup
+	Pids int
+	// largest file a process may write
+	FileSize int64
+	// output of a command, it is killed when it writes more
+	Output int64
+	// delegated cgroup v2 directory, a cgroup is created in it for each
+	// command to limit Memory and Pids
+	Cgroup string
 }
 
 type Option func(*option)
@@ -67,14 +106,36 @@ func WithWorkingDir(dir string) Option {
 	}
 }
 
-// SandboxError indicates the sandbox itself failed (permission, mount, config issues).
-// The command never ran. Retrying the same command won't help.
+// WithNetwork sets the network access of commands, allowedHosts are used
+// by NetworkAllowlist. Commands use the host network by default.
+func WithNetwork(mode NetworkMode, allowedHosts ...string) Option {
+	return func(o *option) {
+		o.network = mode
+		o.allowedHosts = allowedHosts
+	}
+}
+
+func WithLimits(limits Limits) Option {
+	return func(o *option) {
+		o.limits = limits
+	}
+}
+
+// SandboxError indicates the sandbox itself failed (permission, mount, config issues)
+// and the command never ran, or the command broke a limit of the sandbox.
+// Retrying the same command won't help.
 type SandboxError struct {
 	Reason string
 	Err    error
 }
 
-func (e *SandboxError) Error() string { return fmt.Sprintf("sandbox error: %s: %v", e.Reason, e.Err) }
+func (e *SandboxError) Error() string {
+	if e.Err == nil {
+		return "sandbox error: " + e.Reason
+	}
+	return fmt.Sprintf("sandbox error: %s: %v", e.Reason, e.Err)
+}
+
 func (e *SandboxError) Unwrap() error { return e.Err }
 
 // CommandError indicates the command ran inside the sandbox but exited with non-zero code.
@@ -102,6 +163,226 @@ func IsCommandError(err error) bool {
 
 type Sandbox interface {
 	Execute(ctx context.Context, command string) (string, error)
+	// Run runs the command like Execute but writes the combined output to out
+	// while the command runs. A CommandError returned by Run has no Output.
+	Run(ctx context.Context, command string, out io.Writer) error
+	// Start starts the command reading from stdin, e.g. a shell kept between
+	// calls. It runs until it exits, ctx is done or it is killed.
+	Start(ctx context.Context, command string, stdin io.Reader, out io.Writer) (*Process, error)
+}
+
+// Process is a command started by Sandbox.Start.
+type Process struct {
+	cmd *exec.Cmd
+	// wait and kill commands which are not run by cmd
+	wait func() error
+	kill func() error
+	// converts the error of the exited command
+	waitErr func(err error) error
+	// watches the limits of the command, nil without limits
+	limits limitWatcher
+}
+
+// limitWatcher tells which limit a command broke.
+type limitWatcher interface {
+	// violation returns a SandboxError if the command exited with exitCode
+	// because it broke a limit
+	violation(exitCode int) error
+	// reset forgets what the commands before did
+	reset()
+	// close releases what the limits need once the command exited
+	close()
+}
+
+// Wait waits for the command to exit. It returns a CommandError without
+// Output if the command failed, or a SandboxError if it broke a limit.
+func (p *Process) Wait() error {
+	var err error
+	if p.cmd != nil {
+		err = p.cmd.Wait()
+	} else {
+		err = p.wait()
+	}
+	if p.limits != nil {
+		defer p.limits.close()
+	}
+	if err == nil {
+		return nil
+	}
+	if p.limits != nil {
+		if verr := p.limits.violation(exitCode(err)); verr != nil {
+			return verr
+		}
+	}
+	if p.waitErr != nil {
+		return p.waitErr(err)
+	}
+	return &CommandError{ExitCode: exitCode(err), Err: err}
+}
+
+// CheckExit returns a SandboxError if a command run by the process, e.g. by
+// a shell started with Start, exited with exitCode because it broke a limit.
+func (p *Process) CheckExit(exitCode int) error {
+	if p.limits == nil || exitCode == 0 {
+		return nil
+	}
+	return p.limits.violation(exitCode)
+}
+
+// ResetLimits counts the output of the process and what it did from now on,
+// for processes which run one command after another.
+func (p *Process) ResetLimits() {
+	if p.limits != nil {
+		p.limits.reset()
+	}
+}
+
+// Kill kills the command and the processes it started.
+func (p *Process) Kill() error {
+	if p.cmd == nil {
+		return p.kill()
+	}
+	if p.cmd.Cancel != nil {
+		return p.cmd.Cancel()
+	}
+	return p.cmd.Process.Kill()
+}
+
+// runByStart implements Run on top of Start.
+func runByStart(ctx context.Context, sb Sandbox, command string, out io.Writer) error {
+	p, err := sb.Start(ctx, command, nil, out)
+	if err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+// executeByRun implements Execute on top of Run.
+func executeByRun(ctx context.Context, sb Sandbox, command string) (string, error) {
+	var buf lockedBuffer
+	err := sb.Run(ctx, command, &buf)
+	if ce, ok := err.(*CommandError); ok {
+		ce.Output = buf.String()
+	}
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// lockedBuffer is a bytes.Buffer which may be written by stdout and stderr
+// of a command at the same time.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// outputLimiter passes output on until max bytes were written, then calls
+// exceeded once and drops the rest.
+type outputLimiter struct {
+	w        io.Writer
+	max      int64
+	exceeded func()
+
+	mu   sync.Mutex
+	n    int64
+	over bool
+}
+
+func (l *outputLimiter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.over {
+		return len(p), nil
+	}
+	room := l.max - l.n
+	if int64(len(p)) <= room {
+		l.n += int64(len(p))
+		return l.w.Write(p)
+	}
+	l.n = l.max
+	l.over = true
+	l.w.Write(p[:room])
+	if l.exceeded != nil {
+		l.exceeded()
+	}
+	return len(p), nil
+}
+
+func (l *outputLimiter) isExceeded() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.over
+}
+
+func (l *outputLimiter) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.n = 0
+}
+
+// formatBytes formats sizes of limits, e.g. 2GB.
+func formatBytes(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= u.size {
+			v := math.Round(float64(n)/float64(u.size)*10) / 10
+			return strconv.FormatFloat(v, 'f', -1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// commandWaitDelay is how long Wait waits for the output pipes after the
+// command was killed, descendants may still hold them open.
+const commandWaitDelay = 3 * time.Second
+
+// startCommand starts the command so that it is killed as a whole when ctx
+// is done.
+func startCommand(cmd *exec.Cmd, stdin io.Reader, out io.Writer, waitErr func(error) error) (*Process, error) {
+	prepareCommand(cmd, stdin, out)
+	if err := cmd.Start(); err != nil {
+		return nil, &CommandError{ExitCode: -1, Err: err}
+	}
+	return &Process{cmd: cmd, waitErr: waitErr}, nil
+}
+
+func prepareCommand(cmd *exec.Cmd, stdin io.Reader, out io.Writer) {
+	cmd.Stdin = stdin
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = commandWaitDelay
+	setProcessGroup(cmd)
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func exitCode(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	var ce *CommandError
+	if errors.As(err, &ce) {
+		return ce.ExitCode
+	}
+	return -1
 }
 
 // PassthroughSandbox executes commands directly on the host without isolation.
@@ -114,24 +395,17 @@ func NewPassthroughSandbox(workingDir string) Sandbox {
 }
 
 func (p *PassthroughSandbox) Execute(ctx context.Context, command string) (string, error) {
+	return executeByRun(ctx, p, command)
+}
+
+func (p *PassthroughSandbox) Run(ctx context.Context, command string, out io.Writer) error {
+	return runByStart(ctx, p, command, out)
+}
+
+func (p *PassthroughSandbox) Start(ctx context.Context, command string, stdin io.Reader, out io.Writer) (*Process, error) {
 	cmd := exec.CommandContext(ctx, "sh", "-c", command)
 	if p.workingDir != "" {
 		cmd.Dir = p.workingDir
 	}
-
-	output, err := cmd.CombinedOutput()
-	if err == nil {
-		return string(output), nil
-	}
-
-	exitCode := -1
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		exitCode = exitErr.ExitCode()
-	}
-
-	return "", &CommandError{
-		ExitCode: exitCode,
-		Output:   string(output),
-		Err:      err,
-	}
+	return startCommand(cmd, stdin, out, nil)
 }
@@ -5,6 +5,7 @@ package sandbox
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -99,56 +100,91 @@ func (s *SandboxImpl) beforeExecute(_ context.Context) (string, error) {
 }
 
 func (s *SandboxImpl) Execute(ctx context.Context, command string) (string, error) {
+	return executeByRun(ctx, s, command)
+}
+
+func (s *SandboxImpl) Run(ctx context.Context, command string, out io.Writer) error {
+	return runByStart(ctx, s, command, out)
+}
+
+func (s *SandboxImpl) Start(ctx context.Context, command string, stdin io.Reader, out io.Writer) (*Process, error) {
 	bwrapPath, err := s.beforeExecute(ctx)
 	if err != nil {
-		return "", &SandboxError{Reason: "bwrap not available", Err: err}
+		return nil, &SandboxError{Reason: "bwrap not available", Err: err}
 	}
 
 	executableToken, _ := bash.ParseCommand(command)
 	if executableToken == "" {
-		return "", &SandboxError{Reason: "empty command", Err: fmt.Errorf("no executable parsed from command")}
+		return nil, &SandboxError{Reason: "empty command", Err: fmt.Errorf("no executable parsed from command")}
 	}
 
 	executablePath, err := resolveExecutablePath(executableToken)
 	if err != nil {
-		return "", &SandboxError{Reason: fmt.Sprintf("executable %q not found on host", executableToken), Err: err}
+		return nil, &SandboxError{Reason: fmt.Sprintf("executable %q not found on host", executableToken), Err: err}
+	}
+
+	limits, err := newSandboxLimits(s.opt)
+	if err != nil {
+		return nil, err
+	}
+	limitArgs, wrapped, err := limits.wrap([]string{"sh", "-c", command})
+	if err != nil {
+		limits.close()
+		return nil, err
 	}
 
 	bwrapArgs := s.buildBwrapArgs(executablePath)
-	bwrapArgs = append(bwrapArgs, "sh", "-c", command)
+	bwrapArgs = append(bwrapArgs, limitArgs...)
+	bwrapArgs = append(bwrapArgs, wrapped...)
 
 	cmd := exec.CommandContext(ctx, bwrapPath, bwrapArgs...)
 	// Explicitly pass host environment variables into bwrap process.
 	// bwrap --setenv flags in buildBwrapArgs can still override selected keys.
 	cmd.Env = os.Environ()
 
-	output, err := cmd.CombinedOutput()
-	if err == nil {
-		return string(output), nil
-	}
-
-	outputStr := string(output)
-	exitCode := -1
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		exitCode = exitErr.ExitCode()
+	// bwrap fails before the command starts, so its errors are at the head
+	// of the output
+	head := &headWriter{max: 4096}
+	out = limits.limitOutput(out, func() { cmd.Cancel() })
+	prepareCommand(cmd, stdin, io.MultiWriter(out, head))
+	limits.prepare(cmd)
+	if err := cmd.Start(); err != nil {
+		limits.close()
+		return nil, &CommandError{ExitCode: -1, Err: err}
 	}
 
-	if isBwrapError(outputStr) {
-		return "", &SandboxError{
-			Reason: fmt.Sprintf("sandbox restriction (exit %d): %s", exitCode, summarizeOutput(outputStr)),
-			Err:    err,
+	return &Process{cmd: cmd, limits: limits, waitErr: func(err error) error {
+		code := exitCode(err)
+		if outputStr := head.String(); isBwrapError(outputStr) {
+			return &SandboxError{
+				Reason: fmt.Sprintf("sandbox restriction (exit %d): %s", code, summarizeOutput(outputStr)),
+				Err:    err,
+			}
 		}
-	}
+		return &CommandError{
+			ExitCode: code,
+			Err:      err,
+		}
+	}}, nil
+}
+
+// headWriter keeps the first max bytes written to it.
+type headWriter struct {
+	lockedBuffer
+	max int
+}
 
-	return "", &CommandError{
-		ExitCode: exitCode,
-		Output:   outputStr,
-		Err:      err,
+func (w *headWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if room := w.max - w.buf.Len(); room > 0 {
+		w.buf.Write(p[:min(room, len(p))])
 	}
+	return len(p), nil
 }
 
 func isBwrapError(output string) bool {
-	return strings.Contains(output, bwrapErrorPrefix)
+	return strings.Contains(output, bwrapErrorPrefix) || strings.Contains(output, bridgeErrorPrefix)
 }
 
 func summarizeOutput(output string) string {
@@ -212,12 +248,16 @@ func (s *SandboxImpl) buildBwrapArgs(executablePath string) []string {
 		sandboxHome = "/home/sandbox"
 	}
 
-	args := []string{
-		"--unshare-all",
-		"--share-net",
+	args := []string{"--unshare-all"}
+	// commands of NetworkNone and NetworkAllowlist get a network of their
+	// own without a way out, the proxy is the only way out of the latter
+	if s.opt.network == "" || s.opt.network == NetworkFull {
+		args = append(args, "--share-net")
+	}
+	args = append(args,
 		"--die-with-parent",
 		"--new-session",
-	}
+	)
 
 	// ── 1. System core directories ── read only
 	for _, path := range []string{"/usr", "/lib", "/lib64", "/bin", "/sbin"} {
@@ -363,8 +403,3 @@ func resolveToolChainDirs() []string {
 
 	return dirs
 }
-
-func pathExists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
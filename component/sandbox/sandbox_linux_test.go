@@ -2,7 +2,16 @@
 
 package sandbox
 
-import "testing"
+import (
+	"context"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestSandboxImpl_Execute(t *testing.T) {
 	sandbox := &SandboxImpl{}
@@ -11,3 +20,63 @@ func TestSandboxImpl_Execute(t *testing.T) {
 	t.Log(file)
 	t.Log(err)
 }
+
+func TestPassthroughSandbox_RunKillsChildren(t *testing.T) {
+	sb := NewPassthroughSandbox("")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+
+	// the background sleep keeps the output pipe open unless it is killed too
+	start := time.Now()
+	err := sb.Run(ctx, "sleep 30 & sleep 30", io.Discard)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if took := time.Since(start); took > commandWaitDelay {
+		t.Errorf("run returned after %s", took)
+	}
+}
+
+func TestSandboxImpl_Network(t *testing.T) {
+	for mode, shared := range map[NetworkMode]bool{
+		"":               true,
+		NetworkFull:      true,
+		NetworkNone:      false,
+		NetworkAllowlist: false,
+	} {
+		sb := NewSandbox(WithNetwork(mode)).(*SandboxImpl)
+		if got := slices.Contains(sb.buildBwrapArgs("/bin/sh"), "--share-net"); got != shared {
+			t.Errorf("network %q: share net = %v", mode, got)
+		}
+	}
+}
+
+func TestSandboxLimits(t *testing.T) {
+	if _, err := exec.LookPath("prlimit"); err != nil {
+		t.Skip("prlimit not found")
+	}
+	limits, err := newSandboxLimits(option{limits: Limits{FileSize: 1024}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limits.close()
+
+	// run the wrapped command without bwrap
+	file := filepath.Join(t.TempDir(), "big")
+	_, wrapped, err := limits.wrap([]string{"sh", "-c", "head -c 4096 /dev/zero > " + file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exec.Command(wrapped[0], wrapped[1:]...).Run()
+	if err == nil {
+		t.Fatal("expected the command to fail")
+	}
+	verr := limits.violation(exitCode(err))
+	if !IsSandboxError(verr) || !strings.Contains(verr.Error(), "file size limit of 1KB exceeded") {
+		t.Errorf("violation = %v", verr)
+	}
+	if verr := limits.violation(1); verr != nil {
+		t.Errorf("exit code 1 reported as %v", verr)
+	}
+}
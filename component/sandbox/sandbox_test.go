@@ -0,0 +1,64 @@
+package sandbox
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPassthroughSandbox_Run(t *testing.T) {
+	sb := NewPassthroughSandbox(t.TempDir())
+
+	var out lockedBuffer
+	if err := sb.Run(t.Context(), "echo out; echo err >&2", &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "out\n") || !strings.Contains(got, "err\n") {
+		t.Errorf("output = %q", got)
+	}
+
+	output, err := sb.Execute(t.Context(), "echo failed; exit 3")
+	var ce *CommandError
+	if !errors.As(err, &ce) || ce.ExitCode != 3 || ce.Output != "failed\n" {
+		t.Fatalf("output = %q, err = %v", output, err)
+	}
+}
+
+func TestOutputLimiter(t *testing.T) {
+	var (
+		out    lockedBuffer
+		killed int
+	)
+	l := &outputLimiter{w: &out, max: 8, exceeded: func() { killed++ }}
+
+	l.Write([]byte("12345"))
+	l.Write([]byte("67890"))
+	l.Write([]byte("more"))
+	if got := out.String(); got != "12345678" {
+		t.Errorf("output = %q", got)
+	}
+	if !l.isExceeded() || killed != 1 {
+		t.Errorf("exceeded = %v, killed %d times", l.isExceeded(), killed)
+	}
+
+	l = &outputLimiter{w: &out, max: 8}
+	l.Write([]byte("123456"))
+	l.reset()
+	l.Write([]byte("123456"))
+	if l.isExceeded() {
+		t.Error("output limit exceeded after reset")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		512:           "512B",
+		10 << 20:      "10MB",
+		3 << 29:       "1.5GB",
+		1<<20 + 1<<10: "1MB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -14,19 +14,22 @@ const (
 
 // ConfirmRequest represents a confirmation request from a tool
 type ConfirmRequest struct {
-	Channel     string         `json:"channel"`
-	ChatId      string         `json:"chat_id"`
-	ToolName    string         `json:"tool_name"`
-	Level       ConfirmLevel   `json:"level"`
-	Title       string         `json:"title"`
-	Description string         `json:"description"`
-	Command     string         `json:"command"`
+	Channel     string       `json:"channel"`
+	ChatId      string       `json:"chat_id"`
+	ToolName    string       `json:"tool_name"`
+	Level       ConfirmLevel `json:"level"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Command     string       `json:"command"`
 }
 
 // ConfirmResponse represents the user's response to a confirmation request
 type ConfirmResponse struct {
 	Confirmed bool   `json:"confirmed"`
 	Reason    string `json:"reason,omitempty"`
+	Always    bool   `json:"always,omitempty"` // allow the same call for the rest of the session
+	// who answered, recorded in the audit log
+	ApprovedBy string `json:"approved_by,omitempty"`
 }
 
 // ToolConfirmer is the unified interface for requesting user confirmation
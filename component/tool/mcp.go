@@ -12,7 +12,9 @@ import (
 
 	"github.com/ryanreadbooks/tokkibot/config"
 	"github.com/ryanreadbooks/tokkibot/pkg/schema"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
 	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
+	"go.opentelemetry.io/otel/attribute"
 
 	mcpclient "github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
@@ -71,6 +73,10 @@ func (m *McpTool) Info() Info {
 }
 
 func (m *McpTool) Invoke(ctx context.Context, meta InvokeMeta, arguments string) (string, error) {
+	ctx, span := trace.StartSpan(ctx, "mcp.call_tool",
+		attribute.String("mcp.server", m.serverName),
+		attribute.String("mcp.tool", m.raw.Name),
+	)
 	// parse arguments
 	resp, err := m.client.CallTool(ctx, mcp.CallToolRequest{
 		Params: mcp.CallToolParams{
@@ -79,11 +85,13 @@ func (m *McpTool) Invoke(ctx context.Context, meta InvokeMeta, arguments string)
 		},
 	})
 	if err != nil {
-		return "", fmt.Errorf("fail to call mcp tool: %w", err)
+		err = fmt.Errorf("fail to call mcp tool: %w", err)
+	} else if resp.IsError {
+		err = fmt.Errorf("mcp tool call is error")
 	}
-
-	if resp.IsError {
-		return "", fmt.Errorf("mcp tool call is error")
+	trace.EndSpan(span, err)
+	if err != nil {
+		return "", err
 	}
 
 	var output []byte
@@ -146,6 +154,36 @@ func (m *McpToolManager) Init(ctx context.Context, c config.McpConfig) error {
 	return nil
 }
 
+// Reload connects to the servers in c and replaces the current tools and
+// servers. Clients of the previous servers are closed.
+func (m *McpToolManager) Reload(ctx context.Context, c config.McpConfig) error {
+	mcpTools, serverStatuses := m.initMcpTools(ctx, c)
+
+	tools := make(map[string]*McpTool)
+	for serverName, serverTools := range mcpTools {
+		for _, tool := range serverTools {
+			tools[formatMcpToolKey(serverName, tool.raw)] = tool
+		}
+	}
+
+	m.mu.Lock()
+	prevTools := m.tools
+	m.tools = tools
+	m.servers = serverStatuses
+	m.mu.Unlock()
+
+	closed := make(map[*mcpclient.Client]struct{})
+	for _, tool := range prevTools {
+		if _, ok := closed[tool.client]; ok {
+			continue
+		}
+		closed[tool.client] = struct{}{}
+		tool.client.Close()
+	}
+
+	return nil
+}
+
 func (m *McpToolManager) ListTools() []*McpTool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -389,6 +427,8 @@ func (m *McpToolManager) initMcpTools(ctx context.Context, mcpConfig config.McpC
 				mcpTools, err = m.listMcpHttpServerTools(ctx, serverName, server)
 			}
 
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
 				status.Error = err.Error()
 			} else {
@@ -396,10 +436,7 @@ func (m *McpToolManager) initMcpTools(ctx context.Context, mcpConfig config.McpC
 				status.ToolCount = len(mcpTools)
 				tools[serverName] = append(tools[serverName], mcpTools...)
 			}
-
-			mu.Lock()
 			statuses[serverName] = status
-			mu.Unlock()
 		})
 	}
 
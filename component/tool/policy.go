@@ -0,0 +1,21 @@
+package tool
+
+import "context"
+
+type toolFilterContextKey struct{}
+
+// WithToolFilter restricts the tools usable in ctx to those allowed by
+// allow. Filters of nested contexts all apply.
+func WithToolFilter(ctx context.Context, allow func(name string) bool) context.Context {
+	if parent, ok := ctx.Value(toolFilterContextKey{}).(func(string) bool); ok {
+		inner := allow
+		allow = func(name string) bool { return parent(name) && inner(name) }
+	}
+	return context.WithValue(ctx, toolFilterContextKey{}, allow)
+}
+
+// IsToolAllowed reports whether the tool may be used in ctx.
+func IsToolAllowed(ctx context.Context, name string) bool {
+	allow, ok := ctx.Value(toolFilterContextKey{}).(func(string) bool)
+	return !ok || allow(name)
+}
@@ -0,0 +1,35 @@
+package config
+
+import "os"
+
+const (
+	defaultAdminListen = "127.0.0.1:18791"
+
+	// AdminTokenEnv can be used instead of putting the admin token in config.json.
+	AdminTokenEnv = "TOKKIBOT_ADMIN_TOKEN"
+)
+
+// AdminConfig configures the local admin http server of the gateway.
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen,omitempty"` // e.g. 127.0.0.1:18791
+	Token   string `json:"token,omitempty"`  // bearer token or secret://name, falls back to $TOKKIBOT_ADMIN_TOKEN
+}
+
+func (c *AdminConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+func (c *AdminConfig) GetListen() string {
+	if c == nil || c.Listen == "" {
+		return defaultAdminListen
+	}
+	return c.Listen
+}
+
+func (c *AdminConfig) GetToken() string {
+	if c != nil && c.Token != "" {
+		return resolveValueOrEmpty(c.Token)
+	}
+	return os.Getenv(AdminTokenEnv)
+}
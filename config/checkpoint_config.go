@@ -0,0 +1,28 @@
+package config
+
+import "time"
+
+// CheckpointDirName is the directory in an agent workspace where the
+// originals of files changed by the agent are kept.
+const CheckpointDirName = "checkpoints"
+
+const defaultCheckpointTTL = 7 * 24 * time.Hour
+
+// CheckpointConfig controls the snapshots taken before the file tools of an
+// agent change a file.
+type CheckpointConfig struct {
+	Disabled bool   `json:"disabled,omitempty"`
+	TTL      string `json:"ttl,omitempty"` // how long checkpoints are kept, default 168h
+}
+
+func (c *CheckpointConfig) IsEnabled() bool {
+	return c == nil || !c.Disabled
+}
+
+// GetTTL returns how long checkpoints are kept.
+func (c *CheckpointConfig) GetTTL() time.Duration {
+	if c == nil {
+		return defaultCheckpointTTL
+	}
+	return parseDurationOr(c.TTL, defaultCheckpointTTL)
+}
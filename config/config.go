@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"runtime"
+	"sync"
+
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
 )
 
-var conf Config
+var (
+	conf   Config
+	confMu sync.RWMutex
+)
 
 // Default values for provider config
 const (
@@ -43,31 +48,9 @@ type AgentBindingMatch struct {
 }
 
 type AgentBinding struct {
-	Match AgentBindingMatch `json:"match"`
-}
-
-type SandboxConfig struct {
-	Enabled        bool     `json:"enabled"`
-	ReadOnlyPaths  []string `json:"readOnlyPaths,omitempty"`
-	ReadWritePaths []string `json:"readWritePaths,omitempty"`
-}
-
-func (c *SandboxConfig) IsEnabled() bool {
-	return c != nil && c.Enabled && runtime.GOOS == "linux"
-}
-
-func (c *SandboxConfig) GetReadOnlyPaths() []string {
-	if c == nil {
-		return nil
-	}
-	return c.ReadOnlyPaths
-}
-
-func (c *SandboxConfig) GetReadWritePaths() []string {
-	if c == nil {
-		return nil
-	}
-	return c.ReadWritePaths
+	Match     AgentBindingMatch `json:"match"`
+	QueueMode QueueMode         `json:"queueMode,omitempty"` // overrides agent queue mode
+	RateLimit *RateLimitConfig  `json:"rateLimit,omitempty"` // overrides top level rate limits
 }
 
 type AgentEntry struct {
@@ -78,6 +61,10 @@ type AgentEntry struct {
 	Binding      *AgentBinding         `json:"binding,omitempty"`
 	Sandbox      *SandboxConfig        `json:"sandbox,omitempty"`
 	Heartbeat    *AgentHeartbeatConfig `json:"heartbeat,omitempty"`
+	QueueMode    QueueMode             `json:"queueMode,omitempty"`
+	ToolPolicy   *ToolPolicyConfig     `json:"toolPolicy,omitempty"`
+	Checkpoint   *CheckpointConfig     `json:"checkpoint,omitempty"`
+	Shell        *ShellConfig          `json:"shell,omitempty"`
 }
 
 type ChannelEntry struct {
@@ -86,9 +73,21 @@ type ChannelEntry struct {
 }
 
 type Config struct {
-	Providers map[string]ProviderConfig `json:"providers"`
-	Agents    []AgentEntry              `json:"agents"`
-	Channels  []ChannelEntry            `json:"channels"`
+	Providers  map[string]ProviderConfig `json:"providers"`
+	Agents     []AgentEntry              `json:"agents"`
+	Channels   []ChannelEntry            `json:"channels"`
+	Webhook    *WebhookConfig            `json:"webhook,omitempty"`
+	Admin      *AdminConfig              `json:"admin,omitempty"`
+	Tracing    *TracingConfig            `json:"tracing,omitempty"`
+	Identity   *IdentityConfig           `json:"identity,omitempty"`
+	RateLimit  *RateLimitConfig          `json:"rateLimit,omitempty"`
+	ToolPolicy *ToolPolicyConfig         `json:"toolPolicy,omitempty"`
+	WebFetch   *WebFetchConfig           `json:"webFetch,omitempty"`
+	WebSearch  *WebSearchConfig          `json:"webSearch,omitempty"`
+
+	// secrets resolves secret references of a config being reloaded before
+	// its store replaces the shared one, nil for the shared store
+	secrets secretSource
 }
 
 func (c *Config) ToJson() ([]byte, error) {
@@ -146,6 +145,21 @@ func BootstrapConfig() Config {
 	}
 }
 
+// GetApiKey returns the api key with ${ENV} and secret:// references
+// resolved. The raw value is kept in the config so that secrets are not
+// written back on save.
+func (pc *ProviderConfig) GetApiKey() string {
+	apiKey := resolveValueOrEmpty(pc.ApiKey)
+	secret.Register(apiKey)
+	return apiKey
+}
+
+// GetBaseURL returns the base url with ${ENV} and secret:// references
+// resolved.
+func (pc *ProviderConfig) GetBaseURL() string {
+	return resolveValueOrEmpty(pc.BaseURL)
+}
+
 func (pc *ProviderConfig) applyDefaults() {
 	if pc.EnableThinking == nil {
 		enableThinking := defaultEnableThinking
@@ -183,13 +197,16 @@ func (ae *AgentEntry) applyDefaults(providers map[string]ProviderConfig) {
 }
 
 func LoadConfig() (c Config, err error) {
-	c = BootstrapConfig()
 	configPath, err := GetWorkspaceConfigPath()
 	if err != nil {
 		err = fmt.Errorf("failed to get config path: %w", err)
 		return
 	}
+	return loadConfigFrom(configPath)
+}
 
+func loadConfigFrom(configPath string) (c Config, err error) {
+	c = BootstrapConfig()
 	content, err := os.ReadFile(configPath)
 	if err != nil {
 		err = fmt.Errorf("failed to read config file: %w", err)
@@ -209,17 +226,57 @@ func LoadConfig() (c Config, err error) {
 
 	for i := range c.Agents {
 		c.Agents[i].applyDefaults(c.Providers)
+		c.Agents[i].ToolPolicy.compile()
 	}
+	c.ToolPolicy.compile()
 
 	return
 }
 
 func GetConfig() Config {
+	confMu.RLock()
+	defer confMu.RUnlock()
 	return conf
 }
 
+// ReloadConfig reads the config file from disk again and replaces the
+// current config. The previous config is returned for comparison. An invalid
+// config is rejected and the current config is kept.
+func ReloadConfig() (prev Config, err error) {
+	c, err := LoadConfig()
+	if err != nil {
+		return
+	}
+	return replaceConfig(c)
+}
+
+// replaceConfig validates c against the secret store read from disk again,
+// as secrets may have changed along with the config, and swaps in both.
+func replaceConfig(c Config) (prev Config, err error) {
+	store, storeErr := openSharedSecretStore()
+	c.secrets = func() (*secret.Store, error) { return store, storeErr }
+	if err = c.Validate(); err != nil {
+		return
+	}
+	registerSecrets(&c)
+	c.secrets = nil
+
+	confMu.Lock()
+	defer confMu.Unlock()
+	setSecretStore(store)
+	prev = conf
+	conf = c
+	return
+}
+
 // SaveConfig saves the current config to disk
 func SaveConfig() error {
+	confMu.RLock()
+	defer confMu.RUnlock()
+	return saveConfig()
+}
+
+func saveConfig() error {
 	configPath, err := GetWorkspaceConfigPath()
 	if err != nil {
 		return fmt.Errorf("failed to get config path: %w", err)
@@ -239,11 +296,13 @@ func SaveConfig() error {
 
 // UpdateAgentProviderAndModel updates the provider and model for an agent and saves to disk
 func UpdateAgentProviderAndModel(agentName, provider, model string) error {
+	confMu.Lock()
+	defer confMu.Unlock()
 	for i := range conf.Agents {
 		if conf.Agents[i].Name == agentName {
 			conf.Agents[i].Provider = provider
 			conf.Agents[i].Model = model
-			return SaveConfig()
+			return saveConfig()
 		}
 	}
 	return fmt.Errorf("agent not found: %s", agentName)
@@ -252,6 +311,8 @@ func UpdateAgentProviderAndModel(agentName, provider, model string) error {
 // GetAgentEntry returns the agent entry for the given agent id.
 // Returns nil if not found.
 func GetAgentEntry(name string) *AgentEntry {
+	confMu.RLock()
+	defer confMu.RUnlock()
 	for i := range conf.Agents {
 		if conf.Agents[i].Name == name {
 			return &conf.Agents[i]
@@ -263,6 +324,8 @@ func GetAgentEntry(name string) *AgentEntry {
 // GetChannelEntry returns the channel entry for the given channel name.
 // Returns nil if not found.
 func GetChannelEntry(channelName string) *ChannelEntry {
+	confMu.RLock()
+	defer confMu.RUnlock()
 	for i := range conf.Channels {
 		if conf.Channels[i].Name == channelName {
 			return &conf.Channels[i]
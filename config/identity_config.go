@@ -0,0 +1,158 @@
+package config
+
+import (
+	"slices"
+)
+
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleGuest  Role = "guest"
+)
+
+// Wildcard allows all commands or tools in a role policy.
+const Wildcard = "*"
+
+// Control command permissions. Most match the command name; switching the
+// model is separated from viewing it.
+const (
+	PermModelSet = "model.set"
+)
+
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleAdmin, RoleMember, RoleGuest:
+		return true
+	}
+	return false
+}
+
+// UserEntry maps channel sender ids to a user with a role.
+type UserEntry struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// sender ids of the user, either bare ("ou_xxx") or prefixed with the
+	// channel ("lark:ou_xxx")
+	Ids []string `json:"ids"`
+}
+
+// RolePolicy describes what a role is allowed to do. Unset fields fall back
+// to the builtin policy of the role.
+type RolePolicy struct {
+	Commands   []string `json:"commands,omitempty"`  // control commands without the slash, "*" for all
+	Tools      []string `json:"tools,omitempty"`     // allowed tools, "*" for all
+	DenyTools  []string `json:"denyTools,omitempty"` // denied tools, applied after tools
+	CanApprove *bool    `json:"canApprove,omitempty"`
+}
+
+// AllowsCommand reports whether the control command permission is granted.
+func (p RolePolicy) AllowsCommand(perm string) bool {
+	return slices.Contains(p.Commands, Wildcard) || slices.Contains(p.Commands, perm)
+}
+
+// AllowsTool reports whether the tool may be used.
+func (p RolePolicy) AllowsTool(name string) bool {
+	if slices.Contains(p.DenyTools, name) {
+		return false
+	}
+	return slices.Contains(p.Tools, Wildcard) || slices.Contains(p.Tools, name)
+}
+
+// ApproveAllowed reports whether the role can approve tool confirmations.
+func (p RolePolicy) ApproveAllowed() bool {
+	return p.CanApprove != nil && *p.CanApprove
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+var builtinRolePolicies = map[Role]RolePolicy{
+	RoleAdmin: {
+		Commands:   []string{Wildcard},
+		Tools:      []string{Wildcard},
+		CanApprove: boolPtr(true),
+	},
+	RoleMember: {
+		Commands:   []string{"stop", "new", "compact", "skill", "mcp", "model", "status", "checkpoints", "help"},
+		Tools:      []string{Wildcard},
+		CanApprove: boolPtr(false),
+	},
+	RoleGuest: {
+		Commands:   []string{"stop", "new", "status", "help"},
+		Tools:      []string{Wildcard},
+		DenyTools:  []string{"shell", "shell_output", "shell_kill", "write_file", "edit_file", "multi_edit", "apply_patch", "use_skill", "cron"},
+		CanApprove: boolPtr(false),
+	},
+}
+
+// IdentityConfig maps channel senders to users and roles. When it is not
+// configured every sender is treated as an admin.
+type IdentityConfig struct {
+	DefaultRole Role                `json:"defaultRole,omitempty"` // role of unknown senders, default guest
+	Users       []UserEntry         `json:"users,omitempty"`
+	Roles       map[Role]RolePolicy `json:"roles,omitempty"` // overrides of builtin role policies
+}
+
+// Identity is the resolved identity of a message sender.
+type Identity struct {
+	Id     string
+	Name   string
+	Role   Role
+	Policy RolePolicy
+}
+
+func (c *IdentityConfig) IsEnabled() bool {
+	return c != nil
+}
+
+func (c *IdentityConfig) GetDefaultRole() Role {
+	if c == nil || c.DefaultRole == "" {
+		return RoleGuest
+	}
+	return c.DefaultRole
+}
+
+// GetPolicy returns the policy of the role, with configured fields
+// overriding the builtin ones.
+func (c *IdentityConfig) GetPolicy(role Role) RolePolicy {
+	policy := builtinRolePolicies[role]
+	if c == nil {
+		return policy
+	}
+	override, ok := c.Roles[role]
+	if !ok {
+		return policy
+	}
+	if override.Commands != nil {
+		policy.Commands = override.Commands
+	}
+	if override.Tools != nil {
+		policy.Tools = override.Tools
+	}
+	if override.DenyTools != nil {
+		policy.DenyTools = override.DenyTools
+	}
+	if override.CanApprove != nil {
+		policy.CanApprove = override.CanApprove
+	}
+	return policy
+}
+
+// Resolve returns the identity of a sender of the channel. Without identity
+// config, every sender is an admin.
+func (c *IdentityConfig) Resolve(channel, senderId string) Identity {
+	if !c.IsEnabled() {
+		return Identity{Id: senderId, Role: RoleAdmin, Policy: c.GetPolicy(RoleAdmin)}
+	}
+
+	prefixed := channel + ":" + senderId
+	for _, user := range c.Users {
+		if senderId != "" && (slices.Contains(user.Ids, senderId) || slices.Contains(user.Ids, prefixed)) {
+			return Identity{Id: senderId, Name: user.Name, Role: user.Role, Policy: c.GetPolicy(user.Role)}
+		}
+	}
+
+	role := c.GetDefaultRole()
+	return Identity{Id: senderId, Role: role, Policy: c.GetPolicy(role)}
+}
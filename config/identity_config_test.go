@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestIdentityResolve(t *testing.T) {
+	var disabled *IdentityConfig
+	if id := disabled.Resolve("lark", "ou_any"); id.Role != RoleAdmin || !id.Policy.AllowsTool("shell") {
+		t.Fatalf("without identity config everyone is an admin, got %+v", id)
+	}
+
+	c := &IdentityConfig{
+		Users: []UserEntry{
+			{Name: "alice", Role: RoleAdmin, Ids: []string{"lark:ou_alice"}},
+			{Name: "bob", Role: RoleMember, Ids: []string{"ou_bob"}},
+		},
+		Roles: map[Role]RolePolicy{
+			RoleMember: {DenyTools: []string{"shell"}},
+		},
+	}
+
+	if id := c.Resolve("lark", "ou_alice"); id.Name != "alice" || !id.Policy.ApproveAllowed() {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+	bob := c.Resolve("lark", "ou_bob")
+	if bob.Role != RoleMember || bob.Policy.AllowsTool("shell") || !bob.Policy.AllowsTool("read_file") {
+		t.Fatalf("member policy override not applied: %+v", bob)
+	}
+	if bob.Policy.AllowsCommand(PermModelSet) || !bob.Policy.AllowsCommand("model") {
+		t.Fatalf("members may view but not switch the model: %+v", bob.Policy)
+	}
+	if guest := c.Resolve("lark", "ou_stranger"); guest.Role != RoleGuest || guest.Policy.AllowsTool("shell") {
+		t.Fatalf("unknown senders should be guests: %+v", guest)
+	}
+}
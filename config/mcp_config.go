@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"maps"
 	"os"
 	"path/filepath"
@@ -97,6 +98,33 @@ func getMcpConfigFromPath(path string) (c McpConfig, err error) {
 		return
 	}
 
+	for name, server := range c.McpServers {
+		resolved, resolveErr := resolveMcpServer(server)
+		if resolveErr != nil {
+			slog.Warn("[config] failed to resolve mcp server secrets",
+				slog.String("server", name), slog.Any("error", resolveErr))
+		}
+		c.McpServers[name] = resolved
+	}
+
+	return
+}
+
+// readMcpConfigFile reads the mcp config file as is, without expanding env
+// or secret references, so that it can be edited and saved back.
+func readMcpConfigFile(path string) (c McpConfig, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read config file: %w", err)
+		return
+	}
+
+	err = json.Unmarshal(content, &c)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal config: %w", err)
+		return
+	}
+
 	return
 }
 
@@ -119,7 +147,7 @@ func LoadMcpConfigFromScope(scope McpConfigScope) (McpConfig, error) {
 	if err != nil {
 		return McpConfig{}, err
 	}
-	return getMcpConfigFromPath(path)
+	return readMcpConfigFile(path)
 }
 
 func SaveMcpConfig(scope McpConfigScope, c McpConfig) error {
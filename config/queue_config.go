@@ -0,0 +1,35 @@
+package config
+
+// QueueMode decides how messages of a chat are handled when they arrive
+// while the agent is still working on an earlier one.
+type QueueMode string
+
+const (
+	QueueModeQueue     QueueMode = "queue"     // run messages one after another
+	QueueModeCoalesce  QueueMode = "coalesce"  // merge pending messages into one turn
+	QueueModeInterrupt QueueMode = "interrupt" // cancel the running task and restart with new messages
+	QueueModeInject    QueueMode = "inject"    // add new messages to the running loop between iterations
+)
+
+func (m QueueMode) IsValid() bool {
+	switch m {
+	case QueueModeQueue, QueueModeCoalesce, QueueModeInterrupt, QueueModeInject:
+		return true
+	}
+	return false
+}
+
+// GetQueueMode returns the queue mode of the agent. The binding mode takes
+// precedence over the agent mode. Defaults to queue.
+func (ae *AgentEntry) GetQueueMode() QueueMode {
+	if ae == nil {
+		return QueueModeQueue
+	}
+	if ae.Binding != nil && ae.Binding.QueueMode.IsValid() {
+		return ae.Binding.QueueMode
+	}
+	if ae.QueueMode.IsValid() {
+		return ae.QueueMode
+	}
+	return QueueModeQueue
+}
@@ -0,0 +1,108 @@
+package config
+
+const (
+	defaultSenderPerMinute   = 20
+	defaultChatMaxInFlight   = 10
+	defaultMaxConcurrentRuns = 16
+	defaultBlockDuration     = "1h"
+)
+
+// RateLimitConfig protects the gateway from being flooded with messages.
+// Zero values fall back to defaults, negative values disable a limit.
+//
+// The top level config sets the defaults of all bindings and the gateway wide
+// maxConcurrentRuns; a binding overrides the per sender and per chat limits.
+type RateLimitConfig struct {
+	SenderPerMinute   int    `json:"senderPerMinute,omitempty"`   // messages per minute of a sender, default 20
+	SenderBurst       int    `json:"senderBurst,omitempty"`       // messages a sender can send at once
+	ChatMaxInFlight   int    `json:"chatMaxInFlight,omitempty"`   // messages of a chat running or waiting, default 10
+	MaxConcurrentRuns int    `json:"maxConcurrentRuns,omitempty"` // agent runs of the gateway, default 16
+	BlockDuration     string `json:"blockDuration,omitempty"`     // default duration of /block, default 1h
+}
+
+func limitOrDefault(v, def int) int {
+	switch {
+	case v < 0:
+		return 0
+	case v == 0:
+		return def
+	}
+	return v
+}
+
+// GetSenderPerMinute returns the messages per minute of a sender, 0 means
+// unlimited.
+func (c *RateLimitConfig) GetSenderPerMinute() int {
+	if c == nil {
+		return defaultSenderPerMinute
+	}
+	return limitOrDefault(c.SenderPerMinute, defaultSenderPerMinute)
+}
+
+func (c *RateLimitConfig) GetSenderBurst() int {
+	if c == nil || c.SenderBurst <= 0 {
+		return max(1, c.GetSenderPerMinute()/4)
+	}
+	return c.SenderBurst
+}
+
+// GetChatMaxInFlight returns how many messages of a chat may be running or
+// waiting at once, 0 means unlimited.
+func (c *RateLimitConfig) GetChatMaxInFlight() int {
+	if c == nil {
+		return defaultChatMaxInFlight
+	}
+	return limitOrDefault(c.ChatMaxInFlight, defaultChatMaxInFlight)
+}
+
+// GetMaxConcurrentRuns returns how many agent runs the gateway runs at once,
+// 0 means unlimited.
+func (c *RateLimitConfig) GetMaxConcurrentRuns() int {
+	if c == nil {
+		return defaultMaxConcurrentRuns
+	}
+	return limitOrDefault(c.MaxConcurrentRuns, defaultMaxConcurrentRuns)
+}
+
+func (c *RateLimitConfig) GetBlockDuration() string {
+	if c == nil || c.BlockDuration == "" {
+		return defaultBlockDuration
+	}
+	return c.BlockDuration
+}
+
+// merge returns c with the set fields of override applied.
+// maxConcurrentRuns is gateway wide and is not overridden.
+func (c *RateLimitConfig) merge(override *RateLimitConfig) *RateLimitConfig {
+	var merged RateLimitConfig
+	if c != nil {
+		merged = *c
+	}
+	if override == nil {
+		return &merged
+	}
+	if override.SenderPerMinute != 0 {
+		merged.SenderPerMinute = override.SenderPerMinute
+	}
+	if override.SenderBurst != 0 {
+		merged.SenderBurst = override.SenderBurst
+	}
+	if override.ChatMaxInFlight != 0 {
+		merged.ChatMaxInFlight = override.ChatMaxInFlight
+	}
+	if override.BlockDuration != "" {
+		merged.BlockDuration = override.BlockDuration
+	}
+	return &merged
+}
+
+// GetRateLimit returns the rate limits of the agent, with its binding limits
+// applied over the top level ones.
+func GetRateLimit(agentName string) *RateLimitConfig {
+	global := GetConfig().RateLimit
+	var override *RateLimitConfig
+	if entry := GetAgentEntry(agentName); entry != nil && entry.Binding != nil {
+		override = entry.Binding.RateLimit
+	}
+	return global.merge(override)
+}
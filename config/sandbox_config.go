@@ -0,0 +1,232 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backends of the sandbox
+const (
+	SandboxBackendBwrap  = "bwrap"  // bubblewrap on the host, linux only
+	SandboxBackendDocker = "docker" // a container through the Docker Engine API
+)
+
+const defaultSandboxDockerIdleTimeout = 30 * time.Minute
+
+// Network modes of the sandbox
+const (
+	SandboxNetworkFull      = "full"      // the host network
+	SandboxNetworkNone      = "none"      // no network at all
+	SandboxNetworkAllowlist = "allowlist" // only the allowed hosts, through a filtering proxy
+)
+
+type SandboxConfig struct {
+	Enabled        bool                  `json:"enabled"`
+	Backend        string                `json:"backend,omitempty"` // bwrap or docker, default bwrap
+	Docker         *SandboxDockerConfig  `json:"docker,omitempty"`
+	ReadOnlyPaths  []string              `json:"readOnlyPaths,omitempty"`
+	ReadWritePaths []string              `json:"readWritePaths,omitempty"`
+	Network        *SandboxNetworkConfig `json:"network,omitempty"`
+	Limits         *SandboxLimitsConfig  `json:"limits,omitempty"`
+}
+
+// IsEnabled reports whether commands run in a sandbox, bwrap is only
+// supported on linux.
+func (c *SandboxConfig) IsEnabled() bool {
+	return c != nil && c.Enabled && (runtime.GOOS == "linux" || c.GetBackend() == SandboxBackendDocker)
+}
+
+func (c *SandboxConfig) GetBackend() string {
+	if c == nil || c.Backend == "" {
+		return SandboxBackendBwrap
+	}
+	return c.Backend
+}
+
+func (c *SandboxConfig) GetDocker() *SandboxDockerConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Docker
+}
+
+func (c *SandboxConfig) GetReadOnlyPaths() []string {
+	if c == nil {
+		return nil
+	}
+	return c.ReadOnlyPaths
+}
+
+func (c *SandboxConfig) GetReadWritePaths() []string {
+	if c == nil {
+		return nil
+	}
+	return c.ReadWritePaths
+}
+
+func (c *SandboxConfig) GetNetwork() *SandboxNetworkConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Network
+}
+
+func (c *SandboxConfig) GetLimits() *SandboxLimitsConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Limits
+}
+
+// SandboxDockerConfig is the container of the docker backend, podman works
+// through its docker compatible socket as well.
+type SandboxDockerConfig struct {
+	Host        string `json:"host,omitempty"`        // unix:///path or tcp://host:port, DOCKER_HOST or /var/run/docker.sock by default
+	Image       string `json:"image"`                 // e.g. python:3.12
+	Scope       string `json:"scope,omitempty"`       // agent or chat, one container per agent by default
+	IdleTimeout string `json:"idleTimeout,omitempty"` // containers are removed after being idle so long, default 30m
+}
+
+func (c *SandboxDockerConfig) GetHost() string {
+	if c == nil {
+		return ""
+	}
+	return c.Host
+}
+
+func (c *SandboxDockerConfig) GetImage() string {
+	if c == nil {
+		return ""
+	}
+	return c.Image
+}
+
+// IsPerChat reports whether each chat gets a container of its own.
+func (c *SandboxDockerConfig) IsPerChat() bool {
+	return c != nil && c.Scope == "chat"
+}
+
+func (c *SandboxDockerConfig) GetIdleTimeout() time.Duration {
+	if c == nil {
+		return defaultSandboxDockerIdleTimeout
+	}
+	return parseDurationOr(c.IdleTimeout, defaultSandboxDockerIdleTimeout)
+}
+
+// SandboxNetworkConfig controls which hosts commands in the sandbox can reach.
+type SandboxNetworkConfig struct {
+	Mode  string   `json:"mode,omitempty"`  // full, none or allowlist, default full
+	Allow []string `json:"allow,omitempty"` // hosts of allowlist mode, *.example.com matches subdomains
+}
+
+func (c *SandboxNetworkConfig) GetMode() string {
+	if c == nil || c.Mode == "" {
+		return SandboxNetworkFull
+	}
+	return c.Mode
+}
+
+func (c *SandboxNetworkConfig) GetAllow() []string {
+	if c == nil {
+		return nil
+	}
+	return c.Allow
+}
+
+// SandboxLimitsConfig limits the resources a command in the sandbox may use.
+// Limits not set are unlimited.
+type SandboxLimitsConfig struct {
+	CPUTime  string `json:"cpuTime,omitempty"`  // cpu time of each process, e.g. 10m
+	Memory   string `json:"memory,omitempty"`   // e.g. 2GB
+	Pids     int    `json:"pids,omitempty"`     // processes and threads at once
+	FileSize string `json:"fileSize,omitempty"` // largest file a command may write
+	Output   string `json:"output,omitempty"`   // output of a command, it is killed beyond
+	// delegated cgroup v2 directory to create a cgroup per command in, for
+	// memory and pids limits. Resource limits of the processes are used
+	// without it.
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+func (c *SandboxLimitsConfig) GetCPUTime() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return parseDurationOr(c.CPUTime, 0)
+}
+
+func (c *SandboxLimitsConfig) GetMemory() int64 {
+	if c == nil {
+		return 0
+	}
+	return parseBytesOr(c.Memory, 0)
+}
+
+func (c *SandboxLimitsConfig) GetPids() int {
+	if c == nil || c.Pids < 0 {
+		return 0
+	}
+	return c.Pids
+}
+
+func (c *SandboxLimitsConfig) GetFileSize() int64 {
+	if c == nil {
+		return 0
+	}
+	return parseBytesOr(c.FileSize, 0)
+}
+
+func (c *SandboxLimitsConfig) GetOutput() int64 {
+	if c == nil {
+		return 0
+	}
+	return parseBytesOr(c.Output, 0)
+}
+
+func (c *SandboxLimitsConfig) GetCgroup() string {
+	if c == nil {
+		return ""
+	}
+	return c.Cgroup
+}
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// parseBytes parses sizes such as 512, 64KB or 2GB, units are powers of 1024.
+func parseBytes(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	size := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			size = u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(size)), nil
+}
+
+func parseBytesOr(s string, def int64) int64 {
+	if s == "" {
+		return def
+	}
+	n, err := parseBytes(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+package config
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	for in, want := range map[string]int64{
+		"512":    512,
+		"64KB":   64 << 10,
+		"1.5 MB": 3 << 19,
+		"2g":     2 << 30,
+		"1GiB":   1 << 30,
+		"10B":    10,
+	} {
+		got, err := parseBytes(in)
+		if err != nil || got != want {
+			t.Errorf("parseBytes(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1GB", "ten"} {
+		if _, err := parseBytes(in); err == nil {
+			t.Errorf("parseBytes(%q) should fail", in)
+		}
+	}
+}
+
+func TestValidateSandbox(t *testing.T) {
+	verr := &ValidationError{}
+	validateSandbox(verr, "main", &SandboxConfig{
+		Network: &SandboxNetworkConfig{Mode: SandboxNetworkAllowlist, Allow: []string{"*.npmjs.org"}},
+		Limits:  &SandboxLimitsConfig{CPUTime: "10m", Memory: "2GB", Pids: 256, Output: "10MB"},
+	})
+	validateSandbox(verr, "main", nil)
+	validateSandbox(verr, "main", &SandboxConfig{
+		Backend: SandboxBackendDocker,
+		Docker:  &SandboxDockerConfig{Image: "python:3.12", Scope: "chat", IdleTimeout: "1h"},
+	})
+	if len(verr.Problems) != 0 {
+		t.Fatalf("valid sandbox rejected: %v", verr.Error())
+	}
+
+	validateSandbox(verr, "main", &SandboxConfig{
+		Network: &SandboxNetworkConfig{Mode: SandboxNetworkAllowlist},
+		Limits:  &SandboxLimitsConfig{CPUTime: "soon", FileSize: "big", Pids: -1},
+	})
+	validateSandbox(verr, "main", &SandboxConfig{Network: &SandboxNetworkConfig{Mode: "lan"}})
+	validateSandbox(verr, "main", &SandboxConfig{
+		Backend: SandboxBackendDocker,
+		Docker:  &SandboxDockerConfig{Host: "/var/run/docker.sock", Scope: "team"},
+		Network: &SandboxNetworkConfig{Mode: SandboxNetworkAllowlist, Allow: []string{"pypi.org"}},
+	})
+	validateSandbox(verr, "main", &SandboxConfig{Backend: "firecracker"})
+	// empty allowlist, cpu time, file size, pids, unknown mode, then empty
+	// image, host, scope and allowlist of docker and unknown backend
+	if len(verr.Problems) != 10 {
+		t.Fatalf("expected 10 problems, got %d:\n%s", len(verr.Problems), verr.Error())
+	}
+}
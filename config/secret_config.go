@@ -0,0 +1,351 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
+)
+
+const (
+	SecretsPassphraseEnv = "TOKKIBOT_SECRETS_PASSPHRASE"
+	SecretsKeyFileEnv    = "TOKKIBOT_SECRETS_KEYFILE"
+
+	secretsFileName    = "secrets.enc"
+	secretsKeyFileName = "secrets.key"
+)
+
+var (
+	secretStoreMu sync.Mutex
+	secretStore   *secret.Store
+)
+
+// secretSource returns the store secret references are resolved from.
+type secretSource func() (*secret.Store, error)
+
+// GetSecretsPath returns the path of the encrypted secret store:
+// ~/.tokkibot/secrets.enc
+func GetSecretsPath() string {
+	return filepath.Join(GetHomeDir(), secretsFileName)
+}
+
+// GetSecretsKeyFilePath returns the key file of the secret store. It can be
+// overridden with TOKKIBOT_SECRETS_KEYFILE.
+func GetSecretsKeyFilePath() string {
+	if path := os.Getenv(SecretsKeyFileEnv); path != "" {
+		return path
+	}
+	return filepath.Join(GetHomeDir(), secretsKeyFileName)
+}
+
+// secretsKey returns the passphrase of the secret store. The passphrase in
+// TOKKIBOT_SECRETS_PASSPHRASE takes precedence over the key file. If neither
+// exists and create is set, a random key file is generated.
+func secretsKey(create bool) ([]byte, error) {
+	if passphrase := os.Getenv(SecretsPassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	path := GetSecretsKeyFilePath()
+	content, err := os.ReadFile(path)
+	if err == nil {
+		return []byte(strings.TrimSpace(string(content))), nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("failed to read secrets key file, set %s or create %s: %w", SecretsPassphraseEnv, path, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secrets key: %w", err)
+	}
+	encoded := hex.EncodeToString(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create secrets key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secrets key file: %w", err)
+	}
+	slog.Info("[config] generated secrets key file", slog.String("path", path))
+	return []byte(encoded), nil
+}
+
+// OpenSecretStore opens the secret store for editing. With create set, a key
+// file is generated when no passphrase or key file is configured.
+func OpenSecretStore(create bool) (*secret.Store, error) {
+	key, err := secretsKey(create)
+	if err != nil {
+		return nil, err
+	}
+	store, err := secret.Open(GetSecretsPath(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secret store: %w", err)
+	}
+	return store, nil
+}
+
+// getSecretStore returns the shared store used to resolve references. All
+// of its values are registered for redaction once it is opened.
+func getSecretStore() (*secret.Store, error) {
+	secretStoreMu.Lock()
+	defer secretStoreMu.Unlock()
+	if secretStore != nil {
+		return secretStore, nil
+	}
+
+	store, err := openSharedSecretStore()
+	if err != nil {
+		return nil, err
+	}
+	secretStore = store
+	return store, nil
+}
+
+// openSharedSecretStore reads the secret store from disk and registers its
+// values for redaction.
+func openSharedSecretStore() (*secret.Store, error) {
+	if _, err := os.Stat(GetSecretsPath()); err != nil {
+		return nil, fmt.Errorf("secret store %s not found, add secrets with `tokkibot secrets set`", GetSecretsPath())
+	}
+	store, err := OpenSecretStore(false)
+	if err != nil {
+		return nil, err
+	}
+	secret.Register(store.Values()...)
+	return store, nil
+}
+
+// setSecretStore replaces the shared store, nil drops it so that it is
+// reopened on the next resolution.
+func setSecretStore(store *secret.Store) {
+	secretStoreMu.Lock()
+	defer secretStoreMu.Unlock()
+	secretStore = store
+}
+
+// resetSecretStore drops the shared store so that it is reopened on the next
+// resolution, picking up secrets changed since.
+func resetSecretStore() {
+	setSecretStore(nil)
+}
+
+// secretSource returns where secret references of the config are resolved
+// from: the store of a config being reloaded, otherwise the shared one.
+func (c *Config) secretSource() secretSource {
+	if c.secrets != nil {
+		return c.secrets
+	}
+	return getSecretStore
+}
+
+// resolveValue is ResolveValue with the secret source of the config.
+func (c *Config) resolveValue(value string) (string, error) {
+	return resolveValueFrom(c.secretSource(), value)
+}
+
+// expandEnvRefs expands ${NAME} references. Unlike os.ExpandEnv, a bare $ is
+// kept, which may well be part of a key.
+func expandEnvRefs(s string) string {
+	return envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// ResolveValue expands ${ENV} references of a config value, and resolves it
+// from the secret store if it is a secret://name reference.
+func ResolveValue(value string) (string, error) {
+	return resolveValueFrom(getSecretStore, value)
+}
+
+func resolveValueFrom(source secretSource, value string) (string, error) {
+	value = expandEnvRefs(value)
+	name, ok := secret.ParseRef(value)
+	if !ok {
+		return value, nil
+	}
+
+	store, err := source()
+	if err != nil {
+		return "", err
+	}
+	resolved, err := store.Get(name)
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// resolveValueOrEmpty is ResolveValue for getters, failures are logged and
+// reported by Validate.
+func resolveValueOrEmpty(value string) string {
+	resolved, err := ResolveValue(value)
+	if err != nil {
+		slog.Warn("[config] failed to resolve config value", slog.Any("error", err))
+		return ""
+	}
+	return resolved
+}
+
+// ResolveJSONValues resolves every string of raw json with ResolveValue.
+func ResolveJSONValues(raw json.RawMessage) (json.RawMessage, error) {
+	return resolveJSONValuesFrom(getSecretStore, raw)
+}
+
+func resolveJSONValuesFrom(source secretSource, raw json.RawMessage) (json.RawMessage, error) {
+	if !strings.Contains(string(raw), secret.RefPrefix) && !strings.Contains(string(raw), "${") {
+		return raw, nil
+	}
+
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config value: %w", err)
+	}
+	var errs []error
+	v = walkStrings(v, func(s string) string {
+		resolved, err := resolveValueFrom(source, s)
+		if err != nil {
+			errs = append(errs, err)
+			return ""
+		}
+		return resolved
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return json.Marshal(v)
+}
+
+func walkStrings(v any, fn func(string) string) any {
+	switch x := v.(type) {
+	case string:
+		return fn(x)
+	case map[string]any:
+		for k, item := range x {
+			x[k] = walkStrings(item, fn)
+		}
+	case []any:
+		for i, item := range x {
+			x[i] = walkStrings(item, fn)
+		}
+	}
+	return v
+}
+
+// resolveMcpServer resolves secret references in args, env and headers.
+func resolveMcpServer(server McpServer) (McpServer, error) {
+	var errs []error
+	resolve := func(s string) string {
+		if _, ok := secret.ParseRef(s); !ok {
+			return s
+		}
+		resolved, err := ResolveValue(s)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return resolved
+	}
+
+	server.Args = append([]string(nil), server.Args...)
+	for i, arg := range server.Args {
+		server.Args[i] = resolve(arg)
+	}
+	server.Env = resolveStringMap(server.Env, resolve)
+	server.Headers = resolveStringMap(server.Headers, resolve)
+	return server, errors.Join(errs...)
+}
+
+func resolveStringMap(m map[string]string, resolve func(string) string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		// allow references after a scheme, e.g. "Bearer secret://token"
+		if prefix, ref, ok := strings.Cut(v, " "+secret.RefPrefix); ok {
+			out[k] = prefix + " " + resolve(secret.RefPrefix+ref)
+			continue
+		}
+		out[k] = resolve(v)
+	}
+	return out
+}
+
+// registerSecrets resolves credentials of the config up front, so that they
+// are redacted from logs before anything uses them. Failures are left to
+// Validate.
+func registerSecrets(c *Config) {
+	register := func(value string) {
+		if resolved, err := c.resolveValue(value); err == nil {
+			secret.Register(resolved)
+		}
+	}
+	for _, provider := range c.Providers {
+		register(provider.ApiKey)
+	}
+	for _, ch := range c.Channels {
+		for _, raw := range ch.Account {
+			resolved, err := resolveJSONValuesFrom(c.secretSource(), raw)
+			if err != nil {
+				continue
+			}
+			var account map[string]any
+			if json.Unmarshal(resolved, &account) != nil {
+				continue
+			}
+			for key, v := range account {
+				if value, ok := v.(string); ok && isSecretKey(key) {
+					secret.Register(value)
+				}
+			}
+		}
+	}
+	if c.Webhook != nil {
+		for _, hook := range c.Webhook.Hooks {
+			register(hook.Secret)
+		}
+	}
+	if c.Admin != nil {
+		register(c.Admin.Token)
+	}
+	if ws := c.WebSearch; ws != nil {
+		if ep := ws.GetEndpoint(); ep != nil {
+			register(ep.ApiKey)
+		}
+		if ws.JSON != nil {
+			headers := resolveStringMap(ws.JSON.Headers, func(value string) string {
+				resolved, _ := c.resolveValue(value)
+				return resolved
+			})
+			for key, value := range headers {
+				if !isSecretHeader(key) {
+					continue
+				}
+				secret.Register(value)
+				// only the token of "Bearer <token>"
+				if _, token, ok := strings.Cut(value, " "); ok {
+					secret.Register(token)
+				}
+			}
+		}
+	}
+}
+
+// isSecretKey reports whether a config key names a credential, such as
+// appSecret or accessToken.
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"secret", "token", "password", "apikey"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
+)
+
+func TestResolveValue(t *testing.T) {
+	store, err := secret.Open(filepath.Join(t.TempDir(), "secrets.enc"), []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("lark_secret", "lark-resolved")
+	store.Set("mcp_token", "mcp-resolved")
+	secretStoreMu.Lock()
+	secretStore = store
+	secretStoreMu.Unlock()
+	t.Cleanup(resetSecretStore)
+
+	t.Setenv("TOKKIBOT_TEST_KEY", "sk-env")
+	if got, _ := ResolveValue("${TOKKIBOT_TEST_KEY}"); got != "sk-env" {
+		t.Fatalf("expected env expansion, got %q", got)
+	}
+	if got, _ := ResolveValue("sk-$plain"); got != "sk-$plain" {
+		t.Fatalf("bare $ should be kept, got %q", got)
+	}
+	if _, err := ResolveValue("secret://missing"); err == nil {
+		t.Fatal("expected error for missing secret")
+	}
+
+	raw, err := ResolveJSONValues(json.RawMessage(`{"appId":"cli_x","appSecret":"secret://lark_secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account map[string]string
+	if err := json.Unmarshal(raw, &account); err != nil || account["appSecret"] != "lark-resolved" {
+		t.Fatalf("unexpected account %s, %v", raw, err)
+	}
+
+	server, err := resolveMcpServer(McpServer{Url: "https://mcp.example.com", Headers: map[string]string{
+		"Authorization": "Bearer secret://mcp_token",
+	}})
+	if err != nil || server.Headers["Authorization"] != "Bearer mcp-resolved" {
+		t.Fatalf("unexpected headers %v, %v", server.Headers, err)
+	}
+}
+
+func TestWebhookAndAdminSecretRefs(t *testing.T) {
+	store, err := secret.Open(filepath.Join(t.TempDir(), "secrets.enc"), []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("hook_secret", "hook-resolved-value")
+	store.Set("admin_token", "admin-resolved-value")
+	setSecretStore(store)
+	t.Cleanup(resetSecretStore)
+
+	c := Config{
+		Webhook: &WebhookConfig{Hooks: []WebhookEntry{{Name: "ci", Secret: "secret://hook_secret"}}},
+		Admin:   &AdminConfig{Enabled: true, Token: "secret://admin_token"},
+	}
+	if got := c.Webhook.Hooks[0].GetSecret(); got != "hook-resolved-value" {
+		t.Errorf("webhook secret = %q", got)
+	}
+	if got := c.Admin.GetToken(); got != "admin-resolved-value" {
+		t.Errorf("admin token = %q", got)
+	}
+
+	registerSecrets(&c)
+	if got := secret.Redact("hook-resolved-value admin-resolved-value"); strings.Contains(got, "resolved") {
+		t.Errorf("secrets not redacted: %q", got)
+	}
+
+	c.Webhook.Hooks[0].Secret = "secret://missing"
+	var verr *ValidationError
+	if err := c.Validate(); !errors.As(err, &verr) || len(verr.Problems) != 1 {
+		t.Fatalf("expected the missing webhook secret, got %v", err)
+	}
+}
+
+func TestReplaceConfigKeepsSecretStore(t *testing.T) {
+	store, err := secret.Open(filepath.Join(t.TempDir(), "secrets.enc"), []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setSecretStore(store)
+	t.Cleanup(resetSecretStore)
+
+	// a hook without secret fails validation
+	invalid := Config{Webhook: &WebhookConfig{Hooks: []WebhookEntry{{Name: "ci"}}}}
+	if _, err := replaceConfig(invalid); err == nil {
+		t.Fatal("expected the invalid config to be rejected")
+	}
+	secretStoreMu.Lock()
+	kept := secretStore == store
+	secretStoreMu.Unlock()
+	if !kept {
+		t.Error("a rejected reload dropped the secret store")
+	}
+}
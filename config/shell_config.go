@@ -0,0 +1,51 @@
+package config
+
+import "time"
+
+const (
+	defaultShellTimeout    = 60 * time.Second
+	defaultShellMaxTimeout = 30 * time.Minute
+	defaultShellMaxJobs    = 4
+)
+
+// ShellConfig controls how long commands of the shell tool may run.
+type ShellConfig struct {
+	Timeout    string `json:"timeout,omitempty"`    // timeout of a command without one, default 60s
+	MaxTimeout string `json:"maxTimeout,omitempty"` // upper bound of timeouts set per call, default 30m
+	MaxJobs    int    `json:"maxJobs,omitempty"`    // background commands running at once, default 4
+}
+
+// GetTimeout returns the timeout of commands which do not set one.
+func (c *ShellConfig) GetTimeout() time.Duration {
+	if c == nil {
+		return defaultShellTimeout
+	}
+	return min(parseDurationOr(c.Timeout, defaultShellTimeout), c.GetMaxTimeout())
+}
+
+// GetMaxTimeout returns the longest timeout a command may set, background
+// commands included.
+func (c *ShellConfig) GetMaxTimeout() time.Duration {
+	if c == nil {
+		return defaultShellMaxTimeout
+	}
+	return parseDurationOr(c.MaxTimeout, defaultShellMaxTimeout)
+}
+
+func (c *ShellConfig) GetMaxJobs() int {
+	if c == nil || c.MaxJobs <= 0 {
+		return defaultShellMaxJobs
+	}
+	return c.MaxJobs
+}
+
+func parseDurationOr(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
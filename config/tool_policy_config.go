@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ToolAction decides what happens when a tool is called.
+type ToolAction string
+
+const (
+	ToolActionAllow ToolAction = "allow" // run without asking
+	ToolActionAsk   ToolAction = "ask"   // ask the user to confirm first
+	ToolActionDeny  ToolAction = "deny"  // reject the call
+)
+
+func (a ToolAction) IsValid() bool {
+	switch a {
+	case ToolActionAllow, ToolActionAsk, ToolActionDeny:
+		return true
+	}
+	return false
+}
+
+// ToolRule matches tool calls. Empty matchers match everything; a rule
+// matches when all of its matchers do.
+type ToolRule struct {
+	Tool    string     `json:"tool,omitempty"`    // glob of the tool name, e.g. "shell", "github_*"
+	Server  string     `json:"server,omitempty"`  // glob of the mcp server name, only matches mcp tools
+	Command string     `json:"command,omitempty"` // regexp of the shell command
+	Path    string     `json:"path,omitempty"`    // glob of the file path argument, "dir/**" matches everything under dir
+	Action  ToolAction `json:"action"`
+
+	commandRe *regexp.Regexp // compiled Command, set when the config is loaded
+}
+
+// ToolPolicyConfig decides which tool calls are allowed, need confirmation or
+// are denied. Rules are checked in order and the first match wins.
+type ToolPolicyConfig struct {
+	Rules []ToolRule `json:"rules,omitempty"`
+	// action of calls matched by no rule, default allow
+	Default ToolAction `json:"default,omitempty"`
+	// action of calls which ask when nobody can answer, such as cron,
+	// heartbeat and webhook runs, default deny
+	NonInteractive ToolAction `json:"nonInteractive,omitempty"`
+}
+
+// compile compiles the command regexps of the rules, so that they are not
+// compiled on every tool call. Invalid ones are reported by Validate.
+func (c *ToolPolicyConfig) compile() {
+	if c == nil {
+		return
+	}
+	for i := range c.Rules {
+		if c.Rules[i].Command != "" {
+			c.Rules[i].commandRe, _ = regexp.Compile(c.Rules[i].Command)
+		}
+	}
+}
+
+func (c *ToolPolicyConfig) GetDefault() ToolAction {
+	if c == nil || !c.Default.IsValid() {
+		return ToolActionAllow
+	}
+	return c.Default
+}
+
+func (c *ToolPolicyConfig) GetNonInteractive() ToolAction {
+	if c == nil || !c.NonInteractive.IsValid() || c.NonInteractive == ToolActionAsk {
+		return ToolActionDeny
+	}
+	return c.NonInteractive
+}
+
+// GetToolPolicy returns the tool policy of the agent. Rules of the agent are
+// checked before the top level ones, and its defaults take precedence.
+func GetToolPolicy(agentName string) *ToolPolicyConfig {
+	global := GetConfig().ToolPolicy
+	var own *ToolPolicyConfig
+	if entry := GetAgentEntry(agentName); entry != nil {
+		own = entry.ToolPolicy
+	}
+
+	merged := &ToolPolicyConfig{}
+	for _, c := range []*ToolPolicyConfig{own, global} {
+		if c == nil {
+			continue
+		}
+		merged.Rules = append(merged.Rules, c.Rules...)
+		if merged.Default == "" {
+			merged.Default = c.Default
+		}
+		if merged.NonInteractive == "" {
+			merged.NonInteractive = c.NonInteractive
+		}
+	}
+	return merged
+}
+
+// ToolCall describes a tool call for matching rules.
+type ToolCall struct {
+	Name      string
+	McpServer string // set for mcp tools
+	McpTool   string // name of the tool on the mcp server
+	Command   string // command argument of shell tools
+	Paths     []string
+}
+
+// Match reports whether the rule matches the call.
+func (r *ToolRule) Match(call *ToolCall) bool {
+	if r.Tool != "" && !globMatch(r.Tool, call.Name) && (call.McpTool == "" || !globMatch(r.Tool, call.McpTool)) {
+		return false
+	}
+	if r.Server != "" && (call.McpServer == "" || !globMatch(r.Server, call.McpServer)) {
+		return false
+	}
+	if r.Command != "" {
+		re := r.commandRe
+		if re == nil {
+			// rules not loaded from the config file
+			var err error
+			if re, err = regexp.Compile(r.Command); err != nil {
+				return false
+			}
+		}
+		if call.Command == "" || !re.MatchString(call.Command) {
+			return false
+		}
+	}
+	if r.Path != "" {
+		matched := false
+		for _, p := range call.Paths {
+			if PathGlobMatch(r.Path, p) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func globMatch(pattern, name string) bool {
+	ok, _ := filepath.Match(pattern, name)
+	return ok
+}
+
+// PathGlobMatch matches a path against a glob. A leading ~ is the home
+// directory, relative paths are relative to the project directory and a
+// trailing /** matches everything under the directory.
+func PathGlobMatch(pattern, path string) bool {
+	path = absPath(path)
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		dir = absPath(dir)
+		return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+	}
+	return globMatch(absPath(pattern), path)
+}
+
+func absPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(GetProjectDir(), path)
+	}
+	return filepath.Clean(path)
+}
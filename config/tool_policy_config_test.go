@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestToolRuleMatch(t *testing.T) {
+	cases := []struct {
+		name string
+		rule ToolRule
+		call ToolCall
+		want bool
+	}{
+		{"tool name", ToolRule{Tool: "shell"}, ToolCall{Name: "shell"}, true},
+		{"tool glob", ToolRule{Tool: "github_*"}, ToolCall{Name: "github_create_issue"}, true},
+		{"command", ToolRule{Tool: "shell", Command: `^git\s+(status|diff)`}, ToolCall{Name: "shell", Command: "git status"}, true},
+		{"command mismatch", ToolRule{Tool: "shell", Command: `^git\s+(status|diff)`}, ToolCall{Name: "shell", Command: "git push"}, false},
+		{"mcp server", ToolRule{Server: "github"}, ToolCall{Name: "github_merge", McpServer: "github", McpTool: "merge"}, true},
+		{"mcp server and raw tool", ToolRule{Server: "github", Tool: "merge"}, ToolCall{Name: "github_merge", McpServer: "github", McpTool: "merge"}, true},
+		{"server skips builtin", ToolRule{Server: "*"}, ToolCall{Name: "shell"}, false},
+		{"path under dir", ToolRule{Path: "/etc/**"}, ToolCall{Name: "write_file", Paths: []string{"/etc/hosts"}}, true},
+		{"path outside dir", ToolRule{Path: "/etc/**"}, ToolCall{Name: "write_file", Paths: []string{"/tmp/etc"}}, false},
+		{"relative path", ToolRule{Path: "*.md"}, ToolCall{Name: "edit_file", Paths: []string{filepath.Join(GetProjectDir(), "README.md")}}, true},
+	}
+	for _, c := range cases {
+		if got := c.rule.Match(&c.call); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestToolPolicyDefaults(t *testing.T) {
+	var policy *ToolPolicyConfig
+	if policy.GetDefault() != ToolActionAllow || policy.GetNonInteractive() != ToolActionDeny {
+		t.Fatal("unexpected defaults")
+	}
+	policy = &ToolPolicyConfig{NonInteractive: ToolActionAsk}
+	if policy.GetNonInteractive() != ToolActionDeny {
+		t.Fatal("non-interactive runs cannot ask")
+	}
+}
+
+func TestToolPolicyCompiledOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+		"toolPolicy": {"rules": [{"tool": "shell", "command": "^git\\s+push", "action": "ask"}]},
+		"agents": [{"name": "ops", "toolPolicy": {"rules": [{"command": "^kubectl\\b", "action": "deny"}]}}]
+	}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfigFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := c.ToolPolicy.Rules[0]
+	if rule.commandRe == nil || c.Agents[0].ToolPolicy.Rules[0].commandRe == nil {
+		t.Fatal("command regexps should be compiled when the config is loaded")
+	}
+	if !rule.Match(&ToolCall{Name: "shell", Command: "git push origin"}) ||
+		rule.Match(&ToolCall{Name: "shell", Command: "git status"}) {
+		t.Error("unexpected match of the compiled rule")
+	}
+}
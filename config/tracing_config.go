@@ -0,0 +1,63 @@
+package config
+
+import "path/filepath"
+
+const (
+	TracingExporterOtlp = "otlp"
+	TracingExporterFile = "file"
+
+	defaultTracingServiceName = "tokkibot"
+	defaultTracingEndpoint    = "localhost:4318"
+	defaultTracingFileName    = "traces.jsonl"
+)
+
+// TracingConfig configures OpenTelemetry tracing.
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled"`
+	Exporter    string            `json:"exporter,omitempty"`    // otlp (default) or file
+	Endpoint    string            `json:"endpoint,omitempty"`    // otlp/http endpoint, e.g. localhost:4318
+	Insecure    bool              `json:"insecure,omitempty"`    // use http instead of https for otlp
+	Headers     map[string]string `json:"headers,omitempty"`     // extra otlp headers, e.g. auth
+	File        string            `json:"file,omitempty"`        // output of file exporter, defaults to ~/.tokkibot/logs/traces.jsonl
+	SampleRatio float64           `json:"sampleRatio,omitempty"` // 0 < ratio <= 1, defaults to 1
+	ServiceName string            `json:"serviceName,omitempty"`
+}
+
+func (c *TracingConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+func (c *TracingConfig) GetExporter() string {
+	if c.Exporter == "" {
+		return TracingExporterOtlp
+	}
+	return c.Exporter
+}
+
+func (c *TracingConfig) GetEndpoint() string {
+	if c.Endpoint == "" {
+		return defaultTracingEndpoint
+	}
+	return c.Endpoint
+}
+
+func (c *TracingConfig) GetFile() string {
+	if c.File == "" {
+		return filepath.Join(GetLogsDir(), defaultTracingFileName)
+	}
+	return c.File
+}
+
+func (c *TracingConfig) GetSampleRatio() float64 {
+	if c.SampleRatio <= 0 || c.SampleRatio > 1 {
+		return 1
+	}
+	return c.SampleRatio
+}
+
+func (c *TracingConfig) GetServiceName() string {
+	if c.ServiceName == "" {
+		return defaultTracingServiceName
+	}
+	return c.ServiceName
+}
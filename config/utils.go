@@ -42,6 +42,13 @@ func MustInit() {
 	if err != nil {
 		panic(err)
 	}
+	registerSecrets(&conf)
+}
+
+// GetAuditLogPath returns the audit log of tool executions:
+// ~/.tokkibot/audit/audit.jsonl
+func GetAuditLogPath() string {
+	return filepath.Join(GetHomeDir(), "audit", "audit.jsonl")
 }
 
 // GetLogsDir returns the logs directory path: ~/.tokkibot/logs
@@ -0,0 +1,538 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ValidationError reports every problem found in a config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (e *ValidationError) addf(format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Validate checks references and values of the config. A *ValidationError
+// is returned if any problem is found.
+func (c *Config) Validate() error {
+	verr := &ValidationError{}
+
+	agents := make(map[string]struct{}, len(c.Agents))
+	for i, entry := range c.Agents {
+		if entry.Name == "" {
+			verr.addf("agents[%d]: name is empty", i)
+			continue
+		}
+		if _, ok := agents[entry.Name]; ok {
+			verr.addf("agent %s: duplicate name", entry.Name)
+		}
+		agents[entry.Name] = struct{}{}
+
+		if _, ok := c.Providers[entry.Provider]; !ok {
+			verr.addf("agent %s: provider %q not found in providers", entry.Name, entry.Provider)
+		}
+		if entry.QueueMode != "" && !entry.QueueMode.IsValid() {
+			verr.addf("agent %s: unknown queueMode %q", entry.Name, entry.QueueMode)
+		}
+		validateToolPolicy(verr, "agent "+entry.Name+": toolPolicy", entry.ToolPolicy)
+		if entry.Binding != nil {
+			c.validateBinding(verr, entry.Name, entry.Binding)
+		}
+		if hb := entry.Heartbeat; hb != nil && hb.Every != "" {
+			if _, err := time.ParseDuration(hb.Every); err != nil {
+				verr.addf("agent %s: invalid heartbeat interval %q", entry.Name, hb.Every)
+			}
+		}
+		if cp := entry.Checkpoint; cp != nil && cp.TTL != "" {
+			if d, err := time.ParseDuration(cp.TTL); err != nil || d <= 0 {
+				verr.addf("agent %s: invalid checkpoint ttl %q", entry.Name, cp.TTL)
+			}
+		}
+		validateSandbox(verr, entry.Name, entry.Sandbox)
+		if sh := entry.Shell; sh != nil {
+			for _, d := range []string{sh.Timeout, sh.MaxTimeout} {
+				if d == "" {
+					continue
+				}
+				if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+					verr.addf("agent %s: invalid shell timeout %q", entry.Name, d)
+				}
+			}
+		}
+	}
+
+	c.validateProviders(verr)
+	c.validateChannels(verr)
+	c.validateRoutes(verr)
+	c.validateIdentity(verr)
+	validateRateLimit(verr, "rateLimit", c.RateLimit)
+	validateToolPolicy(verr, "toolPolicy", c.ToolPolicy)
+
+	if c.Webhook != nil {
+		hooks := make(map[string]struct{}, len(c.Webhook.Hooks))
+		for i, hook := range c.Webhook.Hooks {
+			if hook.Name == "" {
+				verr.addf("webhook.hooks[%d]: name is empty", i)
+				continue
+			}
+			if _, ok := hooks[hook.Name]; ok {
+				verr.addf("webhook %s: duplicate name", hook.Name)
+			}
+			hooks[hook.Name] = struct{}{}
+			if _, ok := agents[hook.GetAgent()]; !ok && len(agents) > 0 {
+				verr.addf("webhook %s: agent %q not found in agents", hook.Name, hook.GetAgent())
+			}
+			if hook.Secret == "" && !hook.Insecure {
+				verr.addf("webhook %s: secret is empty, set insecure to accept unauthenticated requests", hook.Name)
+			} else if hook.Secret != "" {
+				validateValue(verr, c.secretSource(), "webhook "+hook.Name+": secret", hook.Secret)
+			}
+		}
+	}
+
+	if wf := c.WebFetch; wf != nil && wf.CacheTTL != "" {
+		if d, err := time.ParseDuration(wf.CacheTTL); err != nil || d <= 0 {
+			verr.addf("webFetch: invalid cacheTTL %q", wf.CacheTTL)
+		}
+	}
+	validateWebSearch(verr, c.secretSource(), c.WebSearch)
+
+	if c.Admin.IsEnabled() && c.Admin.Token != "" {
+		validateValue(verr, c.secretSource(), "admin: token", c.Admin.Token)
+	}
+
+	if c.Tracing.IsEnabled() {
+		switch c.Tracing.GetExporter() {
+		case "otlp", "file":
+		default:
+			verr.addf("tracing: unknown exporter %q", c.Tracing.Exporter)
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (c *Config) validateBinding(verr *ValidationError, agentName string, binding *AgentBinding) {
+	match := binding.Match
+	if binding.QueueMode != "" && !binding.QueueMode.IsValid() {
+		verr.addf("agent %s: unknown binding queueMode %q", agentName, binding.QueueMode)
+	}
+	validateRateLimit(verr, "agent "+agentName+": binding rateLimit", binding.RateLimit)
+	if match.Channel == "" {
+		verr.addf("agent %s: binding channel is empty", agentName)
+		return
+	}
+
+	for _, ch := range c.Channels {
+		if ch.Name != match.Channel {
+			continue
+		}
+		if _, ok := ch.Account[match.Account]; !ok {
+			verr.addf("agent %s: binding account %q not found in channel %s", agentName, match.Account, match.Channel)
+		}
+		return
+	}
+	verr.addf("agent %s: binding channel %q not found in channels", agentName, match.Channel)
+}
+
+func validateRateLimit(verr *ValidationError, field string, c *RateLimitConfig) {
+	if c == nil || c.BlockDuration == "" {
+		return
+	}
+	if d, err := time.ParseDuration(c.BlockDuration); err != nil || d <= 0 {
+		verr.addf("%s: invalid blockDuration %q", field, c.BlockDuration)
+	}
+}
+
+func validateToolPolicy(verr *ValidationError, field string, c *ToolPolicyConfig) {
+	if c == nil {
+		return
+	}
+	if c.Default != "" && !c.Default.IsValid() {
+		verr.addf("%s: unknown default action %q", field, c.Default)
+	}
+	if c.NonInteractive != "" && (!c.NonInteractive.IsValid() || c.NonInteractive == ToolActionAsk) {
+		verr.addf("%s: nonInteractive must be allow or deny, got %q", field, c.NonInteractive)
+	}
+	for i, rule := range c.Rules {
+		if !rule.Action.IsValid() {
+			verr.addf("%s: rules[%d]: unknown action %q", field, i, rule.Action)
+		}
+		if rule.Command != "" {
+			if _, err := regexp.Compile(rule.Command); err != nil {
+				verr.addf("%s: rules[%d]: invalid command regexp: %v", field, i, err)
+			}
+		}
+		for _, glob := range []string{rule.Tool, rule.Server, rule.Path} {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				verr.addf("%s: rules[%d]: invalid glob %q", field, i, glob)
+			}
+		}
+	}
+}
+
+// validateProviders checks providers referenced by agents.
+func (c *Config) validateProviders(verr *ValidationError) {
+	var used []string
+	for _, entry := range c.Agents {
+		if !slices.Contains(used, entry.Provider) {
+			used = append(used, entry.Provider)
+		}
+	}
+	slices.Sort(used)
+
+	for _, name := range used {
+		provider, ok := c.Providers[name]
+		if !ok {
+			continue
+		}
+		switch provider.Style {
+		case "", "openai", "anthropic":
+		default:
+			verr.addf("provider %s: unknown style %q", name, provider.Style)
+		}
+		validateValue(verr, c.secretSource(), "provider "+name+": apiKey", provider.ApiKey)
+		validateValue(verr, c.secretSource(), "provider "+name+": baseURL", provider.BaseURL)
+	}
+}
+
+// validateRoutes checks that each chat of a channel account is routed to at
+// most one agent.
+func (c *Config) validateRoutes(verr *ValidationError) {
+	type route struct {
+		fallback string            // agent receiving all other chats
+		chats    map[string]string // chat id -> agent
+	}
+	routes := make(map[string]*route)
+
+	for _, entry := range c.Agents {
+		if entry.Binding == nil {
+			continue
+		}
+		match := entry.Binding.Match
+		key := match.Channel + ":" + match.Account
+		rt, ok := routes[key]
+		if !ok {
+			rt = &route{chats: make(map[string]string)}
+			routes[key] = rt
+		}
+
+		if len(match.ChatIds) == 0 {
+			if rt.fallback != "" {
+				verr.addf("route %s: agents %s and %s both receive all chats", key, rt.fallback, entry.Name)
+				continue
+			}
+			rt.fallback = entry.Name
+			continue
+		}
+		for _, chatId := range match.ChatIds {
+			if other, ok := rt.chats[chatId]; ok && other != entry.Name {
+				verr.addf("route %s: chat %s is routed to both %s and %s", key, chatId, other, entry.Name)
+				continue
+			}
+			rt.chats[chatId] = entry.Name
+		}
+	}
+}
+
+// validateIdentity checks roles of users and that a sender id belongs to
+// one user only.
+func (c *Config) validateIdentity(verr *ValidationError) {
+	if !c.Identity.IsEnabled() {
+		return
+	}
+	if !c.Identity.GetDefaultRole().IsValid() {
+		verr.addf("identity: unknown defaultRole %q", c.Identity.DefaultRole)
+	}
+	for _, role := range slices.Sorted(maps.Keys(c.Identity.Roles)) {
+		if !role.IsValid() {
+			verr.addf("identity: unknown role %q in roles", role)
+		}
+	}
+
+	owners := make(map[string]string)
+	for i, user := range c.Identity.Users {
+		if user.Name == "" {
+			verr.addf("identity.users[%d]: name is empty", i)
+			continue
+		}
+		if !user.Role.IsValid() {
+			verr.addf("user %s: unknown role %q", user.Name, user.Role)
+		}
+		for _, id := range user.Ids {
+			if owner, ok := owners[id]; ok && owner != user.Name {
+				verr.addf("user %s: id %s already belongs to %s", user.Name, id, owner)
+				continue
+			}
+			owners[id] = user.Name
+		}
+	}
+}
+
+// validateValue reports a required value which resolves to nothing.
+func validateValue(verr *ValidationError, source secretSource, field, value string) {
+	resolved, err := resolveValueFrom(source, value)
+	if err != nil {
+		verr.addf("%s: %v", field, err)
+		return
+	}
+	if resolved == "" {
+		verr.addf("%s is empty%s", field, unsetEnvHint(value))
+	}
+}
+
+// validateChannels checks that secret references of channel accounts can
+// be resolved.
+func (c *Config) validateChannels(verr *ValidationError) {
+	for _, ch := range c.Channels {
+		for _, account := range slices.Sorted(maps.Keys(ch.Account)) {
+			if _, err := resolveJSONValuesFrom(c.secretSource(), ch.Account[account]); err != nil {
+				verr.addf("channel %s account %s: %v", ch.Name, account, err)
+			}
+		}
+	}
+}
+
+// unsetEnvHint names the unset environment variables referenced by value.
+func unsetEnvHint(value string) string {
+	var unset []string
+	for _, m := range envRefPattern.FindAllStringSubmatch(value, -1) {
+		if os.Getenv(m[1]) == "" {
+			unset = append(unset, m[1])
+		}
+	}
+	if len(unset) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s not set)", strings.Join(unset, ", "))
+}
+
+// CheckConfigFile validates the config file at path against the Config
+// schema, reporting unknown fields as well as the problems found by Validate.
+func CheckConfigFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	verr := &ValidationError{}
+	var strict Config
+	if err := decodeStrict(content, &strict); err != nil {
+		verr.addf("%s: %v", path, err)
+	}
+
+	c, err := loadConfigFrom(path)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		verr.Problems = append(verr.Problems, err.(*ValidationError).Problems...)
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Validate checks every mcp server of the config.
+func (c *McpConfig) Validate() error {
+	verr := &ValidationError{}
+
+	names := make([]string, 0, len(c.McpServers))
+	for name := range c.McpServers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		server := c.McpServers[name]
+		if err := server.Validate(); err != nil {
+			verr.addf("mcp server %s: %v", name, err)
+			continue
+		}
+		if server.Url != "" {
+			if u, err := url.Parse(server.Url); err != nil || u.Scheme == "" || u.Host == "" {
+				verr.addf("mcp server %s: invalid url %q", name, server.Url)
+			}
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// CheckMcpConfigFile validates the mcp config file at path. Besides the
+// schema, it reports ${ENV} references which expand to empty values.
+func CheckMcpConfigFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read mcp config file: %w", err)
+	}
+
+	verr := &ValidationError{}
+	var seen []string
+	for _, m := range envRefPattern.FindAllSubmatch(content, -1) {
+		name := string(m[1])
+		if os.Getenv(name) == "" && !slices.Contains(seen, name) {
+			seen = append(seen, name)
+			verr.addf("%s: environment variable %s is not set", path, name)
+		}
+	}
+
+	var c McpConfig
+	if err := decodeStrict([]byte(os.ExpandEnv(string(content))), &c); err != nil {
+		verr.addf("%s: %v", path, err)
+	} else if err := c.Validate(); err != nil {
+		verr.Problems = append(verr.Problems, err.(*ValidationError).Problems...)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.McpServers)) {
+		if _, err := resolveMcpServer(c.McpServers[name]); err != nil {
+			verr.addf("mcp server %s: %v", name, err)
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// decodeStrict decodes json content into v and rejects unknown fields.
+func decodeStrict(content []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func validateSandbox(verr *ValidationError, agent string, c *SandboxConfig) {
+	switch c.GetBackend() {
+	case SandboxBackendBwrap:
+	case SandboxBackendDocker:
+		docker := c.GetDocker()
+		if docker.GetImage() == "" {
+			verr.addf("agent %s: sandbox docker image is empty", agent)
+		}
+		if host := docker.GetHost(); host != "" && !strings.HasPrefix(host, "unix://") && !strings.HasPrefix(host, "tcp://") {
+			verr.addf("agent %s: sandbox docker host %q must start with unix:// or tcp://", agent, host)
+		}
+		if docker != nil {
+			switch docker.Scope {
+			case "", "agent", "chat":
+			default:
+				verr.addf("agent %s: unknown sandbox docker scope %q", agent, docker.Scope)
+			}
+			if docker.IdleTimeout != "" {
+				if d, err := time.ParseDuration(docker.IdleTimeout); err != nil || d <= 0 {
+					verr.addf("agent %s: invalid sandbox docker idleTimeout %q", agent, docker.IdleTimeout)
+				}
+			}
+		}
+		if c.GetNetwork().GetMode() == SandboxNetworkAllowlist {
+			verr.addf("agent %s: sandbox network allowlist is not supported by the docker backend", agent)
+		}
+	default:
+		verr.addf("agent %s: unknown sandbox backend %q", agent, c.Backend)
+	}
+
+	network := c.GetNetwork()
+	switch network.GetMode() {
+	case SandboxNetworkFull, SandboxNetworkNone:
+	case SandboxNetworkAllowlist:
+		if len(network.GetAllow()) == 0 {
+			verr.addf("agent %s: sandbox network allowlist is empty, use mode %q to block all hosts", agent, SandboxNetworkNone)
+		}
+	default:
+		verr.addf("agent %s: unknown sandbox network mode %q", agent, network.Mode)
+	}
+
+	limits := c.GetLimits()
+	if limits == nil {
+		return
+	}
+	if limits.CPUTime != "" {
+		if d, err := time.ParseDuration(limits.CPUTime); err != nil || d <= 0 {
+			verr.addf("agent %s: invalid sandbox cpuTime %q", agent, limits.CPUTime)
+		}
+	}
+	for _, size := range []struct{ name, value string }{
+		{"memory", limits.Memory},
+		{"fileSize", limits.FileSize},
+		{"output", limits.Output},
+	} {
+		if size.value == "" {
+			continue
+		}
+		if _, err := parseBytes(size.value); err != nil {
+			verr.addf("agent %s: invalid sandbox %s %q", agent, size.name, size.value)
+		}
+	}
+	if limits.Pids < 0 {
+		verr.addf("agent %s: invalid sandbox pids %d", agent, limits.Pids)
+	}
+}
+
+func validateWebSearch(verr *ValidationError, source secretSource, c *WebSearchConfig) {
+	if !c.IsEnabled() {
+		return
+	}
+	if c.Count < 0 || c.FetchTop < 0 {
+		verr.addf("webSearch: count and fetchTop must not be negative")
+	}
+
+	switch c.Provider {
+	case WebSearchProviderSearXNG:
+		if c.SearXNG == nil {
+			verr.addf("webSearch: searxng.baseURL is empty")
+			return
+		}
+		validateValue(verr, source, "webSearch: searxng.baseURL", c.SearXNG.BaseURL)
+	case WebSearchProviderBrave, WebSearchProviderBing:
+		ep := c.GetEndpoint()
+		if ep == nil {
+			verr.addf("webSearch: %s.apiKey is empty", c.Provider)
+			return
+		}
+		validateValue(verr, source, "webSearch: "+c.Provider+".apiKey", ep.ApiKey)
+	case WebSearchProviderJSON:
+		j := c.JSON
+		if j == nil || !strings.Contains(j.URL, "{query}") {
+			verr.addf("webSearch: json.url must contain a {query} placeholder")
+		}
+		if j == nil || j.Results == "" {
+			verr.addf("webSearch: json.results is empty")
+		}
+		if j == nil {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(j.Headers)) {
+			if _, err := resolveValueFrom(source, j.Headers[key]); err != nil {
+				verr.addf("webSearch: json.headers.%s: %v", key, err)
+			}
+		}
+	default:
+		verr.addf("webSearch: unknown provider %q", c.Provider)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	c := Config{
+		Providers: map[string]ProviderConfig{"openai": {ApiKey: "sk-test", BaseURL: "https://api.openai.com/v1"}},
+		Agents: []AgentEntry{
+			{Name: "main", Provider: "openai", Binding: &AgentBinding{
+				Match: AgentBindingMatch{Channel: "lark", Account: "default"},
+			}},
+		},
+		Channels: []ChannelEntry{{
+			Name:    "lark",
+			Account: map[string]json.RawMessage{"default": json.RawMessage(`{}`)},
+		}},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+
+	c.Providers["remote"] = ProviderConfig{ApiKey: "${TOKKIBOT_TEST_UNSET_KEY}", BaseURL: "https://api.example.com/v1"}
+	c.Agents = append(c.Agents,
+		AgentEntry{Name: "main", Provider: "openai"},
+		AgentEntry{Name: "helper", Provider: "remote", Binding: &AgentBinding{
+			Match: AgentBindingMatch{Channel: "lark", Account: "default"},
+		}},
+		AgentEntry{Name: "ops", Provider: "missing", QueueMode: "later", Binding: &AgentBinding{
+			Match: AgentBindingMatch{Channel: "lark", Account: "ops"},
+		}},
+	)
+	var verr *ValidationError
+	if err := c.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	// duplicate main, missing provider, unknown queue mode, missing account,
+	// unset api key env of remote and overlapping routes of main and helper
+	if len(verr.Problems) != 6 {
+		t.Fatalf("expected 6 problems, got %d:\n%s", len(verr.Problems), verr.Error())
+	}
+}
+
+func TestConfigValidateWebhookSecret(t *testing.T) {
+	c := Config{Webhook: &WebhookConfig{Hooks: []WebhookEntry{{Name: "ci"}}}}
+	var verr *ValidationError
+	if err := c.Validate(); !errors.As(err, &verr) || len(verr.Problems) != 1 ||
+		!strings.Contains(verr.Problems[0], "secret is empty") {
+		t.Fatalf("expected an empty secret problem, got %v", err)
+	}
+
+	c.Webhook.Hooks[0].Insecure = true
+	if err := c.Validate(); err != nil {
+		t.Fatalf("insecure hook rejected: %v", err)
+	}
+}
+
+func TestCheckMcpConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.json")
+	content := `{"mcpServers": {
+		"search": {"url": "https://mcp.example.com", "headers": {"Authorization": "Bearer ${TOKKIBOT_TEST_UNSET_KEY}"}},
+		"broken": {"command": "npx", "url": "https://mcp.example.com"}
+	}}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var verr *ValidationError
+	if err := CheckMcpConfigFile(path); !errors.As(err, &verr) || len(verr.Problems) != 2 {
+		t.Fatalf("expected unset env and broken server, got %v", err)
+	}
+}
+
+func TestProviderConfigExpandEnv(t *testing.T) {
+	t.Setenv("TOKKIBOT_TEST_KEY", "sk-env")
+	pc := ProviderConfig{ApiKey: "${TOKKIBOT_TEST_KEY}", BaseURL: "https://api.example.com/v1"}
+	if got := pc.GetApiKey(); got != "sk-env" {
+		t.Fatalf("expected expanded api key, got %q", got)
+	}
+	if got := unsetEnvHint("${TOKKIBOT_TEST_UNSET_KEY}"); got != " (TOKKIBOT_TEST_UNSET_KEY not set)" {
+		t.Fatalf("unexpected hint %q", got)
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+)
+
+const defaultWebFetchCacheTTL = 24 * time.Hour
+
+// WebFetchConfig controls how web_fetch and web_search get pages.
+type WebFetchConfig struct {
+	NoCache       bool   `json:"noCache,omitempty"`       // do not keep fetched pages on disk
+	CacheTTL      string `json:"cacheTTL,omitempty"`      // how long fetched pages are kept, default 24h
+	RespectRobots bool   `json:"respectRobots,omitempty"` // refuse pages disallowed by robots.txt
+}
+
+func (c *WebFetchConfig) IsCacheEnabled() bool {
+	return c == nil || !c.NoCache
+}
+
+// GetCacheTTL returns how long fetched pages are kept.
+func (c *WebFetchConfig) GetCacheTTL() time.Duration {
+	if c == nil {
+		return defaultWebFetchCacheTTL
+	}
+	return parseDurationOr(c.CacheTTL, defaultWebFetchCacheTTL)
+}
+
+func (c *WebFetchConfig) IsRobotsRespected() bool {
+	return c != nil && c.RespectRobots
+}
+
+// GetWebCacheDir returns the directory of fetched pages:
+// ~/.tokkibot/cache/web
+func GetWebCacheDir() string {
+	return filepath.Join(GetHomeDir(), "cache", "web")
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebFetchConfig(t *testing.T) {
+	var c *WebFetchConfig
+	if !c.IsCacheEnabled() || c.IsRobotsRespected() || c.GetCacheTTL() != 24*time.Hour {
+		t.Fatal("unexpected defaults of a nil config")
+	}
+
+	c = &WebFetchConfig{NoCache: true, CacheTTL: "2h", RespectRobots: true}
+	if c.IsCacheEnabled() || !c.IsRobotsRespected() || c.GetCacheTTL() != 2*time.Hour {
+		t.Fatalf("unexpected config %+v", c)
+	}
+
+	cfg := Config{WebFetch: &WebFetchConfig{CacheTTL: "a day"}}
+	var verr *ValidationError
+	if err := cfg.Validate(); !errors.As(err, &verr) || len(verr.Problems) != 1 {
+		t.Fatalf("expected an invalid cacheTTL, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import "strings"
+
+const (
+	WebSearchProviderSearXNG = "searxng"
+	WebSearchProviderBrave   = "brave"
+	WebSearchProviderBing    = "bing"
+	WebSearchProviderJSON    = "json"
+
+	defaultWebSearchCount = 5
+	maxWebSearchCount     = 20
+)
+
+// WebSearchConfig configures the web_search tool, which is only available
+// when a provider is set.
+type WebSearchConfig struct {
+	Provider string                   `json:"provider"`           // searxng, brave, bing or json
+	Count    int                      `json:"count,omitempty"`    // results per search, default 5, at most 20
+	FetchTop int                      `json:"fetchTop,omitempty"` // top results fetched as markdown unless the call says otherwise
+	SearXNG  *WebSearchEndpointConfig `json:"searxng,omitempty"`
+	Brave    *WebSearchEndpointConfig `json:"brave,omitempty"`
+	Bing     *WebSearchEndpointConfig `json:"bing,omitempty"`
+	JSON     *WebSearchJSONConfig     `json:"json,omitempty"`
+}
+
+// WebSearchEndpointConfig is the endpoint of a search provider. The base url
+// is required for searxng and overrides the public api of brave and bing.
+type WebSearchEndpointConfig struct {
+	BaseURL string `json:"baseURL,omitempty"`
+	ApiKey  string `json:"apiKey,omitempty"`
+}
+
+// WebSearchJSONConfig describes a generic search api answering in json.
+type WebSearchJSONConfig struct {
+	URL     string            `json:"url"`               // request url with {query} and {count} placeholders
+	Headers map[string]string `json:"headers,omitempty"` // values may be ${ENV} or secret:// references
+	Results string            `json:"results"`           // dotted path to the result array, e.g. data.items
+	Fields  *WebSearchFields  `json:"fields,omitempty"`  // dotted paths within a result
+}
+
+type WebSearchFields struct {
+	Title   string `json:"title,omitempty"`   // default title
+	URL     string `json:"url,omitempty"`     // default url
+	Snippet string `json:"snippet,omitempty"` // default snippet
+}
+
+func (c *WebSearchConfig) IsEnabled() bool {
+	return c != nil && c.Provider != ""
+}
+
+func (c *WebSearchConfig) GetCount() int {
+	if c == nil || c.Count <= 0 {
+		return defaultWebSearchCount
+	}
+	return min(c.Count, maxWebSearchCount)
+}
+
+func (c *WebSearchConfig) GetFetchTop() int {
+	if c == nil || c.FetchTop <= 0 {
+		return 0
+	}
+	return min(c.FetchTop, c.GetCount())
+}
+
+// GetEndpoint returns the endpoint config of the configured provider.
+func (c *WebSearchConfig) GetEndpoint() *WebSearchEndpointConfig {
+	if c == nil {
+		return nil
+	}
+	switch c.Provider {
+	case WebSearchProviderSearXNG:
+		return c.SearXNG
+	case WebSearchProviderBrave:
+		return c.Brave
+	case WebSearchProviderBing:
+		return c.Bing
+	}
+	return nil
+}
+
+// GetBaseURL returns the base url with ${ENV} and secret:// references
+// resolved.
+func (c *WebSearchEndpointConfig) GetBaseURL() string {
+	if c == nil {
+		return ""
+	}
+	return resolveValueOrEmpty(c.BaseURL)
+}
+
+// GetApiKey returns the api key with ${ENV} and secret:// references
+// resolved.
+func (c *WebSearchEndpointConfig) GetApiKey() string {
+	if c == nil {
+		return ""
+	}
+	return resolveValueOrEmpty(c.ApiKey)
+}
+
+// GetHeaders returns the request headers with ${ENV} and secret://
+// references resolved.
+func (c *WebSearchJSONConfig) GetHeaders() map[string]string {
+	if c == nil {
+		return nil
+	}
+	return resolveStringMap(c.Headers, resolveValueOrEmpty)
+}
+
+func (f *WebSearchFields) GetTitle() string {
+	if f == nil || f.Title == "" {
+		return "title"
+	}
+	return f.Title
+}
+
+func (f *WebSearchFields) GetURL() string {
+	if f == nil || f.URL == "" {
+		return "url"
+	}
+	return f.URL
+}
+
+func (f *WebSearchFields) GetSnippet() string {
+	if f == nil || f.Snippet == "" {
+		return "snippet"
+	}
+	return f.Snippet
+}
+
+// isSecretHeader reports whether a request header carries a credential.
+func isSecretHeader(key string) bool {
+	return strings.EqualFold(key, "Authorization") || isSecretKey(strings.ReplaceAll(key, "-", ""))
+}
@@ -0,0 +1,45 @@
+package config
+
+import "testing"
+
+func TestWebSearchConfig(t *testing.T) {
+	var c *WebSearchConfig
+	if c.IsEnabled() || c.GetCount() != defaultWebSearchCount || c.GetFetchTop() != 0 {
+		t.Fatal("nil config should be disabled with defaults")
+	}
+
+	c = &WebSearchConfig{Provider: WebSearchProviderBrave, Count: 50, FetchTop: 30, Brave: &WebSearchEndpointConfig{ApiKey: "key"}}
+	if c.GetCount() != maxWebSearchCount || c.GetFetchTop() != maxWebSearchCount {
+		t.Errorf("count %d and fetchTop %d should be capped", c.GetCount(), c.GetFetchTop())
+	}
+	if c.GetEndpoint().GetApiKey() != "key" {
+		t.Errorf("unexpected endpoint %+v", c.GetEndpoint())
+	}
+	if !isSecretHeader("X-API-Key") || !isSecretHeader("authorization") || isSecretHeader("Accept") {
+		t.Error("isSecretHeader misclassified a header")
+	}
+}
+
+func TestValidateWebSearch(t *testing.T) {
+	verr := &ValidationError{}
+	validateWebSearch(verr, getSecretStore, nil)
+	validateWebSearch(verr, getSecretStore, &WebSearchConfig{Provider: WebSearchProviderSearXNG, SearXNG: &WebSearchEndpointConfig{BaseURL: "http://localhost:8888"}})
+	validateWebSearch(verr, getSecretStore, &WebSearchConfig{Provider: WebSearchProviderBing, Bing: &WebSearchEndpointConfig{ApiKey: "key"}})
+	validateWebSearch(verr, getSecretStore, &WebSearchConfig{Provider: WebSearchProviderJSON, JSON: &WebSearchJSONConfig{
+		URL:     "https://search.example.com/api?q={query}&n={count}",
+		Results: "data.items",
+	}})
+	if len(verr.Problems) != 0 {
+		t.Fatalf("valid web search rejected: %v", verr.Error())
+	}
+
+	validateWebSearch(verr, getSecretStore, &WebSearchConfig{Provider: WebSearchProviderSearXNG})
+	validateWebSearch(verr, getSecretStore, &WebSearchConfig{Provider: WebSearchProviderBrave, Count: -1, Brave: &WebSearchEndpointConfig{}})
+	validateWebSearch(verr, getSecretStore, &WebSearchConfig{Provider: WebSearchProviderJSON, JSON: &WebSearchJSONConfig{URL: "https://search.example.com"}})
+	validateWebSearch(verr, getSecretStore, &WebSearchConfig{Provider: "google"})
+	// searxng base url, negative count, brave api key, json url and
+	// results, unknown provider
+	if len(verr.Problems) != 6 {
+		t.Fatalf("expected 6 problems, got %d:\n%s", len(verr.Problems), verr.Error())
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+const (
+	defaultWebhookListen        = "127.0.0.1:18790"
+	defaultWebhookRatePerMinute = 30
+)
+
+// WebhookConfig configures inbound http triggers served by the gateway.
+type WebhookConfig struct {
+	Listen string         `json:"listen,omitempty"` // e.g. 127.0.0.1:18790
+	Hooks  []WebhookEntry `json:"hooks,omitempty"`
+}
+
+type WebhookDelivery struct {
+	Channel string `json:"channel"` // target channel, e.g. lark
+	To      string `json:"to"`      // chatid of target channel
+}
+
+// WebhookEntry defines one endpoint served at /hooks/<name>.
+type WebhookEntry struct {
+	Name   string `json:"name"`
+	Agent  string `json:"agent,omitempty"`  // agent to run, defaults to main
+	ChatId string `json:"chatId,omitempty"` // session chat id, defaults to the hook name
+
+	// Go text/template rendered with the incoming request.
+	// Available fields: .Name, .Payload, .Headers, .Query, .Body
+	Template string `json:"template"`
+
+	// Secret used to verify incoming requests. If SignatureHeader is set,
+	// the header must carry a hex HMAC-SHA256 of the body (optionally
+	// prefixed with "sha256=" as GitHub does). Otherwise the secret must be
+	// sent as a bearer token or in the X-Tokkibot-Secret header. It may be
+	// a secret://name reference.
+	Secret          string `json:"secret,omitempty"`
+	SignatureHeader string `json:"signatureHeader,omitempty"`
+	// Insecure accepts unauthenticated requests when no secret is set.
+	Insecure bool `json:"insecure,omitempty"`
+
+	RatePerMinute int `json:"ratePerMinute,omitempty"`
+	Burst         int `json:"burst,omitempty"`
+
+	Deliver *WebhookDelivery `json:"deliver,omitempty"`
+}
+
+func (c *WebhookConfig) GetListen() string {
+	if c == nil || c.Listen == "" {
+		return defaultWebhookListen
+	}
+	return c.Listen
+}
+
+func (e *WebhookEntry) GetAgent() string {
+	if e.Agent == "" {
+		return MainAgentName
+	}
+	return e.Agent
+}
+
+func (e *WebhookEntry) GetChatId() string {
+	if e.ChatId == "" {
+		return e.Name
+	}
+	return e.ChatId
+}
+
+// GetSecret returns the secret with references resolved, empty if it cannot
+// be resolved.
+func (e *WebhookEntry) GetSecret() string {
+	return resolveValueOrEmpty(e.Secret)
+}
+
+func (e *WebhookEntry) GetRatePerMinute() int {
+	if e.RatePerMinute == 0 {
+		return defaultWebhookRatePerMinute
+	}
+	return e.RatePerMinute
+}
+
+func (e *WebhookEntry) GetBurst() int {
+	if e.Burst <= 0 {
+		return max(1, e.GetRatePerMinute()/6)
+	}
+	return e.Burst
+}
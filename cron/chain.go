@@ -0,0 +1,167 @@
+package cron
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxChainDepth stops chains of tasks which trigger each other in a loop.
+const maxChainDepth = 8
+
+// Condition decides whether the result of a successful run is delivered.
+// All the set parts must hold.
+type Condition struct {
+	// Regex must match the result
+	Regex string `json:"regex,omitempty"`
+	// Changed requires the result to differ from the previous successful run
+	Changed bool `json:"changed,omitempty"`
+	// Judge is a yes or no question about the result answered by the llm,
+	// e.g. "Does the report mention a new incident?". It is a template like
+	// the prompt, with the result as {{.Result}}.
+	Judge string `json:"judge,omitempty"`
+}
+
+// Validate checks the regex and the judge template.
+func (c *Condition) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Regex != "" {
+		if _, err := regexp.Compile(c.Regex); err != nil {
+			return fmt.Errorf("invalid condition regex: %w", err)
+		}
+	}
+	if _, err := parseTemplate(c.Judge); err != nil {
+		return fmt.Errorf("invalid condition judge: %w", err)
+	}
+	return nil
+}
+
+// Check evaluates the regex and changed parts of the condition. The judge
+// part needs the llm and is left to the caller. A false result comes with
+// the reason.
+func (c *Condition) Check(result, previous string) (bool, string) {
+	if c == nil {
+		return true, ""
+	}
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil || !re.MatchString(result) {
+			return false, fmt.Sprintf("result does not match %s", c.Regex)
+		}
+	}
+	if c.Changed && strings.TrimSpace(result) == strings.TrimSpace(previous) {
+		return false, "result is unchanged since the previous run"
+	}
+	return true, ""
+}
+
+// PromptData is available to the prompt templates of a task, e.g.
+// {{.Previous.Result}} or {{.Upstream.Result}}.
+type PromptData struct {
+	Task string
+	Now  time.Time
+	// Previous is the latest successful run of the task, empty on the first run
+	Previous *Run
+	// Upstream is the run which triggered this one through OnSuccess or
+	// OnFailure, empty if the run was not chained
+	Upstream *Run
+	// Result of the current run, only set for the judge of a condition
+	Result string
+}
+
+// RunRequest is passed to the TaskHandler for one execution of a task.
+type RunRequest struct {
+	// Prompt is the rendered prompt of the task
+	Prompt string
+	Data   *PromptData
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	if !strings.Contains(text, "{{") {
+		return nil, nil
+	}
+	return template.New("prompt").Option("missingkey=zero").Parse(text)
+}
+
+// RenderTemplate renders a prompt or judge template. Text without actions
+// is returned as is.
+func RenderTemplate(text string, data *PromptData) (string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	if tmpl == nil {
+		return text, nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// NewRunRequest renders the prompt of the task for a run. upstream is the
+// run which triggered a chained run, nil otherwise.
+func (t *Task) NewRunRequest(upstream *Run) (*RunRequest, error) {
+	previous, err := t.lastSuccessfulRun()
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		previous = &Run{}
+	}
+	if upstream == nil {
+		upstream = &Run{}
+	}
+
+	data := &PromptData{
+		Task:     t.Name,
+		Now:      time.Now(),
+		Previous: previous,
+		Upstream: upstream,
+	}
+	prompt, err := RenderTemplate(t.prompt, data)
+	if err != nil {
+		return nil, err
+	}
+	return &RunRequest{Prompt: prompt, Data: data}, nil
+}
+
+// lastSuccessfulRun returns the latest run with status ok, nil if none.
+func (t *Task) lastSuccessfulRun() (*Run, error) {
+	ids, err := t.runIds()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(ids) - 1; i >= 0; i-- {
+		run, err := t.GetRun(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		if run.Status == RunStatusOK {
+			return run, nil
+		}
+	}
+	return nil, nil
+}
+
+// validateChain checks the prompt template, the condition and the names of
+// chained tasks.
+func (t *Task) validateChain() error {
+	if _, err := parseTemplate(t.prompt); err != nil {
+		return fmt.Errorf("invalid prompt template: %w", err)
+	}
+	if err := t.DeliverIf.Validate(); err != nil {
+		return err
+	}
+	for _, name := range append(append([]string(nil), t.OnSuccess...), t.OnFailure...) {
+		if name == t.Name {
+			return fmt.Errorf("task %s can not trigger itself", t.Name)
+		}
+	}
+	return nil
+}
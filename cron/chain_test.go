@@ -0,0 +1,102 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestChainedTasks(t *testing.T) {
+	m := newTestManager(t)
+	collect := NewTask("collect", "0 9 * * *", "collect the metrics",
+		WithChain([]string{"report"}, []string{"alert"}))
+	report := NewTask("report", "0 9 * * *", "summarize: {{.Upstream.Result}} (last time: {{.Previous.Result}})")
+	alert := NewTask("alert", "0 9 * * *", "collecting failed: {{.Upstream.Error}}")
+	for _, task := range []*Task{collect, report, alert} {
+		if _, err := m.AddOrUpdateTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var prompts []string
+	fail := false
+	m.SetHandler(func(ctx context.Context, task *Task, req *RunRequest) *Outcome {
+		prompts = append(prompts, req.Prompt)
+		if task.Name == "collect" && fail {
+			return &Outcome{Err: errors.New("no data")}
+		}
+		return &Outcome{Result: task.Name + " done"}
+	})
+
+	m.executeTask(collect, TriggerSchedule, nil)
+	m.executeTask(collect, TriggerSchedule, nil)
+	fail = true
+	m.executeTask(collect, TriggerSchedule, nil)
+
+	want := []string{
+		"collect the metrics",
+		"summarize: collect done (last time: )",
+		"collect the metrics",
+		"summarize: collect done (last time: report done)",
+		"collect the metrics",
+		"collecting failed: no data",
+	}
+	if len(prompts) != len(want) {
+		t.Fatalf("prompts = %q", prompts)
+	}
+	for i := range want {
+		if prompts[i] != want[i] {
+			t.Errorf("prompt %d = %q, want %q", i, prompts[i], want[i])
+		}
+	}
+
+	last, _ := alert.LatestRun()
+	if last.Trigger != TriggerChain || last.ChainDepth != 1 || last.Upstream == "" {
+		t.Errorf("unexpected chained run: %+v", last)
+	}
+}
+
+func TestChainLoopStops(t *testing.T) {
+	m := newTestManager(t)
+	ping := NewTask("ping", "0 9 * * *", "ping", WithChain([]string{"pong"}, nil))
+	pong := NewTask("pong", "0 9 * * *", "pong", WithChain([]string{"ping"}, nil))
+	for _, task := range []*Task{ping, pong} {
+		if _, err := m.AddOrUpdateTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := 0
+	m.SetHandler(func(ctx context.Context, task *Task, req *RunRequest) *Outcome {
+		calls++
+		return &Outcome{Result: "ok"}
+	})
+
+	m.executeTask(ping, TriggerManual, nil)
+	if calls != maxChainDepth+1 {
+		t.Errorf("calls = %d, want %d", calls, maxChainDepth+1)
+	}
+
+	self := NewTask("self", "0 9 * * *", "self", WithChain([]string{"self"}, nil))
+	if _, err := m.AddOrUpdateTask(self); err == nil {
+		t.Error("expected an error for a task triggering itself")
+	}
+}
+
+func TestConditionCheck(t *testing.T) {
+	cond := &Condition{Regex: `(?i)incident`, Changed: true}
+	if ok, _ := cond.Check("all good", ""); ok {
+		t.Error("result without a match should not be delivered")
+	}
+	if ok, _ := cond.Check("new incident #1", "new incident #1\n"); ok {
+		t.Error("unchanged result should not be delivered")
+	}
+	if ok, reason := cond.Check("new incident #2", "new incident #1"); !ok {
+		t.Errorf("changed result should be delivered: %s", reason)
+	}
+	if err := (&Condition{Regex: "("}).Validate(); err == nil {
+		t.Error("expected an invalid regex")
+	}
+	if err := (&Condition{Judge: "{{.Result"}).Validate(); err == nil {
+		t.Error("expected an invalid judge template")
+	}
+}
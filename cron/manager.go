@@ -11,6 +11,8 @@ import (
 
 	"github.com/robfig/cron/v3"
 	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
+	"github.com/ryanreadbooks/tokkibot/pkg/safe"
 )
 
 // global manager instance
@@ -27,17 +29,27 @@ func GetGlobalManager() *Manager {
 	return globalManager
 }
 
-// TaskHandler is called when a cron task is triggered
-type TaskHandler func(ctx context.Context, task *Task)
+// TaskHandler is called when a cron task is triggered and reports the
+// outcome of the run.
+type TaskHandler func(ctx context.Context, task *Task, req *RunRequest) *Outcome
+
+// FailureHandler is called when a run of a task with NotifyOnFailure failed
+// after all retries.
+type FailureHandler func(ctx context.Context, task *Task, run *Run)
 
 // Manager manages cron tasks
 type Manager struct {
-	cronsDir string
-	cron     *cron.Cron
-	tasks    map[string]*Task
-	entryIDs map[string]cron.EntryID
-	mu       sync.RWMutex
-	handler  TaskHandler
+	cronsDir       string
+	cron           *cron.Cron
+	tasks          map[string]*Task
+	entryIDs       map[string]cron.EntryID
+	mu             sync.RWMutex
+	handler        TaskHandler
+	failureHandler FailureHandler
+
+	// stopCh is closed by Stop to abort pending retries
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
 // NewManager creates a new cron manager
@@ -48,6 +60,7 @@ func NewManager() *Manager {
 		cron:     cron.New(),
 		tasks:    make(map[string]*Task),
 		entryIDs: make(map[string]cron.EntryID),
+		stopCh:   make(chan struct{}),
 	}
 }
 
@@ -56,6 +69,11 @@ func (m *Manager) SetHandler(handler TaskHandler) {
 	m.handler = handler
 }
 
+// SetFailureHandler sets the handler notified of failed runs
+func (m *Manager) SetFailureHandler(handler FailureHandler) {
+	m.failureHandler = handler
+}
+
 // CronsDir returns the crons directory path
 func (m *Manager) CronsDir() string {
 	return m.cronsDir
@@ -118,29 +136,27 @@ func (m *Manager) Start() {
 	slog.Info("cron scheduler started", "tasks", len(m.tasks))
 }
 
-// Stop stops the cron scheduler
+// Stop stops the cron scheduler and aborts pending retries
 func (m *Manager) Stop() context.Context {
+	m.stopOnce.Do(func() { close(m.stopCh) })
 	return m.cron.Stop()
 }
 
 // scheduleTask registers a task with the cron scheduler
 func (m *Manager) scheduleTask(task *Task) error {
-	entryID, err := m.cron.AddFunc(task.CronExpr, func() {
-		m.executeTask(task)
-	})
+	schedule, err := task.Schedule()
 	if err != nil {
 		return fmt.Errorf("failed to add cron job: %w", err)
 	}
+	entryID := m.cron.Schedule(schedule, cron.FuncJob(func() {
+		m.runScheduled(task)
+	}))
 
 	m.mu.Lock()
 	m.entryIDs[task.Name] = entryID
 	m.mu.Unlock()
 
-	// calculate and log next run time
-	if schedule, err := cron.ParseStandard(task.CronExpr); err == nil {
-		nextRun := schedule.Next(time.Now())
-		slog.Info("scheduled cron task", "name", task.Name, "expr", task.CronExpr, "next_run", nextRun)
-	}
+	slog.Info("scheduled cron task", "name", task.Name, "expr", task.CronExpr, "next_run", schedule.Next(time.Now()))
 
 	return nil
 }
@@ -156,31 +172,104 @@ func (m *Manager) unscheduleTask(taskName string) {
 	}
 }
 
-// executeTask executes a cron task
-func (m *Manager) executeTask(task *Task) {
+// runScheduled waits for the jitter of the task, then executes it.
+func (m *Manager) runScheduled(task *Task) {
+	if delay := task.jitter(); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-m.stopCh:
+			timer.Stop()
+			return
+		}
+	}
+	m.executeTask(task, TriggerSchedule, nil)
+}
+
+// executeTask executes a cron task, then the tasks chained to its outcome.
+// upstream is the run which triggered a chained execution.
+func (m *Manager) executeTask(task *Task, trigger string, upstream *Run) {
+	run := m.execute(task, trigger, upstream)
+	if run == nil {
+		return
+	}
+
+	var next []string
+	switch run.Status {
+	case RunStatusOK:
+		next = task.OnSuccess
+	case RunStatusFailed:
+		next = task.OnFailure
+	}
+	if len(next) > 0 && run.ChainDepth >= maxChainDepth {
+		slog.Warn("cron task chain too deep, stop triggering", "name", task.Name, "depth", run.ChainDepth)
+		return
+	}
+	for _, name := range next {
+		chained, ok := m.GetTask(name)
+		if !ok {
+			slog.Warn("chained cron task not found", "name", task.Name, "chained", name)
+			continue
+		}
+		slog.Info("triggering chained cron task", "name", task.Name, "chained", name, "status", run.Status)
+		m.executeTask(chained, TriggerChain, run)
+	}
+}
+
+// execute runs a cron task, retrying failed runs according to the retry
+// policy of the task, and returns the last run. It returns nil if the task
+// is already running or the scheduler stopped while waiting to retry.
+func (m *Manager) execute(task *Task, trigger string, upstream *Run) *Run {
 	// prevent concurrent execution of the same task
 	if !task.mu.TryLock() {
 		slog.Warn("cron task already running, skipping", "name", task.Name)
-		return
+		metrics.CronExecutions.WithLabelValues(task.Name, metrics.StatusSkipped).Inc()
+		return nil
 	}
 	defer task.mu.Unlock()
 
-	slog.Info("executing cron task", "name", task.Name, "one_shot", task.OneShot)
+	slog.Info("executing cron task", "name", task.Name, "one_shot", task.OneShot, "trigger", trigger)
 
-	// update last run time
-	now := time.Now()
-	task.LastRun = &now
-	if err := task.UpdateMeta(m.cronsDir); err != nil {
-		slog.Error("failed to update task meta", "name", task.Name, "error", err)
+	ctx := context.Background()
+	var run *Run
+	for attempt := 1; ; attempt++ {
+		run = m.runOnce(ctx, task, trigger, attempt, upstream)
+
+		retry := run.Status == RunStatusFailed && attempt <= task.Retry.GetMaxRetries()
+		var delay time.Duration
+		if retry {
+			delay = task.Retry.Delay(attempt)
+			next := run.EndedAt.Add(delay)
+			run.NextRetry = &next
+		}
+		m.recordRun(task, run)
+		if !retry {
+			break
+		}
+
+		slog.Warn("cron task failed, retrying",
+			"name", task.Name,
+			"attempt", attempt,
+			"delay", delay,
+			"error", run.Error,
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-m.stopCh:
+			timer.Stop()
+			slog.Info("cron scheduler stopped, abort retrying", "name", task.Name)
+			return nil
+		}
+		trigger = TriggerRetry
 	}
 
-	if m.handler != nil {
-		ctx := context.Background()
-		m.handler(ctx, task)
+	if run.Status == RunStatusFailed && task.NotifyOnFailure && m.failureHandler != nil {
+		m.failureHandler(ctx, task, run)
 	}
 
 	// auto-disable one-shot tasks after execution
-	if task.OneShot {
+	if task.IsOneShot() {
 		slog.Info("disabling one-shot task after execution", "name", task.Name)
 		task.Enabled = false
 		m.unscheduleTask(task.Name)
@@ -188,14 +277,84 @@ func (m *Manager) executeTask(task *Task) {
 			slog.Error("failed to disable one-shot task", "name", task.Name, "error", err)
 		}
 	}
+	return run
+}
+
+// runOnce runs the handler once and returns the unsaved run record.
+func (m *Manager) runOnce(ctx context.Context, task *Task, trigger string, attempt int, upstream *Run) *Run {
+	run := task.NewRun(trigger, attempt)
+	if upstream != nil {
+		run.Upstream = upstream.Task + "/" + upstream.Id
+		run.ChainDepth = upstream.ChainDepth + 1
+	}
+
+	// update last run time
+	startedAt := run.StartedAt
+	task.LastRun = &startedAt
+	if err := task.UpdateMeta(m.cronsDir); err != nil {
+		slog.Error("failed to update task meta", "name", task.Name, "error", err)
+	}
+
+	var outcome *Outcome
+	req, err := task.NewRunRequest(upstream)
+	switch {
+	case err != nil:
+		outcome = &Outcome{Err: err}
+	case m.handler != nil:
+		outcome = m.handler(ctx, task, req)
+	default:
+		outcome = &Outcome{Err: fmt.Errorf("no handler for cron tasks")}
+	}
+	run.Finish(outcome)
+	return run
+}
+
+// recordRun saves the run and the status of the task.
+func (m *Manager) recordRun(task *Task, run *Run) {
+	task.LastStatus = run.Status
+	if err := task.UpdateMeta(m.cronsDir); err != nil {
+		slog.Error("failed to update task meta", "name", task.Name, "error", err)
+	}
+	if err := task.SaveRun(run); err != nil {
+		slog.Error("failed to save cron run", "name", task.Name, "run", run.Id, "error", err)
+	}
+}
+
+// RunTask triggers a task once in the background regardless of its schedule.
+func (m *Manager) RunTask(taskName string) error {
+	task, exists := m.GetTask(taskName)
+	if !exists {
+		return fmt.Errorf("task %s not found", taskName)
+	}
+
+	safe.Go(func() {
+		m.executeTask(task, TriggerManual, nil)
+	})
+
+	return nil
 }
 
 // AddOrUpdateTask adds a new cron task or updates an existing one
 // If the scheduler is running, the task will be scheduled immediately
 func (m *Manager) AddOrUpdateTask(task *Task) (updated bool, err error) {
-	// validate cron expression
-	if _, err := cron.ParseStandard(task.CronExpr); err != nil {
-		return false, fmt.Errorf("invalid cron expression: %w", err)
+	// validate the schedule, resolving relative times first
+	spec, err := NormalizeSpec(task.CronExpr, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("invalid schedule: %w", err)
+	}
+	task.CronExpr = spec
+	schedule, err := task.Schedule()
+	if err != nil {
+		return false, fmt.Errorf("invalid schedule: %w", err)
+	}
+	if task.Enabled && schedule.Next(time.Now()).IsZero() {
+		return false, fmt.Errorf("invalid schedule: %s has no run in the future", task.CronExpr)
+	}
+	if err := task.validateChain(); err != nil {
+		return false, err
+	}
+	if err := task.Retry.Validate(); err != nil {
+		return false, fmt.Errorf("invalid retry policy: %w", err)
 	}
 
 	m.mu.Lock()
@@ -308,14 +467,18 @@ func (m *Manager) GetNextRun(taskName string) (time.Time, bool) {
 	// if scheduled, use entry's next time
 	if exists {
 		entry := m.cron.Entry(entryID)
-		return entry.Next, true
+		if !entry.Next.IsZero() {
+			return entry.Next, true
+		}
 	}
 
-	// otherwise, calculate from cron expression
+	// otherwise, calculate from the schedule
 	if taskExists && task.Enabled {
-		schedule, err := cron.ParseStandard(task.CronExpr)
+		schedule, err := task.Schedule()
 		if err == nil {
-			return schedule.Next(time.Now()), true
+			if next := schedule.Next(time.Now()); !next.IsZero() {
+				return next, true
+			}
 		}
 	}
 
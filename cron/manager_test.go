@@ -0,0 +1,118 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	return &Manager{
+		cronsDir: t.TempDir(),
+		cron:     cron.New(),
+		tasks:    make(map[string]*Task),
+		entryIDs: make(map[string]cron.EntryID),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func TestExecuteTaskRetriesAndNotifies(t *testing.T) {
+	m := newTestManager(t)
+	task := NewTask("report", "0 9 * * *", "daily report",
+		WithRetry(&RetryPolicy{MaxRetries: 2, Backoff: "1ms"}),
+		WithFailureNotify("lark", "oc_1"),
+	)
+	if _, err := m.AddOrUpdateTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	m.SetHandler(func(ctx context.Context, task *Task, req *RunRequest) *Outcome {
+		calls++
+		if calls < 3 {
+			return &Outcome{Result: "(failed to call llm)", Err: errors.New("llm unavailable")}
+		}
+		return &Outcome{Result: "done", Usage: Usage{TotalTokens: 42}}
+	})
+	notified := 0
+	m.SetFailureHandler(func(ctx context.Context, task *Task, run *Run) { notified++ })
+
+	m.executeTask(task, TriggerManual, nil)
+
+	runs, err := task.ListRuns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || notified != 0 {
+		t.Fatalf("runs=%d notified=%d", len(runs), notified)
+	}
+	for i, run := range runs {
+		if run.Attempt != i+1 {
+			t.Errorf("run %d has attempt %d", i, run.Attempt)
+		}
+	}
+	if runs[0].Status != RunStatusFailed || runs[0].NextRetry == nil || runs[1].Trigger != TriggerRetry {
+		t.Errorf("unexpected first runs: %+v %+v", runs[0], runs[1])
+	}
+	last, _ := task.LatestRun()
+	if last.Status != RunStatusOK || last.Result != "done" || last.Usage.TotalTokens != 42 {
+		t.Errorf("unexpected last run: %+v", last)
+	}
+	if task.LastStatus != RunStatusOK {
+		t.Errorf("last status = %s", task.LastStatus)
+	}
+
+	// a run failing after all retries is notified once
+	m.SetHandler(func(ctx context.Context, task *Task, req *RunRequest) *Outcome {
+		return &Outcome{Err: errors.New("boom")}
+	})
+	m.executeTask(task, TriggerSchedule, nil)
+	if notified != 1 {
+		t.Errorf("notified = %d, want 1", notified)
+	}
+	loaded, err := LoadTask(task.taskDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.LastStatus != RunStatusFailed {
+		t.Errorf("persisted last status = %s", loaded.LastStatus)
+	}
+}
+
+func TestGetRunByPrefix(t *testing.T) {
+	m := newTestManager(t)
+	task := NewTask("report", "0 9 * * *", "daily report")
+	if _, err := m.AddOrUpdateTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	run := task.NewRun(TriggerManual, 1)
+	run.Finish(&Outcome{Result: "ok"})
+	if err := task.SaveRun(run); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := task.GetRun(run.Id[:15])
+	if err != nil || got.Id != run.Id {
+		t.Fatalf("get by prefix: %v %v", got, err)
+	}
+	if _, err := task.GetRun("../meta"); err == nil {
+		t.Error("expected an error for an invalid id")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{MaxRetries: 5, Backoff: "10s", MaxBackoff: "30s"}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("delay of retry %d = %s, want %s", i+1, got, w)
+		}
+	}
+	if err := (&RetryPolicy{Backoff: "soon"}).Validate(); err == nil {
+		t.Error("expected an invalid backoff")
+	}
+}
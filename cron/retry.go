@@ -0,0 +1,67 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = 30 * time.Second
+	defaultRetryMaxBackoff = 10 * time.Minute
+)
+
+// RetryPolicy retries failed runs with exponential backoff.
+type RetryPolicy struct {
+	MaxRetries int `json:"max_retries"`
+	// Backoff is the delay before the first retry, doubled for each further
+	// retry. Default is 30s.
+	Backoff string `json:"backoff,omitempty"`
+	// MaxBackoff caps the delay. Default is 10m.
+	MaxBackoff string `json:"max_backoff,omitempty"`
+}
+
+// Validate checks the durations of the policy.
+func (p *RetryPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative")
+	}
+	for _, d := range []string{p.Backoff, p.MaxBackoff} {
+		if d == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+			return fmt.Errorf("invalid retry backoff %q", d)
+		}
+	}
+	return nil
+}
+
+// GetMaxRetries returns the number of retries after a failed run.
+func (p *RetryPolicy) GetMaxRetries() int {
+	if p == nil {
+		return 0
+	}
+	return p.MaxRetries
+}
+
+// Delay returns the delay before the given retry, starting from 1.
+func (p *RetryPolicy) Delay(retry int) time.Duration {
+	backoff := parseDurationOr(p.Backoff, defaultRetryBackoff)
+	maxBackoff := parseDurationOr(p.MaxBackoff, defaultRetryMaxBackoff)
+
+	delay := backoff
+	for i := 1; i < retry && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+func parseDurationOr(s string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,253 @@
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	runsDirName = "runs"
+
+	// maxKeptRuns is the number of run records kept for each task, older
+	// records are removed when a new run is saved.
+	maxKeptRuns = 200
+)
+
+// RunStatus is the outcome of a task execution.
+type RunStatus string
+
+const (
+	RunStatusOK        RunStatus = "ok"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusCancelled RunStatus = "cancelled"
+)
+
+// Usage is the token usage of a run.
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// Outcome is reported by the TaskHandler for one execution of a task.
+type Outcome struct {
+	Agent  string
+	Result string
+	Err    error // the run failed and may be retried
+	Usage  Usage
+
+	Delivered   bool
+	Suppressed  string // why the condition of the task prevented the delivery
+	DeliveryErr error  // delivery of a successful result failed, not retried
+}
+
+// Run records one execution of a task. Retries of a failed execution are
+// recorded as separate runs with increasing attempts.
+type Run struct {
+	Id         string    `json:"id"`
+	Task       string    `json:"task"`
+	Agent      string    `json:"agent,omitempty"`
+	ChatId     string    `json:"chat_id"`
+	Trigger    string    `json:"trigger"` // schedule, manual, retry or chain
+	Attempt    int       `json:"attempt"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Status     RunStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Result     string    `json:"result"`
+	Usage      Usage     `json:"usage"`
+
+	// Upstream is the task and run id which triggered a chained run
+	Upstream   string `json:"upstream,omitempty"`
+	ChainDepth int    `json:"chain_depth,omitempty"`
+
+	Delivered bool `json:"delivered,omitempty"`
+	// Suppressed is why the condition of the task prevented the delivery
+	Suppressed    string     `json:"suppressed,omitempty"`
+	DeliveryError string     `json:"delivery_error,omitempty"`
+	NextRetry     *time.Time `json:"next_retry,omitempty"`
+}
+
+// Run triggers.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+	TriggerRetry    = "retry"
+	TriggerChain    = "chain"
+)
+
+// newRunId returns a run id which sorts by start time.
+func newRunId(startedAt time.Time) string {
+	return startedAt.UTC().Format("20060102T150405.000000Z")
+}
+
+// NewRun starts the record of an execution of the task.
+func (t *Task) NewRun(trigger string, attempt int) *Run {
+	now := time.Now()
+	return &Run{
+		Id:        newRunId(now),
+		Task:      t.Name,
+		Agent:     t.AgentName,
+		ChatId:    t.ChatId(),
+		Trigger:   trigger,
+		Attempt:   attempt,
+		StartedAt: now,
+	}
+}
+
+// Finish completes the run with the outcome of the handler.
+func (r *Run) Finish(outcome *Outcome) {
+	r.EndedAt = time.Now()
+	r.DurationMs = r.EndedAt.Sub(r.StartedAt).Milliseconds()
+	if outcome == nil {
+		outcome = &Outcome{Err: errors.New("no outcome reported")}
+	}
+	if outcome.Agent != "" {
+		r.Agent = outcome.Agent
+	}
+	r.Result = outcome.Result
+	r.Usage = outcome.Usage
+	r.Delivered = outcome.Delivered
+	r.Suppressed = outcome.Suppressed
+	if outcome.DeliveryErr != nil {
+		r.DeliveryError = outcome.DeliveryErr.Error()
+	}
+
+	switch {
+	case outcome.Err == nil:
+		r.Status = RunStatusOK
+	case errors.Is(outcome.Err, context.Canceled):
+		r.Status = RunStatusCancelled
+		r.Error = outcome.Err.Error()
+	default:
+		r.Status = RunStatusFailed
+		r.Error = outcome.Err.Error()
+	}
+}
+
+func (t *Task) runsDir() string {
+	return filepath.Join(t.taskDir, runsDirName)
+}
+
+// SaveRun writes the run record to the runs directory of the task and
+// removes the oldest records beyond maxKeptRuns.
+func (t *Task) SaveRun(run *Run) error {
+	if t.taskDir == "" {
+		return fmt.Errorf("task %s is not saved", t.Name)
+	}
+	dir := t.runsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create runs directory: %w", err)
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, run.Id+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	return t.pruneRuns()
+}
+
+// runIds returns ids of the recorded runs, oldest first.
+func (t *Task) runIds() ([]string, error) {
+	entries, err := os.ReadDir(t.runsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runs directory: %w", err)
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (t *Task) pruneRuns() error {
+	ids, err := t.runIds()
+	if err != nil {
+		return err
+	}
+	for len(ids) > maxKeptRuns {
+		if err := os.Remove(filepath.Join(t.runsDir(), ids[0]+".json")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old run: %w", err)
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// ListRuns returns the recorded runs of the task, oldest first.
+func (t *Task) ListRuns() ([]*Run, error) {
+	ids, err := t.runIds()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*Run, 0, len(ids))
+	for _, id := range ids {
+		run, err := t.GetRun(id)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// GetRun returns the run with the id. Unique prefixes of ids are accepted.
+func (t *Task) GetRun(id string) (*Run, error) {
+	if strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid run id %s", id)
+	}
+	data, err := os.ReadFile(filepath.Join(t.runsDir(), id+".json"))
+	if os.IsNotExist(err) {
+		ids, lerr := t.runIds()
+		if lerr != nil {
+			return nil, lerr
+		}
+		var matched []string
+		for _, rid := range ids {
+			if strings.HasPrefix(rid, id) {
+				matched = append(matched, rid)
+			}
+		}
+		switch len(matched) {
+		case 0:
+			return nil, fmt.Errorf("run %s of task %s not found", id, t.Name)
+		case 1:
+			return t.GetRun(matched[0])
+		default:
+			return nil, fmt.Errorf("run id %s is ambiguous, %d runs match", id, len(matched))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run: %w", err)
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+// LatestRun returns the most recent run of the task, or nil if it never ran.
+func (t *Task) LatestRun() (*Run, error) {
+	ids, err := t.runIds()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return t.GetRun(ids[len(ids)-1])
+}
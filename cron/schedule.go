@@ -0,0 +1,427 @@
+package cron
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// A schedule spec is one of:
+//
+//   - a 5-field cron expression or descriptor, e.g. "0 9 * * *" or "@daily"
+//   - a fixed interval, e.g. "every 90m" or "every 2 hours"
+//   - an absolute time to run once, e.g. "at 2026-11-01T09:00 Asia/Shanghai"
+//   - a delay to run once, e.g. "in 2h", which is resolved to an absolute
+//     time when the task is saved
+const (
+	specEvery = "every "
+	specAt    = "at "
+	specIn    = "in "
+)
+
+// maxScheduleSkips bounds the search of a run time outside blackout windows.
+const maxScheduleSkips = 10000
+
+var atLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// parseHumanDuration parses Go durations such as 1h30m and phrases such as
+// "2 hours", "90 minutes" or "day".
+func parseHumanDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	fields := strings.Fields(s)
+	n := 1.0
+	switch len(fields) {
+	case 1:
+		// "day", or "3d" which ParseDuration does not know
+		unit := strings.TrimLeft(fields[0], "0123456789.")
+		if num := strings.TrimSuffix(fields[0], unit); num != "" {
+			v, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			n = v
+		}
+		fields = []string{unit}
+	case 2:
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		n = v
+		fields = fields[1:]
+	default:
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	unit, ok := durationUnits[fields[0]]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// loadLocation returns the location of a timezone name, Local if empty.
+func loadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", tz, err)
+	}
+	return loc, nil
+}
+
+// parseAt parses the time of an "at" spec: RFC3339, or a local date time
+// optionally followed by a timezone name.
+func parseAt(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	value := s
+	if i := strings.LastIndexByte(s, ' '); i > 0 {
+		if l, err := time.LoadLocation(s[i+1:]); err == nil {
+			loc = l
+			value = strings.TrimSpace(s[:i])
+		}
+	}
+	for _, layout := range atLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected e.g. 2026-11-01T09:00 Asia/Shanghai", s)
+}
+
+// ParseTime parses a time written as in an "at" spec, in the timezone tz
+// unless the time names its own.
+func ParseTime(s, tz string) (time.Time, error) {
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseAt(s, loc)
+}
+
+// NormalizeSpec resolves relative specs ("in 2h") against now, so that the
+// stored spec keeps its meaning across restarts. Other specs are returned
+// trimmed.
+func NormalizeSpec(spec string, now time.Time) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := cutPrefixFold(spec, specIn); ok {
+		d, err := parseHumanDuration(rest)
+		if err != nil {
+			return "", err
+		}
+		if d <= 0 {
+			return "", fmt.Errorf("delay must be positive")
+		}
+		return specAt + now.Add(d).Truncate(time.Second).Format(time.RFC3339), nil
+	}
+	return spec, nil
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return strings.TrimSpace(s[len(prefix):]), true
+	}
+	return s, false
+}
+
+// Window is a daily blackout window in the timezone of the task. A window
+// whose end is before its start spans midnight. Days limits the window to
+// some weekdays (mon, tue, ...), the day being the one the window starts.
+type Window struct {
+	From string   `json:"from"` // HH:MM
+	To   string   `json:"to"`   // HH:MM, 24:00 for the end of the day
+	Days []string `json:"days,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWindow parses a window written as "[days ]HH:MM-HH:MM", e.g.
+// "22:00-07:00" or "sat,sun 00:00-24:00".
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+	case 2:
+		w.Days = strings.Split(strings.ToLower(fields[0]), ",")
+		fields = fields[1:]
+	default:
+		return w, fmt.Errorf("invalid window %q, expected [days ]HH:MM-HH:MM", s)
+	}
+	from, to, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return w, fmt.Errorf("invalid window %q, expected [days ]HH:MM-HH:MM", s)
+	}
+	w.From, w.To = from, to
+	return w, w.Validate()
+}
+
+func (w Window) String() string {
+	s := w.From + "-" + w.To
+	if len(w.Days) > 0 {
+		s = strings.Join(w.Days, ",") + " " + s
+	}
+	return s
+}
+
+// Validate checks the times and days of the window.
+func (w Window) Validate() error {
+	from, err := parseClock(w.From)
+	if err != nil {
+		return err
+	}
+	to, err := parseClock(w.To)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("window %s is empty", w)
+	}
+	for _, d := range w.Days {
+		if _, ok := weekdays[d]; !ok {
+			return fmt.Errorf("invalid weekday %q in window %s", d, w)
+		}
+	}
+	return nil
+}
+
+// parseClock returns the minutes of the day of HH:MM.
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, herr := strconv.Atoi(h)
+	minute, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hour < 0 || minute < 0 || minute > 59 ||
+		hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return hour*60 + minute, nil
+}
+
+func (w Window) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(w.Days, func(d string) bool { return weekdays[d] == day })
+}
+
+// Contains reports whether t, in the timezone of the task, is inside the window.
+func (w Window) Contains(t time.Time) bool {
+	from, _ := parseClock(w.From)
+	to, _ := parseClock(w.To)
+	minutes := t.Hour()*60 + t.Minute()
+	if from < to {
+		return minutes >= from && minutes < to && w.onDay(t.Weekday())
+	}
+	// spans midnight
+	return (minutes >= from && w.onDay(t.Weekday())) ||
+		(minutes < to && w.onDay((t.Weekday()+6)%7))
+}
+
+// end returns when the window containing t ends, in the timezone of t.
+func (w Window) end(t time.Time) time.Time {
+	from, _ := parseClock(w.From)
+	to, _ := parseClock(w.To)
+	day := t.Day()
+	if from > to && t.Hour()*60+t.Minute() >= from {
+		// ends the next day
+		day++
+	}
+	return time.Date(t.Year(), t.Month(), day, 0, to, 0, 0, t.Location())
+}
+
+// Schedule computes run times of a task. It implements cron.Schedule.
+type Schedule struct {
+	base      cron.Schedule
+	every     time.Duration // interval of "every" schedules
+	once      bool
+	loc       *time.Location
+	startAt   *time.Time
+	endAt     *time.Time
+	blackouts []Window
+}
+
+// onceSchedule fires at a single time.
+type onceSchedule struct {
+	at time.Time
+}
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if s.at.After(t) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+// ParseSchedule parses a schedule spec in the timezone tz, Local if empty.
+func ParseSchedule(spec, tz string) (*Schedule, error) {
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+	spec = strings.TrimSpace(spec)
+	s := &Schedule{loc: loc}
+
+	switch {
+	case spec == "":
+		return nil, fmt.Errorf("empty schedule")
+	case strings.HasPrefix(spec, "@every "):
+		spec = specEvery + strings.TrimPrefix(spec, "@every ")
+		fallthrough
+	case hasPrefixFold(spec, specEvery):
+		rest, _ := cutPrefixFold(spec, specEvery)
+		d, err := parseHumanDuration(rest)
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("interval must be at least 1s")
+		}
+		s.base = cron.Every(d)
+		s.every = d
+	case hasPrefixFold(spec, specAt):
+		rest, _ := cutPrefixFold(spec, specAt)
+		at, err := parseAt(rest, loc)
+		if err != nil {
+			return nil, err
+		}
+		s.base = onceSchedule{at: at}
+		s.once = true
+	case hasPrefixFold(spec, specIn):
+		return nil, fmt.Errorf("relative schedule %q must be normalized first", spec)
+	default:
+		base, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression: %w", err)
+		}
+		// expressions without CRON_TZ= follow the timezone of the task
+		if sched, ok := base.(*cron.SpecSchedule); ok && !hasTZPrefix(spec) {
+			sched.Location = loc
+		}
+		s.base = base
+	}
+	return s, nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	_, ok := cutPrefixFold(s, prefix)
+	return ok
+}
+
+func hasTZPrefix(spec string) bool {
+	return strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=")
+}
+
+// Once reports whether the schedule fires a single time.
+func (s *Schedule) Once() bool {
+	return s.once
+}
+
+// Next returns the first run time after t, zero if there is none.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.startAt != nil && t.Before(*s.startAt) {
+		t = s.startAt.Add(-time.Second)
+	}
+	for range maxScheduleSkips {
+		next := s.nextBase(t)
+		if next.IsZero() {
+			return next
+		}
+		if s.endAt != nil && next.After(*s.endAt) {
+			return time.Time{}
+		}
+		end := s.blackoutEnd(next)
+		if end.IsZero() {
+			return next
+		}
+		// skip the rest of the window at once, stepping through it would use
+		// up the skips with short intervals
+		t = next
+		if skipTo := end.Add(-time.Second); skipTo.After(t) {
+			t = skipTo
+		}
+	}
+	return time.Time{}
+}
+
+// nextBase returns the first time of the base schedule after t. Intervals
+// with a start time fire at the start plus a multiple of the interval, so that
+// runs do not drift away from it.
+func (s *Schedule) nextBase(t time.Time) time.Time {
+	if s.every == 0 || s.startAt == nil {
+		return s.base.Next(t)
+	}
+	if t.Before(*s.startAt) {
+		return *s.startAt
+	}
+	return s.startAt.Add((t.Sub(*s.startAt)/s.every + 1) * s.every)
+}
+
+// blackoutEnd returns when the blackout windows containing t end, zero if t
+// is in none.
+func (s *Schedule) blackoutEnd(t time.Time) time.Time {
+	local := t.In(s.loc)
+	var end time.Time
+	for _, w := range s.blackouts {
+		if w.Contains(local) {
+			if e := w.end(local); e.After(end) {
+				end = e
+			}
+		}
+	}
+	return end
+}
+
+// NextN returns up to n run times after t.
+func (s *Schedule) NextN(t time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for len(times) < n {
+		t = s.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// Location returns the timezone of the schedule.
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// jitterDelay returns a random delay up to the jitter.
+func jitterDelay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return rand.N(jitter)
+}
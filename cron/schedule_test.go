@@ -0,0 +1,202 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustSchedule(t *testing.T, task *Task) *Schedule {
+	t.Helper()
+	s, err := task.Schedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 18, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		tz   string
+		want time.Time
+		once bool
+	}{
+		{"every 90m", "", now.Add(90 * time.Minute), false},
+		{"every 2 hours", "", now.Add(2 * time.Hour), false},
+		{"@every 1d", "", now.Add(24 * time.Hour), false},
+		{"0 9 * * *", "UTC", time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), false},
+		{"0 9 * * *", "Asia/Shanghai", time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), false},
+		{"CRON_TZ=UTC 0 9 * * *", "Asia/Shanghai", time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), false},
+		{"at 2026-11-01T09:00 Asia/Shanghai", "", time.Date(2026, 11, 1, 1, 0, 0, 0, time.UTC), true},
+		{"at 2026-11-01 09:00", "UTC", time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC), true},
+		{"at 2026-10-18T08:00:00Z", "", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec, tt.tz)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(now); !got.Equal(tt.want) {
+			t.Errorf("%s (%s): next = %s, want %s", tt.spec, tt.tz, got, tt.want)
+		}
+		if s.Once() != tt.once {
+			t.Errorf("%s: once = %v", tt.spec, s.Once())
+		}
+	}
+
+	for _, spec := range []string{"", "every soon", "at tomorrow", "in 2h", "61 * * * *"} {
+		if _, err := ParseSchedule(spec, ""); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+	if _, err := ParseSchedule("0 9 * * *", "Mars/Olympus"); err == nil {
+		t.Error("expected an invalid timezone")
+	}
+}
+
+func TestNormalizeSpec(t *testing.T) {
+	now := time.Date(2026, 10, 18, 8, 30, 15, 0, time.UTC)
+	spec, err := NormalizeSpec("in 2 hours", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec != "at 2026-10-18T10:30:15Z" {
+		t.Errorf("spec = %s", spec)
+	}
+	if spec, _ := NormalizeSpec(" 0 9 * * * ", now); spec != "0 9 * * *" {
+		t.Errorf("spec = %q", spec)
+	}
+	if _, err := NormalizeSpec("in -1h", now); err == nil {
+		t.Error("expected an error for a negative delay")
+	}
+}
+
+func TestScheduleWindows(t *testing.T) {
+	now := time.Date(2026, 10, 16, 20, 30, 0, 0, time.UTC) // Friday
+
+	// hourly, but not at night
+	task := NewTask("t", "0 * * * *", "", WithTimezone("UTC"), WithBlackouts(Window{From: "22:00", To: "07:00"}))
+	got := mustSchedule(t, task).NextN(now, 3)
+	want := []time.Time{
+		time.Date(2026, 10, 16, 21, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 17, 7, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC),
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("run %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	// daily, not on weekends, within an active range
+	weekend, err := ParseWindow("sat,sun 00:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)
+	task = NewTask("t", "0 9 * * *", "", WithTimezone("UTC"), WithBlackouts(weekend), WithActiveRange(&start, &end))
+	got = mustSchedule(t, task).NextN(now, 5)
+	want = []time.Time{
+		time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("runs = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("run %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestShortIntervalLongBlackout(t *testing.T) {
+	night := Window{From: "22:00", To: "08:00"}
+	now := time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC)
+
+	// ten hours of one second runs are skipped at once
+	s := mustSchedule(t, NewTask("t", "every 1s", "", WithTimezone("UTC"), WithBlackouts(night)))
+	if got, want := s.Next(now), time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next = %s, want %s", got, want)
+	}
+
+	// runs after the window stay aligned to the start
+	start := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	s = mustSchedule(t, NewTask("t", "every 90m", "", WithTimezone("UTC"), WithBlackouts(night), WithActiveRange(&start, nil)))
+	if got, want := s.Next(now.Add(-time.Hour)), time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next = %s, want %s", got, want)
+	}
+}
+
+func TestIntervalAlignedToStart(t *testing.T) {
+	start := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	s := mustSchedule(t, NewTask("t", "every 90m", "", WithActiveRange(&start, nil)))
+
+	if got := s.Next(start.Add(-time.Hour)); !got.Equal(start) {
+		t.Errorf("first run = %s, want the start %s", got, start)
+	}
+
+	now := time.Date(2026, 10, 18, 10, 17, 23, 0, time.UTC)
+	got := s.NextN(now, 3)
+	want := []time.Time{
+		start.Add(3 * time.Hour),
+		start.Add(270 * time.Minute),
+		start.Add(6 * time.Hour),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("runs = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("run %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	// a run on time is followed by the next multiple
+	if got := s.Next(start.Add(3 * time.Hour)); !got.Equal(start.Add(270 * time.Minute)) {
+		t.Errorf("next after a run = %s", got)
+	}
+}
+
+func TestWindowSpansMidnight(t *testing.T) {
+	w, err := ParseWindow("fri 22:00-07:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	friNight := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	satMorning := time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC)
+	sunMorning := time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)
+	if !w.Contains(friNight) || !w.Contains(satMorning) || w.Contains(sunMorning) {
+		t.Errorf("unexpected window matches")
+	}
+
+	for _, s := range []string{"22:00", "25:00-07:00", "mon 07:00-07:00", "xyz 01:00-02:00"} {
+		if _, err := ParseWindow(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestAddTaskNormalizesSchedule(t *testing.T) {
+	m := newTestManager(t)
+	task := NewTask("reminder", "in 2h", "stand up")
+	if _, err := m.AddOrUpdateTask(task); err != nil {
+		t.Fatal(err)
+	}
+	if !task.IsOneShot() {
+		t.Error("a delayed task should run once")
+	}
+	next, ok := m.GetNextRun("reminder")
+	if !ok || next.Sub(time.Now()) < 119*time.Minute || next.Sub(time.Now()) > 2*time.Hour {
+		t.Errorf("next run = %s %v", next, ok)
+	}
+
+	past := NewTask("past", "at 2020-01-01T00:00:00Z", "too late")
+	if _, err := m.AddOrUpdateTask(past); err == nil {
+		t.Error("expected an error for a time in the past")
+	}
+}
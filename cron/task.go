@@ -18,19 +18,49 @@ const (
 
 // Task represents a cron task
 type Task struct {
-	Name      string     `json:"name"`
-	AgentName string     `json:"agent_name,omitempty"`
+	Name      string `json:"name"`
+	AgentName string `json:"agent_name,omitempty"`
+	// CronExpr is the schedule spec: a cron expression, an interval such as
+	// "every 90m", or a time to run once such as "at 2026-11-01T09:00"
 	CronExpr  string     `json:"cron_expr"`
 	Enabled   bool       `json:"enabled"`
 	OneShot   bool       `json:"one_shot,omitempty"` // run once then disable
 	CreatedAt time.Time  `json:"created_at"`
 	LastRun   *time.Time `json:"last_run,omitempty"`
 
+	// Timezone of the schedule, e.g. Asia/Shanghai, the local timezone if empty
+	Timezone string `json:"timezone,omitempty"`
+	// Jitter delays each scheduled run by a random duration up to it
+	Jitter string `json:"jitter,omitempty"`
+	// the task only runs between StartAt and EndAt when they are set
+	StartAt *time.Time `json:"start_at,omitempty"`
+	EndAt   *time.Time `json:"end_at,omitempty"`
+	// runs falling into blackout windows are skipped
+	Blackouts []Window `json:"blackouts,omitempty"`
+	// LastStatus is the status of the latest run
+	LastStatus RunStatus `json:"last_status,omitempty"`
+
 	// delivery settings
 	Deliver        bool         `json:"deliver"`
 	DeliverChannel chmodel.Type `json:"deliver_channel,omitempty"`
 	DeliverTo      string       `json:"deliver_to,omitempty"`
 
+	// DeliverIf decides whether a successful result is delivered at all
+	DeliverIf *Condition `json:"deliver_if,omitempty"`
+
+	// tasks triggered once a run succeeded or failed after all retries. The
+	// prompts of triggered tasks can use the run as {{.Upstream}}.
+	OnSuccess []string `json:"on_success,omitempty"`
+	OnFailure []string `json:"on_failure,omitempty"`
+
+	// Retry retries failed runs, nil disables retries
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// failure notification, sent once a run failed after all retries
+	NotifyOnFailure bool         `json:"notify_on_failure,omitempty"`
+	NotifyChannel   chmodel.Type `json:"notify_channel,omitempty"`
+	NotifyTo        string       `json:"notify_to,omitempty"`
+
 	// runtime fields, not persisted
 	prompt  string     `json:"-"`
 	taskDir string     `json:"-"`
@@ -49,6 +79,67 @@ func WithDelivery(channel chmodel.Type, to string) TaskOption {
 	}
 }
 
+// WithDeliverIf delivers results only when the condition holds
+func WithDeliverIf(cond *Condition) TaskOption {
+	return func(t *Task) {
+		t.DeliverIf = cond
+	}
+}
+
+// WithChain triggers other tasks after a run succeeded or failed
+func WithChain(onSuccess, onFailure []string) TaskOption {
+	return func(t *Task) {
+		t.OnSuccess = onSuccess
+		t.OnFailure = onFailure
+	}
+}
+
+// WithRetry retries failed runs with the policy
+func WithRetry(policy *RetryPolicy) TaskOption {
+	return func(t *Task) {
+		t.Retry = policy
+	}
+}
+
+// WithFailureNotify sends a notice to a channel when a run failed after all
+// retries. It is independent of the result delivery.
+func WithFailureNotify(channel chmodel.Type, to string) TaskOption {
+	return func(t *Task) {
+		t.NotifyOnFailure = true
+		t.NotifyChannel = channel
+		t.NotifyTo = to
+	}
+}
+
+// WithTimezone sets the timezone of the schedule
+func WithTimezone(tz string) TaskOption {
+	return func(t *Task) {
+		t.Timezone = tz
+	}
+}
+
+// WithJitter delays each scheduled run by a random duration up to jitter
+func WithJitter(jitter string) TaskOption {
+	return func(t *Task) {
+		t.Jitter = jitter
+	}
+}
+
+// WithActiveRange limits runs to the range, nil bounds are open
+func WithActiveRange(start, end *time.Time) TaskOption {
+	return func(t *Task) {
+		t.StartAt = start
+		t.EndAt = end
+	}
+}
+
+// WithBlackouts skips runs falling into the windows
+func WithBlackouts(windows ...Window) TaskOption {
+	return func(t *Task) {
+		t.Blackouts = windows
+	}
+}
+
 // WithAgent sets task owner agent name.
 func WithAgent(agentName string) TaskOption {
 	return func(t *Task) {
@@ -83,6 +174,47 @@ func (t *Task) ChatId() string {
 	return t.Name
 }
 
+// Schedule parses the schedule of the task.
+func (t *Task) Schedule() (*Schedule, error) {
+	sched, err := ParseSchedule(t.CronExpr, t.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	if t.StartAt != nil && t.EndAt != nil && !t.EndAt.After(*t.StartAt) {
+		return nil, fmt.Errorf("end time must be after start time")
+	}
+	for _, w := range t.Blackouts {
+		if err := w.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if t.Jitter != "" {
+		if d, err := time.ParseDuration(t.Jitter); err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid jitter %q", t.Jitter)
+		}
+	}
+	sched.startAt = t.StartAt
+	sched.endAt = t.EndAt
+	sched.blackouts = t.Blackouts
+	return sched, nil
+}
+
+// IsOneShot reports whether the task is disabled after its first run, either
+// by the OneShot flag or by an "at" schedule.
+func (t *Task) IsOneShot() bool {
+	if t.OneShot {
+		return true
+	}
+	sched, err := ParseSchedule(t.CronExpr, t.Timezone)
+	return err == nil && sched.Once()
+}
+
+// jitter returns the random delay of a scheduled run.
+func (t *Task) jitter() time.Duration {
+	d, _ := time.ParseDuration(t.Jitter)
+	return jitterDelay(d)
+}
+
 // Prompt returns the task's prompt content
 func (t *Task) Prompt() string {
 	return t.prompt
@@ -0,0 +1,498 @@
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/cron"
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
+)
+
+const (
+	adminShutdownWait   = 5 * time.Second
+	adminReadHeaderWait = 10 * time.Second
+	maxAdminBodyBytes   = 1 << 20 // 1MB
+)
+
+// AdminServer is a local http server exposing gateway status and management
+// endpoints. All endpoints except /healthz and /readyz require a bearer token,
+// including the prometheus /metrics endpoint.
+type AdminServer struct {
+	listen string
+	token  string
+
+	gateway *Gateway
+}
+
+func NewAdminServer(gateway *Gateway, cfg *config.AdminConfig) *AdminServer {
+	return &AdminServer{
+		listen:  cfg.GetListen(),
+		token:   cfg.GetToken(),
+		gateway: gateway,
+	}
+}
+
+// Start serves admin requests in a separate goroutine until ctx is done.
+func (s *AdminServer) Start(ctx context.Context) {
+	if s.token == "" {
+		slog.WarnContext(ctx, "admin server is enabled but no token is configured, skipped",
+			slog.String("env", config.AdminTokenEnv))
+		return
+	}
+
+	server := &http.Server{
+		Addr:              s.listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: adminReadHeaderWait,
+	}
+
+	s.gateway.wg.Go(func() {
+		slog.InfoContext(ctx, "admin server started", slog.String("listen", s.listen))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.ErrorContext(ctx, "admin server stopped", slog.Any("error", err))
+		}
+	})
+
+	s.gateway.wg.Go(func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), adminShutdownWait)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	})
+}
+
+func (s *AdminServer) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/agents", s.handleListAgents)
+	api.HandleFunc("GET /api/adapters", s.handleListAdapters)
+	api.HandleFunc("GET /api/mcp", s.handleListMcp)
+
+	api.HandleFunc("GET /api/tasks", s.handleListTasks)
+	api.HandleFunc("POST /api/tasks/{key}/cancel", s.handleCancelTask)
+
+	api.HandleFunc("GET /api/crons", s.handleListCrons)
+	api.HandleFunc("POST /api/crons", s.handlePutCron)
+	api.HandleFunc("GET /api/crons/{name}", s.handleGetCron)
+	api.HandleFunc("DELETE /api/crons/{name}", s.handleDeleteCron)
+	api.HandleFunc("POST /api/crons/{name}/enable", s.handleEnableCron)
+	api.HandleFunc("POST /api/crons/{name}/disable", s.handleDisableCron)
+	api.HandleFunc("POST /api/crons/{name}/run", s.handleRunCron)
+	api.HandleFunc("GET /api/crons/{name}/runs", s.handleListCronRuns)
+	api.HandleFunc("GET /api/crons/{name}/runs/{id}", s.handleGetCronRun)
+
+	api.HandleFunc("GET /api/heartbeats", s.handleListHeartbeats)
+	api.HandleFunc("PUT /api/heartbeats/{agent}", s.handleUpdateHeartbeat)
+
+	api.HandleFunc("POST /api/config/reload", s.handleReloadConfig)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.Handle("/api/", s.requireToken(api))
+	mux.Handle("GET /metrics", s.requireToken(metrics.Handler()))
+
+	return mux
+}
+
+func (s *AdminServer) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeAdminError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, code int, err error) {
+	writeAdminJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func decodeAdminBody(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func (s *AdminServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *AdminServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.gateway.ready.Load() {
+		writeAdminJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+type adminAgentView struct {
+	Name         string `json:"name"`
+	Provider     string `json:"provider"`
+	Model        string `json:"model"`
+	ToolCount    int    `json:"tool_count"`
+	McpToolCount int    `json:"mcp_tool_count"`
+}
+
+func (s *AdminServer) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	names := s.gateway.agentNames()
+	views := make([]adminAgentView, 0, len(names))
+	for _, name := range names {
+		// the agent may have been removed by a reload since listing the names
+		ag := s.gateway.getAgent(name)
+		if ag == nil {
+			continue
+		}
+		views = append(views, adminAgentView{
+			Name:         name,
+			Provider:     ag.GetProvider(),
+			Model:        ag.GetModel(),
+			ToolCount:    ag.GetToolCount(),
+			McpToolCount: ag.GetMcpToolCount(),
+		})
+	}
+	writeAdminJSON(w, http.StatusOK, views)
+}
+
+type adminAdapterView struct {
+	Channel string   `json:"channel"`
+	Account string   `json:"account,omitempty"`
+	Agents  []string `json:"agents"`
+}
+
+func (s *AdminServer) handleListAdapters(w http.ResponseWriter, r *http.Request) {
+	routers := s.gateway.listRouters()
+	views := make([]adminAdapterView, 0, len(routers))
+	for _, router := range routers {
+		views = append(views, adminAdapterView{
+			Channel: router.adapter.Type().String(),
+			Account: router.account,
+			Agents:  router.agentNames(),
+		})
+	}
+	writeAdminJSON(w, http.StatusOK, views)
+}
+
+type adminMcpServerView struct {
+	Agent     string `json:"agent"`
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	ToolCount int    `json:"tool_count"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (s *AdminServer) handleListMcp(w http.ResponseWriter, r *http.Request) {
+	views := make([]adminMcpServerView, 0)
+	for _, name := range s.gateway.agentNames() {
+		ag := s.gateway.getAgent(name)
+		if ag == nil {
+			continue
+		}
+		for _, server := range ag.ListMcpServers() {
+			views = append(views, adminMcpServerView{
+				Agent:     name,
+				Name:      server.Name,
+				OK:        server.OK,
+				ToolCount: server.ToolCount,
+				Error:     server.Error,
+			})
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, views)
+}
+
+type adminTaskView struct {
+	Key     string `json:"key"`
+	Agent   string `json:"agent"`
+	Channel string `json:"channel"`
+	ChatId  string `json:"chat_id"`
+}
+
+func (s *AdminServer) handleListTasks(w http.ResponseWriter, r *http.Request) {
+	keys := s.gateway.runningKeys()
+	views := make([]adminTaskView, 0, len(keys))
+	for _, key := range keys {
+		view := adminTaskView{Key: key}
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) == 3 {
+			view.Agent, view.Channel, view.ChatId = parts[0], parts[1], parts[2]
+		}
+		views = append(views, view)
+	}
+	writeAdminJSON(w, http.StatusOK, views)
+}
+
+func (s *AdminServer) handleCancelTask(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !s.gateway.cancelRunning(key) {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("task %s is not running", key))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]string{"status": "canceled"})
+}
+
+type adminCronView struct {
+	*cron.Task
+	Prompt  string     `json:"prompt"`
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+type adminCronRequest struct {
+	Name    string `json:"name"`
+	Agent   string `json:"agent,omitempty"`
+	Expr    string `json:"expr"`
+	Prompt  string `json:"prompt"`
+	Once    bool   `json:"once,omitempty"`
+	Enabled *bool  `json:"enabled,omitempty"`
+	Deliver *struct {
+		Channel string `json:"channel"`
+		To      string `json:"to"`
+	} `json:"deliver,omitempty"`
+	Timezone        string            `json:"timezone,omitempty"`
+	Jitter          string            `json:"jitter,omitempty"`
+	StartAt         *time.Time        `json:"start_at,omitempty"`
+	EndAt           *time.Time        `json:"end_at,omitempty"`
+	Blackouts       []cron.Window     `json:"blackouts,omitempty"`
+	DeliverIf       *cron.Condition   `json:"deliver_if,omitempty"`
+	OnSuccess       []string          `json:"on_success,omitempty"`
+	OnFailure       []string          `json:"on_failure,omitempty"`
+	Retry           *cron.RetryPolicy `json:"retry,omitempty"`
+	NotifyOnFailure *struct {
+		Channel string `json:"channel"`
+		To      string `json:"to"`
+	} `json:"notify_on_failure,omitempty"`
+}
+
+func (s *AdminServer) cronView(task *cron.Task) adminCronView {
+	view := adminCronView{Task: task, Prompt: task.Prompt()}
+	if next, ok := s.gateway.cronMgr.GetNextRun(task.Name); ok {
+		view.NextRun = &next
+	}
+	return view
+}
+
+func (s *AdminServer) handleListCrons(w http.ResponseWriter, r *http.Request) {
+	tasks := s.gateway.cronMgr.ListTasks()
+	slices.SortFunc(tasks, func(a, b *cron.Task) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	views := make([]adminCronView, 0, len(tasks))
+	for _, task := range tasks {
+		views = append(views, s.cronView(task))
+	}
+	writeAdminJSON(w, http.StatusOK, views)
+}
+
+func (s *AdminServer) handleGetCron(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.gateway.cronMgr.GetTask(r.PathValue("name"))
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("task %s not found", r.PathValue("name")))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, s.cronView(task))
+}
+
+// handlePutCron creates a cron task or replaces an existing one with the same name.
+func (s *AdminServer) handlePutCron(w http.ResponseWriter, r *http.Request) {
+	var req adminCronRequest
+	if err := decodeAdminBody(w, r, &req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Name == "" || req.Expr == "" || req.Prompt == "" {
+		writeAdminError(w, http.StatusBadRequest, errors.New("name, expr and prompt are required"))
+		return
+	}
+	if strings.ContainsAny(req.Name, `/\`) {
+		writeAdminError(w, http.StatusBadRequest, errors.New("invalid task name"))
+		return
+	}
+
+	agentName := req.Agent
+	if agentName == "" {
+		agentName = config.MainAgentName
+	}
+	if s.gateway.getAgent(agentName) == nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("agent %s not found", agentName))
+		return
+	}
+
+	opts := []cron.TaskOption{cron.WithAgent(agentName)}
+	if req.Once {
+		opts = append(opts, cron.WithOneShot())
+	}
+	if req.Deliver != nil {
+		if req.Deliver.Channel == "" || req.Deliver.To == "" {
+			writeAdminError(w, http.StatusBadRequest, errors.New("deliver requires channel and to"))
+			return
+		}
+		opts = append(opts, cron.WithDelivery(chmodel.Type(req.Deliver.Channel), req.Deliver.To))
+	}
+	opts = append(opts,
+		cron.WithTimezone(req.Timezone),
+		cron.WithJitter(req.Jitter),
+		cron.WithActiveRange(req.StartAt, req.EndAt),
+		cron.WithBlackouts(req.Blackouts...),
+		cron.WithDeliverIf(req.DeliverIf),
+		cron.WithChain(req.OnSuccess, req.OnFailure),
+	)
+	if req.Retry != nil {
+		opts = append(opts, cron.WithRetry(req.Retry))
+	}
+	if req.NotifyOnFailure != nil {
+		if req.NotifyOnFailure.Channel == "" || req.NotifyOnFailure.To == "" {
+			writeAdminError(w, http.StatusBadRequest, errors.New("notify_on_failure requires channel and to"))
+			return
+		}
+		opts = append(opts, cron.WithFailureNotify(chmodel.Type(req.NotifyOnFailure.Channel), req.NotifyOnFailure.To))
+	}
+
+	task := cron.NewTask(req.Name, req.Expr, req.Prompt, opts...)
+	if req.Enabled != nil {
+		task.Enabled = *req.Enabled
+	}
+
+	updated, err := s.gateway.cronMgr.AddOrUpdateTask(task)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	code := http.StatusCreated
+	if updated {
+		code = http.StatusOK
+	}
+	writeAdminJSON(w, code, s.cronView(task))
+}
+
+func (s *AdminServer) handleDeleteCron(w http.ResponseWriter, r *http.Request) {
+	s.doCronAction(w, r, s.gateway.cronMgr.DeleteTask, "deleted")
+}
+
+func (s *AdminServer) handleEnableCron(w http.ResponseWriter, r *http.Request) {
+	s.doCronAction(w, r, s.gateway.cronMgr.EnableTask, "enabled")
+}
+
+func (s *AdminServer) handleDisableCron(w http.ResponseWriter, r *http.Request) {
+	s.doCronAction(w, r, s.gateway.cronMgr.DisableTask, "disabled")
+}
+
+func (s *AdminServer) handleRunCron(w http.ResponseWriter, r *http.Request) {
+	s.doCronAction(w, r, s.gateway.cronMgr.RunTask, "triggered")
+}
+
+func (s *AdminServer) handleListCronRuns(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.gateway.cronMgr.GetTask(r.PathValue("name"))
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("task %s not found", r.PathValue("name")))
+		return
+	}
+	runs, err := task.ListRuns()
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// newest first, without the result text which can be large
+	slices.Reverse(runs)
+	for _, run := range runs {
+		run.Result = ""
+	}
+	writeAdminJSON(w, http.StatusOK, runs)
+}
+
+func (s *AdminServer) handleGetCronRun(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.gateway.cronMgr.GetTask(r.PathValue("name"))
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("task %s not found", r.PathValue("name")))
+		return
+	}
+	run, err := task.GetRun(r.PathValue("id"))
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, run)
+}
+
+func (s *AdminServer) doCronAction(w http.ResponseWriter, r *http.Request, action func(string) error, status string) {
+	name := r.PathValue("name")
+	if _, ok := s.gateway.cronMgr.GetTask(name); !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("task %s not found", name))
+		return
+	}
+	if err := action(name); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+func (s *AdminServer) handleListHeartbeats(w http.ResponseWriter, r *http.Request) {
+	if s.gateway.heartbeatMgr == nil {
+		writeAdminJSON(w, http.StatusOK, map[string]config.AgentHeartbeatConfig{})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, s.gateway.heartbeatMgr.List())
+}
+
+func (s *AdminServer) handleUpdateHeartbeat(w http.ResponseWriter, r *http.Request) {
+	agentName := r.PathValue("agent")
+	if s.gateway.getAgent(agentName) == nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("agent %s not found", agentName))
+		return
+	}
+
+	var cfg config.AgentHeartbeatConfig
+	if err := decodeAdminBody(w, r, &cfg); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.gateway.heartbeatMgr.Update(agentName, cfg); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, cfg)
+}
+
+type adminReloadView struct {
+	Status   string   `json:"status"`
+	Changes  []string `json:"changes,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (s *AdminServer) handleReloadConfig(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.gateway.ReloadConfig(r.Context())
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		writeAdminJSON(w, http.StatusBadRequest, adminReloadView{Status: "rejected", Problems: verr.Problems})
+		return
+	}
+	view := adminReloadView{Status: "reloaded", Changes: changes}
+	if err != nil {
+		view.Status = "partially_applied"
+		view.Error = err.Error()
+	}
+	writeAdminJSON(w, http.StatusOK, view)
+}
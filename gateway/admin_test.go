@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ryanreadbooks/tokkibot/agent"
+	"github.com/ryanreadbooks/tokkibot/config"
+)
+
+func TestAdminServerAuthAndTasks(t *testing.T) {
+	canceled := false
+	g := &Gateway{
+		running: map[string]context.CancelFunc{
+			"main:lark:oc_1": func() { canceled = true },
+		},
+	}
+	h := (&AdminServer{token: "t0ken", gateway: g}).Handler()
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/healthz", ""); w.Code != http.StatusOK {
+		t.Fatalf("healthz: got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/readyz", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz before start: got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/api/tasks", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: got %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "/api/tasks", "t0ken")
+	var tasks []adminTaskView
+	if err := json.Unmarshal(w.Body.Bytes(), &tasks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Agent != "main" || tasks[0].ChatId != "oc_1" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+
+	if w := do(http.MethodPost, "/api/tasks/main:lark:oc_1/cancel", "t0ken"); w.Code != http.StatusOK || !canceled {
+		t.Fatalf("cancel: got %d, canceled=%v", w.Code, canceled)
+	}
+	if w := do(http.MethodPost, "/api/tasks/main:lark:oc_2/cancel", "t0ken"); w.Code != http.StatusNotFound {
+		t.Fatalf("cancel missing: got %d", w.Code)
+	}
+
+	if w := do(http.MethodGet, "/metrics", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("metrics without token: got %d", w.Code)
+	}
+	w = do(http.MethodGet, "/metrics", "t0ken")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "go_goroutines") {
+		t.Fatalf("metrics: got %d", w.Code)
+	}
+}
+
+// TestAdminListAgentsDuringReload is meant to be run with -race.
+func TestAdminListAgentsDuringReload(t *testing.T) {
+	g := &Gateway{
+		agents: map[string]*agent.Agent{config.MainAgentName: {}},
+		option: &gatewayOption{},
+	}
+	h := (&AdminServer{token: "t0ken", gateway: g}).Handler()
+
+	withAgents := config.Config{Agents: []config.AgentEntry{{Name: config.MainAgentName}, {Name: "a"}, {Name: "b"}}}
+	withoutAgents := config.Config{Agents: []config.AgentEntry{{Name: config.MainAgentName}}}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 200 {
+			g.agentsMu.Lock()
+			g.agents["a"], g.agents["b"] = &agent.Agent{}, &agent.Agent{}
+			g.agentsMu.Unlock()
+			r := &configReloader{g: g, ctx: t.Context(), prev: withAgents, cur: withoutAgents}
+			r.applyAgents()
+		}
+	}()
+
+	for range 200 {
+		for _, path := range []string{"/api/agents", "/api/mcp"} {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("Authorization", "Bearer t0ken")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: got %d", path, w.Code)
+			}
+		}
+	}
+	wg.Wait()
+
+	r := httptest.NewRequest(http.MethodGet, "/api/agents", nil)
+	r.Header.Set("Authorization", "Bearer t0ken")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var views []adminAgentView
+	if err := json.Unmarshal(w.Body.Bytes(), &views); err != nil {
+		t.Fatal(err)
+	}
+	if len(views) != 1 || views[0].Name != config.MainAgentName {
+		t.Fatalf("unexpected agents after reload: %+v", views)
+	}
+}
@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ryanreadbooks/tokkibot/agent/checkpoint"
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+)
+
+const (
+	checkpointsUsage = "Usage: /checkpoints list | /checkpoints diff <n|id> [file] | /checkpoints restore <n|id> [file]"
+
+	maxCheckpointsListed  = 20
+	maxCheckpointDiffLine = 300
+)
+
+func (g *Gateway) handleCheckpoints(rawMsg *chmodel.IncomingMessage, agentName string) {
+	store := g.agentByName(agentName).Checkpoints()
+	if store == nil {
+		g.sendResponse(rawMsg, "Checkpoints are disabled for this agent")
+		return
+	}
+
+	args := strings.Fields(strings.TrimPrefix(strings.TrimSpace(rawMsg.Content), string(ControlCmdCheckpoints)))
+	subCmd := ""
+	if len(args) > 0 {
+		subCmd = strings.ToLower(args[0])
+	}
+
+	session := checkpoint.SessionKey(rawMsg.Channel.String(), rawMsg.ChatId)
+	switch subCmd {
+	case "", "list":
+		g.handleCheckpointsList(rawMsg, store, session)
+	case "diff", "restore":
+		if len(args) < 2 {
+			g.sendResponse(rawMsg, checkpointsUsage)
+			return
+		}
+		turn, err := store.Get(session, args[1])
+		if errors.Is(err, checkpoint.ErrNotFound) {
+			g.sendResponse(rawMsg, fmt.Sprintf("Checkpoint not found: %s", args[1]))
+			return
+		}
+		if err != nil {
+			g.sendResponse(rawMsg, "Failed to load checkpoint: "+err.Error())
+			return
+		}
+		var files []*checkpoint.File
+		if len(args) > 2 {
+			f := turn.File(args[2])
+			if f == nil {
+				g.sendResponse(rawMsg, fmt.Sprintf("File %s was not changed in checkpoint %s", args[2], turn.Id))
+				return
+			}
+			files = append(files, f)
+		}
+		if subCmd == "diff" {
+			g.handleCheckpointsDiff(rawMsg, turn, files)
+		} else {
+			g.handleCheckpointsRestore(rawMsg, agentName, store, session, turn, files)
+		}
+	default:
+		g.sendResponse(rawMsg, fmt.Sprintf("Unknown checkpoints subcommand: %s\n%s", subCmd, checkpointsUsage))
+	}
+}
+
+func (g *Gateway) handleCheckpointsList(rawMsg *chmodel.IncomingMessage, store *checkpoint.Store, session string) {
+	turns, err := store.List(session)
+	if err != nil {
+		g.sendResponse(rawMsg, "Failed to list checkpoints: "+err.Error())
+		return
+	}
+	if len(turns) == 0 {
+		g.sendResponse(rawMsg, "No file changes in this session")
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**Checkpoints (%d):**\n\n", len(turns))
+	fmt.Fprintf(&sb, "| # | Time | Files | Prompt |\n")
+	fmt.Fprintf(&sb, "|---|------|-------|--------|\n")
+	for i, turn := range turns {
+		if i == maxCheckpointsListed {
+			fmt.Fprintf(&sb, "\n... %d older checkpoints\n", len(turns)-i)
+			break
+		}
+		prompt := strings.ReplaceAll(turn.Prompt, "|", "\\|")
+		if turn.Restored != nil {
+			prompt = "↩️ " + prompt
+		}
+		fmt.Fprintf(&sb, "| %d | %s | %s | %s |\n", i+1, turn.Created.Local().Format("01-02 15:04:05"), checkpointFiles(turn), prompt)
+	}
+	fmt.Fprintf(&sb, "\nUse `/checkpoints diff <n>` to see the changes, `/checkpoints restore <n> [file]` to undo them")
+	g.sendResponse(rawMsg, sb.String())
+}
+
+// checkpointFiles lists the changed files of a turn by their base names.
+func checkpointFiles(turn *checkpoint.Turn) string {
+	names := make([]string, 0, len(turn.Files))
+	for _, f := range turn.Files {
+		name := f.Path[strings.LastIndexAny(f.Path, `/\`)+1:]
+		switch {
+		case !f.Existed:
+			name += " (new)"
+		case f.Deleted:
+			name += " (deleted)"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (g *Gateway) handleCheckpointsDiff(rawMsg *chmodel.IncomingMessage, turn *checkpoint.Turn, files []*checkpoint.File) {
+	if len(files) == 0 {
+		files = turn.Files
+	}
+
+	var diff strings.Builder
+	for _, f := range files {
+		d, err := turn.Diff(f)
+		if err != nil {
+			g.sendResponse(rawMsg, "Failed to diff checkpoint: "+err.Error())
+			return
+		}
+		diff.WriteString(d)
+	}
+
+	lines := strings.SplitAfter(diff.String(), "\n")
+	if len(lines) > maxCheckpointDiffLine {
+		lines = append(lines[:maxCheckpointDiffLine], fmt.Sprintf("... (%d more lines)\n", len(lines)-maxCheckpointDiffLine))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**Checkpoint %s**\n\n", turn.Id)
+	if turn.Prompt != "" {
+		fmt.Fprintf(&sb, "> %s\n\n", turn.Prompt)
+	}
+	fmt.Fprintf(&sb, "```diff\n%s```", strings.Join(lines, ""))
+	g.sendResponse(rawMsg, sb.String())
+}
+
+func (g *Gateway) handleCheckpointsRestore(
+	rawMsg *chmodel.IncomingMessage,
+	agentName string,
+	store *checkpoint.Store,
+	session string,
+	turn *checkpoint.Turn,
+	files []*checkpoint.File,
+) {
+	// the agent may be changing the same files
+	sessionKey := fmt.Sprintf("%s:%s", agentName, rawMsg.Key())
+	g.runningMu.RLock()
+	_, isRunning := g.running[sessionKey]
+	g.runningMu.RUnlock()
+	if isRunning {
+		g.sendResponse(rawMsg, "Cannot restore files while a task is running. Please wait for the task to complete or use `/stop` first.")
+		return
+	}
+
+	if len(files) == 0 {
+		files = turn.Files
+	}
+	var modified []string
+	for _, f := range files {
+		if turn.Modified(f) {
+			modified = append(modified, f.Path)
+		}
+	}
+
+	if err := store.Restore(session, turn, files); err != nil {
+		g.sendResponse(rawMsg, "Failed to restore checkpoint: "+err.Error())
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✅ Restored %d file(s) to their state before checkpoint %s\n", len(files), turn.Id)
+	for _, f := range files {
+		fmt.Fprintf(&sb, "- %s\n", f.Path)
+	}
+	if len(modified) > 0 {
+		fmt.Fprintf(&sb, "\n⚠️ Changes made after the checkpoint were discarded in:\n")
+		for _, path := range modified {
+			fmt.Fprintf(&sb, "- %s\n", path)
+		}
+	}
+	fmt.Fprintf(&sb, "\nThe restore is a checkpoint of its own, use `/checkpoints restore 1` to undo it")
+	g.sendResponse(rawMsg, sb.String())
+}
@@ -2,14 +2,30 @@ package gateway
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
+	chadapter "github.com/ryanreadbooks/tokkibot/channel/adapter"
 	"github.com/ryanreadbooks/tokkibot/channel/model"
 	"github.com/ryanreadbooks/tokkibot/component/tool"
+	"github.com/ryanreadbooks/tokkibot/config"
 )
 
+// how long a tool call waits for an approver before it is denied
+const approvalTimeout = 10 * time.Minute
+
 // ConfirmHandler implements tool.ToolConfirmer using IncomingMessage callbacks
 type ConfirmHandler struct {
 	msg *model.IncomingMessage
+
+	// set for gateway messages, where confirmations of channels without a
+	// confirmation ui are answered in the chat
+	g          *Gateway
+	adapter    chadapter.Adapter
+	sessionKey string
+	identity   config.Identity
 }
 
 // NewConfirmHandler creates a new ConfirmHandler
@@ -17,10 +33,22 @@ func NewConfirmHandler(msg *model.IncomingMessage) *ConfirmHandler {
 	return &ConfirmHandler{msg: msg}
 }
 
+func (g *Gateway) newConfirmHandler(
+	msg *model.IncomingMessage,
+	adapter chadapter.Adapter,
+	sessionKey string,
+	identity config.Identity,
+) *ConfirmHandler {
+	return &ConfirmHandler{msg: msg, g: g, adapter: adapter, sessionKey: sessionKey, identity: identity}
+}
+
 // RequestConfirm implements tool.ToolConfirmer
 func (h *ConfirmHandler) RequestConfirm(ctx context.Context, req *tool.ConfirmRequest) (*tool.ConfirmResponse, error) {
 	if h.msg.OnConfirmWaiting == nil {
-		return &tool.ConfirmResponse{Confirmed: true}, nil
+		if h.g == nil {
+			return &tool.ConfirmResponse{Confirmed: false, Reason: "confirmation is not supported by the channel"}, nil
+		}
+		return h.g.waitApproval(ctx, h, req)
 	}
 
 	respCh := make(chan *model.ConfirmResponse, 1)
@@ -46,11 +74,130 @@ func (h *ConfirmHandler) RequestConfirm(ctx context.Context, req *tool.ConfirmRe
 	// Wait for confirm response or context cancellation
 	select {
 	case resp := <-respCh:
+		return h.confirmResponse(ctx, resp), nil
+	case <-ctx.Done():
+		return &tool.ConfirmResponse{Confirmed: false, Reason: "cancelled"}, ctx.Err()
+	}
+}
+
+// confirmResponse converts the answer given in the confirmation ui of the
+// channel. In the gateway the answer only counts if the one who answered may
+// approve tool calls, just like /approve.
+func (h *ConfirmHandler) confirmResponse(ctx context.Context, resp *model.ConfirmResponse) *tool.ConfirmResponse {
+	responder := h.identity
+	if h.g != nil && resp.ResponderId != "" {
+		responder = h.g.identify(&model.IncomingMessage{Channel: h.msg.Channel, SenderId: resp.ResponderId})
+	}
+	if h.g != nil && !responder.Policy.ApproveAllowed() {
+		slog.WarnContext(ctx, "confirmation answered by a sender who cannot approve",
+			slog.String("sender_id", responder.Id),
+			slog.String("role", string(responder.Role)))
 		return &tool.ConfirmResponse{
-			Confirmed: resp.Confirmed,
-			Reason:    resp.Reason,
-		}, nil
+			Confirmed: false,
+			Reason:    fmt.Sprintf("role %s cannot approve tool calls", responder.Role),
+		}
+	}
+
+	return &tool.ConfirmResponse{
+		Confirmed:  resp.Confirmed,
+		Reason:     resp.Reason,
+		Always:     resp.Always,
+		ApprovedBy: approverLabel(responder),
+	}
+}
+
+// pendingApproval is a tool call waiting for /approve or /deny.
+type pendingApproval struct {
+	respCh chan *tool.ConfirmResponse
+}
+
+// waitApproval asks approvers in the chat to approve the tool call and waits
+// for their answer.
+func (g *Gateway) waitApproval(ctx context.Context, h *ConfirmHandler, req *tool.ConfirmRequest) (*tool.ConfirmResponse, error) {
+	pending := &pendingApproval{respCh: make(chan *tool.ConfirmResponse, 1)}
+
+	g.approvalsMu.Lock()
+	g.approvals[h.sessionKey] = append(g.approvals[h.sessionKey], pending)
+	g.approvalsMu.Unlock()
+	defer g.removeApproval(h.sessionKey, pending)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔐 **Approval needed**: %s wants to run `%s`", displayName(h.identity), req.ToolName)
+	if req.Title != "" {
+		fmt.Fprintf(&sb, " (%s)", req.Title)
+	}
+	if req.Command != "" {
+		fmt.Fprintf(&sb, "\n```\n%s\n```", req.Command)
+	}
+	sb.WriteString("\nAn approver can reply `/approve`, `/approve always` to allow it for the rest of the session, or `/deny [reason]`.")
+	g.replyNotice(h.adapter, h.msg, sb.String())
+
+	slog.InfoContext(ctx, "waiting for tool approval",
+		slog.String("tool", req.ToolName),
+		slog.String("sender_id", h.identity.Id),
+		slog.String("role", string(h.identity.Role)))
+
+	timer := time.NewTimer(approvalTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-pending.respCh:
+		return resp, nil
+	case <-timer.C:
+		return &tool.ConfirmResponse{Confirmed: false, Reason: "no approver answered in time"}, nil
 	case <-ctx.Done():
 		return &tool.ConfirmResponse{Confirmed: false, Reason: "cancelled"}, ctx.Err()
 	}
 }
+
+func (g *Gateway) removeApproval(sessionKey string, pending *pendingApproval) {
+	g.approvalsMu.Lock()
+	defer g.approvalsMu.Unlock()
+
+	list := g.approvals[sessionKey]
+	for i, p := range list {
+		if p == pending {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(g.approvals, sessionKey)
+		return
+	}
+	g.approvals[sessionKey] = list
+}
+
+// resolveApproval answers the oldest pending approval of the session.
+// Returns false if nothing is pending.
+func (g *Gateway) resolveApproval(sessionKey string, resp *tool.ConfirmResponse) bool {
+	g.approvalsMu.Lock()
+	list := g.approvals[sessionKey]
+	if len(list) == 0 {
+		g.approvalsMu.Unlock()
+		return false
+	}
+	pending := list[0]
+	g.approvalsMu.Unlock()
+
+	g.removeApproval(sessionKey, pending)
+	pending.respCh <- resp
+	return true
+}
+
+func displayName(identity config.Identity) string {
+	switch {
+	case identity.Name != "":
+		return identity.Name
+	case identity.Id != "":
+		return identity.Id
+	}
+	return "someone"
+}
+
+// approverLabel names who answered a confirmation in the audit log.
+func approverLabel(identity config.Identity) string {
+	if identity.Name != "" && identity.Id != "" {
+		return identity.Name + " (" + identity.Id + ")"
+	}
+	return displayName(identity)
+}
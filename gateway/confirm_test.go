@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+	"github.com/ryanreadbooks/tokkibot/config"
+)
+
+func TestConfirmHandlerApproval(t *testing.T) {
+	identity := &config.IdentityConfig{}
+	g := &Gateway{approvals: make(map[string][]*pendingApproval)}
+	adapter := newFakeAdapter()
+	msg := &chmodel.IncomingMessage{Channel: chmodel.Lark, ChatId: "chat", SenderId: "ou_guest"}
+	req := &tool.ConfirmRequest{ToolName: "shell", Command: "rm -rf build"}
+
+	noChannel := NewConfirmHandler(msg)
+	if resp, _ := noChannel.RequestConfirm(context.Background(), req); resp.Confirmed {
+		t.Fatal("tool calls should not be approved without a way to ask")
+	}
+
+	guest := g.newConfirmHandler(msg, adapter, "main:lark:chat", identity.Resolve("lark", "ou_guest"))
+	done := make(chan *tool.ConfirmResponse)
+	go func() {
+		resp, _ := guest.RequestConfirm(context.Background(), req)
+		done <- resp
+	}()
+
+	// the approval request is posted to the chat
+	<-adapter.out
+	if !g.resolveApproval("main:lark:chat", &tool.ConfirmResponse{Confirmed: false, Reason: "no"}) {
+		t.Fatal("expected a pending approval")
+	}
+	if resp := <-done; resp.Confirmed || resp.Reason != "no" {
+		t.Fatalf("expected denial, got %+v", resp)
+	}
+	if g.resolveApproval("main:lark:chat", &tool.ConfirmResponse{Confirmed: true}) {
+		t.Fatal("approval should be removed once answered")
+	}
+
+	// admins are asked as well and can approve their own calls
+	admin := g.newConfirmHandler(msg, adapter, "main:lark:chat", config.Identity{
+		Id: "ou_admin", Role: config.RoleAdmin, Policy: identity.GetPolicy(config.RoleAdmin),
+	})
+	go func() {
+		resp, _ := admin.RequestConfirm(context.Background(), req)
+		done <- resp
+	}()
+	<-adapter.out
+	g.resolveApproval("main:lark:chat", &tool.ConfirmResponse{Confirmed: true, Always: true})
+	if resp := <-done; !resp.Confirmed || !resp.Always {
+		t.Fatalf("expected approval for the session, got %+v", resp)
+	}
+}
+
+func TestConfirmHandlerResponder(t *testing.T) {
+	identity := &config.IdentityConfig{}
+	g := &Gateway{}
+	msg := &chmodel.IncomingMessage{Channel: chmodel.Lark, ChatId: "chat", SenderId: "ou_guest"}
+	msg.OnConfirmWaiting = func(e *chmodel.ConfirmEvent) {
+		e.RespCh <- &chmodel.ConfirmResponse{Confirmed: true, Always: true}
+	}
+	req := &tool.ConfirmRequest{ToolName: "shell", Command: "rm -rf build"}
+
+	// a guest cannot approve their own call with the button
+	guest := g.newConfirmHandler(msg, nil, "main:lark:chat", identity.Resolve("lark", "ou_guest"))
+	if resp, _ := guest.RequestConfirm(context.Background(), req); resp.Confirmed || resp.Always {
+		t.Fatalf("guest approved their own call: %+v", resp)
+	}
+
+	// the one who clicked is recorded, not the requester; without identity
+	// config everyone is an admin
+	msg.OnConfirmWaiting = func(e *chmodel.ConfirmEvent) {
+		e.RespCh <- &chmodel.ConfirmResponse{Confirmed: true, ResponderId: "ou_admin"}
+	}
+	resp, _ := guest.RequestConfirm(context.Background(), req)
+	if !resp.Confirmed || resp.ApprovedBy != "ou_admin" {
+		t.Fatalf("expected approval by ou_admin, got %+v", resp)
+	}
+}
+
+func TestCommandPermission(t *testing.T) {
+	member := (&config.IdentityConfig{}).GetPolicy(config.RoleMember)
+	cases := []struct {
+		content string
+		allowed bool
+	}{
+		{"/model", true},
+		{"/model set openai gpt-4o", false},
+		{"/new", true},
+	}
+	for _, c := range cases {
+		perm := commandPermission(parseControlCommand(c.content), c.content)
+		if member.AllowsCommand(perm) != c.allowed {
+			t.Errorf("%s: expected allowed=%v for permission %q", c.content, c.allowed, perm)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
 
 	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
@@ -22,6 +23,12 @@ const (
 	ControlCmdModel   ControlCommand = "/model"
 	ControlCmdStatus  ControlCommand = "/status"
 	ControlCmdHelp    ControlCommand = "/help"
+	ControlCmdApprove ControlCommand = "/approve"
+	ControlCmdDeny    ControlCommand = "/deny"
+	ControlCmdBlock   ControlCommand = "/block"
+	ControlCmdUnblock ControlCommand = "/unblock"
+
+	ControlCmdCheckpoints ControlCommand = "/checkpoints"
 )
 
 var controlCommands = []ControlCommand{
@@ -33,6 +40,11 @@ var controlCommands = []ControlCommand{
 	ControlCmdModel,
 	ControlCmdStatus,
 	ControlCmdHelp,
+	ControlCmdApprove,
+	ControlCmdDeny,
+	ControlCmdBlock,
+	ControlCmdUnblock,
+	ControlCmdCheckpoints,
 }
 
 // parseControlCommand extracts control command from message content
@@ -58,14 +70,56 @@ const helpMessage = `**Available Commands:**
 - /model - Show current model and available providers
 - /model set <provider> [model] - Switch provider and model
 - /status - Show current session status (model, context size, etc.)
+- /approve [always] - Approve the oldest tool call waiting for approval, always for the rest of the session
+- /deny [reason] - Deny the oldest tool call waiting for approval
+- /block <sender_id> [duration] - Ignore messages of a sender for a while
+- /block list - List blocked senders
+- /unblock <sender_id> - Unblock a sender
+- /checkpoints - List the file changes made by the agent in this session
+- /checkpoints diff <n|id> [file] - Show the changes of a checkpoint
+- /checkpoints restore <n|id> [file] - Restore files to their state before a checkpoint
 - /help - Show this help message`
 
+// identify resolves the sender of the message to a user and role.
+func (g *Gateway) identify(rawMsg *chmodel.IncomingMessage) config.Identity {
+	return config.GetConfig().Identity.Resolve(rawMsg.Channel.String(), rawMsg.SenderId)
+}
+
+// commandPermission returns the permission needed to run the command, or ""
+// if the command is governed otherwise.
+func commandPermission(cmd ControlCommand, content string) string {
+	switch cmd {
+	case ControlCmdApprove, ControlCmdDeny:
+		return "" // needs canApprove
+	case ControlCmdModel:
+		args := strings.Fields(strings.TrimPrefix(strings.TrimSpace(content), string(ControlCmdModel)))
+		if len(args) > 0 && strings.ToLower(args[0]) == "set" {
+			return config.PermModelSet
+		}
+	}
+	return strings.TrimPrefix(string(cmd), "/")
+}
+
 // handleControl handles control commands and returns true if handled
-func (g *Gateway) handleControl(rawMsg *chmodel.IncomingMessage, cmd ControlCommand, agentName string) bool {
+func (g *Gateway) handleControl(
+	rawMsg *chmodel.IncomingMessage,
+	cmd ControlCommand,
+	agentName string,
+	identity config.Identity,
+) bool {
 	if cmd == ControlCmdNone {
 		return false
 	}
 
+	if perm := commandPermission(cmd, rawMsg.Content); perm != "" && !identity.Policy.AllowsCommand(perm) {
+		slog.WarnContext(rawMsg.Context(), "control command denied",
+			slog.String("sender_id", identity.Id),
+			slog.String("role", string(identity.Role)),
+			slog.String("permission", perm))
+		g.sendResponse(rawMsg, fmt.Sprintf("⛔ `%s` is not allowed for role %s", perm, identity.Role))
+		return true
+	}
+
 	switch cmd {
 	case ControlCmdStop:
 		g.handleStop(rawMsg, agentName)
@@ -83,6 +137,14 @@ func (g *Gateway) handleControl(rawMsg *chmodel.IncomingMessage, cmd ControlComm
 		g.handleStatus(rawMsg, agentName)
 	case ControlCmdHelp:
 		g.handleHelp(rawMsg)
+	case ControlCmdApprove, ControlCmdDeny:
+		g.handleApproval(rawMsg, cmd, agentName, identity)
+	case ControlCmdBlock:
+		g.handleBlock(rawMsg, agentName)
+	case ControlCmdUnblock:
+		g.handleUnblock(rawMsg)
+	case ControlCmdCheckpoints:
+		g.handleCheckpoints(rawMsg, agentName)
 	}
 
 	return true
@@ -91,6 +153,8 @@ func (g *Gateway) handleControl(rawMsg *chmodel.IncomingMessage, cmd ControlComm
 func (g *Gateway) handleStop(rawMsg *chmodel.IncomingMessage, agentName string) {
 	sessionKey := fmt.Sprintf("%s:%s", agentName, rawMsg.Key())
 
+	dropped := g.clearQueue(sessionKey)
+
 	g.runningMu.RLock()
 	cancel, exists := g.running[sessionKey]
 	g.runningMu.RUnlock()
@@ -101,6 +165,10 @@ func (g *Gateway) handleStop(rawMsg *chmodel.IncomingMessage, agentName string)
 	}
 
 	cancel()
+	if dropped > 0 {
+		g.sendResponse(rawMsg, fmt.Sprintf("Task stop signal sent, %d queued message(s) dropped", dropped))
+		return
+	}
 	g.sendResponse(rawMsg, "Task stop signal sent")
 }
 
@@ -127,6 +195,43 @@ func (g *Gateway) handleCompact(rawMsg *chmodel.IncomingMessage, agentName strin
 	g.sendResponse(rawMsg, fmt.Sprintf("Context compacted (compressed %d tool calls)", compressed))
 }
 
+func (g *Gateway) handleApproval(
+	rawMsg *chmodel.IncomingMessage,
+	cmd ControlCommand,
+	agentName string,
+	identity config.Identity,
+) {
+	if !identity.Policy.ApproveAllowed() {
+		g.sendResponse(rawMsg, fmt.Sprintf("⛔ Role %s cannot approve tool calls", identity.Role))
+		return
+	}
+
+	reason := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rawMsg.Content), string(cmd)))
+	resp := &tool.ConfirmResponse{Confirmed: cmd == ControlCmdApprove, Reason: reason, ApprovedBy: approverLabel(identity)}
+	if resp.Confirmed && strings.EqualFold(reason, "always") {
+		resp.Always = true
+		resp.Reason = ""
+	}
+	if resp.Reason == "" {
+		resp.Reason = fmt.Sprintf("%s by %s", strings.TrimPrefix(string(cmd), "/"), displayName(identity))
+	}
+
+	sessionKey := fmt.Sprintf("%s:%s", agentName, rawMsg.Key())
+	if !g.resolveApproval(sessionKey, resp) {
+		g.sendResponse(rawMsg, "No tool call is waiting for approval")
+		return
+	}
+	if resp.Always {
+		g.sendResponse(rawMsg, "✅ Approved for the rest of the session")
+		return
+	}
+	if resp.Confirmed {
+		g.sendResponse(rawMsg, "✅ Approved")
+		return
+	}
+	g.sendResponse(rawMsg, "🚫 Denied")
+}
+
 func (g *Gateway) handleHelp(rawMsg *chmodel.IncomingMessage) {
 	g.sendResponse(rawMsg, helpMessage)
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"reflect"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/ants/v2"
@@ -12,9 +15,9 @@ import (
 	"github.com/ryanreadbooks/tokkibot/agent/tools"
 	chadapter "github.com/ryanreadbooks/tokkibot/channel/adapter"
 	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
-	"github.com/ryanreadbooks/tokkibot/component/tool"
 	"github.com/ryanreadbooks/tokkibot/config"
 	"github.com/ryanreadbooks/tokkibot/cron"
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
 	"github.com/ryanreadbooks/tokkibot/pkg/trace"
 )
 
@@ -27,6 +30,11 @@ type gatewayOption struct {
 	enableCwdAccess           bool
 
 	heartbeatCfgs map[string]config.AgentHeartbeatConfig // agent name -> heartbeat config
+	webhookCfg    *config.WebhookConfig
+	adminCfg      *config.AdminConfig
+
+	adapterFactory AdapterFactory
+	watchConfig    bool
 }
 
 type GatewayOption func(*gatewayOption)
@@ -69,6 +77,37 @@ func WithHeartbeatCfgs(cfgs map[string]config.AgentHeartbeatConfig) GatewayOptio
 	}
 }
 
+// WithWebhookCfg enables inbound webhook triggers.
+func WithWebhookCfg(cfg *config.WebhookConfig) GatewayOption {
+	return func(o *gatewayOption) {
+		o.webhookCfg = cfg
+	}
+}
+
+// AdapterFactory creates the adapter of a channel account. It is used to
+// start adapters for bindings added by a config reload.
+type AdapterFactory func(channel, account string) (chadapter.Adapter, error)
+
+func WithAdapterFactory(f AdapterFactory) GatewayOption {
+	return func(o *gatewayOption) {
+		o.adapterFactory = f
+	}
+}
+
+// WithConfigWatch reloads the config when config files change on disk.
+func WithConfigWatch(watch bool) GatewayOption {
+	return func(o *gatewayOption) {
+		o.watchConfig = watch
+	}
+}
+
+// WithAdminCfg enables the admin http server.
+func WithAdminCfg(cfg *config.AdminConfig) GatewayOption {
+	return func(o *gatewayOption) {
+		o.adminCfg = cfg
+	}
+}
+
 // routeRule defines how to route messages to an agent
 type routeRule struct {
 	agentName string
@@ -79,11 +118,43 @@ type routeRule struct {
 type adapterRouter struct {
 	adapter chadapter.Adapter
 	account string
-	rules   []*routeRule
+
+	mu    sync.RWMutex
+	rules []*routeRule
+
+	cancel context.CancelFunc // stops the adapter and its worker, set once started
+}
+
+func (r *adapterRouter) key() string {
+	return r.adapter.Type().String() + ":" + r.account
+}
+
+// setRules replaces the routing rules and reports whether they changed.
+func (r *adapterRouter) setRules(rules []*routeRule) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := !reflect.DeepEqual(r.rules, rules)
+	r.rules = rules
+	return changed
+}
+
+// agentNames returns names of agents routed by the router.
+func (r *adapterRouter) agentNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.rules))
+	for _, rule := range r.rules {
+		names = append(names, rule.agentName)
+	}
+	return names
 }
 
 // matchAgent returns the agent name for a given chatId
 func (r *adapterRouter) matchAgent(chatId string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	var fallback string
 	for _, rule := range r.rules {
 		if len(rule.chatIds) == 0 {
@@ -98,20 +169,33 @@ func (r *adapterRouter) matchAgent(chatId string) string {
 }
 
 type Gateway struct {
-	agents  map[string]*agent.Agent // name -> agent
-	wg      sync.WaitGroup
-	routers []*adapterRouter
+	agentsMu sync.RWMutex
+	agents   map[string]*agent.Agent // name -> agent
+	wg       sync.WaitGroup
+
+	routersMu sync.RWMutex
+	routers   []*adapterRouter
 	// adapter indexes:
 	// - channel + account -> adapter
 	channelAdaptersMu sync.RWMutex
 	channelAdapters   map[chmodel.Type]map[string]chadapter.Adapter
 	poolMu            sync.Mutex
 	pools             map[string]*ants.Pool
+	queuesMu          sync.Mutex
+	queues            map[string]*chatQueue
 
 	// running tasks cancel functions, key: "agentName:channel:chatId"
 	runningMu sync.RWMutex
 	running   map[string]context.CancelFunc
 
+	// tool calls waiting for /approve or /deny, key: "agentName:channel:chatId"
+	approvalsMu sync.Mutex
+	approvals   map[string][]*pendingApproval
+
+	// sender rate limits, block list and gateway wide run slots
+	limiter  *limiter
+	runSlots *runSlots
+
 	// cron manager
 	cronMgr *cron.Manager
 
@@ -119,6 +203,18 @@ type Gateway struct {
 	option  *gatewayOption
 
 	heartbeatMgr *HeartbeatManager
+	webhookMgr   *WebhookManager
+	adminServer  *AdminServer
+
+	// set once adapters and workers are started
+	ready  atomic.Bool
+	runCtx context.Context
+
+	// config reload state
+	rootCtx   context.Context
+	reloadMu  sync.Mutex
+	mcpCfg    config.McpConfig
+	allAgents bool // agents added to config are started on reload
 }
 
 func defaultGatewayOption() *gatewayOption {
@@ -133,6 +229,7 @@ func NewGateway(ctx context.Context, opts ...GatewayOption) (*Gateway, error) {
 	for _, opt := range opts {
 		opt(option)
 	}
+	allAgents := len(option.agentNames) == 0
 
 	if len(option.agentNames) == 0 {
 		// read all agent ids from config
@@ -146,14 +243,9 @@ func NewGateway(ctx context.Context, opts ...GatewayOption) (*Gateway, error) {
 
 	agents := make(map[string]*agent.Agent, len(option.agentNames))
 	for _, name := range option.agentNames {
-		ag, err := agent.Prepare(ctx, name,
-			agent.WithEnableCwdAccess(option.enableCwdAccess),
-		)
+		ag, err := prepareAgent(ctx, name, option)
 		if err != nil {
-			return nil, fmt.Errorf("failed to prepare agent %s: %w", name, err)
-		}
-		if !option.enableAutoMessageDelivery {
-			ag.UnRegisterTool(tools.ToolNameSendMessage)
+			return nil, err
 		}
 		agents[name] = ag
 	}
@@ -174,38 +266,112 @@ func NewGateway(ctx context.Context, opts ...GatewayOption) (*Gateway, error) {
 	gateway := &Gateway{
 		agents:          agents,
 		pools:           make(map[string]*ants.Pool),
+		queues:          make(map[string]*chatQueue),
 		channelAdapters: make(map[chmodel.Type]map[string]chadapter.Adapter),
 		running:         make(map[string]context.CancelFunc),
+		approvals:       make(map[string][]*pendingApproval),
+		limiter:         newLimiter(),
+		runSlots:        newRunSlots(),
 		cronMgr:         cron.GetGlobalManager(),
 		verbose:         option.verbose,
 		option:          option,
+		rootCtx:         ctx,
+		allAgents:       allAgents,
 	}
+	gateway.mcpCfg, _ = config.GetMcpConfig()
 
 	gateway.cronMgr.SetHandler(gateway.handleCronTask)
+	gateway.cronMgr.SetFailureHandler(gateway.notifyCronFailure)
+
+	if err := metrics.Register(&poolCollector{gateway: gateway}); err != nil {
+		slog.Warn("failed to register pool metrics", slog.Any("error", err))
+	}
 
 	if err := gateway.cronMgr.Load(); err != nil {
 		slog.Warn("failed to load cron tasks", slog.Any("error", err))
 	}
 
-	// heartbeat manager
-	if len(option.heartbeatCfgs) > 0 {
-		heartbeatMgr := NewHeartbeatManager(gateway, option.heartbeatCfgs)
-		gateway.heartbeatMgr = heartbeatMgr
+	// heartbeat manager, created even without heartbeats so that reloads can
+	// add them later
+	gateway.heartbeatMgr = NewHeartbeatManager(gateway, option.heartbeatCfgs)
+
+	// webhook manager
+	if option.webhookCfg != nil && len(option.webhookCfg.Hooks) > 0 {
+		gateway.webhookMgr = NewWebhookManager(gateway, option.webhookCfg)
+	}
+
+	// admin server
+	if option.adminCfg.IsEnabled() {
+		gateway.adminServer = NewAdminServer(gateway, option.adminCfg)
 	}
 
 	return gateway, nil
 }
 
+func prepareAgent(ctx context.Context, name string, option *gatewayOption) (*agent.Agent, error) {
+	ag, err := agent.Prepare(ctx, name,
+		agent.WithEnableCwdAccess(option.enableCwdAccess),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare agent %s: %w", name, err)
+	}
+	if !option.enableAutoMessageDelivery {
+		ag.UnRegisterTool(tools.ToolNameSendMessage)
+	}
+	return ag, nil
+}
+
 // GetAgent returns the agent for the given name. Returns main agent if name is empty.
 func (g *Gateway) GetAgent(name ...string) *agent.Agent {
 	agentName := config.MainAgentName
 	if len(name) > 0 && name[0] != "" {
 		agentName = name[0]
 	}
-	return g.agents[agentName]
+	return g.getAgent(agentName)
+}
+
+// agentNames returns sorted names of all agents.
+func (g *Gateway) agentNames() []string {
+	g.agentsMu.RLock()
+	defer g.agentsMu.RUnlock()
+
+	names := make([]string, 0, len(g.agents))
+	for name := range g.agents {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// runningKeys returns sorted keys of running tasks.
+func (g *Gateway) runningKeys() []string {
+	g.runningMu.RLock()
+	keys := make([]string, 0, len(g.running))
+	for key := range g.running {
+		keys = append(keys, key)
+	}
+	g.runningMu.RUnlock()
+
+	slices.Sort(keys)
+	return keys
+}
+
+// cancelRunning cancels the running task with the given key.
+func (g *Gateway) cancelRunning(key string) bool {
+	g.runningMu.RLock()
+	cancel, exists := g.running[key]
+	g.runningMu.RUnlock()
+
+	if exists {
+		cancel()
+	}
+	return exists
 }
 
 func (g *Gateway) agentByName(name string) *agent.Agent {
+	g.agentsMu.RLock()
+	defer g.agentsMu.RUnlock()
+
 	if ag, ok := g.agents[name]; ok {
 		return ag
 	}
@@ -226,6 +392,9 @@ func (g *Gateway) AddAdapter(adapter chadapter.Adapter, agentName ...string) {
 // If chatIds is nil/empty, all messages go to the specified agent.
 // Multiple calls with the same adapter will add additional routing rules.
 func (g *Gateway) AddAdapterWithRouting(adapter chadapter.Adapter, agentName, account string, chatIds []string) {
+	g.routersMu.Lock()
+	defer g.routersMu.Unlock()
+
 	// Find existing router for this adapter
 	var router *adapterRouter
 	for _, r := range g.routers {
@@ -247,18 +416,26 @@ func (g *Gateway) AddAdapterWithRouting(adapter chadapter.Adapter, agentName, ac
 		)
 	}
 
-	// Build chatId set
+	// Add routing rule
+	router.mu.Lock()
+	router.rules = append(router.rules, newRouteRule(agentName, chatIds))
+	router.mu.Unlock()
+
+	g.indexAdapter(adapter, account)
+}
+
+func newRouteRule(agentName string, chatIds []string) *routeRule {
 	chatIdSet := make(map[string]struct{})
 	for _, id := range chatIds {
 		chatIdSet[id] = struct{}{}
 	}
-
-	// Add routing rule
-	router.rules = append(router.rules, &routeRule{
+	return &routeRule{
 		agentName: agentName,
 		chatIds:   chatIdSet,
-	})
+	}
+}
 
+func (g *Gateway) indexAdapter(adapter chadapter.Adapter, account string) {
 	g.channelAdaptersMu.Lock()
 	defer g.channelAdaptersMu.Unlock()
 	if _, ok := g.channelAdapters[adapter.Type()]; !ok {
@@ -267,6 +444,28 @@ func (g *Gateway) AddAdapterWithRouting(adapter chadapter.Adapter, agentName, ac
 	g.channelAdapters[adapter.Type()][account] = adapter
 }
 
+// listRouters returns a snapshot of the routers.
+func (g *Gateway) listRouters() []*adapterRouter {
+	g.routersMu.RLock()
+	defer g.routersMu.RUnlock()
+	return slices.Clone(g.routers)
+}
+
+// startRouter starts the adapter and its message worker. They are stopped
+// when ctx is done or the router is canceled.
+func (g *Gateway) startRouter(ctx context.Context, router *adapterRouter) {
+	ctx, router.cancel = context.WithCancel(ctx)
+	if g.verbose {
+		slog.Info(fmt.Sprintf("channel %s (agents: %v) begin to run...", router.adapter.Type(), router.agentNames()))
+	}
+	g.wg.Go(func() {
+		router.adapter.Start(ctx)
+	})
+	g.wg.Go(func() {
+		g.messageWorker(ctx, router)
+	})
+}
+
 func (g *Gateway) Run(ctx context.Context) error {
 	// schedule and start cron tasks
 	g.cronMgr.RegisterAll()
@@ -275,26 +474,32 @@ func (g *Gateway) Run(ctx context.Context) error {
 		defer g.cronMgr.Stop()
 	}
 
+	g.routersMu.Lock()
+	g.runCtx = ctx
 	for _, router := range g.routers {
-		if g.verbose {
-			var agentNames []string
-			for _, r := range router.rules {
-				agentNames = append(agentNames, r.agentName)
-			}
-			slog.Info(fmt.Sprintf("channel %s (agents: %v) begin to run...", router.adapter.Type(), agentNames))
-		}
-		g.wg.Go(func() {
-			router.adapter.Start(ctx)
-		})
-		g.wg.Go(func() {
-			g.messageWorker(ctx, router)
-		})
+		g.startRouter(ctx, router)
 	}
+	g.routersMu.Unlock()
 
 	if g.heartbeatMgr != nil {
 		g.heartbeatMgr.Start(ctx)
 	}
 
+	if g.webhookMgr != nil {
+		g.webhookMgr.Start(ctx)
+	}
+
+	if g.adminServer != nil {
+		g.adminServer.Start(ctx)
+	}
+
+	if g.option.watchConfig {
+		g.watchConfig(ctx)
+	}
+
+	g.ready.Store(true)
+	defer g.ready.Store(false)
+
 	g.wg.Wait()
 
 	return nil
@@ -406,44 +611,37 @@ func (g *Gateway) messageWorker(ctx context.Context, router *adapterRouter) {
 					slog.Int("attachments", len(rawMsg.Attachments)))
 			}
 
-			if cmd := parseControlCommand(rawMsg.Content); g.handleControl(rawMsg, cmd, agentName) {
+			if !g.admit(taskCtx, rawMsg, adapter, agentName) {
 				continue
 			}
 
-			// Pool per agent:channel:chatId (size=1): serializes messages within
-			// the same chat, while different chats and agents run in parallel.
-			sessionKey := fmt.Sprintf("%s:%s", agentName, rawMsg.Key())
-			chatPool := g.getOrCreatePool(sessionKey)
+			identity := g.identify(rawMsg)
+			if cmd := parseControlCommand(rawMsg.Content); g.handleControl(rawMsg, cmd, agentName, identity) {
+				continue
+			}
 
-			attachments := extractAttachments(rawMsg)
+			// Queue per agent:channel:chatId: a session runs one task at a time,
+			// while different chats and agents run in parallel.
+			sessionKey := fmt.Sprintf("%s:%s", agentName, rawMsg.Key())
 			userMessage := &agent.UserMessage{
 				Channel:     adapter.Type().String(),
 				ChatId:      rawMsg.ChatId,
 				Content:     rawMsg.Content,
 				Created:     rawMsg.Created,
-				Attachments: attachments,
+				Attachments: extractAttachments(rawMsg),
+				Sender: &agent.UserMessageSender{
+					Id:   identity.Id,
+					Name: identity.Name,
+					Role: string(identity.Role),
+				},
 			}
 
-			taskCtx, taskCancel := context.WithCancel(taskCtx)
-			runningKey := sessionKey
-
-			g.runningMu.Lock()
-			g.running[runningKey] = taskCancel
-			g.runningMu.Unlock()
-
-			go chatPool.Submit(func() {
-				defer func() {
-					g.runningMu.Lock()
-					delete(g.running, runningKey)
-					g.runningMu.Unlock()
-				}()
-
-				if rawMsg.Stream {
-					g.workerDoStream(taskCtx, rawMsg, userMessage, adapter, agentName)
-				} else {
-					g.workerDo(taskCtx, rawMsg, userMessage, adapter, agentName)
-				}
-			})
+			g.enqueue(sessionKey, &chatTask{
+				rawMsg:      rawMsg,
+				userMessage: userMessage,
+				identity:    identity,
+				ctx:         taskCtx,
+			}, adapter, agentName)
 		}
 	}
 }
@@ -466,12 +664,10 @@ func (g *Gateway) workerDo(
 	userMessage *agent.UserMessage,
 	adapter chadapter.Adapter,
 	agentName string,
+	extraOpts ...agent.AskOption,
 ) {
-	confirmHandler := NewConfirmHandler(rawMsg)
-	ctx = tool.WithConfirmer(ctx, confirmHandler)
-
 	ag := g.agentByName(agentName)
-	askOpts := []agent.AskOption{}
+	askOpts := slices.Clone(extraOpts)
 	if g.option.enableAutoMessageDelivery {
 		askOpts = append(askOpts, agent.WithMessageChannel(&agent.AskTemporaryMessageChannel{
 			OutChan:  adapter.SendChan(),
@@ -498,13 +694,11 @@ func (g *Gateway) workerDoStream(
 	userMessage *agent.UserMessage,
 	adapter chadapter.Adapter,
 	agentName string,
+	extraOpts ...agent.AskOption,
 ) {
-	confirmHandler := NewConfirmHandler(rawMsg)
-	ctx = tool.WithConfirmer(ctx, confirmHandler)
-
 	ag := g.agentByName(agentName)
 	emitter := &msgEmitter{msg: rawMsg}
-	askOpts := []agent.AskOption{}
+	askOpts := slices.Clone(extraOpts)
 	if g.option.enableAutoMessageDelivery {
 		askOpts = append(askOpts, agent.WithMessageChannel(&agent.AskTemporaryMessageChannel{
 			OutChan:  adapter.SendChan(),
@@ -536,31 +730,61 @@ func (e *msgEmitter) EmitTool(round int, name, args string) {
 	})
 }
 
+func (e *msgEmitter) EmitFileChange(round int, path, diff string) {
+	e.msg.EmitTool(&chmodel.StreamTool{
+		Round: round,
+		Diff:  diff,
+	})
+}
+
+func (e *msgEmitter) EmitToolOutput(round int, name, output string, done bool) {
+	e.msg.EmitTool(&chmodel.StreamTool{
+		Round:      round,
+		Name:       name,
+		Output:     output,
+		OutputDone: done,
+	})
+}
+
 func (e *msgEmitter) EmitDone() {
 	e.msg.EmitDone()
 }
 
 func (g *Gateway) getAgent(name string) *agent.Agent {
+	g.agentsMu.RLock()
+	defer g.agentsMu.RUnlock()
 	return g.agents[name]
 }
 
 // handleCronTask handles a triggered cron task using the __cron virtual agent
-func (g *Gateway) handleCronTask(ctx context.Context, task *cron.Task) {
+func (g *Gateway) handleCronTask(ctx context.Context, task *cron.Task, req *cron.RunRequest) *cron.Outcome {
 	chatId := task.ChatId()
 	ownerAgent := task.AgentName
 	if ownerAgent == "" {
 		// Backward compatibility for old cron tasks saved before agent_name was introduced.
 		ownerAgent = config.CronsAgentName
 	}
+	outcome := &cron.Outcome{Agent: ownerAgent}
 
 	// Create trace info for cron task
 	traceInfo := trace.NewTraceInfo("cron", chatId, "")
 	ctx = trace.WithTrace(ctx, traceInfo)
 
+	ctx, span := trace.StartSpan(ctx, "cron.run",
+		trace.AttrChannel.String("cron"),
+		trace.AttrChatID.String(chatId),
+	)
+	defer span.End()
+
+	status := metrics.StatusError
+	defer func() {
+		metrics.CronExecutions.WithLabelValues(task.Name, status).Inc()
+	}()
+
 	userMessage := &agent.UserMessage{
 		Channel: "cron",
 		ChatId:  chatId,
-		Content: task.Prompt(),
+		Content: req.Prompt,
 		Created: time.Now().Unix(),
 	}
 
@@ -570,51 +794,151 @@ func (g *Gateway) handleCronTask(ctx context.Context, task *cron.Task) {
 			slog.String("name", task.Name),
 			slog.String("agent", ownerAgent),
 		)
-		return
+		outcome.Err = fmt.Errorf("agent %s not found", ownerAgent)
+		return outcome
 	}
 
-	result := targetAgent.Ask(ctx, userMessage)
+	var stats agent.RunStats
+	outcome.Result = targetAgent.Ask(ctx, userMessage, agent.WithRunStats(&stats))
+	outcome.Err = stats.Err
+	outcome.Usage = cron.Usage{
+		PromptTokens:     stats.Usage.PromptTokens,
+		CompletionTokens: stats.Usage.CompletionTokens,
+		TotalTokens:      stats.Usage.TotalTokens,
+	}
 	slog.InfoContext(ctx, "cron task executed",
 		slog.String("name", task.Name),
 		slog.String("agent", ownerAgent),
+		slog.Any("error", stats.Err),
 	)
 
+	if ctx.Err() != nil {
+		outcome.Err = ctx.Err()
+		return outcome
+	}
+	if outcome.Err != nil {
+		// failed runs are retried or reported by the failure notification
+		return outcome
+	}
+
 	// deliver result if configured
 	if !task.Deliver {
-		return
+		status = metrics.StatusOK
+		return outcome
 	}
 
-	bindingAccount := g.getAgentBindingAccount(ownerAgent, task.DeliverChannel)
-	adapter := g.getDeliveryAdapter(
-		task.DeliverChannel,
-		bindingAccount,
-	)
-	if adapter == nil {
-		slog.ErrorContext(ctx, "adapter not found for cron task delivery",
+	if deliver, reason := g.checkCronCondition(ctx, targetAgent, task, req, outcome.Result); !deliver {
+		slog.InfoContext(ctx, "cron task result not delivered by condition",
+			slog.String("name", task.Name),
+			slog.String("reason", reason),
+		)
+		status = metrics.StatusOK
+		outcome.Suppressed = reason
+		return outcome
+	}
+
+	err := g.deliverResult(ctx, ownerAgent, task.DeliverChannel, task.DeliverTo, chatId, outcome.Result)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to deliver cron task result",
 			slog.String("name", task.Name),
 			slog.String("agent", ownerAgent),
 			slog.String("channel", task.DeliverChannel.String()),
-			slog.String("account", bindingAccount),
+			slog.String("account", g.getAgentBindingAccount(ownerAgent, task.DeliverChannel)),
 			slog.String("to", task.DeliverTo),
+			slog.Any("error", err),
+		)
+		outcome.DeliveryErr = err
+		return outcome
+	}
+
+	status = metrics.StatusOK
+	outcome.Delivered = true
+	slog.InfoContext(ctx, "cron task result delivered",
+		slog.String("name", task.Name),
+		slog.String("agent", ownerAgent),
+		slog.String("channel", task.DeliverChannel.String()),
+		slog.String("to", task.DeliverTo),
+	)
+	return outcome
+}
+
+// checkCronCondition decides whether the result of a cron task is delivered.
+// A failing judgement delivers the result, so that nothing is lost silently.
+func (g *Gateway) checkCronCondition(
+	ctx context.Context,
+	targetAgent *agent.Agent,
+	task *cron.Task,
+	req *cron.RunRequest,
+	result string,
+) (bool, string) {
+	cond := task.DeliverIf
+	if cond == nil {
+		return true, ""
+	}
+	if ok, reason := cond.Check(result, req.Data.Previous.Result); !ok {
+		return false, reason
+	}
+	if cond.Judge == "" {
+		return true, ""
+	}
+
+	data := *req.Data
+	data.Result = result
+	question, err := cron.RenderTemplate(cond.Judge, &data)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to render cron condition", slog.String("name", task.Name), slog.Any("error", err))
+		return true, ""
+	}
+	yes, reason, err := targetAgent.Judge(ctx, question, result)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to judge cron condition", slog.String("name", task.Name), slog.Any("error", err))
+		return true, ""
+	}
+	if !yes {
+		return false, fmt.Sprintf("judged no: %s", reason)
+	}
+	return true, ""
+}
+
+// notifyCronFailure sends the failure notice of a cron task run.
+func (g *Gateway) notifyCronFailure(ctx context.Context, task *cron.Task, run *cron.Run) {
+	content := fmt.Sprintf("⚠️ Cron task %s failed after %d attempt(s): %s\nRun: %s\nSee `tokkibot cron logs %s %s` for details.",
+		task.Name, run.Attempt, run.Error, run.Id, task.Name, run.Id)
+	err := g.deliverResult(ctx, run.Agent, task.NotifyChannel, task.NotifyTo, task.ChatId(), content)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to notify cron task failure",
+			slog.String("name", task.Name),
+			slog.String("channel", task.NotifyChannel.String()),
+			slog.String("account", g.getAgentBindingAccount(run.Agent, task.NotifyChannel)),
+			slog.String("to", task.NotifyTo),
+			slog.Any("error", err),
 		)
-		return
+	}
+}
+
+// deliverResult sends content produced by a non-interactive run (cron, webhook)
+// to the given receiver via the adapter bound to agentName.
+func (g *Gateway) deliverResult(
+	ctx context.Context,
+	agentName string,
+	channelType chmodel.Type,
+	to, chatId, content string,
+) error {
+	bindingAccount := g.getAgentBindingAccount(agentName, channelType)
+	adapter := g.getDeliveryAdapter(channelType, bindingAccount)
+	if adapter == nil {
+		return fmt.Errorf("adapter not found for channel %s (account: %s)", channelType, bindingAccount)
 	}
 
 	select {
 	case adapter.SendChan() <- &chmodel.OutgoingMessage{
-		ReceiverId: task.DeliverTo,
-		Channel:    task.DeliverChannel,
+		ReceiverId: to,
+		Channel:    channelType,
 		ChatId:     chatId,
-		Content:    result,
+		Content:    content,
 	}:
-		slog.InfoContext(ctx, "cron task result delivered",
-			slog.String("name", task.Name),
-			slog.String("agent", ownerAgent),
-			slog.String("channel", task.DeliverChannel.String()),
-			slog.String("account", bindingAccount),
-			slog.String("to", task.DeliverTo),
-		)
+		return nil
 	default:
-		slog.WarnContext(ctx, "failed to deliver cron task result", slog.String("name", task.Name))
+		return fmt.Errorf("send channel of %s is full", channelType)
 	}
 }
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"strings"
 	"sync"
@@ -10,6 +11,7 @@ import (
 	"github.com/ryanreadbooks/tokkibot/agent"
 	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
 	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
 	"github.com/ryanreadbooks/tokkibot/pkg/safe"
 )
 
@@ -21,7 +23,38 @@ type heartbeatEntry struct {
 	mu        sync.Mutex
 	agentName string
 	cfg       config.AgentHeartbeatConfig
+	every     time.Duration
 	ticker    *time.Ticker
+	stop      chan struct{}
+}
+
+// newHeartbeatEntry creates the entry of the agent. Returns nil entry if the
+// heartbeat is disabled by a zero interval.
+func newHeartbeatEntry(agentName string, cfg config.AgentHeartbeatConfig) (*heartbeatEntry, error) {
+	duration, err := time.ParseDuration(cfg.Every)
+	if err != nil {
+		return nil, fmt.Errorf("invalid heartbeat interval %q: %w", cfg.Every, err)
+	}
+	if duration == 0 {
+		return nil, nil
+	}
+
+	if duration < minHeartbeatInterval {
+		slog.Info("heartbeat interval adjusted to minimum",
+			slog.String("agent", agentName),
+			slog.String("configured", cfg.Every),
+			slog.String("effective", minHeartbeatInterval.String()),
+		)
+	}
+	duration = max(duration, minHeartbeatInterval)
+
+	return &heartbeatEntry{
+		agentName: agentName,
+		cfg:       cfg,
+		every:     duration,
+		ticker:    time.NewTicker(duration),
+		stop:      make(chan struct{}),
+	}, nil
 }
 
 func (e *heartbeatEntry) getCfg() config.AgentHeartbeatConfig {
@@ -39,6 +72,7 @@ func (e *heartbeatEntry) setCfg(cfg config.AgentHeartbeatConfig) {
 type HeartbeatManager struct {
 	mu      sync.RWMutex
 	entries map[string]*heartbeatEntry
+	rootCtx context.Context // set once started
 
 	gateway *Gateway
 }
@@ -47,7 +81,7 @@ func NewHeartbeatManager(gateway *Gateway, cfgs map[string]config.AgentHeartbeat
 	// create crons
 	entries := make(map[string]*heartbeatEntry, len(cfgs))
 	for agentName, cfg := range cfgs {
-		duration, err := time.ParseDuration(cfg.Every)
+		entry, err := newHeartbeatEntry(agentName, cfg)
 		if err != nil {
 			slog.Warn("invalid heartbeat interval, skipped",
 				slog.String("agent", agentName),
@@ -56,22 +90,8 @@ func NewHeartbeatManager(gateway *Gateway, cfgs map[string]config.AgentHeartbeat
 			)
 			continue
 		}
-		if duration == 0 {
-			continue
-		}
-
-		if duration < minHeartbeatInterval {
-			slog.Info("heartbeat interval adjusted to minimum",
-				slog.String("agent", agentName),
-				slog.String("configured", cfg.Every),
-				slog.String("effective", minHeartbeatInterval.String()),
-			)
-		}
-		duration = max(duration, minHeartbeatInterval)
-		entries[agentName] = &heartbeatEntry{
-			agentName: agentName,
-			cfg:       cfg,
-			ticker:    time.NewTicker(duration),
+		if entry != nil {
+			entries[agentName] = entry
 		}
 	}
 
@@ -83,35 +103,49 @@ func NewHeartbeatManager(gateway *Gateway, cfgs map[string]config.AgentHeartbeat
 
 // runs in a separate goroutine
 func (m *HeartbeatManager) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rootCtx = ctx
 	for _, entry := range m.entries {
-		entry := entry
-		safe.Go(func() {
-			slog.InfoContext(ctx, "heartbeat manager started",
-				slog.String("agent", entry.agentName),
-				slog.String("target", entry.cfg.Target),
-				slog.String("to", entry.cfg.To),
-			)
+		m.run(ctx, entry)
+	}
+}
 
-			for {
-				select {
-				case <-ctx.Done():
-					entry.ticker.Stop()
-					return
-				case <-entry.ticker.C: // wait for next tick
-					m.HandleHeartbeat(ctx, entry)
-				}
+func (m *HeartbeatManager) run(ctx context.Context, entry *heartbeatEntry) {
+	safe.Go(func() {
+		slog.InfoContext(ctx, "heartbeat manager started",
+			slog.String("agent", entry.agentName),
+			slog.String("target", entry.cfg.Target),
+			slog.String("to", entry.cfg.To),
+		)
+
+		defer entry.ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-entry.stop:
+				return
+			case <-entry.ticker.C: // wait for next tick
+				m.HandleHeartbeat(ctx, entry)
 			}
-		})
-	}
+		}
+	})
 }
 
 func (m *HeartbeatManager) HandleHeartbeat(ctx context.Context, entry *heartbeatEntry) {
 	curHeartbeatCfg := entry.getCfg()
+	agentName := entry.agentName
+	result := "skipped"
+	defer func() {
+		metrics.HeartbeatRuns.WithLabelValues(agentName, result).Inc()
+	}()
+
 	if curHeartbeatCfg.Target == "" || curHeartbeatCfg.To == "" || curHeartbeatCfg.Prompt == "" {
 		return
 	}
 
-	agentName := entry.agentName
 	targetChannel := chmodel.Type(curHeartbeatCfg.Target)
 	bindingAccount := m.gateway.getAgentBindingAccount(agentName, targetChannel)
 	slog.InfoContext(ctx, "heartbeat triggered",
@@ -149,7 +183,7 @@ func (m *HeartbeatManager) HandleHeartbeat(ctx context.Context, entry *heartbeat
 	}
 
 	startAt := time.Now()
-	result := targetAgent.Ask(ctx, &agent.UserMessage{
+	answer := targetAgent.Ask(ctx, &agent.UserMessage{
 		Channel: curHeartbeatCfg.Target,
 		ChatId:  curHeartbeatCfg.To,
 		Content: curHeartbeatCfg.Prompt,
@@ -158,6 +192,7 @@ func (m *HeartbeatManager) HandleHeartbeat(ctx context.Context, entry *heartbeat
 	elapsed := time.Since(startAt)
 
 	if err := ctx.Err(); err != nil {
+		result = "canceled"
 		slog.WarnContext(ctx, "heartbeat ask canceled",
 			slog.String("agent", agentName),
 			slog.String("target", curHeartbeatCfg.Target),
@@ -169,7 +204,8 @@ func (m *HeartbeatManager) HandleHeartbeat(ctx context.Context, entry *heartbeat
 		return
 	}
 
-	if strings.HasPrefix(strings.TrimSpace(result), "HEARTBEAT_NOTHING") {
+	if strings.HasPrefix(strings.TrimSpace(answer), "HEARTBEAT_NOTHING") {
+		result = "nothing"
 		slog.InfoContext(ctx, "heartbeat nothing to do",
 			slog.String("agent", agentName),
 			slog.String("target", curHeartbeatCfg.Target),
@@ -184,10 +220,12 @@ func (m *HeartbeatManager) HandleHeartbeat(ctx context.Context, entry *heartbeat
 		ReceiverId: curHeartbeatCfg.To,
 		Channel:    targetChannel,
 		ChatId:     curHeartbeatCfg.To,
-		Content:    result,
+		Content:    answer,
 		Metadata:   nil,
 	}:
+		result = "delivered"
 	default:
+		result = "dropped"
 		slog.WarnContext(ctx, "heartbeat dropped: adapter output channel is full",
 			slog.String("agent", agentName),
 			slog.String("target", curHeartbeatCfg.Target),
@@ -197,20 +235,55 @@ func (m *HeartbeatManager) HandleHeartbeat(ctx context.Context, entry *heartbeat
 	}
 }
 
-func (m *HeartbeatManager) Update(agentName string, cfg config.AgentHeartbeatConfig) {
-	duration, err := time.ParseDuration(cfg.Every)
+// Update applies cfg to the heartbeat of the agent. The heartbeat is added if
+// the agent has none, and removed if cfg disables it.
+func (m *HeartbeatManager) Update(agentName string, cfg config.AgentHeartbeatConfig) error {
+	newEntry, err := newHeartbeatEntry(agentName, cfg)
 	if err != nil {
-		return
+		return err
+	}
+	if newEntry == nil {
+		m.Remove(agentName)
+		return nil
 	}
-	duration = max(duration, minHeartbeatInterval)
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	entry := m.entries[agentName]
 	if entry == nil {
-		return
+		m.entries[agentName] = newEntry
+		if m.rootCtx != nil {
+			m.run(m.rootCtx, newEntry)
+		}
+		return nil
 	}
 
+	newEntry.ticker.Stop()
 	entry.setCfg(cfg)
-	entry.ticker.Reset(duration)
+	entry.ticker.Reset(newEntry.every)
+
+	return nil
+}
+
+// Remove stops the heartbeat of the agent.
+func (m *HeartbeatManager) Remove(agentName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[agentName]; ok {
+		close(entry.stop)
+		delete(m.entries, agentName)
+	}
+}
+
+// List returns the current heartbeat config of every agent.
+func (m *HeartbeatManager) List() map[string]config.AgentHeartbeatConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cfgs := make(map[string]config.AgentHeartbeatConfig, len(m.entries))
+	for agentName, entry := range m.entries {
+		cfgs[agentName] = entry.getCfg()
+	}
+	return cfgs
 }
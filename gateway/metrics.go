@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// chat sessions are not used as labels, there is no bound on their number
+var (
+	chatQueueDepthDesc = prometheus.NewDesc(
+		"tokkibot_chat_queue_depth",
+		"Running and waiting tasks of all chat sessions of an agent and channel.",
+		[]string{"agent", "channel"}, nil,
+	)
+	chatQueueDepthMaxDesc = prometheus.NewDesc(
+		"tokkibot_chat_queue_depth_max",
+		"Running and waiting tasks of the busiest chat session of an agent and channel.",
+		[]string{"agent", "channel"}, nil,
+	)
+)
+
+var activeRunsDesc = prometheus.NewDesc(
+	"tokkibot_gateway_active_runs",
+	"Agent runs holding a gateway run slot.",
+	nil, nil,
+)
+
+// poolCollector reports chat pool queue depth at scrape time.
+type poolCollector struct {
+	gateway *Gateway
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- chatQueueDepthDesc
+	ch <- chatQueueDepthMaxDesc
+	ch <- activeRunsDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	depths := c.gateway.queueDepths()
+
+	c.gateway.poolMu.Lock()
+	for session, pool := range c.gateway.pools {
+		depths[session] += pool.Running() + pool.Waiting()
+	}
+	c.gateway.poolMu.Unlock()
+
+	type queueLabels struct{ agent, channel string }
+	total := make(map[queueLabels]int)
+	busiest := make(map[queueLabels]int)
+	for session, depth := range depths {
+		// sessions are keyed agent:channel:chat
+		agent, rest, _ := strings.Cut(session, ":")
+		channel, _, _ := strings.Cut(rest, ":")
+		labels := queueLabels{agent, channel}
+		total[labels] += depth
+		busiest[labels] = max(busiest[labels], depth)
+	}
+	for labels, depth := range total {
+		ch <- prometheus.MustNewConstMetric(chatQueueDepthDesc, prometheus.GaugeValue, float64(depth), labels.agent, labels.channel)
+		ch <- prometheus.MustNewConstMetric(chatQueueDepthMaxDesc, prometheus.GaugeValue, float64(busiest[labels]), labels.agent, labels.channel)
+	}
+	ch <- prometheus.MustNewConstMetric(activeRunsDesc, prometheus.GaugeValue, float64(c.gateway.runSlots.inUse()))
+}
@@ -0,0 +1,36 @@
+package gateway
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/panjf2000/ants/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPoolCollectorAggregatesSessions(t *testing.T) {
+	g := &Gateway{
+		queues: map[string]*chatQueue{
+			"main:lark:oc_1": {pending: make([]*chatTask, 3)},
+			"main:lark:oc_2": {pending: make([]*chatTask, 1)},
+			"ops:cli:chat":   {injected: make([]*chatTask, 2)},
+		},
+		pools:    map[string]*ants.Pool{},
+		runSlots: newRunSlots(),
+	}
+
+	expected := `
+# HELP tokkibot_chat_queue_depth Running and waiting tasks of all chat sessions of an agent and channel.
+# TYPE tokkibot_chat_queue_depth gauge
+tokkibot_chat_queue_depth{agent="main",channel="lark"} 4
+tokkibot_chat_queue_depth{agent="ops",channel="cli"} 2
+# HELP tokkibot_chat_queue_depth_max Running and waiting tasks of the busiest chat session of an agent and channel.
+# TYPE tokkibot_chat_queue_depth_max gauge
+tokkibot_chat_queue_depth_max{agent="main",channel="lark"} 3
+tokkibot_chat_queue_depth_max{agent="ops",channel="cli"} 2
+`
+	if err := testutil.CollectAndCompare(&poolCollector{gateway: g}, strings.NewReader(expected),
+		"tokkibot_chat_queue_depth", "tokkibot_chat_queue_depth_max"); err != nil {
+		t.Fatal(err)
+	}
+}
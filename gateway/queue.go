@@ -0,0 +1,365 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/agent"
+	chadapter "github.com/ryanreadbooks/tokkibot/channel/adapter"
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/component/tool"
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
+)
+
+// weight of the latest run when updating the average run duration
+const queueRunAvgWeight = 0.3
+
+// chatTask is a user message waiting to be handled by the agent.
+type chatTask struct {
+	rawMsg      *chmodel.IncomingMessage // the message to reply to
+	userMessage *agent.UserMessage
+	identity    config.Identity // permissions the task runs with
+	ctx         context.Context // carries trace info of the message
+}
+
+// mergeChatTasks merges two tasks into one turn. The merged task replies to
+// the latest message.
+func mergeChatTasks(prev, next *chatTask) *chatTask {
+	merged := *next.userMessage
+	merged.Content = joinNonEmpty(prev.userMessage.Content, next.userMessage.Content)
+	merged.Attachments = append(slices.Clone(prev.userMessage.Attachments), next.userMessage.Attachments...)
+
+	return &chatTask{
+		rawMsg:      next.rawMsg,
+		userMessage: &merged,
+		identity:    next.identity,
+		ctx:         next.ctx,
+	}
+}
+
+// canMerge reports whether two tasks may run as one turn. Tasks of different
+// roles never merge, so a message cannot borrow the permissions of another.
+func canMerge(a, b *chatTask) bool {
+	return a.identity.Role == b.identity.Role
+}
+
+func joinNonEmpty(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + "\n\n" + b
+}
+
+// chatQueue holds messages of a session which arrive while the agent is busy.
+// At most one run of a session is active at a time.
+type chatQueue struct {
+	mu       sync.Mutex
+	busy     bool
+	pending  []*chatTask
+	injected []*chatTask // waiting to be added to the running loop
+	running  *chatTask
+
+	cancel     context.CancelFunc // cancels the active run
+	runStartAt time.Time
+	avgRun     time.Duration // moving average of run durations
+}
+
+// observeRun updates the average run duration.
+func (q *chatQueue) observeRun(elapsed time.Duration) {
+	if q.avgRun == 0 {
+		q.avgRun = elapsed
+		return
+	}
+	q.avgRun = time.Duration(queueRunAvgWeight*float64(elapsed) + (1-queueRunAvgWeight)*float64(q.avgRun))
+}
+
+// estimateWait estimates how long a task at position (1-based) in pending
+// waits before it starts. Returns 0 if there is no run history yet.
+func (q *chatQueue) estimateWait(position int, now time.Time) time.Duration {
+	if q.avgRun == 0 {
+		return 0
+	}
+	remaining := max(q.avgRun-now.Sub(q.runStartAt), 0)
+	return remaining + time.Duration(position-1)*q.avgRun
+}
+
+// inFlight returns the number of messages running or waiting. Caller must
+// hold q.mu.
+func (q *chatQueue) inFlight() int {
+	n := len(q.pending) + len(q.injected)
+	if q.busy {
+		n++
+	}
+	return n
+}
+
+// takeInjected returns and clears the injected tasks.
+func (q *chatQueue) takeInjected() []*chatTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tasks := q.injected
+	q.injected = nil
+	return tasks
+}
+
+func (g *Gateway) getOrCreateQueue(key string) *chatQueue {
+	g.queuesMu.Lock()
+	defer g.queuesMu.Unlock()
+
+	q, ok := g.queues[key]
+	if !ok {
+		q = &chatQueue{}
+		g.queues[key] = q
+	}
+	return q
+}
+
+// enqueue hands the task to the session queue. If the session is idle, a run
+// starts right away; otherwise the task is handled according to the queue
+// mode of the agent and the user is told what happens to the message.
+func (g *Gateway) enqueue(
+	sessionKey string,
+	task *chatTask,
+	adapter chadapter.Adapter,
+	agentName string,
+) {
+	q := g.getOrCreateQueue(sessionKey)
+	mode := config.GetAgentEntry(agentName).GetQueueMode()
+
+	q.mu.Lock()
+	if !q.busy {
+		q.busy = true
+		q.pending = append(q.pending, task)
+		q.mu.Unlock()
+
+		chatPool := g.getOrCreatePool(sessionKey)
+		go chatPool.Submit(func() {
+			g.runQueue(sessionKey, q, adapter, agentName)
+		})
+		return
+	}
+
+	if limit := config.GetRateLimit(agentName).GetChatMaxInFlight(); limit > 0 && q.inFlight() >= limit {
+		q.mu.Unlock()
+		slog.WarnContext(task.ctx, "chat has too many messages in flight",
+			slog.String("session", sessionKey),
+			slog.Int("limit", limit))
+		g.replyFinal(adapter, task.rawMsg, "🚦 There are too many messages waiting in this chat. "+
+			"Please try again once I've caught up, or use /stop to clear the queue.")
+		return
+	}
+
+	var (
+		absorbed *chatTask // replaced by a merged task
+		notice   string
+	)
+	if mode == config.QueueModeInject && q.running != nil && !canMerge(q.running, task) {
+		mode = config.QueueModeQueue
+	}
+	switch mode {
+	case config.QueueModeInject:
+		// the user is notified once the message is picked up by the loop
+		q.injected = append(q.injected, task)
+	case config.QueueModeCoalesce, config.QueueModeInterrupt:
+		if last := len(q.pending) - 1; last >= 0 && canMerge(q.pending[last], task) {
+			absorbed = q.pending[last]
+			q.pending[last] = mergeChatTasks(absorbed, task)
+		} else {
+			q.pending = append(q.pending, task)
+		}
+		if mode == config.QueueModeInterrupt {
+			if q.cancel != nil {
+				q.cancel()
+			}
+			notice = "⏹ Interrupting the current task to handle your new message."
+		} else {
+			notice = "⏳ The agent is busy. Your messages will be handled together in the next turn" +
+				formatWait(q.estimateWait(len(q.pending), time.Now())) + "."
+		}
+	default:
+		q.pending = append(q.pending, task)
+		notice = fmt.Sprintf("⏳ The agent is busy. Your message is queued at position %d", len(q.pending)) +
+			formatWait(q.estimateWait(len(q.pending), time.Now())) + "."
+	}
+	q.mu.Unlock()
+
+	if absorbed != nil {
+		g.replyFinal(adapter, absorbed.rawMsg, "↪ Merged into your latest message.")
+	}
+	if notice != "" {
+		g.replyNotice(adapter, task.rawMsg, notice)
+	}
+}
+
+func formatWait(wait time.Duration) string {
+	if wait <= 0 {
+		return ""
+	}
+	return ", estimated wait ~" + wait.Round(time.Second).String()
+}
+
+// runQueue runs pending tasks of the session one after another until the
+// queue is empty.
+func (g *Gateway) runQueue(sessionKey string, q *chatQueue, adapter chadapter.Adapter, agentName string) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.busy = false
+			q.cancel = nil
+			q.running = nil
+			q.mu.Unlock()
+			return
+		}
+		task := q.pending[0]
+		q.pending = q.pending[1:]
+		q.running = task
+		runCtx, runCancel := context.WithCancel(task.ctx)
+		q.cancel = runCancel
+		q.runStartAt = time.Now()
+		q.mu.Unlock()
+
+		g.runningMu.Lock()
+		g.running[sessionKey] = runCancel
+		g.runningMu.Unlock()
+
+		if err := g.acquireRunSlot(runCtx, task.rawMsg, adapter); err == nil {
+			g.runTask(runCtx, sessionKey, q, task, adapter, agentName)
+			g.runSlots.release()
+		}
+		runCancel()
+
+		g.runningMu.Lock()
+		delete(g.running, sessionKey)
+		g.runningMu.Unlock()
+
+		var absorbed []*chatTask
+		q.mu.Lock()
+		q.observeRun(time.Since(q.runStartAt))
+		// messages which missed the running loop become the next turn
+		if len(q.injected) > 0 {
+			leftover := q.injected[0]
+			for _, t := range q.injected[1:] {
+				absorbed = append(absorbed, leftover)
+				leftover = mergeChatTasks(leftover, t)
+			}
+			q.injected = nil
+			q.pending = append(q.pending, leftover)
+		}
+		q.mu.Unlock()
+
+		for _, t := range absorbed {
+			g.replyFinal(adapter, t.rawMsg, "↪ Merged into your latest message.")
+		}
+	}
+}
+
+func (g *Gateway) runTask(
+	ctx context.Context,
+	sessionKey string,
+	q *chatQueue,
+	task *chatTask,
+	adapter chadapter.Adapter,
+	agentName string,
+) {
+	rawMsg := task.rawMsg
+	ctx, span := trace.StartSpan(ctx, "gateway.message",
+		trace.AttrAgent.String(agentName),
+		trace.AttrChannel.String(rawMsg.Channel.String()),
+		trace.AttrChatID.String(rawMsg.ChatId),
+	)
+	defer span.End()
+
+	injectOpt := agent.WithInjectedMessages(func() []*agent.UserMessage {
+		tasks := q.takeInjected()
+		msgs := make([]*agent.UserMessage, 0, len(tasks))
+		for _, t := range tasks {
+			convertAttachments(ctx, t.userMessage)
+			msgs = append(msgs, t.userMessage)
+			g.replyFinal(adapter, t.rawMsg, "➕ Added to the running task.")
+		}
+		if len(msgs) > 0 {
+			slog.InfoContext(ctx, "injecting messages into running task", slog.Int("count", len(msgs)))
+		}
+		return msgs
+	})
+
+	ctx = tool.WithToolFilter(ctx, task.identity.Policy.AllowsTool)
+	ctx = tool.WithConfirmer(ctx, g.newConfirmHandler(rawMsg, adapter, sessionKey, task.identity))
+	convertAttachments(ctx, task.userMessage)
+
+	if rawMsg.Stream {
+		g.workerDoStream(ctx, rawMsg, task.userMessage, adapter, agentName, injectOpt)
+	} else {
+		g.workerDo(ctx, rawMsg, task.userMessage, adapter, agentName, injectOpt)
+	}
+}
+
+// clearQueue drops pending and injected messages of the session and returns
+// how many were dropped.
+func (g *Gateway) clearQueue(sessionKey string) int {
+	g.queuesMu.Lock()
+	q, ok := g.queues[sessionKey]
+	g.queuesMu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	q.mu.Lock()
+	dropped := append(q.pending, q.injected...)
+	q.pending = nil
+	q.injected = nil
+	q.mu.Unlock()
+
+	for _, t := range dropped {
+		if t.rawMsg.Stream {
+			g.sendResponse(t.rawMsg, "Dropped by /stop")
+		}
+	}
+	return len(dropped)
+}
+
+// queueDepths returns the number of waiting messages of each session.
+func (g *Gateway) queueDepths() map[string]int {
+	g.queuesMu.Lock()
+	defer g.queuesMu.Unlock()
+
+	depths := make(map[string]int, len(g.queues))
+	for key, q := range g.queues {
+		q.mu.Lock()
+		depths[key] = len(q.pending) + len(q.injected)
+		q.mu.Unlock()
+	}
+	return depths
+}
+
+// replyFinal replies to the message and finishes it.
+func (g *Gateway) replyFinal(adapter chadapter.Adapter, rawMsg *chmodel.IncomingMessage, content string) {
+	if rawMsg.Stream {
+		g.sendResponse(rawMsg, content)
+		return
+	}
+	g.replyNotice(adapter, rawMsg, content)
+}
+
+// replyNotice replies to the message without finishing it.
+func (g *Gateway) replyNotice(adapter chadapter.Adapter, rawMsg *chmodel.IncomingMessage, content string) {
+	select {
+	case adapter.SendChan() <- &chmodel.OutgoingMessage{
+		ReceiverId: rawMsg.SenderId,
+		Channel:    rawMsg.Channel,
+		ChatId:     rawMsg.ChatId,
+		Content:    content,
+		Metadata:   rawMsg.Metadata,
+	}:
+	default:
+	}
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/agent"
+	agcontext "github.com/ryanreadbooks/tokkibot/agent/context"
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+)
+
+func TestMergeChatTasks(t *testing.T) {
+	first := &chatTask{
+		rawMsg: &chmodel.IncomingMessage{ChatId: "oc_1"},
+		userMessage: &agent.UserMessage{
+			Content:     "look at this",
+			Attachments: []*agcontext.UserInputAttachment{{Key: "img_1"}},
+		},
+	}
+	second := &chatTask{
+		rawMsg:      &chmodel.IncomingMessage{ChatId: "oc_1"},
+		userMessage: &agent.UserMessage{Content: "and tell me what it is"},
+	}
+
+	merged := mergeChatTasks(first, second)
+	if merged.rawMsg != second.rawMsg {
+		t.Fatal("merged task should reply to the latest message")
+	}
+	if merged.userMessage.Content != "look at this\n\nand tell me what it is" {
+		t.Fatalf("unexpected content: %q", merged.userMessage.Content)
+	}
+	if len(merged.userMessage.Attachments) != 1 || len(second.userMessage.Attachments) != 0 {
+		t.Fatal("attachments should be combined without touching the source")
+	}
+}
+
+func TestChatQueueEstimateWait(t *testing.T) {
+	q := &chatQueue{}
+	now := time.Now()
+	if wait := q.estimateWait(1, now); wait != 0 {
+		t.Fatalf("no history: got %s", wait)
+	}
+
+	q.observeRun(10 * time.Second)
+	q.observeRun(20 * time.Second)
+	if q.avgRun != 13*time.Second {
+		t.Fatalf("avg run: got %s", q.avgRun)
+	}
+
+	q.runStartAt = now.Add(-3 * time.Second)
+	if wait := q.estimateWait(2, now); wait != 23*time.Second {
+		t.Fatalf("position 2: got %s", wait)
+	}
+	q.runStartAt = now.Add(-time.Minute)
+	if wait := q.estimateWait(1, now); wait != 0 {
+		t.Fatalf("overdue run: got %s", wait)
+	}
+}
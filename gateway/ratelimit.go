@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	chadapter "github.com/ryanreadbooks/tokkibot/channel/adapter"
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/ratelimit"
+)
+
+const (
+	// sender limits are pruned once there are more than this many
+	senderLimitsPruneSize = 4096
+	// idle sender limits older than this are pruned
+	senderLimitIdle = 10 * time.Minute
+)
+
+// senderLimit is the message rate limit of a sender.
+type senderLimit struct {
+	bucket    *ratelimit.TokenBucket
+	perMinute int
+	burst     int
+	lastSeen  time.Time
+	notified  bool // the sender was told about the limit
+}
+
+// limiter holds per sender rate limits and the temporary block list.
+type limiter struct {
+	mu      sync.Mutex
+	senders map[string]*senderLimit // key: "agentName:channel:senderId"
+	blocked map[string]time.Time    // key: "channel:senderId", value: expiry
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		senders: make(map[string]*senderLimit),
+		blocked: make(map[string]time.Time),
+	}
+}
+
+// allow takes a token of the sender. When the sender is over the limit, it
+// returns the time until the next message is allowed, and whether the sender
+// should be notified, which happens once per limited streak.
+func (l *limiter) allow(key string, perMinute, burst int, now time.Time) (wait time.Duration, ok, notify bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sl, exists := l.senders[key]
+	if !exists || sl.perMinute != perMinute || sl.burst != burst {
+		if !exists && len(l.senders) >= senderLimitsPruneSize {
+			l.pruneLocked(now)
+		}
+		sl = &senderLimit{
+			bucket:    ratelimit.NewTokenBucket(ratelimit.PerMinute(perMinute), burst),
+			perMinute: perMinute,
+			burst:     burst,
+		}
+		l.senders[key] = sl
+	}
+	sl.lastSeen = now
+
+	wait, ok = sl.bucket.Reserve()
+	if ok {
+		sl.notified = false
+		return 0, true, false
+	}
+	notify = !sl.notified
+	sl.notified = true
+	return wait, false, notify
+}
+
+func (l *limiter) pruneLocked(now time.Time) {
+	for key, sl := range l.senders {
+		if now.Sub(sl.lastSeen) > senderLimitIdle {
+			delete(l.senders, key)
+		}
+	}
+}
+
+// block blocks the sender until the given time.
+func (l *limiter) block(sender string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.blocked[sender] = until
+}
+
+// unblock removes the sender from the block list and reports whether it was
+// blocked.
+func (l *limiter) unblock(sender string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.blocked[sender]
+	delete(l.blocked, sender)
+	return ok
+}
+
+// isBlocked reports whether the sender is blocked, dropping expired blocks.
+func (l *limiter) isBlocked(sender string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until, ok := l.blocked[sender]
+	if !ok {
+		return false
+	}
+	if now.After(until) {
+		delete(l.blocked, sender)
+		return false
+	}
+	return true
+}
+
+// blockedSenders returns blocked senders and their expiry.
+func (l *limiter) blockedSenders(now time.Time) map[string]time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	maps.DeleteFunc(l.blocked, func(_ string, until time.Time) bool {
+		return now.After(until)
+	})
+	return maps.Clone(l.blocked)
+}
+
+// runSlots limits agent runs of the gateway. The limit is read on every
+// acquire, so that config reloads apply to waiting runs.
+type runSlots struct {
+	mu     sync.Mutex
+	active int
+	freed  chan struct{} // closed when a slot is released
+}
+
+func newRunSlots() *runSlots {
+	return &runSlots{freed: make(chan struct{})}
+}
+
+// tryAcquire takes a slot if one is free. A non-positive limit is unlimited.
+func (s *runSlots) tryAcquire(limit int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit > 0 && s.active >= limit {
+		return false
+	}
+	s.active++
+	return true
+}
+
+// acquire waits until a slot is free or ctx is done.
+func (s *runSlots) acquire(ctx context.Context, limit func() int) error {
+	for {
+		s.mu.Lock()
+		if l := limit(); l <= 0 || s.active < l {
+			s.active++
+			s.mu.Unlock()
+			return nil
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *runSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
+
+func (s *runSlots) inUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// senderKey returns the block list key of a sender.
+func senderKey(channel, senderId string) string {
+	return channel + ":" + senderId
+}
+
+// admit checks the block list and the rate limit of the sender. Messages
+// which are not admitted are dropped, over-limit senders get a reply once.
+func (g *Gateway) admit(
+	ctx context.Context,
+	rawMsg *chmodel.IncomingMessage,
+	adapter chadapter.Adapter,
+	agentName string,
+) bool {
+	channel := rawMsg.Channel.String()
+	now := time.Now()
+	if g.limiter.isBlocked(senderKey(channel, rawMsg.SenderId), now) {
+		if g.verbose {
+			slog.InfoContext(ctx, "dropped message of blocked sender",
+				slog.String("sender_id", rawMsg.SenderId),
+				slog.String("chat_id", rawMsg.ChatId))
+		}
+		return false
+	}
+
+	limits := config.GetRateLimit(agentName)
+	perMinute := limits.GetSenderPerMinute()
+	if perMinute <= 0 || rawMsg.SenderId == "" {
+		return true
+	}
+
+	key := agentName + ":" + senderKey(channel, rawMsg.SenderId)
+	wait, ok, notify := g.limiter.allow(key, perMinute, limits.GetSenderBurst(), now)
+	if ok {
+		return true
+	}
+
+	slog.WarnContext(ctx, "sender rate limited",
+		slog.String("agent", agentName),
+		slog.String("sender_id", rawMsg.SenderId),
+		slog.String("chat_id", rawMsg.ChatId))
+	if notify {
+		g.replyFinal(adapter, rawMsg, fmt.Sprintf(
+			"🐢 You're sending messages faster than I can keep up with. Please wait ~%s and try again.",
+			max(wait.Round(time.Second), time.Second)))
+	}
+	return false
+}
+
+// acquireRunSlot waits for a gateway wide run slot. The user is told when the
+// message has to wait.
+func (g *Gateway) acquireRunSlot(
+	ctx context.Context,
+	rawMsg *chmodel.IncomingMessage,
+	adapter chadapter.Adapter,
+) error {
+	limit := func() int { return config.GetConfig().RateLimit.GetMaxConcurrentRuns() }
+	if g.runSlots.tryAcquire(limit()) {
+		return nil
+	}
+	g.replyNotice(adapter, rawMsg, "⏳ Many conversations are running right now. Your message will start as soon as possible.")
+	return g.runSlots.acquire(ctx, limit)
+}
+
+// parseSender parses a sender of a /block command, either "ou_xxx" of the
+// current channel or "lark:ou_xxx".
+func parseSender(arg string, channel chmodel.Type) string {
+	if strings.Contains(arg, ":") {
+		return arg
+	}
+	return senderKey(channel.String(), arg)
+}
+
+func (g *Gateway) handleBlock(rawMsg *chmodel.IncomingMessage, agentName string) {
+	args := strings.Fields(strings.TrimPrefix(strings.TrimSpace(rawMsg.Content), string(ControlCmdBlock)))
+	if len(args) == 0 {
+		g.sendResponse(rawMsg, "Usage: /block <sender_id> [duration] or /block list")
+		return
+	}
+	if strings.ToLower(args[0]) == "list" {
+		g.handleBlockList(rawMsg)
+		return
+	}
+
+	durationStr := config.GetRateLimit(agentName).GetBlockDuration()
+	if len(args) > 1 {
+		durationStr = args[1]
+	}
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil || duration <= 0 {
+		g.sendResponse(rawMsg, fmt.Sprintf("Invalid duration: %s", durationStr))
+		return
+	}
+
+	sender := parseSender(args[0], rawMsg.Channel)
+	g.limiter.block(sender, time.Now().Add(duration))
+	slog.WarnContext(rawMsg.Context(), "sender blocked",
+		slog.String("sender", sender),
+		slog.String("by", rawMsg.SenderId),
+		slog.Duration("duration", duration))
+	g.sendResponse(rawMsg, fmt.Sprintf("🚫 `%s` is blocked for %s", sender, duration))
+}
+
+func (g *Gateway) handleBlockList(rawMsg *chmodel.IncomingMessage) {
+	now := time.Now()
+	blocked := g.limiter.blockedSenders(now)
+	if len(blocked) == 0 {
+		g.sendResponse(rawMsg, "No blocked senders")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("**Blocked Senders:**\n")
+	for _, sender := range slices.Sorted(maps.Keys(blocked)) {
+		fmt.Fprintf(&sb, "- `%s` (%s left)\n", sender, blocked[sender].Sub(now).Round(time.Second))
+	}
+	g.sendResponse(rawMsg, sb.String())
+}
+
+func (g *Gateway) handleUnblock(rawMsg *chmodel.IncomingMessage) {
+	args := strings.Fields(strings.TrimPrefix(strings.TrimSpace(rawMsg.Content), string(ControlCmdUnblock)))
+	if len(args) == 0 {
+		g.sendResponse(rawMsg, "Usage: /unblock <sender_id>")
+		return
+	}
+
+	sender := parseSender(args[0], rawMsg.Channel)
+	if !g.limiter.unblock(sender) {
+		g.sendResponse(rawMsg, fmt.Sprintf("`%s` is not blocked", sender))
+		return
+	}
+	g.sendResponse(rawMsg, fmt.Sprintf("✅ `%s` is unblocked", sender))
+}
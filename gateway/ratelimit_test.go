@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	l := newLimiter()
+	now := time.Now()
+
+	for i := range 2 {
+		if _, ok, _ := l.allow("main:lark:ou_1", 60, 2, now); !ok {
+			t.Fatalf("message %d should be allowed within burst", i)
+		}
+	}
+	_, ok, notify := l.allow("main:lark:ou_1", 60, 2, now)
+	if ok || !notify {
+		t.Fatalf("over limit: ok=%v notify=%v", ok, notify)
+	}
+	if _, _, notify = l.allow("main:lark:ou_1", 60, 2, now); notify {
+		t.Fatal("sender should be notified once per streak")
+	}
+	if _, ok, _ := l.allow("main:lark:ou_2", 60, 2, now); !ok {
+		t.Fatal("other senders should not be limited")
+	}
+}
+
+func TestLimiterBlock(t *testing.T) {
+	l := newLimiter()
+	now := time.Now()
+
+	l.block("lark:ou_1", now.Add(time.Minute))
+	if !l.isBlocked("lark:ou_1", now) {
+		t.Fatal("sender should be blocked")
+	}
+	if l.isBlocked("lark:ou_1", now.Add(2*time.Minute)) {
+		t.Fatal("block should expire")
+	}
+	if len(l.blockedSenders(now)) != 0 {
+		t.Fatal("expired block should be dropped")
+	}
+
+	l.block("lark:ou_2", now.Add(time.Minute))
+	if !l.unblock("lark:ou_2") || l.isBlocked("lark:ou_2", now) {
+		t.Fatal("sender should be unblocked")
+	}
+}
+
+func TestRunSlots(t *testing.T) {
+	s := newRunSlots()
+	limit := func() int { return 1 }
+
+	if !s.tryAcquire(limit()) {
+		t.Fatal("first slot should be free")
+	}
+	if s.tryAcquire(limit()) {
+		t.Fatal("second slot should be taken")
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- s.acquire(context.Background(), limit) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should wait for a release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.release()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.acquire(ctx, limit); err == nil {
+		t.Fatal("acquire should fail once ctx is done")
+	}
+}
@@ -0,0 +1,313 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"github.com/ryanreadbooks/tokkibot/config"
+)
+
+// ReloadConfig reloads config.json and the mcp configs from disk and applies
+// the differences to the running gateway. An invalid config is rejected as a
+// whole and the current config is kept. Returns the applied changes.
+func (g *Gateway) ReloadConfig(ctx context.Context) ([]string, error) {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	prev, err := config.ReloadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	r := &configReloader{
+		g:    g,
+		ctx:  ctx,
+		prev: prev,
+		cur:  config.GetConfig(),
+	}
+	r.applyAgents()
+	r.applyBindings()
+	r.applyHeartbeats()
+	r.applyMcp()
+
+	if !reflect.DeepEqual(prev.Webhook, r.cur.Webhook) ||
+		!reflect.DeepEqual(prev.Admin, r.cur.Admin) ||
+		!reflect.DeepEqual(prev.Tracing, r.cur.Tracing) {
+		slog.WarnContext(ctx, "webhook, admin or tracing config changed, restart the gateway to apply")
+	}
+
+	slog.InfoContext(ctx, "config reloaded",
+		slog.Any("changes", r.changes),
+		slog.Int("errors", len(r.errs)),
+	)
+	return r.changes, errors.Join(r.errs...)
+}
+
+// configReloader applies the differences between two configs.
+type configReloader struct {
+	g         *Gateway
+	ctx       context.Context
+	prev, cur config.Config
+
+	changes []string
+	errs    []error
+}
+
+func (r *configReloader) changef(format string, args ...any) {
+	r.changes = append(r.changes, fmt.Sprintf(format, args...))
+}
+
+func (r *configReloader) fail(err error) {
+	slog.ErrorContext(r.ctx, "failed to apply config change", slog.Any("error", err))
+	r.errs = append(r.errs, err)
+}
+
+// agentEntry returns the entry of the agent in c. Virtual agents use the
+// entry of the main agent.
+func agentEntry(c *config.Config, name string) *config.AgentEntry {
+	for i := range c.Agents {
+		if c.Agents[i].Name == name {
+			return &c.Agents[i]
+		}
+	}
+	if name == config.CronsAgentName {
+		return agentEntry(c, config.MainAgentName)
+	}
+	return nil
+}
+
+// applyAgents updates llm clients, iterations and sandboxes of existing
+// agents, starts added agents and drops removed ones.
+func (r *configReloader) applyAgents() {
+	g := r.g
+
+	for _, name := range g.agentNames() {
+		ag := g.getAgent(name)
+		prevEntry, curEntry := agentEntry(&r.prev, name), agentEntry(&r.cur, name)
+		if curEntry == nil {
+			if name == config.MainAgentName || name == config.CronsAgentName {
+				continue
+			}
+			g.agentsMu.Lock()
+			delete(g.agents, name)
+			g.agentsMu.Unlock()
+			r.changef("agent %s removed", name)
+			continue
+		}
+		if prevEntry == nil {
+			continue
+		}
+
+		if prevEntry.Provider != curEntry.Provider ||
+			prevEntry.Model != curEntry.Model ||
+			!reflect.DeepEqual(r.prev.Providers[curEntry.Provider], r.cur.Providers[curEntry.Provider]) {
+			if err := ag.SetProviderAndModel(curEntry.Provider, curEntry.Model); err != nil {
+				r.fail(fmt.Errorf("agent %s: %w", name, err))
+			} else {
+				r.changef("agent %s llm updated (%s/%s)", name, ag.GetProvider(), ag.GetModel())
+			}
+		}
+		if prevEntry.MaxIteration != curEntry.MaxIteration {
+			ag.SetMaxIteration(curEntry.MaxIteration)
+			r.changef("agent %s max iteration set to %d", name, curEntry.MaxIteration)
+		}
+		if !reflect.DeepEqual(prevEntry.Sandbox, curEntry.Sandbox) {
+			ag.SetSandbox(curEntry.Sandbox)
+			r.changef("agent %s sandbox updated", name)
+		}
+		if !reflect.DeepEqual(r.prev.WebFetch, r.cur.WebFetch) || !reflect.DeepEqual(r.prev.WebSearch, r.cur.WebSearch) {
+			ag.SetWeb(r.cur.WebFetch, r.cur.WebSearch)
+			r.changef("agent %s web tools updated", name)
+		}
+	}
+
+	if !g.allAgents {
+		return
+	}
+	for _, entry := range r.cur.Agents {
+		if g.getAgent(entry.Name) != nil {
+			continue
+		}
+		ag, err := prepareAgent(g.rootCtx, entry.Name, g.option)
+		if err != nil {
+			r.fail(err)
+			continue
+		}
+		g.agentsMu.Lock()
+		g.agents[entry.Name] = ag
+		g.agentsMu.Unlock()
+		r.changef("agent %s added", entry.Name)
+	}
+}
+
+type desiredRouter struct {
+	channel string
+	account string
+	rules   []*routeRule
+}
+
+// applyBindings updates routing rules of running adapters, starts adapters
+// for added channel accounts and stops adapters of removed ones. Adapters
+// whose account config changed are restarted.
+func (r *configReloader) applyBindings() {
+	g := r.g
+
+	var (
+		desired = make(map[string]*desiredRouter)
+		order   []string
+	)
+	for _, entry := range r.cur.Agents {
+		if entry.Binding == nil || g.getAgent(entry.Name) == nil {
+			continue
+		}
+		match := entry.Binding.Match
+		key := match.Channel + ":" + match.Account
+		d, ok := desired[key]
+		if !ok {
+			d = &desiredRouter{channel: match.Channel, account: match.Account}
+			desired[key] = d
+			order = append(order, key)
+		}
+		d.rules = append(d.rules, newRouteRule(entry.Name, match.ChatIds))
+	}
+
+	// only routers created from bindings are managed here
+	managed := make(map[string]struct{})
+	for _, entry := range r.prev.Agents {
+		if entry.Binding != nil {
+			managed[entry.Binding.Match.Channel+":"+entry.Binding.Match.Account] = struct{}{}
+		}
+	}
+
+	g.routersMu.Lock()
+	defer g.routersMu.Unlock()
+
+	routers := make([]*adapterRouter, 0, len(g.routers))
+	existing := make(map[string]*adapterRouter, len(g.routers))
+	for _, router := range g.routers {
+		key := router.key()
+		if _, ok := managed[key]; !ok {
+			routers = append(routers, router)
+			continue
+		}
+
+		d, ok := desired[key]
+		switch {
+		case !ok:
+			g.stopRouter(router)
+			r.changef("adapter %s stopped", key)
+		case !bytes.Equal(channelAccountRaw(&r.prev, d.channel, d.account), channelAccountRaw(&r.cur, d.channel, d.account)):
+			g.stopRouter(router)
+			r.changef("adapter %s stopped for restart", key)
+		default:
+			if router.setRules(d.rules) {
+				r.changef("adapter %s routes to %v", key, router.agentNames())
+			}
+			routers = append(routers, router)
+			existing[key] = router
+		}
+	}
+
+	for _, key := range order {
+		if _, ok := existing[key]; ok {
+			continue
+		}
+		d := desired[key]
+		if g.option.adapterFactory == nil {
+			r.fail(fmt.Errorf("adapter %s: no adapter factory, restart the gateway to apply", key))
+			continue
+		}
+		adapter, err := g.option.adapterFactory(d.channel, d.account)
+		if err != nil {
+			r.fail(fmt.Errorf("adapter %s: %w", key, err))
+			continue
+		}
+
+		router := &adapterRouter{adapter: adapter, account: d.account, rules: d.rules}
+		routers = append(routers, router)
+		g.indexAdapter(adapter, d.account)
+		if g.runCtx != nil {
+			g.startRouter(g.runCtx, router)
+		}
+		r.changef("adapter %s started", key)
+	}
+
+	g.routers = routers
+}
+
+// stopRouter stops the adapter and its worker and removes it from the
+// adapter index. Callers must hold routersMu.
+func (g *Gateway) stopRouter(router *adapterRouter) {
+	if router.cancel != nil {
+		router.cancel()
+	}
+
+	g.channelAdaptersMu.Lock()
+	defer g.channelAdaptersMu.Unlock()
+	byAccount := g.channelAdapters[router.adapter.Type()]
+	if byAccount[router.account] == router.adapter {
+		delete(byAccount, router.account)
+	}
+}
+
+func channelAccountRaw(c *config.Config, channel, account string) json.RawMessage {
+	for _, ch := range c.Channels {
+		if ch.Name == channel {
+			return ch.Account[account]
+		}
+	}
+	return nil
+}
+
+// applyHeartbeats adds, updates and removes heartbeats of agents.
+func (r *configReloader) applyHeartbeats() {
+	g := r.g
+	current := g.heartbeatMgr.List()
+
+	for _, name := range g.agentNames() {
+		entry := agentEntry(&r.cur, name)
+		if name == config.CronsAgentName {
+			continue
+		}
+
+		_, running := current[name]
+		if entry == nil || entry.Heartbeat == nil {
+			if running {
+				g.heartbeatMgr.Remove(name)
+				r.changef("heartbeat of agent %s removed", name)
+			}
+			continue
+		}
+		if running && current[name] == *entry.Heartbeat {
+			continue
+		}
+		if err := g.heartbeatMgr.Update(name, *entry.Heartbeat); err != nil {
+			r.fail(fmt.Errorf("heartbeat of agent %s: %w", name, err))
+			continue
+		}
+		r.changef("heartbeat of agent %s updated", name)
+	}
+}
+
+// applyMcp reconnects mcp servers of all agents if the mcp config changed.
+func (r *configReloader) applyMcp() {
+	g := r.g
+	mcpCfg, _ := config.GetMcpConfig()
+	if reflect.DeepEqual(g.mcpCfg, mcpCfg) {
+		return
+	}
+	g.mcpCfg = mcpCfg
+
+	for _, name := range g.agentNames() {
+		// mcp clients live as long as the gateway, not the reload request
+		if err := g.getAgent(name).ReloadMcp(g.rootCtx); err != nil {
+			r.fail(fmt.Errorf("agent %s: %w", name, err))
+		}
+	}
+	r.changef("mcp servers reloaded")
+}
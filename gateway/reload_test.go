@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ryanreadbooks/tokkibot/agent"
+	chadapter "github.com/ryanreadbooks/tokkibot/channel/adapter"
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/config"
+)
+
+type fakeAdapter struct {
+	in      chan *chmodel.IncomingMessage
+	out     chan *chmodel.OutgoingMessage
+	stopped chan struct{}
+}
+
+func newFakeAdapter() *fakeAdapter {
+	return &fakeAdapter{
+		in:      make(chan *chmodel.IncomingMessage),
+		out:     make(chan *chmodel.OutgoingMessage, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (a *fakeAdapter) Type() chmodel.Type                           { return chmodel.Lark }
+func (a *fakeAdapter) ReceiveChan() <-chan *chmodel.IncomingMessage { return a.in }
+func (a *fakeAdapter) SendChan() chan<- *chmodel.OutgoingMessage    { return a.out }
+func (a *fakeAdapter) Start(ctx context.Context) error {
+	<-ctx.Done()
+	close(a.stopped)
+	return ctx.Err()
+}
+
+func bindingConfig(bindings map[string]string) config.Config {
+	c := config.Config{
+		Channels: []config.ChannelEntry{{
+			Name: "lark",
+			Account: map[string]json.RawMessage{
+				"acc1": json.RawMessage(`{"appId":"1"}`),
+				"acc2": json.RawMessage(`{"appId":"2"}`),
+			},
+		}},
+	}
+	for agentName, account := range bindings {
+		c.Agents = append(c.Agents, config.AgentEntry{
+			Name: agentName,
+			Binding: &config.AgentBinding{
+				Match: config.AgentBindingMatch{Channel: "lark", Account: account},
+			},
+		})
+	}
+	return c
+}
+
+func TestReloadApplyBindings(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	created := make(map[string]*fakeAdapter)
+	g := &Gateway{
+		agents: map[string]*agent.Agent{
+			"a": {},
+			"b": {},
+		},
+		channelAdapters: make(map[chmodel.Type]map[string]chadapter.Adapter),
+		option: &gatewayOption{
+			adapterFactory: func(channel, account string) (chadapter.Adapter, error) {
+				adapter := newFakeAdapter()
+				created[account] = adapter
+				return adapter, nil
+			},
+		},
+		runCtx: ctx,
+	}
+
+	acc1 := newFakeAdapter()
+	g.AddAdapterWithRouting(acc1, "a", "acc1", nil)
+	g.startRouter(ctx, g.routers[0])
+
+	// b is bound to a new account
+	r := &configReloader{
+		g:    g,
+		ctx:  ctx,
+		prev: bindingConfig(map[string]string{"a": "acc1"}),
+		cur:  bindingConfig(map[string]string{"a": "acc1", "b": "acc2"}),
+	}
+	r.applyBindings()
+	if len(r.errs) > 0 || len(g.listRouters()) != 2 || created["acc2"] == nil {
+		t.Fatalf("acc2 adapter not started: changes=%v errs=%v", r.changes, r.errs)
+	}
+	if g.getAdapterByAccount(chmodel.Lark, "acc2") != created["acc2"] {
+		t.Fatal("acc2 adapter not indexed")
+	}
+
+	// a is moved to acc2, acc1 is no longer used
+	r = &configReloader{
+		g:    g,
+		ctx:  ctx,
+		prev: r.cur,
+		cur:  bindingConfig(map[string]string{"a": "acc2", "b": "acc2"}),
+	}
+	r.applyBindings()
+	<-acc1.stopped
+
+	routers := g.listRouters()
+	if len(routers) != 1 || len(routers[0].agentNames()) != 2 {
+		t.Fatalf("unexpected routers after reload: %v", r.changes)
+	}
+	if g.getAdapterByAccount(chmodel.Lark, "acc1") != nil {
+		t.Fatal("acc1 adapter still indexed")
+	}
+}
@@ -1,10 +1,24 @@
 package gateway
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/ryanreadbooks/tokkibot/agent"
+	"github.com/ryanreadbooks/tokkibot/agent/ref"
 	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/pkg/document"
+	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
 )
 
+// maxDocumentAttachmentChars bounds the converted text of a document sent
+// along with a message, the rest is read with load_ref.
+const maxDocumentAttachmentChars = 20000
+
 func extractAttachments(msg *chmodel.IncomingMessage) []*agent.UserMessageAttachment {
 	attachments := make([]*agent.UserMessageAttachment, 0, len(msg.Attachments))
 	for _, attachment := range msg.Attachments {
@@ -18,3 +32,69 @@ func extractAttachments(msg *chmodel.IncomingMessage) []*agent.UserMessageAttach
 
 	return attachments
 }
+
+// convertAttachments converts the document attachments of the message. It is
+// called when the task runs, so a large document does not hold up the
+// message loop of the adapter.
+func convertAttachments(ctx context.Context, msg *agent.UserMessage) {
+	for _, att := range msg.Attachments {
+		if att.Type == agent.AttachmentType(chmodel.AttachmentFile) {
+			convertDocumentAttachment(ctx, att)
+		}
+	}
+}
+
+// convertDocumentAttachment replaces a PDF, office or CSV file by its
+// markdown. The whole markdown is saved as a ref, long documents are cut
+// with a note on reading on with load_ref.
+func convertDocumentAttachment(ctx context.Context, att *agent.UserMessageAttachment) {
+	format := document.Detect(att.Key, att.Data)
+	if format == "" {
+		return
+	}
+
+	// the parsers read files sent by anyone in the chat
+	defer func() {
+		if err := recover(); err != nil {
+			slog.ErrorContext(ctx, "[gateway] document attachment conversion panic",
+				slog.String("key", att.Key),
+				slog.Any("error", err),
+				slog.String("stack", string(debug.Stack())))
+			att.Data = fmt.Appendf(nil, "[Document %s could not be read]", att.Key)
+			att.MimeType = "text/plain"
+		}
+	}()
+
+	markdown, err := document.ToMarkdown(format, att.Data)
+	if err != nil {
+		slog.WarnContext(ctx, "[gateway] failed to convert document attachment",
+			slog.String("key", att.Key), slog.String("format", string(format)), slog.Any("error", err))
+		att.Data = fmt.Appendf(nil, "[Document %s could not be read: %v]", att.Key, err)
+		att.MimeType = "text/plain"
+		return
+	}
+
+	total := utf8.RuneCountInString(markdown)
+	refName, err := ref.Save(markdown)
+	if err != nil {
+		slog.WarnContext(ctx, "[gateway] failed to save document attachment", slog.String("key", att.Key), slog.Any("error", err))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Document %s, %s, %d characters", att.Key, format, total)
+	if refName != "" {
+		fmt.Fprintf(&b, ", saved as %s", refName)
+	}
+	b.WriteString("]\n\n")
+	if total > maxDocumentAttachmentChars {
+		b.WriteString(xstring.Truncate(markdown, maxDocumentAttachmentChars))
+		if refName != "" {
+			fmt.Fprintf(&b, "\n\n[The first %d characters are shown, call load_ref with name %s and offset %d to read on]",
+				maxDocumentAttachmentChars, refName, maxDocumentAttachmentChars)
+		}
+	} else {
+		b.WriteString(markdown)
+	}
+	att.Data = []byte(b.String())
+	att.MimeType = "text/markdown"
+}
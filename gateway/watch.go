@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/config"
+)
+
+const configWatchInterval = 2 * time.Second
+
+// configFiles returns paths of the config files that affect the gateway.
+func configFiles() []string {
+	var paths []string
+	for _, get := range []func() (string, error){
+		config.GetWorkspaceConfigPath,
+		config.GetWorkspaceMcpConfigPath,
+		config.GetProjectMcpConfigPath,
+	} {
+		if path, err := get(); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// fileSums holds content checksums of files. Missing files have no sum.
+type fileSums map[string][sha256.Size]byte
+
+func readFileSums(paths []string) fileSums {
+	sums := make(fileSums, len(paths))
+	for _, path := range paths {
+		if content, err := os.ReadFile(path); err == nil {
+			sums[path] = sha256.Sum256(content)
+		}
+	}
+	return sums
+}
+
+func (s fileSums) equal(other fileSums) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for path, sum := range s {
+		if other[path] != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// watchConfig polls config files and reloads the config once they stop
+// changing, so that a reload does not see a half written file.
+func (g *Gateway) watchConfig(ctx context.Context) {
+	paths := configFiles()
+	last := readFileSums(paths)
+
+	g.wg.Go(func() {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+
+		pending := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			sums := readFileSums(paths)
+			if !sums.equal(last) {
+				last = sums
+				pending = true
+				continue
+			}
+			if !pending {
+				continue
+			}
+			pending = false
+
+			slog.InfoContext(ctx, "config files changed, reloading")
+			if _, err := g.ReloadConfig(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to reload config", slog.Any("error", err))
+			}
+		}
+	})
+}
@@ -0,0 +1,429 @@
+package gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/agent"
+	chmodel "github.com/ryanreadbooks/tokkibot/channel/model"
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/ratelimit"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
+	"github.com/ryanreadbooks/tokkibot/pkg/xstring"
+)
+
+const (
+	webhookChannel        = "webhook"
+	webhookPathPrefix     = "/hooks/"
+	webhookSecretHeader   = "X-Tokkibot-Secret"
+	maxWebhookBodyBytes   = 1 << 20 // 1MB
+	webhookShutdownWait   = 5 * time.Second
+	webhookReadHeaderWait = 10 * time.Second
+)
+
+var (
+	errWebhookUnauthorized = errors.New("invalid webhook secret or signature")
+	errWebhookBusy         = errors.New("too many webhook runs waiting")
+)
+
+type webhookHook struct {
+	cfg     config.WebhookEntry
+	tmpl    *template.Template
+	limiter *ratelimit.TokenBucket
+}
+
+// webhookTemplateData is the data passed to the hook prompt template
+type webhookTemplateData struct {
+	Name    string
+	Payload any // decoded json body, nil if the body is not json
+	Headers map[string]string
+	Query   map[string]string
+	Body    string
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v any) string {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	},
+	"truncate": func(n int, s string) string {
+		return xstring.Truncate(s, n)
+	},
+}
+
+// WebhookManager serves configured inbound http triggers and turns
+// incoming payloads into agent runs.
+type WebhookManager struct {
+	listen string
+	hooks  map[string]*webhookHook
+
+	rootCtx context.Context
+	gateway *Gateway
+
+	queuesMu sync.Mutex
+	queues   map[string]*webhookQueue // by session key
+}
+
+// webhookQueue holds the runs of a hook session. At most one run of a
+// session is active at a time, like chat messages.
+type webhookQueue struct {
+	mu      sync.Mutex
+	busy    bool
+	pending []*webhookRun
+}
+
+type webhookRun struct {
+	hook      *webhookHook
+	prompt    string
+	traceInfo *trace.TraceInfo
+}
+
+func NewWebhookManager(gateway *Gateway, cfg *config.WebhookConfig) *WebhookManager {
+	hooks := make(map[string]*webhookHook, len(cfg.Hooks))
+	for _, entry := range cfg.Hooks {
+		if entry.Name == "" || strings.Contains(entry.Name, "/") {
+			slog.Warn("invalid webhook name, skipped", slog.String("name", entry.Name))
+			continue
+		}
+		tmpl, err := template.New(entry.Name).
+			Funcs(webhookTemplateFuncs).
+			Parse(entry.Template)
+		if err != nil {
+			slog.Warn("invalid webhook template, skipped",
+				slog.String("name", entry.Name),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		if entry.Secret == "" {
+			if !entry.Insecure {
+				slog.Warn("webhook has no secret, skipped", slog.String("name", entry.Name))
+				continue
+			}
+			slog.Warn("webhook is insecure, requests will not be verified",
+				slog.String("name", entry.Name))
+		}
+
+		hooks[entry.Name] = &webhookHook{
+			cfg:     entry,
+			tmpl:    tmpl,
+			limiter: ratelimit.NewTokenBucket(ratelimit.PerMinute(entry.GetRatePerMinute()), entry.GetBurst()),
+		}
+	}
+
+	return &WebhookManager{
+		listen:  cfg.GetListen(),
+		hooks:   hooks,
+		gateway: gateway,
+		queues:  make(map[string]*webhookQueue),
+	}
+}
+
+// Start serves webhooks in a separate goroutine until ctx is done.
+func (m *WebhookManager) Start(ctx context.Context) {
+	m.rootCtx = ctx
+
+	mux := http.NewServeMux()
+	mux.Handle(webhookPathPrefix, m)
+	server := &http.Server{
+		Addr:              m.listen,
+		Handler:           mux,
+		ReadHeaderTimeout: webhookReadHeaderWait,
+	}
+
+	m.gateway.wg.Go(func() {
+		slog.InfoContext(ctx, "webhook server started",
+			slog.String("listen", m.listen),
+			slog.Int("hooks", len(m.hooks)),
+		)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.ErrorContext(ctx, "webhook server stopped", slog.Any("error", err))
+		}
+	})
+
+	m.gateway.wg.Go(func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownWait)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	})
+}
+
+func (m *WebhookManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, webhookPathPrefix)
+	hook, ok := m.hooks[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebhookBodyBytes {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := verifyWebhookRequest(&hook.cfg, r.Header, body); err != nil {
+		slog.WarnContext(r.Context(), "webhook verification failed",
+			slog.String("name", name),
+			slog.String("remote", r.RemoteAddr),
+		)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if wait, ok := hook.limiter.Reserve(); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	prompt, err := renderWebhookPrompt(hook.tmpl, name, r, body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to render prompt: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	agentName := hook.cfg.GetAgent()
+	if m.gateway.getAgent(agentName) == nil {
+		http.Error(w, fmt.Sprintf("agent %s not found", agentName), http.StatusInternalServerError)
+		return
+	}
+
+	traceInfo := trace.NewTraceInfo(webhookChannel, hook.cfg.GetChatId(), "")
+	if err := m.trigger(hook, prompt, traceInfo); err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status": "accepted",
+		"req_id": traceInfo.ReqID,
+	})
+}
+
+// trigger queues an agent run for the hook. Runs of the same hook session
+// are serialized and bounded just like chat messages.
+func (m *WebhookManager) trigger(hook *webhookHook, prompt string, traceInfo *trace.TraceInfo) error {
+	agentName := hook.cfg.GetAgent()
+	sessionKey := fmt.Sprintf("%s:%s:%s", agentName, webhookChannel, hook.cfg.GetChatId())
+	q := m.getOrCreateQueue(sessionKey)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	inFlight := len(q.pending)
+	if q.busy {
+		inFlight++
+	}
+	if limit := config.GetRateLimit(agentName).GetChatMaxInFlight(); limit > 0 && inFlight >= limit {
+		return errWebhookBusy
+	}
+
+	q.pending = append(q.pending, &webhookRun{hook: hook, prompt: prompt, traceInfo: traceInfo})
+	if !q.busy {
+		q.busy = true
+		go m.runQueue(sessionKey, q)
+	}
+	return nil
+}
+
+func (m *WebhookManager) getOrCreateQueue(key string) *webhookQueue {
+	m.queuesMu.Lock()
+	defer m.queuesMu.Unlock()
+
+	q, ok := m.queues[key]
+	if !ok {
+		q = &webhookQueue{}
+		m.queues[key] = q
+	}
+	return q
+}
+
+// runQueue runs pending runs of the session one after another until the
+// queue is empty. The active run is registered as running so that it can be
+// stopped, and takes a run slot of the gateway.
+func (m *WebhookManager) runQueue(sessionKey string, q *webhookQueue) {
+	g := m.gateway
+	limit := func() int { return config.GetConfig().RateLimit.GetMaxConcurrentRuns() }
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.busy = false
+			q.mu.Unlock()
+			return
+		}
+		run := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		runCtx, runCancel := context.WithCancel(trace.WithTrace(m.rootCtx, run.traceInfo))
+		g.runningMu.Lock()
+		g.running[sessionKey] = runCancel
+		g.runningMu.Unlock()
+
+		if err := g.runSlots.acquire(runCtx, limit); err == nil {
+			m.handleHook(runCtx, run.hook, run.prompt)
+			g.runSlots.release()
+		}
+		runCancel()
+
+		g.runningMu.Lock()
+		delete(g.running, sessionKey)
+		g.runningMu.Unlock()
+	}
+}
+
+func (m *WebhookManager) handleHook(ctx context.Context, hook *webhookHook, prompt string) {
+	agentName := hook.cfg.GetAgent()
+	chatId := hook.cfg.GetChatId()
+
+	targetAgent := m.gateway.getAgent(agentName)
+	if targetAgent == nil {
+		return
+	}
+
+	ctx, span := trace.StartSpan(ctx, "webhook.run",
+		trace.AttrAgent.String(agentName),
+		trace.AttrChannel.String(webhookChannel),
+		trace.AttrChatID.String(chatId),
+	)
+	defer span.End()
+
+	slog.InfoContext(ctx, "webhook triggered",
+		slog.String("name", hook.cfg.Name),
+		slog.String("agent", agentName),
+		slog.Int("prompt_len", len(prompt)),
+	)
+
+	startAt := time.Now()
+	result := targetAgent.Ask(ctx, &agent.UserMessage{
+		Channel: webhookChannel,
+		ChatId:  chatId,
+		Content: prompt,
+		Created: time.Now().Unix(),
+	})
+	slog.InfoContext(ctx, "webhook run finished",
+		slog.String("name", hook.cfg.Name),
+		slog.String("agent", agentName),
+		slog.Int64("elapsed_ms", time.Since(startAt).Milliseconds()),
+	)
+
+	deliver := hook.cfg.Deliver
+	if deliver == nil || deliver.Channel == "" || deliver.To == "" {
+		return
+	}
+
+	err := m.gateway.deliverResult(ctx, agentName, chmodel.Type(deliver.Channel), deliver.To, chatId, result)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to deliver webhook result",
+			slog.String("name", hook.cfg.Name),
+			slog.String("agent", agentName),
+			slog.String("channel", deliver.Channel),
+			slog.String("account", m.gateway.getAgentBindingAccount(agentName, chmodel.Type(deliver.Channel))),
+			slog.String("to", deliver.To),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// verifyWebhookRequest checks the request secret or the body signature.
+// Hooks without a secret accept requests only when marked insecure.
+func verifyWebhookRequest(cfg *config.WebhookEntry, header http.Header, body []byte) error {
+	if cfg.Secret == "" {
+		if cfg.Insecure {
+			return nil
+		}
+		return errWebhookUnauthorized
+	}
+	// an unresolvable reference accepts no request
+	secret := cfg.GetSecret()
+	if secret == "" {
+		return errWebhookUnauthorized
+	}
+
+	if cfg.SignatureHeader != "" {
+		signature := strings.TrimSpace(header.Get(cfg.SignatureHeader))
+		signature = strings.TrimPrefix(signature, "sha256=")
+		got, err := hex.DecodeString(signature)
+		if err != nil || len(got) == 0 {
+			return errWebhookUnauthorized
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return errWebhookUnauthorized
+		}
+		return nil
+	}
+
+	token := header.Get(webhookSecretHeader)
+	if token == "" {
+		token, _ = strings.CutPrefix(header.Get("Authorization"), "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return errWebhookUnauthorized
+	}
+
+	return nil
+}
+
+func renderWebhookPrompt(tmpl *template.Template, name string, r *http.Request, body []byte) (string, error) {
+	data := webhookTemplateData{
+		Name:    name,
+		Headers: make(map[string]string, len(r.Header)),
+		Query:   make(map[string]string),
+		Body:    string(body),
+	}
+	for key := range r.Header {
+		data.Headers[key] = r.Header.Get(key)
+	}
+	for key := range r.URL.Query() {
+		data.Query[key] = r.URL.Query().Get(key)
+	}
+
+	var payload any
+	if err := json.Unmarshal(body, &payload); err == nil {
+		data.Payload = payload
+	}
+
+	var bd strings.Builder
+	if err := tmpl.Execute(&bd, data); err != nil {
+		return "", err
+	}
+
+	prompt := strings.TrimSpace(bd.String())
+	if prompt == "" {
+		return "", errors.New("rendered prompt is empty")
+	}
+	return prompt, nil
+}
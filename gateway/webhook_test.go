@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/ryanreadbooks/tokkibot/config"
+	"github.com/ryanreadbooks/tokkibot/pkg/trace"
+)
+
+func TestVerifyWebhookRequest(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	signed := &config.WebhookEntry{Secret: "s3cret", SignatureHeader: "X-Hub-Signature-256"}
+	h := http.Header{}
+	h.Set("X-Hub-Signature-256", sig)
+	if err := verifyWebhookRequest(signed, h, body); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := verifyWebhookRequest(signed, h, []byte(`{}`)); err == nil {
+		t.Fatal("signature over different body accepted")
+	}
+
+	token := &config.WebhookEntry{Secret: "s3cret"}
+	h = http.Header{}
+	h.Set("Authorization", "Bearer s3cret")
+	if err := verifyWebhookRequest(token, h, body); err != nil {
+		t.Fatalf("valid bearer token rejected: %v", err)
+	}
+	h.Set("Authorization", "Bearer wrong")
+	if err := verifyWebhookRequest(token, h, body); err == nil {
+		t.Fatal("wrong bearer token accepted")
+	}
+
+	if err := verifyWebhookRequest(&config.WebhookEntry{}, http.Header{}, body); err == nil {
+		t.Fatal("request to a hook without secret accepted")
+	}
+	if err := verifyWebhookRequest(&config.WebhookEntry{Insecure: true}, http.Header{}, body); err != nil {
+		t.Fatalf("request to an insecure hook rejected: %v", err)
+	}
+}
+
+func TestWebhookUnsignedRequest(t *testing.T) {
+	m := NewWebhookManager(nil, &config.WebhookConfig{Hooks: []config.WebhookEntry{
+		{Name: "ci", Template: "{{.Body}}", Secret: "s3cret"},
+		{Name: "open", Template: "{{.Body}}"},
+	}})
+
+	post := func(name string) int {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, webhookPathPrefix+name, strings.NewReader(`{}`)))
+		return w.Code
+	}
+	if code := post("ci"); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned request: got %d, want 401", code)
+	}
+	// hooks without secret are not served unless insecure
+	if code := post("open"); code != http.StatusNotFound {
+		t.Fatalf("hook without secret: got %d, want 404", code)
+	}
+}
+
+func TestRenderWebhookPrompt(t *testing.T) {
+	tmpl := template.Must(template.New("gh").Funcs(webhookTemplateFuncs).Parse(
+		`{{.Name}}: {{.Payload.action}} by {{index .Headers "X-User"}} ref={{.Query.ref}}`))
+
+	r := httptest.NewRequest(http.MethodPost, "/hooks/gh?ref=main", strings.NewReader(""))
+	r.Header.Set("X-User", "bob")
+
+	got, err := renderWebhookPrompt(tmpl, "gh", r, []byte(`{"action":"opened"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "gh: opened by bob ref=main"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWebhookTriggerQueuesRuns(t *testing.T) {
+	g := &Gateway{
+		running:  make(map[string]context.CancelFunc),
+		runSlots: newRunSlots(),
+	}
+	m := NewWebhookManager(g, &config.WebhookConfig{})
+	m.rootCtx = t.Context()
+	hook := &webhookHook{cfg: config.WebhookEntry{Name: "ci", Agent: "missing"}}
+	sessionKey := "missing:" + webhookChannel + ":" + hook.cfg.GetChatId()
+
+	// a run is active, so new runs wait up to the in-flight limit
+	q := m.getOrCreateQueue(sessionKey)
+	q.busy = true
+	limit := config.GetRateLimit("missing").GetChatMaxInFlight()
+	for i := 1; i < limit; i++ {
+		if err := m.trigger(hook, "run", trace.NewTraceInfo(webhookChannel, "", "")); err != nil {
+			t.Fatalf("run %d rejected: %v", i, err)
+		}
+	}
+	if err := m.trigger(hook, "run", trace.NewTraceInfo(webhookChannel, "", "")); !errors.Is(err, errWebhookBusy) {
+		t.Fatalf("expected errWebhookBusy, got %v", err)
+	}
+
+	// once idle, the queue drains and no run is left registered
+	q.mu.Lock()
+	q.busy = false
+	q.mu.Unlock()
+	if err := m.trigger(hook, "run", trace.NewTraceInfo(webhookChannel, "", "")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q.mu.Lock()
+		idle := !q.busy && len(q.pending) == 0
+		q.mu.Unlock()
+		if idle {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queue not drained")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if keys := g.runningKeys(); len(keys) != 0 {
+		t.Fatalf("runs still registered: %v", keys)
+	}
+	if n := g.runSlots.inUse(); n != 0 {
+		t.Fatalf("%d run slots still in use", n)
+	}
+}
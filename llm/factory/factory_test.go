@@ -60,12 +60,16 @@ var (
 	testAnthropicLLM llm.LLM
 )
 
+// TestMain creates the llms of tests which call real models. Without
+// credentials those tests are skipped, the others still run.
 func TestMain(m *testing.M) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if apiKey == "" || baseURL == "" {
-		fmt.Println("OPENAI_API_KEY and OPENAI_BASE_URL are required")
-		os.Exit(1)
+	anthropicAPIKey := os.Getenv("ANTHROPIC_API_KEY")
+	anthropicBaseURL := os.Getenv("ANTHROPIC_BASE_URL")
+	if apiKey == "" || baseURL == "" || anthropicAPIKey == "" || anthropicBaseURL == "" {
+		fmt.Println("OPENAI_API_KEY, OPENAI_BASE_URL, ANTHROPIC_API_KEY and ANTHROPIC_BASE_URL are required to call models")
+		os.Exit(m.Run())
 	}
 
 	var err error
@@ -74,22 +78,25 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
-	anthropicAPIKey := os.Getenv("ANTHROPIC_API_KEY")
-	anthropicBaseURL := os.Getenv("ANTHROPIC_BASE_URL")
-	if anthropicAPIKey == "" || anthropicBaseURL == "" {
-		fmt.Println("ANTHROPIC_API_KEY and ANTHROPIC_BASE_URL are required")
-		os.Exit(1)
-	}
-
 	testAnthropicLLM, err = NewLLM(WithAPIKey(anthropicAPIKey), WithBaseURL(anthropicBaseURL), WithStyle(StyleAnthropic))
 	if err != nil {
 		panic(err)
 	}
 
-	m.Run()
+	os.Exit(m.Run())
+}
+
+// skipWithoutLLMs skips a test which calls real models when their
+// credentials are missing.
+func skipWithoutLLMs(t *testing.T) {
+	if testOpenAiLLM == nil || testAnthropicLLM == nil {
+		t.Skip("model credentials are not set")
+	}
 }
 
 func TestChatCompletionSingleRound(t *testing.T) {
+	skipWithoutLLMs(t)
+
 	messages := []param.Message{
 		param.NewSystemMessage("You are a helpful assistant."),
 		param.NewUserMessage(
@@ -134,6 +141,8 @@ type testCaseDef struct {
 }
 
 func TestChatCompletion(t *testing.T) {
+	skipWithoutLLMs(t)
+
 	messages := []param.Message{
 		param.NewSystemMessage("You are a helpful assistant."),
 		param.NewUserMessage(
@@ -219,6 +228,8 @@ func TestChatCompletion(t *testing.T) {
 }
 
 func TestChatCompletionStream(t *testing.T) {
+	skipWithoutLLMs(t)
+
 	messages := []param.Message{
 		param.NewSystemMessage("You are a helpful assistant."),
 		param.NewUserMessage("Tell me why the sky is blue in short"),
@@ -253,6 +264,8 @@ type testGetRandomNameInput struct {
 }
 
 func TestChatCompletionStreamWithTools(t *testing.T) {
+	skipWithoutLLMs(t)
+
 	messages := []param.Message{
 		param.NewSystemMessage("You are a helpful assistant."),
 		param.NewUserMessage("Return a random number and a random name using tools. YOU MUST USE TOOLS" +
@@ -286,6 +299,8 @@ func TestChatCompletionStreamWithTools(t *testing.T) {
 }
 
 func TestChatCompletionStreamWithToolsHandler(t *testing.T) {
+	skipWithoutLLMs(t)
+
 	messages := []param.Message{
 		param.NewSystemMessage("You are a helpful assistant."),
 		param.NewUserMessage("Return a random number and a random name using tools. YOU MUST USE TOOLS" +
@@ -0,0 +1,68 @@
+package factory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// Probe checks that the provider answers and accepts the api key by listing
+// its models. No tokens are consumed.
+func Probe(ctx context.Context, opts ...Option) error {
+	proOpt := DefaultOption()
+	proOpt.apply(opts...)
+
+	if proOpt.apiKey == "" {
+		return fmt.Errorf("api key is required")
+	}
+	if proOpt.baseURL == "" {
+		return fmt.Errorf("api base is required")
+	}
+
+	baseURL := strings.TrimSuffix(proOpt.baseURL, "/")
+	var (
+		req *http.Request
+		err error
+	)
+	switch proOpt.style {
+	case StyleOpenAI:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/models", nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+proOpt.apiKey)
+		}
+	case StyleAnthropic:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/v1/models", nil)
+		if err == nil {
+			req.Header.Set("X-Api-Key", proOpt.apiKey)
+			req.Header.Set("Anthropic-Version", anthropicVersion)
+		}
+	default:
+		return fmt.Errorf("unsupported style: %s", proOpt.style)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("provider unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("api key rejected: %s", resp.Status)
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		// some compatible providers do not serve the models endpoint, but
+		// they did answer
+		return nil
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package factory
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/models" && r.Header.Get("Authorization") == "Bearer good":
+			w.Write([]byte(`{"data":[]}`))
+		case r.URL.Path == "/v1/models" && r.Header.Get("X-Api-Key") == "good":
+			w.Write([]byte(`{"data":[]}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	for _, style := range []Style{StyleOpenAI, StyleAnthropic} {
+		if err := Probe(ctx, WithAPIKey("good"), WithBaseURL(srv.URL), WithStyle(style)); err != nil {
+			t.Fatalf("%s: expected probe to succeed, got %v", style, err)
+		}
+		err := Probe(ctx, WithAPIKey("bad"), WithBaseURL(srv.URL), WithStyle(style))
+		if err == nil || !strings.Contains(err.Error(), "api key rejected") {
+			t.Fatalf("%s: expected rejected api key, got %v", style, err)
+		}
+	}
+}
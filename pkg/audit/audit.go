@@ -0,0 +1,331 @@
+// Package audit keeps an append-only, hash-chained log of tool executions.
+//
+// Every entry carries the hash of the previous entry, and its own hash covers
+// all of its fields, so that editing, removing or reordering entries breaks
+// the chain and is detected by Verify.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Status of a tool execution.
+const (
+	StatusOK        = "ok"
+	StatusError     = "error"
+	StatusDenied    = "denied"   // rejected by permissions or the tool policy
+	StatusRejected  = "rejected" // confirmation was refused
+	StatusCancelled = "cancelled"
+	StatusNotFound  = "not_found"
+)
+
+// Entry is one tool execution.
+type Entry struct {
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"time"`
+
+	Agent      string `json:"agent"`
+	Channel    string `json:"channel"`
+	ChatId     string `json:"chatId"`
+	SenderId   string `json:"senderId,omitempty"`
+	SenderName string `json:"senderName,omitempty"`
+
+	Tool       string `json:"tool"`
+	Arguments  string `json:"arguments"`
+	ResultHash string `json:"resultHash,omitempty"` // sha256 of the result
+	ResultLen  int    `json:"resultLen"`
+	DurationMs int64  `json:"durationMs"`
+	Sandbox    string `json:"sandbox,omitempty"` // sandbox of command tools, e.g. bwrap or none
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+
+	Policy           string `json:"policy,omitempty"` // action of the tool policy: allow, ask or deny
+	ConfirmRequested bool   `json:"confirmRequested"`
+	ApprovedBy       string `json:"approvedBy,omitempty"`
+	ApprovalReason   string `json:"approvalReason,omitempty"`
+
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// HashResult returns the hash recorded for a tool result.
+func HashResult(result string) string {
+	sum := sha256.Sum256([]byte(result))
+	return hex.EncodeToString(sum[:])
+}
+
+// computeHash returns the hash of the entry, which covers every field but
+// the hash itself.
+func (e *Entry) computeHash() (string, error) {
+	c := *e
+	c.Hash = ""
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Logger appends entries to an audit file.
+type Logger struct {
+	mu       sync.Mutex
+	path     string
+	f        *os.File
+	size     int64 // size of the file after our last write
+	seq      int64
+	lastHash string
+}
+
+// Open opens the audit file for appending, creating it if needed.
+func Open(path string) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	l := &Logger{path: path, f: f, size: -1}
+	if err := l.syncTail(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// syncTail reloads the chain head when the file was appended by another
+// process since our last write.
+func (l *Logger) syncTail() error {
+	info, err := l.f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat audit file: %w", err)
+	}
+	if info.Size() == l.size {
+		return nil
+	}
+
+	last, err := lastLine(l.path, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to read audit file: %w", err)
+	}
+	l.size = info.Size()
+	if len(last) == 0 {
+		l.seq, l.lastHash = 0, ""
+		return nil
+	}
+	var e Entry
+	if err := json.Unmarshal(last, &e); err != nil {
+		return fmt.Errorf("failed to parse last audit entry: %w", err)
+	}
+	l.seq, l.lastHash = e.Seq, e.Hash
+	return nil
+}
+
+// lastLine returns the last non-empty line of the first size bytes of the file.
+func lastLine(path string, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	const chunk = 64 * 1024
+	var tail []byte
+	for off := size; off > 0; {
+		n := min(int64(chunk), off)
+		off -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, off); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		if off == 0 {
+			return trimmed, nil
+		}
+	}
+	return nil, nil
+}
+
+// Append chains the entry to the log and writes it. The file is locked
+// while the chain head is read and the entry written, so that the agent and
+// the gateway can append to the same log.
+func (l *Logger) Append(e *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := lockFile(l.f); err != nil {
+		return fmt.Errorf("failed to lock audit file: %w", err)
+	}
+	defer unlockFile(l.f)
+
+	if err := l.syncTail(); err != nil {
+		return err
+	}
+
+	e.Seq = l.seq + 1
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.PrevHash = l.lastHash
+	hash, err := e.computeHash()
+	if err != nil {
+		return fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := l.f.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit file: %w", err)
+	}
+
+	l.size += int64(len(line))
+	l.seq = e.Seq
+	l.lastHash = e.Hash
+	return nil
+}
+
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Read calls fn for every entry of the audit file in order, until fn
+// returns false.
+func Read(path string, fn func(e *Entry, raw []byte) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		raw, err := r.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 {
+			var e Entry
+			if uerr := json.Unmarshal(trimmed, &e); uerr != nil {
+				return fmt.Errorf("failed to parse audit entry at line %d: %w", line, uerr)
+			}
+			if !fn(&e, trimmed) {
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ErrTampered is returned by Verify when the chain is broken.
+var ErrTampered = errors.New("audit log has been tampered with")
+
+// Verify checks the hash chain of the audit file and returns the number of
+// verified entries.
+func Verify(path string) (int, error) {
+	var (
+		count    int
+		prevHash string
+		prevSeq  int64
+		verr     error
+	)
+	err := Read(path, func(e *Entry, _ []byte) bool {
+		hash, err := e.computeHash()
+		switch {
+		case err != nil:
+			verr = err
+		case e.PrevHash != prevHash:
+			verr = fmt.Errorf("%w: entry %d does not follow entry %d", ErrTampered, e.Seq, prevSeq)
+		case e.Seq != prevSeq+1:
+			verr = fmt.Errorf("%w: entry %d follows entry %d", ErrTampered, e.Seq, prevSeq)
+		case hash != e.Hash:
+			verr = fmt.Errorf("%w: entry %d was modified", ErrTampered, e.Seq)
+		}
+		if verr != nil {
+			return false
+		}
+		count++
+		prevHash, prevSeq = e.Hash, e.Seq
+		return true
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, verr
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultLogger *Logger
+)
+
+// Init opens the audit file used by Record.
+func Init(path string) error {
+	l, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultLogger != nil {
+		defaultLogger.Close()
+	}
+	defaultLogger = l
+	return nil
+}
+
+// Record appends the entry to the audit file opened by Init. Failures are
+// logged, auditing never fails a tool call.
+func Record(e *Entry) {
+	defaultMu.Lock()
+	l := defaultLogger
+	defaultMu.Unlock()
+	if l == nil {
+		return
+	}
+	if err := l.Append(e); err != nil {
+		slog.Error("[audit] failed to record tool execution",
+			slog.String("tool", e.Tool),
+			slog.Any("error", err))
+	}
+}
+
+// Close closes the audit file opened by Init.
+func Close() {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultLogger != nil {
+		defaultLogger.Close()
+		defaultLogger = nil
+	}
+}
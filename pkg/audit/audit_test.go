@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppendAndVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{"ls", "rm -rf build", "git status"} {
+		if err := l.Append(&Entry{Agent: "main", Tool: "shell", Arguments: `{"command":"` + cmd + `"}`, Status: StatusOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// a reopened logger continues the chain
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(&Entry{Agent: "main", Tool: "read_file", Status: StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	n, err := Verify(path)
+	if err != nil || n != 4 {
+		t.Fatalf("verify: n=%d err=%v", n, err)
+	}
+
+	var tools []string
+	err = Read(path, func(e *Entry, _ []byte) bool {
+		if (&Filter{Tool: "shell"}).Match(e) {
+			tools = append(tools, e.Arguments)
+		}
+		return true
+	})
+	if err != nil || len(tools) != 3 {
+		t.Fatalf("read: %v %v", tools, err)
+	}
+}
+
+func TestAppendFromTwoLoggers(t *testing.T) {
+	// two loggers of one file stand for the agent and the gateway
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var wg sync.WaitGroup
+	for _, agent := range []string{"cli", "gateway"} {
+		l, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		wg.Go(func() {
+			for range 100 {
+				if err := l.Append(&Entry{Agent: agent, Tool: "shell", Status: StatusOK}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if n, err := Verify(path); err != nil || n != 200 {
+		t.Fatalf("verify: n=%d err=%v", n, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if err := l.Append(&Entry{Tool: "shell", Arguments: `{"command":"rm -rf build"}`, Status: StatusOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	content, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(content), "\n")
+
+	modified := strings.Replace(string(content), "rm -rf build", "ls", 1)
+	os.WriteFile(path, []byte(modified), 0600)
+	if _, err := Verify(path); !errors.Is(err, ErrTampered) {
+		t.Fatalf("modified entry: %v", err)
+	}
+
+	removed := lines[0] + lines[2]
+	os.WriteFile(path, []byte(removed), 0600)
+	if _, err := Verify(path); !errors.Is(err, ErrTampered) {
+		t.Fatalf("removed entry: %v", err)
+	}
+}
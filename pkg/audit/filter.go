@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// Filter selects entries. Empty fields match everything; Tool is a glob.
+type Filter struct {
+	Agent   string
+	Channel string
+	ChatId  string
+	Sender  string // sender id or name
+	Tool    string
+	Status  string
+	Since   time.Time
+	Until   time.Time
+}
+
+// Match reports whether the entry is selected by the filter.
+func (f *Filter) Match(e *Entry) bool {
+	switch {
+	case f.Agent != "" && e.Agent != f.Agent,
+		f.Channel != "" && e.Channel != f.Channel,
+		f.ChatId != "" && e.ChatId != f.ChatId,
+		f.Sender != "" && e.SenderId != f.Sender && e.SenderName != f.Sender,
+		f.Status != "" && e.Status != f.Status,
+		!f.Since.IsZero() && e.Time.Before(f.Since),
+		!f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	}
+	if f.Tool != "" {
+		if ok, _ := filepath.Match(f.Tool, e.Tool); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// lockFile is a no-op, processes appending at the same time may fork the
+// chain.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
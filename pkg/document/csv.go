@@ -0,0 +1,83 @@
+package document
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// csvToMarkdown converts a CSV or TSV file to a table whose header is the
+// first record. Files exported by Excel on Chinese systems are GB18030 and
+// are decoded as such when they are not UTF-8.
+func csvToMarkdown(data []byte) (string, error) {
+	data, err := decodeText(data)
+	if err != nil {
+		return "", err
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = csvDelimiter(data)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var (
+		rows [][]string
+		size int
+	)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse csv: %w", err)
+		}
+		rows = append(rows, record)
+		for _, field := range record {
+			size += len(field)
+		}
+		if size > maxMarkdownSize {
+			break
+		}
+	}
+
+	w := newWriter()
+	w.table(rows)
+	return w.String(), nil
+}
+
+// decodeText returns text as UTF-8, dropping byte order marks.
+func decodeText(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return data[3:], nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder().Bytes(data)
+	case utf8.Valid(data):
+		return data, nil
+	}
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode text: %w", err)
+	}
+	return decoded, nil
+}
+
+// csvDelimiter picks the most frequent of comma, semicolon and tab in the
+// first line.
+func csvDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	delimiter, most := ',', bytes.Count(line, []byte(","))
+	for _, d := range []rune{'\t', ';'} {
+		if n := bytes.Count(line, []byte(string(d))); n > most {
+			delimiter, most = d, n
+		}
+	}
+	return delimiter
+}
@@ -0,0 +1,165 @@
+// Package document converts documents to markdown in pure Go: PDF files,
+// Word documents, Excel workbooks and PowerPoint presentations of the
+// Office Open XML formats, and CSV files. Text is kept with headings, lists
+// and tables, formatting and images are dropped.
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/ryanreadbooks/tokkibot/pkg/pdf"
+)
+
+// Format of a document.
+type Format string
+
+const (
+	FormatPDF  Format = "pdf"
+	FormatDOCX Format = "docx"
+	FormatXLSX Format = "xlsx"
+	FormatPPTX Format = "pptx"
+	FormatCSV  Format = "csv"
+)
+
+const (
+	// maxPartSize bounds the decompressed size of a part of an office file
+	maxPartSize = 64 * 1024 * 1024
+	// maxMarkdownSize bounds the markdown of a document, the rest is dropped
+	maxMarkdownSize = 16 * 1024 * 1024
+)
+
+var ErrUnsupported = errors.New("unsupported document format")
+
+// Detect returns the format of a document by its content, and by the
+// extension of name for formats without a signature. It returns "" for
+// anything else.
+func Detect(name string, data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return FormatPDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return ""
+		}
+		for _, f := range zr.File {
+			switch f.Name {
+			case "word/document.xml":
+				return FormatDOCX
+			case "xl/workbook.xml":
+				return FormatXLSX
+			case "ppt/presentation.xml":
+				return FormatPPTX
+			}
+		}
+		return ""
+	}
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv", ".tsv":
+		return FormatCSV
+	}
+	return ""
+}
+
+// ToMarkdown converts a document of format to markdown.
+func ToMarkdown(format Format, data []byte) (string, error) {
+	switch format {
+	case FormatPDF:
+		return pdfToMarkdown(data)
+	case FormatDOCX:
+		return docxToMarkdown(data)
+	case FormatXLSX:
+		return xlsxToMarkdown(data)
+	case FormatPPTX:
+		return pptxToMarkdown(data)
+	case FormatCSV:
+		return csvToMarkdown(data)
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupported, format)
+}
+
+func pdfToMarkdown(data []byte) (string, error) {
+	pages, err := pdf.ExtractText(data)
+	if err != nil {
+		return "", err
+	}
+	w := newWriter()
+	for i, text := range pages {
+		w.heading(2, fmt.Sprintf("Page %d", i+1))
+		w.paragraph(text)
+	}
+	return w.String(), nil
+}
+
+// officeFile is an office document, a zip of xml parts.
+type officeFile struct {
+	parts map[string]*zip.File
+}
+
+func openOfficeFile(data []byte) (*officeFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open office file: %w", err)
+	}
+	o := &officeFile{parts: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		o.parts[f.Name] = f
+	}
+	return o, nil
+}
+
+// read returns the data of a part, or nil if there is no such part.
+func (o *officeFile) read(name string) ([]byte, error) {
+	f, ok := o.parts[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxPartSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(data) > maxPartSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxPartSize)
+	}
+	return data, nil
+}
+
+// relationships returns the targets of the relationships of a part by id,
+// as part names.
+func (o *officeFile) relationships(part string) (map[string]string, error) {
+	dir, file := path.Split(part)
+	data, err := o.read(dir + "_rels/" + file + ".rels")
+	if err != nil || data == nil {
+		return nil, err
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	rels := make(map[string]string)
+	for _, rel := range root.all("Relationship") {
+		if rel.attr("TargetMode") == "External" {
+			continue
+		}
+		target := rel.attr("Target")
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(dir, target)
+		}
+		rels[rel.attr("Id")] = target
+	}
+	return rels, nil
+}
@@ -0,0 +1,203 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const (
+	nsW   = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	nsR   = `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+	nsA   = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"`
+	nsP   = `xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+	nsRel = `xmlns="http://schemas.openxmlformats.org/package/2006/relationships"`
+	nsX   = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"`
+)
+
+// zipOf writes parts into a zip file.
+func zipOf(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func convert(t *testing.T, name string, data []byte, want Format) string {
+	t.Helper()
+	format := Detect(name, data)
+	if format != want {
+		t.Fatalf("Detect(%s) = %q, want %q", name, format, want)
+	}
+	md, err := ToMarkdown(format, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func TestDOCX(t *testing.T) {
+	data := zipOf(t, map[string]string{
+		"word/document.xml": `<w:document ` + nsW + `><w:body>
+<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t>Quarterly report</w:t></w:r></w:p>
+<w:p><w:pPr><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr><w:r><w:t xml:space="preserve">Revenue grew </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>12%</w:t></w:r><w:r><w:t>.</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>First</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Second</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Detail</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="2"/></w:numPr></w:pPr><w:r><w:t>Bullet</w:t></w:r></w:p>
+<w:tbl>
+<w:tr><w:tc><w:p><w:r><w:t>Region</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Sales</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>North|East</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>10</w:t></w:r></w:p><w:p><w:r><w:t>est.</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:tcPr><w:gridSpan w:val="2"/></w:tcPr><w:p><w:r><w:t>Total</w:t></w:r></w:p></w:tc></w:tr>
+</w:tbl>
+<w:p><w:r><w:t>The end</w:t></w:r><w:r><w:br/></w:r><w:r><w:t>really</w:t></w:r></w:p>
+</w:body></w:document>`,
+		"word/styles.xml": `<w:styles ` + nsW + `><w:style w:type="paragraph" w:styleId="1"><w:name w:val="heading 1"/></w:style></w:styles>`,
+		"word/numbering.xml": `<w:numbering ` + nsW + `>
+<w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:numFmt w:val="decimal"/></w:lvl><w:lvl w:ilvl="1"><w:numFmt w:val="bullet"/></w:lvl></w:abstractNum>
+<w:abstractNum w:abstractNumId="1"><w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/></w:lvl></w:abstractNum>
+<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num><w:num w:numId="2"><w:abstractNumId w:val="1"/></w:num>
+</w:numbering>`,
+	})
+
+	want := `# Quarterly report
+
+Revenue grew 12%.
+
+1. First
+2. Second
+   - Detail
+- Bullet
+
+| Region | Sales |
+| --- | --- |
+| North\|East | 10<br>est. |
+| Total |  |
+
+The end
+really`
+	if got := convert(t, "report.docx", data, FormatDOCX); got != want {
+		t.Errorf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := zipOf(t, map[string]string{
+		"xl/workbook.xml": `<workbook ` + nsX + ` ` + nsR + `><workbookPr/><sheets>
+<sheet name="Q1" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" state="hidden" r:id="rId2"/>
+</sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships ` + nsRel + `>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<sst ` + nsX + `><si><t>Date</t></si><si><t>Amount</t></si><si><r><t>Share</t></r><r><t xml:space="preserve"> %</t></r></si><si><t>东京</t><rPh><t>とうきょう</t></rPh></si></sst>`,
+		"xl/styles.xml": `<styleSheet ` + nsX + `><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy&quot;年&quot;m&quot;月&quot;d&quot;日&quot;;@"/></numFmts>
+<cellXfs><xf numFmtId="0"/><xf numFmtId="164"/><xf numFmtId="10"/><xf numFmtId="22"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet ` + nsX + `><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="E1" t="inlineStr"><is><t>Note</t></is></c></row>
+<row r="2"><c r="A2" s="1"><v>45306</v></c><c r="B2"><f>SUM(X1:X9)</f><v>0.30000000000000004</v></c><c r="C2" s="2"><v>0.125</v></c><c r="E2" t="s"><v>3</v></c></row>
+<row r="4"><c r="A4" s="3"><v>45306.5</v></c><c r="B4"><v>1234567.5</v></c><c r="D4" t="b"><v>1</v></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet ` + nsX + `><sheetData/></worksheet>`,
+	})
+
+	want := `## Sheet: Q1
+
+| Date | Amount | Share % |  | Note |
+| --- | --- | --- | --- | --- |
+| 2024-01-15 | 0.3 | 12.5% |  | 东京 |
+| 2024-01-15 12:00:00 | 1234567.5 |  | TRUE |  |
+
+## Sheet: Empty (hidden)
+
+(empty)`
+	if got := convert(t, "q1.xlsx", data, FormatXLSX); got != want {
+		t.Errorf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPPTX(t *testing.T) {
+	slide := func(title, body string) string {
+		return `<p:sld ` + nsA + ` ` + nsP + `><p:cSld><p:spTree>
+<p:sp><p:nvSpPr><p:cNvPr id="1" name="Title"/><p:cNvSpPr/><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>` + title + `</a:t></a:r></a:p></p:txBody></p:sp>
+<p:sp><p:nvSpPr><p:cNvPr id="2" name="Body"/><p:cNvSpPr/><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody>` + body + `</p:txBody></p:sp>
+<p:sp><p:nvSpPr><p:cNvPr id="3" name="Number"/><p:cNvSpPr/><p:nvPr><p:ph type="sldNum"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>7</a:t></a:r></a:p></p:txBody></p:sp>
+</p:spTree></p:cSld></p:sld>`
+	}
+	data := zipOf(t, map[string]string{
+		"ppt/presentation.xml": `<p:presentation ` + nsP + ` ` + nsR + `><p:sldIdLst><p:sldId id="256" r:id="rId3"/><p:sldId id="257" r:id="rId2"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships ` + nsRel + `>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide1.xml"/>
+</Relationships>`,
+		"ppt/slides/slide1.xml": slide("Roadmap", `<a:p><a:r><a:t>Ship it</a:t></a:r></a:p><a:p><a:pPr lvl="1"/><a:r><a:t>Soon</a:t></a:r><a:br/><a:r><a:t>really</a:t></a:r></a:p>`),
+		"ppt/slides/slide2.xml": slide("Thanks", `<a:p><a:r><a:t>Questions?</a:t></a:r></a:p>`),
+		"ppt/slides/_rels/slide1.xml.rels": `<Relationships ` + nsRel + `>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide" Target="../notesSlides/notesSlide1.xml"/>
+</Relationships>`,
+		"ppt/notesSlides/notesSlide1.xml": `<p:notes ` + nsA + ` ` + nsP + `><p:cSld><p:spTree>
+<p:sp><p:nvSpPr><p:cNvPr id="2" name="Notes"/><p:cNvSpPr/><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Mention the budget</a:t></a:r></a:p></p:txBody></p:sp>
+</p:spTree></p:cSld></p:notes>`,
+	})
+
+	want := `## Slide 1: Roadmap
+
+Ship it
+
+   - Soon
+really
+
+Notes:
+
+Mention the budget
+
+## Slide 2: Thanks
+
+Questions?`
+	if got := convert(t, "deck.pptx", data, FormatPPTX); got != want {
+		t.Errorf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	gbk, err := simplifiedchinese.GB18030.NewEncoder().String("名称;金额\n苹果;3\n\"a;b\";4\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "| 名称 | 金额 |\n| --- | --- |\n| 苹果 | 3 |\n| a;b | 4 |"
+	if got := convert(t, "fruit.csv", []byte(gbk), FormatCSV); got != want {
+		t.Errorf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+
+	want = "| a | b |\n| --- | --- |\n| 1 | 2 |"
+	if got := convert(t, "x.TSV", []byte("\xef\xbb\xbfa\tb\n1\t2\n"), FormatCSV); got != want {
+		t.Errorf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if f := Detect("a.pdf", []byte("%PDF-1.7\n")); f != FormatPDF {
+		t.Errorf("expected pdf, got %q", f)
+	}
+	if f := Detect("a.zip", zipOf(t, map[string]string{"a.txt": "a"})); f != "" {
+		t.Errorf("expected no format for a zip, got %q", f)
+	}
+	if f := Detect("notes.txt", []byte("a,b\n")); f != "" {
+		t.Errorf("expected no format for text, got %q", f)
+	}
+	if _, err := ToMarkdown(FormatDOCX, []byte("not a zip")); err == nil {
+		t.Error("expected an error for a broken docx")
+	}
+}
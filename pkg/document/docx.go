@@ -0,0 +1,239 @@
+package document
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// docxConverter converts the body of a Word document.
+type docxConverter struct {
+	w        *writer
+	headings map[string]int // heading level by paragraph style id
+	ordered  map[string]map[int]bool
+	counters map[string][]int // numbers of ordered list items by list id
+}
+
+func docxToMarkdown(data []byte) (string, error) {
+	o, err := openOfficeFile(data)
+	if err != nil {
+		return "", err
+	}
+	part, err := o.read("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	if part == nil {
+		return "", fmt.Errorf("%w: no word/document.xml", ErrUnsupported)
+	}
+	root, err := parseXML(part)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse word/document.xml: %w", err)
+	}
+
+	c := &docxConverter{
+		w:        newWriter(),
+		headings: docxHeadingStyles(o),
+		ordered:  docxOrderedLists(o),
+		counters: make(map[string][]int),
+	}
+	if body := root.child("body"); body != nil {
+		c.blocks(body)
+	}
+	return c.w.String(), nil
+}
+
+func (c *docxConverter) blocks(n *xmlNode) {
+	for _, child := range n.children {
+		if c.w.full() {
+			return
+		}
+		switch child.name {
+		case "p":
+			c.paragraph(child)
+		case "tbl":
+			c.table(child)
+		case "sdt":
+			// content controls, e.g. a table of contents
+			if content := child.child("sdtContent"); content != nil {
+				c.blocks(content)
+			}
+		case "customXml", "smartTag":
+			c.blocks(child)
+		}
+	}
+}
+
+func (c *docxConverter) paragraph(p *xmlNode) {
+	text := docxText(p)
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	if level, ok := c.headings[p.path("pPr", "pStyle").attr("val")]; ok {
+		c.w.heading(level, strings.Join(strings.Fields(text), " "))
+		return
+	}
+	if numPr := p.path("pPr", "numPr"); numPr != nil {
+		numID := numPr.child("numId").attr("val")
+		level, _ := strconv.Atoi(numPr.child("ilvl").attr("val"))
+		if numID != "" && numID != "0" {
+			c.w.listItem(level, c.listMarker(numID, level), text)
+			return
+		}
+	}
+	c.w.paragraph(text)
+}
+
+// listMarker returns "-" for bulleted lists and the number of the item for
+// ordered lists.
+func (c *docxConverter) listMarker(numID string, level int) string {
+	if level < 0 || level > 8 || !c.ordered[numID][level] {
+		return "-"
+	}
+	counters := c.counters[numID]
+	for len(counters) <= level {
+		counters = append(counters, 0)
+	}
+	counters[level]++
+	// deeper levels start again
+	for i := level + 1; i < len(counters); i++ {
+		counters[i] = 0
+	}
+	c.counters[numID] = counters
+	return strconv.Itoa(counters[level]) + "."
+}
+
+func (c *docxConverter) table(tbl *xmlNode) {
+	var rows [][]string
+	for _, tr := range tbl.children {
+		if tr.name != "tr" {
+			continue
+		}
+		var row []string
+		for _, tc := range tr.children {
+			if tc.name != "tc" {
+				continue
+			}
+			var paragraphs []string
+			tc.walk(func(n *xmlNode) bool {
+				if n.name == "p" {
+					if text := strings.TrimSpace(docxText(n)); text != "" {
+						paragraphs = append(paragraphs, text)
+					}
+					return false
+				}
+				return true
+			})
+			row = append(row, strings.Join(paragraphs, "\n"))
+			// a cell spanning columns is followed by empty cells
+			if span, err := strconv.Atoi(tc.path("tcPr", "gridSpan").attr("val")); err == nil {
+				for i := 1; i < span && i < 64; i++ {
+					row = append(row, "")
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	c.w.table(rows)
+}
+
+// docxText returns the text of the runs of a paragraph.
+func docxText(p *xmlNode) string {
+	var b strings.Builder
+	p.walk(func(n *xmlNode) bool {
+		switch n.name {
+		case "pPr", "rPr":
+			// tab stops are not tabs
+			return false
+		case "t":
+			b.WriteString(n.text)
+		case "tab":
+			b.WriteString("\t")
+		case "br", "cr":
+			b.WriteString("\n")
+		case "p":
+			// paragraphs of text boxes
+			b.WriteString("\n")
+		}
+		return true
+	})
+	return b.String()
+}
+
+// docxHeadingStyles returns the heading level of the paragraph styles named
+// Title or heading N, or having an outline level.
+func docxHeadingStyles(o *officeFile) map[string]int {
+	headings := map[string]int{"Title": 1}
+	for i := 1; i <= 9; i++ {
+		headings["Heading"+strconv.Itoa(i)] = i
+	}
+
+	data, err := o.read("word/styles.xml")
+	if err != nil || data == nil {
+		return headings
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return headings
+	}
+	for _, style := range root.all("style") {
+		if style.attr("type") != "paragraph" {
+			continue
+		}
+		id := style.attr("styleId")
+		name := strings.ToLower(style.child("name").attr("val"))
+		switch {
+		case name == "title":
+			headings[id] = 1
+		case strings.HasPrefix(name, "heading "):
+			if level, err := strconv.Atoi(strings.TrimPrefix(name, "heading ")); err == nil {
+				headings[id] = level
+			}
+		default:
+			if level, err := strconv.Atoi(style.path("pPr", "outlineLvl").attr("val")); err == nil && level < 9 {
+				headings[id] = level + 1
+			}
+		}
+	}
+	return headings
+}
+
+// docxOrderedLists returns the levels of each list which are numbered
+// rather than bulleted.
+func docxOrderedLists(o *officeFile) map[string]map[int]bool {
+	data, err := o.read("word/numbering.xml")
+	if err != nil || data == nil {
+		return nil
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil
+	}
+
+	abstract := make(map[string]map[int]bool)
+	for _, an := range root.all("abstractNum") {
+		levels := make(map[int]bool)
+		for _, lvl := range an.children {
+			if lvl.name != "lvl" {
+				continue
+			}
+			level, err := strconv.Atoi(lvl.attr("ilvl"))
+			if err != nil {
+				continue
+			}
+			switch lvl.child("numFmt").attr("val") {
+			case "bullet", "none", "":
+			default:
+				levels[level] = true
+			}
+		}
+		abstract[an.attr("abstractNumId")] = levels
+	}
+
+	lists := make(map[string]map[int]bool)
+	for _, num := range root.all("num") {
+		lists[num.attr("numId")] = abstract[num.child("abstractNumId").attr("val")]
+	}
+	return lists
+}
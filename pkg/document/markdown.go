@@ -0,0 +1,247 @@
+package document
+
+import (
+	"encoding/xml"
+	"strings"
+	"unicode"
+)
+
+// writer writes markdown blocks, stopping at maxMarkdownSize.
+type writer struct {
+	b         strings.Builder
+	tight     bool // the last block was a list item
+	truncated bool
+}
+
+func newWriter() *writer {
+	return &writer{}
+}
+
+// full reports whether the markdown reached its size limit, later blocks
+// are dropped.
+func (w *writer) full() bool {
+	if w.b.Len() >= maxMarkdownSize {
+		w.truncated = true
+	}
+	return w.truncated
+}
+
+func (w *writer) block(text string, tight bool) {
+	// keep the indentation of list items
+	text = strings.TrimLeft(strings.TrimRightFunc(text, unicode.IsSpace), "\r\n")
+	if text == "" || w.full() {
+		return
+	}
+	if w.b.Len() > 0 {
+		if tight && w.tight {
+			w.b.WriteString("\n")
+		} else {
+			w.b.WriteString("\n\n")
+		}
+	}
+	w.b.WriteString(text)
+	w.tight = tight
+}
+
+func (w *writer) heading(level int, text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		w.block(strings.Repeat("#", min(max(level, 1), 6))+" "+text, false)
+	}
+}
+
+func (w *writer) paragraph(text string) {
+	w.block(strings.TrimSpace(text), false)
+}
+
+// listItem writes an item of a list, indented by level. The marker is "-"
+// or the number of the item, e.g. "1.".
+func (w *writer) listItem(level int, marker, text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		w.block(strings.Repeat("   ", max(level, 0))+marker+" "+text, true)
+	}
+}
+
+// table writes rows as a table whose header is the first row. Empty rows
+// and trailing empty columns are dropped.
+func (w *writer) table(rows [][]string) {
+	cols := 0
+	kept := rows[:0:0]
+	for _, row := range rows {
+		n := len(row)
+		for n > 0 && strings.TrimSpace(row[n-1]) == "" {
+			n--
+		}
+		if n == 0 {
+			continue
+		}
+		kept = append(kept, row[:n])
+		cols = max(cols, n)
+	}
+	if len(kept) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for i := range cols {
+			cell := ""
+			if i < len(row) {
+				cell = tableCell(row[i])
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+	}
+	writeRow(kept[0])
+	b.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+	for _, row := range kept[1:] {
+		writeRow(row)
+		if b.Len() >= maxMarkdownSize {
+			w.truncated = true
+			break
+		}
+	}
+	w.block(b.String(), false)
+}
+
+var tableCellReplacer = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+func tableCell(s string) string {
+	return tableCellReplacer.Replace(strings.TrimSpace(s))
+}
+
+func (w *writer) String() string {
+	s := w.b.String()
+	if w.truncated {
+		s += "\n\n[The document is too large, the rest is omitted]"
+	}
+	return s
+}
+
+// maxXMLDepth bounds the nesting of xml elements.
+const maxXMLDepth = 256
+
+// xmlNode is an element of an xml part. Names are local names, namespaces
+// are dropped.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string // the character data directly in the element
+}
+
+// parseXML parses an xml part into a tree.
+func parseXML(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(strings.NewReader(string(data)))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if len(stack) == 1 && len(root.children) > 0 {
+				return root.children[0], nil
+			}
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			top.children = append(top.children, n)
+			if len(stack) > maxXMLDepth {
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 1 {
+				top.text += string(t)
+			}
+		}
+	}
+}
+
+// attr returns the value of an attribute, or "" if n is nil.
+func (n *xmlNode) attr(name string) string {
+	if n == nil {
+		return ""
+	}
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// relID returns the r:id attribute, the id of a relationship of the part.
+func (n *xmlNode) relID() string {
+	for _, a := range n.attrs {
+		if a.Name.Local == "id" && strings.HasSuffix(a.Name.Space, "/relationships") {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child named name, or nil.
+func (n *xmlNode) child(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// path returns the element at the path of child names, or nil.
+func (n *xmlNode) path(names ...string) *xmlNode {
+	for _, name := range names {
+		n = n.child(name)
+	}
+	return n
+}
+
+// all returns the elements named name under n in document order, not
+// looking into matched elements.
+func (n *xmlNode) all(name string) []*xmlNode {
+	var found []*xmlNode
+	n.walk(func(c *xmlNode) bool {
+		if c.name == name {
+			found = append(found, c)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// walk calls fn for the elements under n in document order, not descending
+// into elements for which fn returns false.
+func (n *xmlNode) walk(fn func(*xmlNode) bool) {
+	if n == nil {
+		return
+	}
+	for _, c := range n.children {
+		if fn(c) {
+			c.walk(fn)
+		}
+	}
+}
+
+// textOf joins the text of the elements named name under n.
+func (n *xmlNode) textOf(name string) string {
+	var b strings.Builder
+	for _, t := range n.all(name) {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
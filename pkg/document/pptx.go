@@ -0,0 +1,182 @@
+package document
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+func pptxToMarkdown(data []byte) (string, error) {
+	o, err := openOfficeFile(data)
+	if err != nil {
+		return "", err
+	}
+	part, err := o.read("ppt/presentation.xml")
+	if err != nil {
+		return "", err
+	}
+	if part == nil {
+		return "", fmt.Errorf("%w: no ppt/presentation.xml", ErrUnsupported)
+	}
+	presentation, err := parseXML(part)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse ppt/presentation.xml: %w", err)
+	}
+	rels, err := o.relationships("ppt/presentation.xml")
+	if err != nil {
+		return "", err
+	}
+
+	w := newWriter()
+	for i, sld := range presentation.child("sldIdLst").all("sldId") {
+		if w.full() {
+			break
+		}
+		name, ok := rels[sld.relID()]
+		if !ok {
+			continue
+		}
+		slide, err := parsePart(o, name)
+		if err != nil || slide == nil {
+			continue
+		}
+
+		title := fmt.Sprintf("Slide %d", i+1)
+		if t := slideTitle(slide); t != "" {
+			title += ": " + t
+		}
+		w.heading(2, title)
+		writeShapes(w, slide, true)
+
+		// speaker notes
+		slideRels, _ := o.relationships(name)
+		for _, target := range slideRels {
+			if !strings.HasPrefix(path.Base(target), "notesSlide") {
+				continue
+			}
+			if notes, err := parsePart(o, target); err == nil && notes != nil {
+				var nw writer
+				writeShapes(&nw, notes, false)
+				if text := nw.String(); text != "" {
+					w.paragraph("Notes:\n\n" + text)
+				}
+			}
+		}
+	}
+	return w.String(), nil
+}
+
+func parsePart(o *officeFile, name string) (*xmlNode, error) {
+	data, err := o.read(name)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return parseXML(data)
+}
+
+// placeholder returns the type of the placeholder a shape fills, or "".
+func placeholder(sp *xmlNode) string {
+	for _, c := range sp.children {
+		if !strings.HasPrefix(c.name, "nv") {
+			continue
+		}
+		if ph := c.path("nvPr", "ph"); ph != nil {
+			if t := ph.attr("type"); t != "" {
+				return t
+			}
+			return "body"
+		}
+	}
+	return ""
+}
+
+func isTitle(sp *xmlNode) bool {
+	t := placeholder(sp)
+	return t == "title" || t == "ctrTitle"
+}
+
+func slideTitle(slide *xmlNode) string {
+	for _, sp := range slide.all("sp") {
+		if isTitle(sp) {
+			return strings.Join(strings.Fields(sp.textOf("t")), " ")
+		}
+	}
+	return ""
+}
+
+// writeShapes writes the text of the shapes and tables of a slide in
+// document order. The title is left out when it is in the heading already,
+// and so are slide numbers, dates and footers.
+func writeShapes(w *writer, slide *xmlNode, skipTitle bool) {
+	slide.walk(func(n *xmlNode) bool {
+		switch n.name {
+		case "sp":
+			switch placeholder(n) {
+			case "sldNum", "dt", "ftr", "hdr", "sldImg":
+				return false
+			}
+			if skipTitle && isTitle(n) {
+				return false
+			}
+			if body := n.child("txBody"); body != nil {
+				writeTextBody(w, body)
+			}
+			return false
+		case "tbl":
+			var rows [][]string
+			for _, tr := range n.all("tr") {
+				var row []string
+				for _, tc := range tr.all("tc") {
+					row = append(row, paragraphsText(tc))
+				}
+				rows = append(rows, row)
+			}
+			w.table(rows)
+			return false
+		}
+		return true
+	})
+}
+
+// writeTextBody writes the paragraphs of a text body, as a list when they
+// are indented.
+func writeTextBody(w *writer, body *xmlNode) {
+	for _, p := range body.all("p") {
+		text := pptxText(p)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		pPr := p.child("pPr")
+		level, _ := strconv.Atoi(pPr.attr("lvl"))
+		if level > 0 || pPr.child("buChar") != nil || pPr.child("buAutoNum") != nil {
+			w.listItem(level, "-", text)
+			continue
+		}
+		w.paragraph(text)
+	}
+}
+
+func paragraphsText(n *xmlNode) string {
+	var lines []string
+	for _, p := range n.all("p") {
+		if text := strings.TrimSpace(pptxText(p)); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func pptxText(p *xmlNode) string {
+	var b strings.Builder
+	p.walk(func(n *xmlNode) bool {
+		switch n.name {
+		case "t":
+			b.WriteString(n.text)
+		case "br":
+			b.WriteString("\n")
+		}
+		return true
+	})
+	return b.String()
+}
@@ -0,0 +1,406 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSheetColumns is the number of columns of an Excel sheet.
+const maxSheetColumns = 16384
+
+// numberKind is how a number of a cell is shown, by its number format.
+type numberKind int
+
+const (
+	numberGeneral numberKind = iota
+	numberPercent
+	numberDate
+	numberTime
+	numberDateTime
+)
+
+// xlsxConverter converts the sheets of an Excel workbook.
+type xlsxConverter struct {
+	o        *officeFile
+	shared   []string
+	styles   []numberKind // by cell style index
+	date1904 bool
+}
+
+func xlsxToMarkdown(data []byte) (string, error) {
+	o, err := openOfficeFile(data)
+	if err != nil {
+		return "", err
+	}
+	part, err := o.read("xl/workbook.xml")
+	if err != nil {
+		return "", err
+	}
+	if part == nil {
+		return "", fmt.Errorf("%w: no xl/workbook.xml", ErrUnsupported)
+	}
+	wb, err := parseXML(part)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse xl/workbook.xml: %w", err)
+	}
+	rels, err := o.relationships("xl/workbook.xml")
+	if err != nil {
+		return "", err
+	}
+
+	c := &xlsxConverter{o: o}
+	switch wb.child("workbookPr").attr("date1904") {
+	case "1", "true":
+		c.date1904 = true
+	}
+	if c.shared, err = xlsxSharedStrings(o); err != nil {
+		return "", err
+	}
+	c.styles = xlsxCellStyles(o)
+
+	w := newWriter()
+	for _, sheet := range wb.all("sheet") {
+		if w.full() {
+			break
+		}
+		title := "Sheet: " + sheet.attr("name")
+		if state := sheet.attr("state"); state == "hidden" || state == "veryHidden" {
+			title += " (hidden)"
+		}
+		w.heading(2, title)
+
+		target, ok := rels[sheet.relID()]
+		if !ok {
+			continue
+		}
+		rows, err := c.sheetRows(target)
+		if err != nil {
+			return "", err
+		}
+		if len(rows) == 0 {
+			w.paragraph("(empty)")
+			continue
+		}
+		w.table(rows)
+	}
+	return w.String(), nil
+}
+
+// sheetRows returns the values of the cells of a sheet as shown by Excel,
+// without formatting such as thousands separators.
+func (c *xlsxConverter) sheetRows(name string) ([][]string, error) {
+	part, err := c.o.read(name)
+	if err != nil || part == nil {
+		return nil, err
+	}
+
+	var (
+		d    = xml.NewDecoder(bytes.NewReader(part))
+		rows [][]string
+		row  []string
+		// the current cell
+		col        int
+		typ, style string
+		value      strings.Builder
+		inValue    bool
+		inPhonetic bool
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				col = len(row)
+				typ, style = "", ""
+				value.Reset()
+				for _, a := range t.Attr {
+					switch a.Name.Local {
+					case "r":
+						if n, ok := columnIndex(a.Value); ok {
+							col = n
+						}
+					case "t":
+						typ = a.Value
+					case "s":
+						style = a.Value
+					}
+				}
+			case "v", "t":
+				inValue = !inPhonetic
+			case "rPh":
+				// phonetic guides of east asian text
+				inPhonetic = true
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "rPh":
+				inPhonetic = false
+			case "c":
+				if col >= maxSheetColumns {
+					continue
+				}
+				for len(row) <= col {
+					row = append(row, "")
+				}
+				row[col] = c.cellValue(value.String(), typ, style)
+			case "row":
+				rows = append(rows, row)
+			}
+		}
+	}
+}
+
+func (c *xlsxConverter) cellValue(v, typ, style string) string {
+	switch typ {
+	case "s":
+		if i, err := strconv.Atoi(v); err == nil && i >= 0 && i < len(c.shared) {
+			return c.shared[i]
+		}
+		return ""
+	case "b":
+		if v == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "inlineStr", "str", "e", "d":
+		return v
+	}
+
+	kind := numberGeneral
+	if i, err := strconv.Atoi(style); err == nil && i >= 0 && i < len(c.styles) {
+		kind = c.styles[i]
+	}
+	return formatNumber(v, kind, c.date1904)
+}
+
+// formatNumber formats the number v of a cell. Numbers are rounded to the
+// 15 significant digits Excel shows, dates are shown as 2006-01-02.
+func formatNumber(v string, kind numberKind, date1904 bool) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+
+	switch kind {
+	case numberPercent:
+		return roundNumber(f*100) + "%"
+	case numberDate, numberTime, numberDateTime:
+		if t, ok := excelTime(f, date1904); ok {
+			switch kind {
+			case numberDate:
+				return t.Format(time.DateOnly)
+			case numberTime:
+				return t.Format(time.TimeOnly)
+			default:
+				return t.Format(time.DateTime)
+			}
+		}
+	}
+	return roundNumber(f)
+}
+
+func roundNumber(f float64) string {
+	f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// excelTime converts a serial date of Excel, the days since the start of
+// 1900 or 1904.
+func excelTime(serial float64, date1904 bool) (time.Time, bool) {
+	if serial < 0 || serial > 2958465 { // 9999-12-31
+		return time.Time{}, false
+	}
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	switch {
+	case date1904:
+		base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	case serial < 60:
+		// Excel counts 1900-02-29, which did not exist
+		base = base.AddDate(0, 0, 1)
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	return base.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second), true
+}
+
+// columnIndex returns the column of a cell reference such as B3, from 0.
+func columnIndex(ref string) (int, bool) {
+	n := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		n = n*26 + int(ref[i]-'A'+1)
+		if n > maxSheetColumns {
+			return 0, false
+		}
+	}
+	return n - 1, i > 0
+}
+
+// xlsxSharedStrings returns the strings cells refer to by index.
+func xlsxSharedStrings(o *officeFile) ([]string, error) {
+	part, err := o.read("xl/sharedStrings.xml")
+	if err != nil || part == nil {
+		return nil, err
+	}
+
+	var (
+		d          = xml.NewDecoder(bytes.NewReader(part))
+		shared     []string
+		item       strings.Builder
+		inText     bool
+		inPhonetic bool
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return shared, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xl/sharedStrings.xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				item.Reset()
+			case "t":
+				inText = !inPhonetic
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.CharData:
+			if inText {
+				item.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			case "si":
+				shared = append(shared, item.String())
+			}
+		}
+	}
+}
+
+// xlsxCellStyles returns how numbers of each cell style are shown.
+func xlsxCellStyles(o *officeFile) []numberKind {
+	part, err := o.read("xl/styles.xml")
+	if err != nil || part == nil {
+		return nil
+	}
+	root, err := parseXML(part)
+	if err != nil {
+		return nil
+	}
+
+	custom := make(map[int]numberKind)
+	for _, f := range root.child("numFmts").all("numFmt") {
+		if id, err := strconv.Atoi(f.attr("numFmtId")); err == nil {
+			custom[id] = numberFormatKind(f.attr("formatCode"))
+		}
+	}
+
+	var styles []numberKind
+	for _, xf := range root.child("cellXfs").all("xf") {
+		id, _ := strconv.Atoi(xf.attr("numFmtId"))
+		kind, ok := custom[id]
+		if !ok {
+			kind = builtinNumberKind(id)
+		}
+		styles = append(styles, kind)
+	}
+	return styles
+}
+
+func builtinNumberKind(id int) numberKind {
+	switch {
+	case id == 9 || id == 10:
+		return numberPercent
+	case id >= 14 && id <= 17:
+		return numberDate
+	case id >= 18 && id <= 21, id >= 45 && id <= 47:
+		return numberTime
+	case id == 22:
+		return numberDateTime
+	}
+	return numberGeneral
+}
+
+// numberFormatKind tells dates, times and percentages by the letters of a
+// format code outside of quoted text, escapes and brackets.
+func numberFormatKind(code string) numberKind {
+	// the first section formats positive numbers
+	var (
+		b       strings.Builder
+		elapsed bool
+	)
+	for i := 0; i < len(code); i++ {
+		switch ch := code[i]; ch {
+		case ';':
+			i = len(code)
+		case '"':
+			if j := strings.IndexByte(code[i+1:], '"'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(code)
+			}
+		case '\\', '_', '*':
+			i++
+		case '[':
+			j := strings.IndexByte(code[i:], ']')
+			if j < 0 {
+				i = len(code)
+				continue
+			}
+			switch strings.ToLower(code[i+1 : i+j]) {
+			case "h", "hh", "m", "mm", "s", "ss":
+				elapsed = true
+			}
+			i += j
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	s := strings.ToLower(b.String())
+	hasDate := strings.ContainsAny(s, "yd") || (strings.Contains(s, "m") && !strings.ContainsAny(s, "hs"))
+	hasTime := elapsed || strings.ContainsAny(s, "hs")
+	switch {
+	case s == "general":
+		return numberGeneral
+	case hasDate && hasTime:
+		return numberDateTime
+	case hasDate:
+		return numberDate
+	case hasTime:
+		return numberTime
+	case strings.Contains(s, "%"):
+		return numberPercent
+	}
+	return numberGeneral
+}
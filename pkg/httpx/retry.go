@@ -5,6 +5,8 @@ import (
 	"math"
 	"net/http"
 	"time"
+
+	"github.com/ryanreadbooks/tokkibot/pkg/metrics"
 )
 
 type RetryConfig struct {
@@ -53,6 +55,7 @@ func (rt *RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error
 
 	for attempt := 0; attempt <= rt.cfg.MaxRetries; attempt++ {
 		if attempt > 0 {
+			metrics.HTTPRetries.WithLabelValues(req.URL.Host).Inc()
 			delay := rt.calcBackoff(attempt)
 			select {
 			case <-req.Context().Done():
@@ -3,12 +3,14 @@ package log
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/ryanreadbooks/tokkibot/pkg/secret"
 	"github.com/ryanreadbooks/tokkibot/pkg/trace"
 )
 
@@ -59,7 +61,7 @@ func rotateLogFile() error {
 	currentDate = today
 
 	// Create a JSON handler with time formatting and short source paths
-	jsonHandler := slog.NewJSONHandler(logFile, &slog.HandlerOptions{
+	jsonHandler := slog.NewJSONHandler(redactWriter{w: logFile}, &slog.HandlerOptions{
 		Level:     slog.LevelDebug,
 		AddSource: true,
 		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
@@ -89,6 +91,18 @@ func rotateLogFile() error {
 	return nil
 }
 
+// redactWriter hides registered secret values from log lines.
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := r.w.Write(secret.RedactBytes(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
 // TraceHandler wraps a slog.Handler to add trace info from context
 type TraceHandler struct {
 	slog.Handler
@@ -110,6 +124,12 @@ func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
 			r.AddAttrs(slog.String(trace.LogKeyMessageID, traceInfo.MessageID))
 		}
 	}
+	if traceID, spanID := trace.SpanIDs(ctx); traceID != "" {
+		r.AddAttrs(
+			slog.String(trace.LogKeyTraceID, traceID),
+			slog.String(trace.LogKeySpanID, spanID),
+		)
+	}
 	return h.Handler.Handle(ctx, r)
 }
 
@@ -0,0 +1,121 @@
+// Package metrics defines prometheus metrics of tokkibot.
+//
+// All metrics are registered to a dedicated registry which is exposed by
+// Handler.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tokkibot"
+
+// Status label values
+const (
+	StatusOK      = "ok"
+	StatusError   = "error"
+	StatusSkipped = "skipped"
+)
+
+// Tool kinds
+const (
+	ToolKindBuiltin = "builtin"
+	ToolKindMcp     = "mcp"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	LLMRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "Latency of LLM requests.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"provider", "model", "stream", "status"})
+
+	LLMTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens reported by LLM providers.",
+	}, []string{"provider", "model", "type"}) // type: prompt | completion
+
+	ToolInvocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_invocations_total",
+		Help:      "Tool invocations.",
+	}, []string{"tool", "kind", "status"})
+
+	ToolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_duration_seconds",
+		Help:      "Duration of tool invocations.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30, 60},
+	}, []string{"tool", "kind"})
+
+	CronExecutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cron_executions_total",
+		Help:      "Cron task executions by outcome.",
+	}, []string{"task", "status"})
+
+	HeartbeatRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_runs_total",
+		Help:      "Heartbeat runs by result.",
+	}, []string{"agent", "result"}) // result: delivered | nothing | canceled | dropped | skipped
+
+	HTTPRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_retries_total",
+		Help:      "Retried outgoing http requests.",
+	}, []string{"host"})
+
+	ContextCompactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "context_compactions_total",
+		Help:      "Context compaction events.",
+	}, []string{"agent", "kind", "trigger"}) // kind: compress_tool_calls | summarize, trigger: auto | manual
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		LLMRequestDuration,
+		LLMTokens,
+		ToolInvocations,
+		ToolDuration,
+		CronExecutions,
+		HeartbeatRuns,
+		HTTPRetries,
+		ContextCompactions,
+	)
+}
+
+// Register registers extra collectors, e.g. collectors reading runtime state
+// at scrape time.
+func Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns the http handler serving all metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// StatusOf returns StatusOK if err is nil, StatusError otherwise.
+func StatusOf(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusOK
+}
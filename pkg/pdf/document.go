@@ -0,0 +1,381 @@
+// Package pdf extracts the text of PDF files in pure Go. It reads the
+// subset of the format written by office suites, browsers and TeX:
+// uncompressed and object-stream objects, Flate, ASCIIHex and ASCII85
+// streams and ToUnicode maps of fonts. Encrypted files are not supported
+// and scanned pages have no text.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+var (
+	ErrNotPDF    = errors.New("not a pdf file")
+	ErrEncrypted = errors.New("encrypted pdf files are not supported")
+)
+
+const (
+	maxResolveDepth = 32
+	maxDecodedSize  = 64 * 1024 * 1024 // 64MB per stream
+)
+
+var objectHeaderRegexp = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// Document is a parsed PDF file.
+type Document struct {
+	objects map[int]any
+	trailer dict
+	pages   []page
+}
+
+type page struct {
+	dict      dict
+	resources dict
+}
+
+// Open parses a PDF file. The cross-reference table is not needed, objects
+// are found by scanning the file, so damaged files can often still be read.
+func Open(data []byte) (*Document, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+
+	d := &Document{objects: make(map[int]any), trailer: dict{}}
+	d.scanObjects(data)
+	d.scanTrailers(data)
+	if _, ok := d.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+	d.expandObjectStreams()
+	d.pages = d.collectPages()
+	if len(d.pages) == 0 {
+		return nil, fmt.Errorf("%w: no pages found", ErrNotPDF)
+	}
+	return d, nil
+}
+
+// NumPages returns the number of pages.
+func (d *Document) NumPages() int {
+	return len(d.pages)
+}
+
+// scanObjects parses every "num gen obj" of the file. Later objects replace
+// earlier ones, as incremental updates append to the file.
+func (d *Document) scanObjects(data []byte) {
+	end := 0
+	for _, m := range objectHeaderRegexp.FindAllSubmatchIndex(data, -1) {
+		if m[0] < end {
+			// inside the previous object, e.g. in stream data
+			continue
+		}
+		if m[0] > 0 && !isSpace(data[m[0]-1]) && !isDelimiter(data[m[0]-1]) {
+			continue
+		}
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+
+		p := newParser(data)
+		p.pos = m[1]
+		v, err := p.value()
+		if err != nil {
+			continue
+		}
+		if dct, ok := v.(dict); ok {
+			if s, next, ok := readStream(data, p.pos, dct); ok {
+				v = s
+				p.pos = next
+			}
+		}
+		d.objects[num] = v
+		end = p.pos
+	}
+}
+
+// readStream reads the stream data following the dictionary of a stream
+// object at pos.
+func readStream(data []byte, pos int, dct dict) (*stream, int, bool) {
+	p := newParser(data)
+	p.pos = pos
+	p.skipSpace()
+	if !bytes.HasPrefix(data[p.pos:], []byte("stream")) {
+		return nil, pos, false
+	}
+	start := p.pos + len("stream")
+	if start < len(data) && data[start] == '\r' {
+		start++
+	}
+	if start < len(data) && data[start] == '\n' {
+		start++
+	}
+
+	// trust /Length only if endstream follows it
+	if n, ok := toInt(dct["Length"]); ok && n >= 0 && n <= len(data)-start {
+		q := newParser(data)
+		q.pos = start + n
+		q.skipSpace()
+		if bytes.HasPrefix(data[q.pos:], []byte("endstream")) {
+			return &stream{dict: dct, raw: data[start : start+n]}, q.pos + len("endstream"), true
+		}
+	}
+
+	i := bytes.Index(data[start:], []byte("endstream"))
+	if i < 0 {
+		return &stream{dict: dct, raw: data[start:]}, len(data), true
+	}
+	raw := bytes.TrimSuffix(data[start:start+i], []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return &stream{dict: dct, raw: raw}, start + i + len("endstream"), true
+}
+
+// scanTrailers merges the trailer dictionaries and the dictionaries of
+// cross-reference streams, later ones win.
+func (d *Document) scanTrailers(data []byte) {
+	merge := func(t dict) {
+		for _, k := range []name{"Root", "Encrypt", "Info"} {
+			if v, ok := t[k]; ok {
+				d.trailer[k] = v
+			}
+		}
+	}
+
+	for _, num := range slices.Sorted(maps.Keys(d.objects)) {
+		if s, ok := d.objects[num].(*stream); ok && s.dict["Type"] == name("XRef") {
+			merge(s.dict)
+		}
+	}
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		p := newParser(data)
+		p.pos = i + j + len("trailer")
+		if v, err := p.value(); err == nil {
+			if t, ok := v.(dict); ok {
+				merge(t)
+			}
+		}
+		i += j + len("trailer")
+	}
+}
+
+// expandObjectStreams adds the objects compressed in object streams which
+// are not defined directly.
+func (d *Document) expandObjectStreams() {
+	for _, num := range slices.Sorted(maps.Keys(d.objects)) {
+		s, ok := d.objects[num].(*stream)
+		if !ok || s.dict["Type"] != name("ObjStm") {
+			continue
+		}
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := toInt(d.resolve(s.dict["N"]))
+		first, _ := toInt(d.resolve(s.dict["First"]))
+		if first <= 0 || first > len(data) {
+			continue
+		}
+
+		header := newParser(data[:first])
+		for range n {
+			objNum, err1 := header.value()
+			offset, err2 := header.value()
+			if err1 != nil || err2 != nil {
+				break
+			}
+			on, ok1 := toInt(objNum)
+			off, ok2 := toInt(offset)
+			if !ok1 || !ok2 || off < 0 || off >= len(data)-first {
+				continue
+			}
+			if _, ok := d.objects[on]; ok {
+				continue
+			}
+			p := newParser(data)
+			p.pos = first + off
+			if v, err := p.value(); err == nil {
+				d.objects[on] = v
+			}
+		}
+	}
+}
+
+// resolve follows references.
+func (d *Document) resolve(v any) any {
+	for range maxResolveDepth {
+		r, ok := v.(ref)
+		if !ok {
+			return v
+		}
+		v = d.objects[r.num]
+	}
+	return nil
+}
+
+func (d *Document) resolveDict(v any) dict {
+	switch v := d.resolve(v).(type) {
+	case dict:
+		return v
+	case *stream:
+		return v.dict
+	}
+	return nil
+}
+
+// decode returns the decoded data of a stream.
+func (d *Document) decode(s *stream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = []any{f}
+	case array:
+		filters = f
+	}
+
+	data := s.raw
+	for _, f := range filters {
+		var err error
+		switch d.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			data, err = inflate(data)
+		case name("ASCIIHexDecode"), name("AHx"):
+			data, err = decodeASCIIHex(data)
+		case name("ASCII85Decode"), name("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data. Data of truncated or damaged streams is
+// kept as far as it could be read.
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, maxDecodedSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// collectPages walks the page tree from the catalog. Without a usable
+// catalog, page objects are taken in the order of their numbers.
+func (d *Document) collectPages() []page {
+	var pages []page
+	visited := make(map[int]bool)
+
+	var walk func(v any, resources dict, depth int)
+	walk = func(v any, resources dict, depth int) {
+		if r, ok := v.(ref); ok {
+			if visited[r.num] {
+				return
+			}
+			visited[r.num] = true
+		}
+		node := d.resolveDict(v)
+		if node == nil || depth > maxResolveDepth {
+			return
+		}
+		if res := d.resolveDict(node["Resources"]); res != nil {
+			resources = res
+		}
+		kids, ok := d.resolve(node["Kids"]).(array)
+		if !ok {
+			if node["Type"] != name("Pages") {
+				pages = append(pages, page{dict: node, resources: resources})
+			}
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+
+	if catalog := d.resolveDict(d.trailer["Root"]); catalog != nil {
+		walk(catalog["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, num := range slices.Sorted(maps.Keys(d.objects)) {
+		if node, ok := d.objects[num].(dict); ok && node["Type"] == name("Page") {
+			pages = append(pages, page{dict: node, resources: d.resolveDict(node["Resources"])})
+		}
+	}
+	return pages
+}
+
+// contents returns the decoded content streams of a page.
+func (d *Document) contents(pg page) []byte {
+	var streams []any
+	switch c := d.resolve(pg.dict["Contents"]).(type) {
+	case *stream:
+		streams = []any{c}
+	case array:
+		streams = c
+	}
+
+	var buf bytes.Buffer
+	for _, s := range streams {
+		s, ok := d.resolve(s).(*stream)
+		if !ok {
+			continue
+		}
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,308 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// maxCMapEntries bounds the codes a ToUnicode map may define.
+const maxCMapEntries = 1 << 20
+
+// font maps the character codes of strings shown with a font to text.
+type font struct {
+	toUnicode *cmap
+	twoByte   bool        // composite fonts without a ToUnicode map
+	encoding  [256]string // simple fonts
+}
+
+var defaultFont = newSimpleFont(nil)
+
+func newSimpleFont(base *charmap.Charmap) *font {
+	if base == nil {
+		base = charmap.Windows1252
+	}
+	f := &font{}
+	for i := range f.encoding {
+		if r := base.DecodeByte(byte(i)); r >= ' ' {
+			f.encoding[i] = string(r)
+		}
+	}
+	return f
+}
+
+func (d *Document) loadFont(fd dict) *font {
+	if fd == nil {
+		return defaultFont
+	}
+
+	var f *font
+	if fd["Subtype"] == name("Type0") {
+		f = &font{twoByte: true}
+	} else {
+		f = d.simpleFont(fd)
+	}
+	if s, ok := d.resolve(fd["ToUnicode"]).(*stream); ok {
+		if data, err := d.decode(s); err == nil {
+			if cm := parseCMap(data); len(cm.chars) > 0 {
+				f.toUnicode = cm
+			}
+		}
+	}
+	return f
+}
+
+// simpleFont reads the encoding and the differences of a simple font.
+func (d *Document) simpleFont(fd dict) *font {
+	var (
+		base        *charmap.Charmap
+		differences array
+	)
+	switch enc := d.resolve(fd["Encoding"]).(type) {
+	case name:
+		base = namedEncoding(enc)
+	case dict:
+		if n, ok := d.resolve(enc["BaseEncoding"]).(name); ok {
+			base = namedEncoding(n)
+		}
+		differences, _ = d.resolve(enc["Differences"]).(array)
+	}
+
+	f := newSimpleFont(base)
+	code := 0
+	for _, v := range differences {
+		switch v := d.resolve(v).(type) {
+		case float64:
+			code = int(v)
+		case name:
+			if code >= 0 && code < 256 {
+				if text, ok := glyphText(string(v)); ok {
+					f.encoding[code] = text
+				}
+			}
+			code++
+		}
+	}
+	return f
+}
+
+func namedEncoding(n name) *charmap.Charmap {
+	if n == "MacRomanEncoding" {
+		return charmap.Macintosh
+	}
+	return charmap.Windows1252
+}
+
+func (f *font) decode(s string) string {
+	if f.toUnicode != nil {
+		return f.toUnicode.decode(s, f)
+	}
+	if f.twoByte {
+		// codes are glyph ids which cannot be mapped without a ToUnicode map
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		b.WriteString(f.encoding[s[i]])
+	}
+	return b.String()
+}
+
+// cmap is a ToUnicode map.
+type cmap struct {
+	spaces []codespace
+	chars  map[cmapCode]string
+}
+
+type codespace struct {
+	n      int // bytes of a code
+	lo, hi uint32
+}
+
+type cmapCode struct {
+	n    int
+	code uint32
+}
+
+func codeOf(s string) cmapCode {
+	c := cmapCode{n: len(s)}
+	for i := 0; i < len(s) && i < 4; i++ {
+		c.code = c.code<<8 | uint32(s[i])
+	}
+	return c
+}
+
+// parseCMap reads the codespace ranges, bfchar and bfrange mappings of a
+// ToUnicode map.
+func parseCMap(data []byte) *cmap {
+	cm := &cmap{chars: make(map[cmapCode]string)}
+	p := newParser(data)
+	var operands []any
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return cm
+		}
+		v, err := p.value()
+		if err != nil {
+			return cm
+		}
+		kw, ok := v.(keyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 && len(lo) <= 4 {
+					cm.spaces = append(cm.spaces, codespace{n: len(lo), lo: codeOf(lo).code, hi: codeOf(hi).code})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(string)
+				dst, ok2 := operands[i+1].(string)
+				if ok1 && ok2 && len(cm.chars) < maxCMapEntries {
+					cm.chars[codeOf(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 {
+					continue
+				}
+				cm.addRange(codeOf(lo), codeOf(hi).code, operands[i+2])
+			}
+		}
+		if strings.HasPrefix(string(kw), "end") || strings.HasPrefix(string(kw), "begin") {
+			operands = operands[:0]
+		}
+	}
+}
+
+func (cm *cmap) addRange(lo cmapCode, hi uint32, dst any) {
+	if hi < lo.code || int(hi-lo.code) > maxCMapEntries-len(cm.chars) {
+		return
+	}
+	switch dst := dst.(type) {
+	case string:
+		// the last code unit is incremented through the range
+		units := utf16Units(dst)
+		if len(units) == 0 {
+			return
+		}
+		for code := lo.code; code <= hi; code++ {
+			cm.chars[cmapCode{n: lo.n, code: code}] = string(utf16.Decode(units))
+			units[len(units)-1]++
+			if code == hi {
+				break
+			}
+		}
+	case array:
+		for i, v := range dst {
+			s, ok := v.(string)
+			code := lo.code + uint32(i)
+			if !ok || code > hi {
+				break
+			}
+			cm.chars[cmapCode{n: lo.n, code: code}] = utf16BE(s)
+		}
+	}
+}
+
+// decode maps the codes of s, which are split by the codespace ranges.
+// Unmapped single byte codes fall back to the encoding of the font.
+func (cm *cmap) decode(s string, f *font) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := cm.codeLen(s[i:], f)
+		code := codeOf(s[i : i+n])
+		if text, ok := cm.chars[code]; ok {
+			b.WriteString(text)
+		} else if n == 1 && !f.twoByte {
+			b.WriteString(f.encoding[s[i]])
+		}
+		i += n
+	}
+	return b.String()
+}
+
+func (cm *cmap) codeLen(s string, f *font) int {
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		code := codeOf(s[:n]).code
+		for _, sp := range cm.spaces {
+			if sp.n == n && code >= sp.lo && code <= sp.hi {
+				return n
+			}
+		}
+	}
+	if f.twoByte && len(s) >= 2 {
+		return 2
+	}
+	return 1
+}
+
+func utf16Units(s string) []uint16 {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return units
+}
+
+func utf16BE(s string) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
+
+// glyphNames maps common glyph names of the Adobe glyph list to text.
+// Letters and digits named by themselves, uniXXXX and uXXXX are handled by
+// glyphText.
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#",
+	"dollar": "$", "percent": "%", "ampersand": "&", "quotesingle": "'",
+	"parenleft": "(", "parenright": ")", "asterisk": "*", "plus": "+",
+	"comma": ",", "hyphen": "-", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	"colon": ":", "semicolon": ";", "less": "<", "equal": "=",
+	"greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "asciicircum": "^",
+	"underscore": "_", "grave": "`", "braceleft": "{", "bar": "|",
+	"braceright": "}", "asciitilde": "~", "quoteleft": "‘",
+	"quoteright": "’", "quotedblleft": "“", "quotedblright": "”",
+	"quotesinglbase": "‚", "quotedblbase": "„", "endash": "–",
+	"emdash": "—", "bullet": "•", "ellipsis": "…", "dagger": "†",
+	"daggerdbl": "‡", "minus": "−", "degree": "°", "copyright": "©",
+	"registered": "®", "trademark": "™", "section": "§", "paragraph": "¶",
+	"euro": "€", "sterling": "£", "yen": "¥", "cent": "¢",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"nbspace": " ", "periodcentered": "·", "multiply": "×", "divide": "÷",
+}
+
+func glyphText(n string) (string, bool) {
+	if text, ok := glyphNames[n]; ok {
+		return text, true
+	}
+	if len(n) == 1 {
+		return n, true
+	}
+	if hex, ok := strings.CutPrefix(n, "uni"); ok && len(hex) >= 4 {
+		if v, err := strconv.ParseUint(hex[:4], 16, 32); err == nil {
+			return string(rune(v)), true
+		}
+	}
+	if hex, ok := strings.CutPrefix(n, "u"); ok && len(hex) >= 4 && len(hex) <= 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return string(rune(v)), true
+		}
+	}
+	return "", false
+}
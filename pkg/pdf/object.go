@@ -0,0 +1,372 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// PDF objects as parsed: nil, bool, float64, string (literal and hex
+// strings keep their raw bytes), name, array, dict, ref, keyword and
+// *stream.
+type (
+	name    string
+	keyword string
+	array   []any
+	dict    map[name]any
+
+	ref struct {
+		num, gen int
+	}
+
+	stream struct {
+		dict dict
+		raw  []byte
+	}
+)
+
+var errSyntax = errors.New("pdf syntax error")
+
+// maxNesting bounds arrays and dictionaries in arrays and dictionaries.
+const maxNesting = 64
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// parser reads objects of a file or tokens of a content stream.
+type parser struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func newParser(data []byte) *parser {
+	return &parser{data: data}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+// skipSpace skips whitespace and comments.
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case isSpace(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// value reads the next object. Keywords, such as the operators of content
+// streams, are returned as keyword.
+func (p *parser) value() (any, error) {
+	p.skipSpace()
+	if p.eof() {
+		return nil, errSyntax
+	}
+
+	c := p.data[p.pos]
+	switch {
+	case c == '/':
+		p.pos++
+		return p.name(), nil
+	case c == '(':
+		p.pos++
+		return p.literalString(), nil
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		return p.dict()
+	case c == '<':
+		p.pos++
+		return p.hexString(), nil
+	case c == '[':
+		p.pos++
+		return p.array()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.numberOrRef()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		// stray delimiter, skip it as a keyword
+		p.pos++
+		return keyword(c), nil
+	}
+
+	kw := p.regular()
+	switch kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return keyword(kw), nil
+}
+
+// regular reads a run of regular characters.
+func (p *parser) regular() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func (p *parser) name() name {
+	raw := p.regular()
+	if !bytes.ContainsRune([]byte(raw), '#') {
+		return name(raw)
+	}
+	var b []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(raw[i+1:i+3], 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, raw[i])
+	}
+	return name(b)
+}
+
+func (p *parser) literalString() string {
+	var (
+		b     []byte
+		depth = 1
+	)
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(b)
+			}
+		case '\\':
+			if p.eof() {
+				return string(b)
+			}
+			c = p.data[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// line continuation
+				if !p.eof() && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && !p.eof() && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func (p *parser) hexString() string {
+	var (
+		b    []byte
+		half = -1
+	)
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		if c == '>' {
+			break
+		}
+		var v int
+		switch {
+		case c >= '0' && c <= '9':
+			v = int(c - '0')
+		case c >= 'a' && c <= 'f':
+			v = int(c-'a') + 10
+		case c >= 'A' && c <= 'F':
+			v = int(c-'A') + 10
+		default:
+			continue
+		}
+		if half < 0 {
+			half = v
+		} else {
+			b = append(b, byte(half<<4|v))
+			half = -1
+		}
+	}
+	if half >= 0 {
+		b = append(b, byte(half<<4))
+	}
+	return string(b)
+}
+
+func (p *parser) array() (any, error) {
+	if p.depth++; p.depth > maxNesting {
+		return nil, errSyntax
+	}
+	defer func() { p.depth-- }()
+
+	a := array{}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return a, nil
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return a, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+}
+
+func (p *parser) dict() (any, error) {
+	if p.depth++; p.depth > maxNesting {
+		return nil, errSyntax
+	}
+	defer func() { p.depth-- }()
+
+	d := dict{}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return d, nil
+		}
+		if p.data[p.pos] == '>' {
+			p.pos++
+			if !p.eof() && p.data[p.pos] == '>' {
+				p.pos++
+			}
+			return d, nil
+		}
+		k, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(name)
+		if !ok {
+			// a broken entry, skip to the next name
+			continue
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if kw, ok := v.(keyword); ok && (kw == ">" || kw == "endobj") {
+			return d, nil
+		}
+		d[key] = v
+	}
+}
+
+// numberOrRef reads a number, or a reference "num gen R".
+func (p *parser) numberOrRef() (any, error) {
+	n, isInt, ok := p.number()
+	if !ok {
+		return keyword(p.regular()), nil
+	}
+	if !isInt || n < 0 {
+		return n, nil
+	}
+
+	save := p.pos
+	p.skipSpace()
+	gen, isInt, ok := p.number()
+	if ok && isInt && gen >= 0 {
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == 'R' &&
+			(p.pos+1 == len(p.data) || isSpace(p.data[p.pos+1]) || isDelimiter(p.data[p.pos+1])) {
+			p.pos++
+			return ref{num: int(n), gen: int(gen)}, nil
+		}
+	}
+	p.pos = save
+	return n, nil
+}
+
+func (p *parser) number() (n float64, isInt, ok bool) {
+	start := p.pos
+	if p.pos < len(p.data) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+		p.pos++
+	}
+	isInt = true
+	digits := 0
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '.' && isInt {
+			isInt = false
+		} else if c < '0' || c > '9' {
+			break
+		} else {
+			digits++
+		}
+		p.pos++
+	}
+	if digits == 0 {
+		p.pos = start
+		return 0, false, false
+	}
+	n, err := strconv.ParseFloat(string(p.data[start:p.pos]), 64)
+	if err != nil {
+		p.pos = start
+		return 0, false, false
+	}
+	return n, isInt, true
+}
+
+func toInt(v any) (int, bool) {
+	f, ok := v.(float64)
+	return int(f), ok
+}
+
+func toFloat(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
@@ -0,0 +1,146 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pdfBuilder writes minimal PDF files for tests.
+type pdfBuilder struct {
+	objs []string
+}
+
+func (b *pdfBuilder) add(obj string) int {
+	b.objs = append(b.objs, obj)
+	return len(b.objs)
+}
+
+func (b *pdfBuilder) stream(dict string, data string, compress bool) int {
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write([]byte(data))
+		w.Close()
+		data = buf.String()
+		dict += " /Filter /FlateDecode"
+	}
+	return b.add(fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data))
+}
+
+func (b *pdfBuilder) bytes(trailer string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for i, obj := range b.objs {
+		if obj == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d %s >>\n%%%%EOF\n", len(b.objs)+1, trailer)
+	return buf.Bytes()
+}
+
+func TestExtractText(t *testing.T) {
+	b := &pdfBuilder{}
+	font := b.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [39 /quoteright 150 /fi] >> >>")
+	c1 := b.stream("", "BT /F1 12 Tf 72 720 Td (Hello, World!) Tj 0 -14 Td (It\\047s a \\226ne day) Tj ET", false)
+	c2 := b.stream("", "BT /F1 12 Tf 1 0 0 1 72 720 Tm [(Page)-250(two)] TJ ET\nBI /W 2 /H 1 /BPC 8 /CS /G ID \x00\xff EI\nBT 1 0 0 1 72 700 Tm (\\(done\\)) Tj ET", true)
+	pages := b.add("")
+	p1 := b.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R >>", pages, c1))
+	p2 := b.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents [%d 0 R] >>", pages, c2))
+	b.objs[pages-1] = fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R %d 0 R] /Count 2 /Resources << /Font << /F1 %d 0 R >> >> >>", p1, p2, font)
+	root := b.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+
+	got, err := ExtractText(b.bytes(fmt.Sprintf("/Root %d 0 R", root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Hello, World!\nIt’s a fine day", "Page two\n(done)"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExtractTextToUnicode(t *testing.T) {
+	b := &pdfBuilder{}
+	cmap := b.stream("", `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <0020>
+<0010> <4F60597D>
+endbfchar
+1 beginbfrange
+<0020> <0022> <0061>
+endbfrange
+endcmap`, true)
+	font := b.add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /Noto /Encoding /Identity-H /ToUnicode %d 0 R >>", cmap))
+	form := b.stream(fmt.Sprintf("/Type /XObject /Subtype /Form /Resources << /Font << /F2 %d 0 R >> >>", font),
+		"BT /F2 10 Tf 0 -20 Td <0010> Tj ET", true)
+	content := b.stream("", "BT /F2 10 Tf 72 720 Td <00200021000300220099> Tj ET /X1 Do", true)
+
+	// the page tree is compressed in an object stream
+	pageNum, pagesNum, rootNum := len(b.objs)+1, len(b.objs)+2, len(b.objs)+3
+	objs := []string{
+		fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R /Resources << /Font << /F2 %d 0 R >> /XObject << /X1 %d 0 R >> >> >>", pagesNum, content, font, form),
+		fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", pageNum),
+		fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesNum),
+	}
+	var header, body strings.Builder
+	for i, obj := range objs {
+		fmt.Fprintf(&header, "%d %d ", pageNum+i, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	b.objs = append(b.objs, "", "", "")
+	b.stream(fmt.Sprintf("/Type /ObjStm /N 3 /First %d", header.Len()), header.String()+body.String(), true)
+
+	got, err := ExtractText(b.bytes(fmt.Sprintf("/Root %d 0 R", rootNum)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "ab c\n你好" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open([]byte("hello")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("expected ErrNotPDF, got %v", err)
+	}
+
+	b := &pdfBuilder{}
+	b.add("<< /Type /Catalog >>")
+	b.add("<< /Filter /Standard /V 2 >>")
+	if _, err := Open(b.bytes("/Root 1 0 R /Encrypt 2 0 R")); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("expected ErrEncrypted, got %v", err)
+	}
+	if _, err := Open(b.bytes("/Root 1 0 R")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("expected no pages, got %v", err)
+	}
+}
+
+func TestExtractTextMalformed(t *testing.T) {
+	// /Length overflows the stream start, which the padding moves far
+	// enough into the file
+	b := &pdfBuilder{}
+	b.add("(" + strings.Repeat("x", 4096) + ")")
+	b.add("<< /Length 9223372036854774000 >>\nstream\nBT (x) Tj ET\nendstream")
+	b.add("<< /Type /Catalog >>")
+	if _, err := ExtractText(b.bytes("/Root 3 0 R")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("huge length: expected ErrNotPDF, got %v", err)
+	}
+
+	// object stream header with a negative offset
+	b = &pdfBuilder{}
+	b.stream("/Type /ObjStm /N 1 /First 5", "5 -20<< /Type /Catalog >>", false)
+	if _, err := ExtractText(b.bytes("/Root 5 0 R")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("negative offset: expected ErrNotPDF, got %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFormDepth bounds form xobjects drawn by form xobjects.
+const maxFormDepth = 8
+
+// ExtractText returns the text of each page of a PDF file.
+func ExtractText(data []byte) (_ []string, err error) {
+	// the parser reads untrusted files, a bug in it must not take the
+	// caller down
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed pdf file: %v", r)
+		}
+	}()
+
+	d, err := Open(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]string, d.NumPages())
+	for i := range pages {
+		pages[i] = d.Text(i)
+	}
+	return pages, nil
+}
+
+// Text returns the text of page i, counting from 0. Lines are kept, the
+// text of a line is joined by spaces where the file moves to the right.
+func (d *Document) Text(i int) string {
+	if i < 0 || i >= len(d.pages) {
+		return ""
+	}
+	pg := d.pages[i]
+	e := &textExtractor{d: d, fonts: make(map[int]*font)}
+	e.run(d.contents(pg), pg.resources, 0)
+	return cleanText(e.out.String())
+}
+
+type textExtractor struct {
+	d     *Document
+	out   strings.Builder
+	fonts map[int]*font // by object number
+
+	y    float64
+	hasY bool
+}
+
+func (e *textExtractor) run(content []byte, resources dict, depth int) {
+	var (
+		p        = newParser(content)
+		operands []any
+		cur      *font
+	)
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return
+		}
+		v, err := p.value()
+		if err != nil {
+			return
+		}
+		op, ok := v.(keyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if n, ok := operands[len(operands)-2].(name); ok {
+					cur = e.font(resources, n)
+				}
+			}
+		case "Tj":
+			e.show(cur, lastOperand(operands))
+		case "'", "\"":
+			e.newline()
+			e.show(cur, lastOperand(operands))
+		case "TJ":
+			items, _ := lastOperand(operands).(array)
+			for _, item := range items {
+				switch item := item.(type) {
+				case string:
+					e.show(cur, item)
+				case float64:
+					// a large negative adjustment moves right by a space
+					if item < -200 {
+						e.space()
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, ty := toFloat(operands[len(operands)-2]), toFloat(operands[len(operands)-1])
+				if ty != 0 {
+					e.y += ty
+					e.newline()
+				} else if tx > 0 {
+					e.space()
+				}
+			}
+		case "T*":
+			e.newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				y := toFloat(operands[len(operands)-1])
+				if e.hasY && math.Abs(y-e.y) > 0.5 {
+					e.newline()
+				} else {
+					e.space()
+				}
+				e.y, e.hasY = y, true
+			}
+		case "Do":
+			if n, ok := lastOperand(operands).(name); ok && depth < maxFormDepth {
+				e.form(resources, n, depth)
+			}
+		case "BI":
+			p.skipInlineImage()
+		case "ET":
+			e.space()
+		}
+		operands = operands[:0]
+	}
+}
+
+func lastOperand(operands []any) any {
+	if len(operands) == 0 {
+		return nil
+	}
+	return operands[len(operands)-1]
+}
+
+// form draws the text of a form xobject.
+func (e *textExtractor) form(resources dict, n name, depth int) {
+	xobjects := e.d.resolveDict(resources["XObject"])
+	s, ok := e.d.resolve(xobjects[n]).(*stream)
+	if !ok || s.dict["Subtype"] != name("Form") {
+		return
+	}
+	data, err := e.d.decode(s)
+	if err != nil {
+		return
+	}
+	if res := e.d.resolveDict(s.dict["Resources"]); res != nil {
+		resources = res
+	}
+	e.run(data, resources, depth+1)
+}
+
+func (e *textExtractor) show(f *font, v any) {
+	s, ok := v.(string)
+	if !ok {
+		return
+	}
+	if f == nil {
+		f = defaultFont
+	}
+	e.out.WriteString(f.decode(s))
+}
+
+func (e *textExtractor) space() {
+	s := e.out.String()
+	if s == "" {
+		return
+	}
+	if r, _ := utf8.DecodeLastRuneInString(s); !unicode.IsSpace(r) {
+		e.out.WriteByte(' ')
+	}
+}
+
+func (e *textExtractor) newline() {
+	s := e.out.String()
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		e.out.WriteByte('\n')
+	}
+}
+
+func (e *textExtractor) font(resources dict, n name) *font {
+	fonts := e.d.resolveDict(resources["Font"])
+	v := fonts[n]
+	r, isRef := v.(ref)
+	if isRef {
+		if f, ok := e.fonts[r.num]; ok {
+			return f
+		}
+	}
+	f := e.d.loadFont(e.d.resolveDict(v))
+	if isRef {
+		e.fonts[r.num] = f
+	}
+	return f
+}
+
+var ligatureReplacer = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl")
+
+// cleanText trims the lines of text, drops repeated blank lines and spells
+// out ligatures.
+func cleanText(s string) string {
+	lines := strings.Split(ligatureReplacer.Replace(s), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// skipInlineImage skips the data of an inline image, after the BI operator.
+func (p *parser) skipInlineImage() {
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return
+		}
+		v, err := p.value()
+		if err != nil {
+			return
+		}
+		if v == keyword("ID") {
+			break
+		}
+	}
+	// the data ends at "EI" between whitespace
+	for i := p.pos + 1; i+1 < len(p.data); i++ {
+		if p.data[i] == 'E' && p.data[i+1] == 'I' && isSpace(p.data[i-1]) &&
+			(i+2 == len(p.data) || isSpace(p.data[i+2])) {
+			p.pos = i + 2
+			return
+		}
+	}
+	p.pos = len(p.data)
+}
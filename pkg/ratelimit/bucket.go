@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket is a simple thread-safe token bucket.
+//
+// Tokens are refilled continuously at rate per second up to burst.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	now func() time.Time
+}
+
+// NewTokenBucket creates a bucket which starts full.
+// A non-positive rate means unlimited.
+func NewTokenBucket(ratePerSecond float64, burst int) *TokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   ratePerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// PerMinute is a helper to convert a per minute count to a per second rate.
+func PerMinute(n int) float64 {
+	return float64(n) / 60
+}
+
+// Allow reports whether one token can be taken now.
+func (b *TokenBucket) Allow() bool {
+	_, ok := b.Reserve()
+	return ok
+}
+
+// Reserve tries to take one token. When no token is available, it returns
+// the duration to wait until the next token is refilled.
+func (b *TokenBucket) Reserve() (time.Duration, bool) {
+	if b == nil || b.rate <= 0 {
+		return 0, true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return wait, false
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := NewTokenBucket(1, 2)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("expected burst of 2 to be allowed")
+	}
+	wait, ok := b.Reserve()
+	if ok {
+		t.Fatal("expected bucket to be empty")
+	}
+	if wait != time.Second {
+		t.Fatalf("unexpected wait: %v", wait)
+	}
+
+	now = now.Add(time.Second)
+	if !b.Allow() {
+		t.Fatal("expected token to be refilled after 1s")
+	}
+}
+
+func TestTokenBucketUnlimited(t *testing.T) {
+	b := NewTokenBucket(0, 0)
+	for range 100 {
+		if !b.Allow() {
+			t.Fatal("unlimited bucket should always allow")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in redacted text.
+const Redacted = "[REDACTED]"
+
+// values shorter than this are too likely to appear by accident
+const minRedactLen = 6
+
+var (
+	redactMu       sync.RWMutex
+	redactValues   = make(map[string]struct{})
+	redactReplacer *strings.Replacer
+)
+
+// Register marks values as secret so that Redact hides them.
+func Register(values ...string) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+
+	added := false
+	for _, v := range values {
+		if len(v) < minRedactLen {
+			continue
+		}
+		if _, ok := redactValues[v]; !ok {
+			redactValues[v] = struct{}{}
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// longer values first so that a secret containing another one is
+	// replaced as a whole
+	sorted := make([]string, 0, len(redactValues))
+	for v := range redactValues {
+		sorted = append(sorted, v)
+	}
+	slices.SortFunc(sorted, func(a, b string) int { return len(b) - len(a) })
+
+	oldnew := make([]string, 0, len(sorted)*2)
+	for _, v := range sorted {
+		oldnew = append(oldnew, v, Redacted)
+	}
+	redactReplacer = strings.NewReplacer(oldnew...)
+}
+
+// Redact replaces registered secret values in s.
+func Redact(s string) string {
+	redactMu.RLock()
+	r := redactReplacer
+	redactMu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// RedactBytes is like Redact for byte slices. b is returned as is if it
+// contains no secret.
+func RedactBytes(b []byte) []byte {
+	redactMu.RLock()
+	r := redactReplacer
+	redactMu.RUnlock()
+	if r == nil {
+		return b
+	}
+	s := string(b)
+	if out := r.Replace(s); out != s {
+		return []byte(out)
+	}
+	return b
+}
@@ -0,0 +1,21 @@
+package secret
+
+import "strings"
+
+// RefPrefix prefixes references to secrets in config values, e.g.
+// secret://openai_api_key.
+const RefPrefix = "secret://"
+
+// ParseRef returns the secret name of a reference.
+func ParseRef(s string) (string, bool) {
+	name, ok := strings.CutPrefix(s, RefPrefix)
+	if !ok || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// Ref returns the reference to the named secret.
+func Ref(name string) string {
+	return RefPrefix + name
+}
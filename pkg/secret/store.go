@@ -0,0 +1,197 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const (
+	storeVersion = 1
+	kdfName      = "pbkdf2-sha256"
+	kdfIter      = 600_000
+	keyLen       = 32
+	saltLen      = 16
+)
+
+var (
+	ErrNotFound      = errors.New("secret not found")
+	ErrBadPassphrase = errors.New("wrong passphrase or key file")
+	ErrEmptyKey      = errors.New("passphrase or key file is empty")
+)
+
+// storeFile is the on-disk layout of the store. Only data is encrypted.
+type storeFile struct {
+	Version    int    `json:"version"`
+	Kdf        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// Store is a local secret store encrypted with AES-256-GCM. The key is
+// derived from a passphrase or the content of a key file with PBKDF2.
+type Store struct {
+	path string
+
+	mu     sync.RWMutex
+	aead   cipher.AEAD
+	salt   []byte
+	iter   int
+	values map[string]string
+}
+
+// Open opens the store at path with the passphrase. An empty store is
+// returned if the file does not exist; it is created on Save.
+func Open(path string, passphrase []byte) (*Store, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	s := &Store{path: path, iter: kdfIter, values: make(map[string]string)}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read secret store: %w", err)
+		}
+		s.salt = make([]byte, saltLen)
+		if _, err := rand.Read(s.salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		if err := s.initCipher(passphrase); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	var f storeFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret store: %w", err)
+	}
+	if f.Version != storeVersion || f.Kdf != kdfName {
+		return nil, fmt.Errorf("unsupported secret store version %d (%s)", f.Version, f.Kdf)
+	}
+
+	s.salt, s.iter = f.Salt, f.Iterations
+	if err := s.initCipher(passphrase); err != nil {
+		return nil, err
+	}
+	plain, err := s.aead.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	if err := json.Unmarshal(plain, &s.values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secrets: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Store) initCipher(passphrase []byte) error {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), s.salt, s.iter, keyLen)
+	if err != nil {
+		return fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	s.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create gcm: %w", err)
+	}
+	return nil
+}
+
+// Get returns the value of the secret.
+func (s *Store) Get(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return value, nil
+}
+
+// Set sets the value of the secret. Call Save to persist it.
+func (s *Store) Set(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[name] = value
+}
+
+// Delete removes the secret. Returns false if it does not exist.
+func (s *Store) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[name]; !ok {
+		return false
+	}
+	delete(s.values, name)
+	return true
+}
+
+// Names returns sorted names of all secrets.
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Sorted(maps.Keys(s.values))
+}
+
+// Values returns all secret values.
+func (s *Store) Values() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Collect(maps.Values(s.values))
+}
+
+// Save encrypts the secrets with a fresh nonce and writes them to disk.
+func (s *Store) Save() error {
+	s.mu.RLock()
+	plain, err := json.Marshal(s.values)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	content, err := json.MarshalIndent(storeFile{
+		Version:    storeVersion,
+		Kdf:        kdfName,
+		Iterations: s.iter,
+		Salt:       s.salt,
+		Nonce:      nonce,
+		Data:       s.aead.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create secret store directory: %w", err)
+	}
+	// write to a temp file first so that a crash never leaves a broken store
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	store, err := Open(path, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("openai", "sk-roundtrip")
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(path)
+	if strings.Contains(string(content), "sk-roundtrip") {
+		t.Fatal("secret stored in plain text")
+	}
+
+	reopened, err := Open(path, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := reopened.Get("openai"); err != nil || value != "sk-roundtrip" {
+		t.Fatalf("expected sk-roundtrip, got %q, %v", value, err)
+	}
+	if _, err := reopened.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := Open(path, []byte("wrong")); !errors.Is(err, ErrBadPassphrase) {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	Register("sk-redact-short", "sk-redact-short-and-long", "abc")
+	got := Redact("keys sk-redact-short-and-long, sk-redact-short and abc")
+	if got != "keys [REDACTED], [REDACTED] and abc" {
+		t.Fatalf("unexpected redaction: %q", got)
+	}
+}
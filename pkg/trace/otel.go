@@ -0,0 +1,147 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ryanreadbooks/tokkibot"
+
+// Span attribute keys shared across packages
+const (
+	AttrAgent   = attribute.Key("tokkibot.agent")
+	AttrChannel = attribute.Key("tokkibot.channel")
+	AttrChatID  = attribute.Key("tokkibot.chat_id")
+	AttrReqID   = attribute.Key("tokkibot.req_id")
+)
+
+// Span is an alias so that callers do not need to import otel directly.
+type Span = oteltrace.Span
+
+type Exporter string
+
+const (
+	ExporterOtlp Exporter = "otlp"
+	ExporterFile Exporter = "file"
+)
+
+// OtelOptions configures the global tracer provider.
+type OtelOptions struct {
+	ServiceName string
+	Exporter    Exporter
+	Endpoint    string // otlp/http endpoint
+	Insecure    bool
+	Headers     map[string]string
+	FilePath    string // file exporter output
+	SampleRatio float64
+}
+
+// InitOtel installs a global tracer provider. The returned shutdown function
+// flushes pending spans and must be called before exit.
+//
+// Without InitOtel, spans are no-ops.
+func InitOtel(ctx context.Context, opts OtelOptions) (shutdown func(context.Context) error, err error) {
+	var (
+		exporter sdktrace.SpanExporter
+		closers  []func() error
+	)
+
+	switch opts.Exporter {
+	case ExporterFile:
+		if err := os.MkdirAll(filepath.Dir(opts.FilePath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create trace file dir: %w", err)
+		}
+		f, err := os.OpenFile(opts.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		closers = append(closers, f.Close)
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+	case ExporterOtlp, "":
+		clientOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		if len(opts.Headers) > 0 {
+			clientOpts = append(clientOpts, otlptracehttp.WithHeaders(opts.Headers))
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter: %s", opts.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	return func(ctx context.Context) error {
+		errs := []error{provider.Shutdown(ctx)}
+		for _, c := range closers {
+			errs = append(errs, c())
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// StartSpan starts a span as a child of the span in ctx. Request info from
+// TraceInfo in ctx is attached to the span.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, Span) {
+	if info := FromContext(ctx); info != nil {
+		attrs = append(attrs, AttrReqID.String(info.ReqID))
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, oteltrace.WithAttributes(attrs...))
+}
+
+// EndSpan records err on the span if any and ends it.
+func EndSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SpanIDs returns ids of the span in ctx, or empty strings if there is no
+// recording span.
+func SpanIDs(ctx context.Context) (traceID, spanID string) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
@@ -0,0 +1,46 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitOtelFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := InitOtel(context.Background(), OtelOptions{
+		ServiceName: "tokkibot-test",
+		Exporter:    ExporterFile,
+		FilePath:    path,
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithTrace(context.Background(), NewTraceInfo("cli", "chat", ""))
+	ctx, parent := StartSpan(ctx, "parent")
+	if traceID, _ := SpanIDs(ctx); traceID == "" {
+		t.Fatal("expected a valid span in ctx")
+	}
+	_, child := StartSpan(ctx, "child")
+	EndSpan(child, errors.New("boom"))
+	EndSpan(parent, nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Name":"parent"`, `"Name":"child"`, "boom", string(AttrReqID)} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("trace file does not contain %q", want)
+		}
+	}
+}
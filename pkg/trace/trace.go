@@ -12,6 +12,8 @@ const (
 	LogKeyChannel   = "channel"
 	LogKeyChatID    = "chat_id"
 	LogKeyMessageID = "message_id"
+	LogKeyTraceID   = "trace_id"
+	LogKeySpanID    = "span_id"
 )
 
 type traceKey struct{}